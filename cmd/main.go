@@ -1,12 +1,15 @@
 package main
 
 import (
+	"context"
 	"log"
 
 	"github.com/labstack/echo/v4"
 	"github.com/turplespace/portos/internal/database"
 	"github.com/turplespace/portos/internal/routes"
 	"github.com/turplespace/portos/internal/services"
+	"github.com/turplespace/portos/internal/services/auth"
+	"github.com/turplespace/portos/internal/services/deploy"
 	"github.com/turplespace/portos/internal/services/proxy"
 )
 
@@ -16,14 +19,21 @@ func main() {
 	logService := services.GetLogService()
 	routes.SetupRoutes(e)
 	database.Init()
-	err := proxy.RemoveDataInFolder()
-	if err != nil {
-		log.Fatalf("Failed to remove data in folder: %v", err)
+	if err := auth.EnsureAdmin(); err != nil {
+		log.Fatalf("Failed to create admin account: %v", err)
+	}
+	if err := database.DeleteExpiredSessions(); err != nil {
+		log.Printf("Failed to delete expired sessions: %v", err)
 	}
-	err = proxy.CreateFolderIfNotExists()
+	err := proxy.CreateFolderIfNotExists()
 	if err != nil {
 		log.Fatalf("Failed to create folder: %v", err)
 	}
+	// The proxies point to the containers as they run now, and follow them as they are restarted
+	if err := deploy.SyncProxies(); err != nil {
+		log.Printf("Failed to sync proxies: %v", err)
+	}
+	go deploy.WatchProxies(context.Background())
 
 	log.Print("Server starting on :8080")
 	if err := e.Start(":8080"); err != nil {
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+/*
+config is the configuration file of turplectl, by default turplectl/config.json in the user
+configuration directory or the path in TURPLECTL_CONFIG. It holds a context per server, with
+the token used to authenticate, so it is only readable by its owner.
+*/
+type config struct {
+	CurrentContext string                   `json:"current_context"`
+	Contexts       map[string]contextConfig `json:"contexts"`
+
+	path string
+}
+
+type contextConfig struct {
+	Server string `json:"server"`
+	Token  string `json:"token,omitempty"`
+}
+
+func configPath() (string, error) {
+	if path := os.Getenv("TURPLECTL_CONFIG"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find the configuration directory, set TURPLECTL_CONFIG: %v", err)
+	}
+	return filepath.Join(dir, "turplectl", "config.json"), nil
+}
+
+// loadConfig reads the configuration file, a missing file is an empty configuration
+func loadConfig() (*config, error) {
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &config{Contexts: make(map[string]contextConfig), path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	if cfg.Contexts == nil {
+		cfg.Contexts = make(map[string]contextConfig)
+	}
+	return cfg, nil
+}
+
+func (c *config) save() error {
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return fmt.Errorf("failed to create %s: %v", filepath.Dir(c.path), err)
+	}
+	if err := os.WriteFile(c.path, append(data, '\n'), 0600); err != nil {
+		return fmt.Errorf("failed to write %s: %v", c.path, err)
+	}
+	return nil
+}
+
+// credentials returns the server and token of a context, the current one when name is empty,
+// overridden by TURPLECTL_SERVER and TURPLECTL_TOKEN
+func (c *config) credentials(name string) (string, string, error) {
+	if name == "" {
+		name = c.CurrentContext
+	}
+
+	var selected contextConfig
+	if name != "" {
+		var ok bool
+		if selected, ok = c.Contexts[name]; !ok {
+			return "", "", fmt.Errorf("context %q does not exist, see turplectl config get-contexts", name)
+		}
+	}
+	if server := os.Getenv("TURPLECTL_SERVER"); server != "" {
+		selected.Server = server
+	}
+	if token := os.Getenv("TURPLECTL_TOKEN"); token != "" {
+		selected.Token = token
+	}
+
+	if selected.Server == "" {
+		return "", "", errors.New("no server configured, run turplectl config set-context or set TURPLECTL_SERVER")
+	}
+	return selected.Server, selected.Token, nil
+}
+
+func setContext(a *app, args []string) error {
+	fs := newFlagSet(a, "config set-context NAME")
+	server := fs.String("server", "", "Base URL of the server, such as http://localhost:8080")
+	token := fs.String("token", "", "API token")
+	use := fs.Bool("use", false, "Make it the current context")
+	name, err := parseName(fs, args)
+	if err != nil {
+		return err
+	}
+
+	context := a.config.Contexts[name]
+	if *server != "" {
+		context.Server = *server
+	}
+	if *token != "" {
+		context.Token = *token
+	}
+	if context.Server == "" {
+		return errors.New("missing --server")
+	}
+	a.config.Contexts[name] = context
+	if *use || a.config.CurrentContext == "" {
+		a.config.CurrentContext = name
+	}
+	if err := a.config.save(); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stderr, "Context %s saved\n", name)
+	return nil
+}
+
+func useContext(a *app, args []string) error {
+	name, err := parseName(newFlagSet(a, "config use-context NAME"), args)
+	if err != nil {
+		return err
+	}
+	if _, ok := a.config.Contexts[name]; !ok {
+		return fmt.Errorf("context %q does not exist", name)
+	}
+	a.config.CurrentContext = name
+	if err := a.config.save(); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stderr, "Switched to context %s\n", name)
+	return nil
+}
+
+func deleteContext(a *app, args []string) error {
+	name, err := parseName(newFlagSet(a, "config delete-context NAME"), args)
+	if err != nil {
+		return err
+	}
+	if _, ok := a.config.Contexts[name]; !ok {
+		return fmt.Errorf("context %q does not exist", name)
+	}
+	delete(a.config.Contexts, name)
+	if a.config.CurrentContext == name {
+		a.config.CurrentContext = ""
+	}
+	if err := a.config.save(); err != nil {
+		return err
+	}
+	fmt.Fprintf(a.stderr, "Context %s deleted\n", name)
+	return nil
+}
+
+func getContexts(a *app, args []string) error {
+	if _, _, err := parseArgs(newFlagSet(a, "config get-contexts"), args); err != nil {
+		return err
+	}
+
+	// Tokens are secrets, only say whether one is set
+	type contextRow struct {
+		Name    string `json:"name"`
+		Server  string `json:"server"`
+		Token   bool   `json:"token"`
+		Current bool   `json:"current"`
+	}
+	var list []contextRow
+	var rows [][]string
+	for _, name := range sorted(keys(a.config.Contexts)) {
+		context := a.config.Contexts[name]
+		row := contextRow{Name: name, Server: context.Server, Token: context.Token != "", Current: name == a.config.CurrentContext}
+		list = append(list, row)
+		rows = append(rows, []string{mark(row.Current, "*"), name, context.Server, mark(row.Token, "set")})
+	}
+	return a.print(list, []string{"CURRENT", "NAME", "SERVER", "TOKEN"}, rows)
+}
+
+// parseName parses a subcommand taking a single name
+func parseName(fs *flag.FlagSet, args []string) (string, error) {
+	positional, _, err := parseArgs(fs, args)
+	if err != nil {
+		return "", err
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return "", flag.ErrHelp
+	}
+	return positional[0], nil
+}
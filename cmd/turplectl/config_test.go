@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// withConfig points turplectl at a configuration file of the test and clears the overrides
+func withConfig(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "turplectl", "config.json")
+	t.Setenv("TURPLECTL_CONFIG", path)
+	t.Setenv("TURPLECTL_SERVER", "")
+	t.Setenv("TURPLECTL_TOKEN", "")
+	return path
+}
+
+// turplectl runs a command and returns what it printed on stdout
+func turplectl(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	err := run(context.Background(), args, &stdout, &stderr)
+	return stdout.String(), err
+}
+
+func TestContexts(t *testing.T) {
+	path := withConfig(t)
+	if cfg, err := loadConfig(); err != nil || cfg.CurrentContext != "" || len(cfg.Contexts) != 0 {
+		t.Fatalf("missing configuration = %+v, %v, want an empty one", cfg, err)
+	}
+
+	for _, args := range [][]string{
+		{"config", "set-context", "local", "--server", "http://localhost:8080", "--token", "tct_local"},
+		{"config", "set-context", "prod", "--server", "https://cubes.example.com"},
+		{"config", "set-context", "prod", "--token", "tct_prod"},
+	} {
+		if _, err := turplectl(t, args...); err != nil {
+			t.Fatalf("%v: %v", args, err)
+		}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("configuration mode = %v, want 0600 as it holds tokens", info.Mode().Perm())
+	}
+
+	// The first context becomes the current one, a context keeps the fields not given again
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]contextConfig{
+		"local": {Server: "http://localhost:8080", Token: "tct_local"},
+		"prod":  {Server: "https://cubes.example.com", Token: "tct_prod"},
+	}
+	if cfg.CurrentContext != "local" || len(cfg.Contexts) != 2 || cfg.Contexts["local"] != want["local"] || cfg.Contexts["prod"] != want["prod"] {
+		t.Errorf("configuration = %+v, want %v with local current", cfg, want)
+	}
+	if server, token, err := cfg.credentials(""); err != nil || server != "http://localhost:8080" || token != "tct_local" {
+		t.Errorf("current credentials = %q, %q, %v, want those of local", server, token, err)
+	}
+	if server, token, err := cfg.credentials("prod"); err != nil || server != "https://cubes.example.com" || token != "tct_prod" {
+		t.Errorf("credentials of prod = %q, %q, %v", server, token, err)
+	}
+	if _, _, err := cfg.credentials("staging"); err == nil {
+		t.Error("credentials of a missing context succeeded")
+	}
+	t.Setenv("TURPLECTL_TOKEN", "tct_override")
+	if _, token, _ := cfg.credentials(""); token != "tct_override" {
+		t.Errorf("token with TURPLECTL_TOKEN = %q, want the override", token)
+	}
+	t.Setenv("TURPLECTL_TOKEN", "")
+
+	// Tokens are never printed
+	output, err := turplectl(t, "config", "get-contexts", "-o", "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rows []struct {
+		Name    string `json:"name"`
+		Token   bool   `json:"token"`
+		Current bool   `json:"current"`
+	}
+	if err := json.Unmarshal([]byte(output), &rows); err != nil || len(rows) != 2 || rows[0].Name != "local" || !rows[0].Current || !rows[1].Token {
+		t.Errorf("get-contexts = %s, %v, want local current and prod with a token", output, err)
+	}
+	if strings.Contains(output, "tct_") {
+		t.Errorf("get-contexts printed a token: %s", output)
+	}
+
+	if _, err := turplectl(t, "config", "use-context", "prod"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := turplectl(t, "config", "delete-context", "prod"); err != nil {
+		t.Fatal(err)
+	}
+	if cfg, err = loadConfig(); err != nil || cfg.CurrentContext != "" || len(cfg.Contexts) != 1 {
+		t.Errorf("configuration after deleting the current context = %+v, %v, want local only and no current one", cfg, err)
+	}
+	if _, err := turplectl(t, "config", "use-context", "prod"); err == nil {
+		t.Error("use-context of a deleted context succeeded")
+	}
+}
+
+func TestLoadConfigRejectsInvalidFiles(t *testing.T) {
+	path := withConfig(t)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := loadConfig(); err == nil || !strings.Contains(err.Error(), path) {
+		t.Errorf("loadConfig = %v, want an error naming %s", err, path)
+	}
+}
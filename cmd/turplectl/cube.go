@@ -0,0 +1,372 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/turplespace/portos/pkg/client"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+// allCubes lists every cube of a workspace matching the options, following the page cursors
+func allCubes(a *app, workspaceID int, options *client.ListCubesOptions) ([]models.GetCubesResponse, error) {
+	if options == nil {
+		options = &client.ListCubesOptions{}
+	}
+
+	cubes := []models.GetCubesResponse{}
+	for {
+		page, err := a.client.ListCubes(a.ctx, workspaceID, options)
+		if err != nil {
+			return nil, err
+		}
+		cubes = append(cubes, page.Cubes...)
+		if page.NextCursor == "" || options.Limit > 0 {
+			return cubes, nil
+		}
+		options.Cursor = page.NextCursor
+	}
+}
+
+func listCubes(a *app, args []string) error {
+	fs := newFlagSet(a, "cube list WORKSPACE_ID [flags]")
+	options := &client.ListCubesOptions{}
+	fs.StringVar(&options.Search, "q", "", "Search in the name and image")
+	fs.StringVar(&options.Image, "image", "", "Image, without a tag it matches every tag")
+	fs.StringVar(&options.Label, "label", "", "key=value, or a key matching any value")
+	fs.StringVar(&options.Status, "status", "", "Container state such as running or exited")
+	fs.StringVar(&options.Sort, "sort", "", "name, created_at, -name or -created_at")
+	fs.IntVar(&options.Limit, "limit", 0, "Print a single page of this size, every cube by default")
+	fs.StringVar(&options.Cursor, "cursor", "", "Cursor of the page to print, with --limit")
+	workspaceID, err := parseID(fs, args)
+	if err != nil {
+		return err
+	}
+
+	cubes, err := allCubes(a, workspaceID, options)
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, len(cubes))
+	for i, cube := range cubes {
+		rows[i] = []string{strconv.Itoa(cube.ContainerID), cube.ContainerName, cube.Image, cube.Status, replicas(cube.ReadyReplicas, cube.Replicas), orDash(cube.IPAddress)}
+	}
+	return a.print(cubes, []string{"ID", "NAME", "IMAGE", "STATUS", "READY", "IP"}, rows)
+}
+
+func getCube(a *app, args []string) error {
+	id, err := parseID(newFlagSet(a, "cube get ID"), args)
+	if err != nil {
+		return err
+	}
+
+	cube, err := a.client.GetCube(a.ctx, id)
+	if err != nil {
+		return err
+	}
+
+	data := cube.ContainerData
+	if data == nil {
+		data = &models.Container{ID: id}
+	}
+	volumes := make([]string, 0, len(data.Volumes))
+	for _, host := range sorted(keys(data.Volumes)) {
+		volumes = append(volumes, host+":"+data.Volumes[host])
+	}
+	pending := make([]string, len(cube.PendingChanges))
+	for i, change := range cube.PendingChanges {
+		pending[i] = change.Field
+	}
+	rows := [][]string{
+		{"ID:", strconv.Itoa(data.ID)},
+		{"Name:", data.Name},
+		{"Image:", data.Image},
+		{"Status:", cube.Status},
+		{"Ready:", replicas(cube.ReadyReplicas, cube.Replicas)},
+		{"Load balancing:", orDash(data.LoadBalancing)},
+		{"IP:", orDash(cube.IPAddress)},
+		{"Ports:", orDash(strings.Join(data.Ports, ", "))},
+		{"Environment:", orDash(strings.Join(data.EnvironmentVars, ", "))},
+		{"Volumes:", orDash(strings.Join(volumes, ", "))},
+		{"Labels:", orDash(strings.Join(data.Labels, ", "))},
+		{"CPUs:", orDash(data.ResourceLimits.CPUs)},
+		{"Memory:", orDash(data.ResourceLimits.Memory)},
+		{"Pending changes:", orDash(strings.Join(pending, ", "))},
+	}
+	return a.print(cube, nil, rows)
+}
+
+/*
+addCube adds cubes to a workspace, either one described by flags or every cube of a JSON
+file. The file holds a cube or a list of cubes in the format of the API.
+*/
+func addCube(a *app, args []string) error {
+	fs := newFlagSet(a, "cube add WORKSPACE_ID (--name NAME --image IMAGE [flags] | -f FILE)")
+	file := fs.String("f", "", "JSON file with a cube or a list of cubes, - for stdin")
+	var cube models.Container
+	var ports, env, volumes, labels stringList
+	fs.StringVar(&cube.Name, "name", "", "Cube name")
+	fs.StringVar(&cube.Image, "image", "", "Image, such as nginx:latest")
+	fs.Var(&ports, "port", "Port mapping host:container, repeatable")
+	fs.Var(&env, "env", "Environment variable KEY=value, repeatable")
+	fs.Var(&volumes, "volume", "Volume host_path:container_path, repeatable")
+	fs.Var(&labels, "label", "Label key=value, repeatable")
+	fs.StringVar(&cube.ResourceLimits.CPUs, "cpus", "", "CPU limit, such as 0.5")
+	fs.StringVar(&cube.ResourceLimits.Memory, "memory", "", "Memory limit, such as 512m")
+	fs.IntVar(&cube.Replicas, "replicas", 0, "Number of containers running the cube, 1 by default")
+	fs.StringVar(&cube.LoadBalancing, "load-balancing", "", "round_robin, least_conn, ip_hash or random")
+	workspaceID, err := parseID(fs, args)
+	if err != nil {
+		return err
+	}
+
+	var cubes []models.Container
+	if *file != "" {
+		if cube.Name != "" || cube.Image != "" {
+			return errors.New("--name and --image cannot be used with -f")
+		}
+		if cubes, err = readCubes(*file); err != nil {
+			return err
+		}
+	} else {
+		if cube.Name == "" || cube.Image == "" {
+			fs.Usage()
+			return flag.ErrHelp
+		}
+		cube.Ports, cube.EnvironmentVars, cube.Labels = ports, env, labels
+		cube.Volumes = make(map[string]string, len(volumes))
+		for _, volume := range volumes {
+			host, target, found := strings.Cut(volume, ":")
+			if !found {
+				return fmt.Errorf("invalid volume %q, expected host_path:container_path", volume)
+			}
+			cube.Volumes[host] = target
+		}
+		cubes = []models.Container{cube}
+	}
+
+	type addedCube struct {
+		ID   int    `json:"id"`
+		Name string `json:"name"`
+	}
+	added := make([]addedCube, 0, len(cubes))
+	for _, cube := range cubes {
+		id, err := a.client.AddCube(a.ctx, workspaceID, cube)
+		if err != nil {
+			return fmt.Errorf("failed to add cube %s: %w", cube.Name, err)
+		}
+		added = append(added, addedCube{ID: id, Name: cube.Name})
+		if a.output == "table" {
+			fmt.Fprintf(a.stdout, "Cube %s added with ID %d\n", cube.Name, id)
+		}
+	}
+	if a.output == "json" {
+		return a.print(added, nil, nil)
+	}
+	return nil
+}
+
+// readCubes reads a cube or a list of cubes from a JSON file, - reads stdin
+func readCubes(path string) ([]models.Container, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
+	var cubes []models.Container
+	if trimmed := strings.TrimSpace(string(data)); strings.HasPrefix(trimmed, "[") {
+		err = json.Unmarshal(data, &cubes)
+	} else {
+		var cube models.Container
+		err = json.Unmarshal(data, &cube)
+		cubes = append(cubes, cube)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %v", path, err)
+	}
+	if len(cubes) == 0 {
+		return nil, fmt.Errorf("%s has no cubes", path)
+	}
+	return cubes, nil
+}
+
+func deleteCube(a *app, args []string) error {
+	id, err := parseID(newFlagSet(a, "cube delete ID"), args)
+	if err != nil {
+		return err
+	}
+	if err := a.client.DeleteCube(a.ctx, id); err != nil {
+		return err
+	}
+	return a.done(map[string]int{"id": id}, "Cube %d deleted", id)
+}
+
+func deployCube(a *app, args []string) error {
+	return cubeOperation(a, newFlagSet(a, "cube deploy ID"), args, "deployed", a.client.DeployCube)
+}
+
+func redeployCube(a *app, args []string) error {
+	fs := newFlagSet(a, "cube redeploy ID [--blue-green]")
+	blueGreen := fs.Bool("blue-green", false, "Replace the container without dropping the traffic of its proxies")
+	return cubeOperation(a, fs, args, "redeployed", func(ctx context.Context, cubeID int) error {
+		if *blueGreen {
+			return a.client.RedeployCubeBlueGreen(ctx, cubeID)
+		}
+		return a.client.RedeployCube(ctx, cubeID)
+	})
+}
+
+func scaleCube(a *app, args []string) error {
+	fs := newFlagSet(a, "cube scale ID --replicas N [--load-balancing METHOD]")
+	var req models.ScaleCubeRequest
+	fs.IntVar(&req.Replicas, "replicas", 0, "Number of containers running the cube")
+	fs.StringVar(&req.LoadBalancing, "load-balancing", "", "round_robin, least_conn, ip_hash or random, kept when empty")
+	id, err := parseID(fs, args)
+	if err != nil {
+		return err
+	}
+
+	result, err := a.client.ScaleCube(a.ctx, id, req)
+	if err != nil {
+		return err
+	}
+	return a.done(result, "Cube %d scaled to %d replicas, %s ready, revision %d", id, result.Replicas, replicas(result.ReadyReplicas, result.Replicas), result.Revision)
+}
+
+// replicas formats the running replicas of a cube out of those it should run, such as 2/3
+func replicas(ready int, desired int) string {
+	return fmt.Sprintf("%d/%d", ready, desired)
+}
+
+func stopCube(a *app, args []string) error {
+	return cubeOperation(a, newFlagSet(a, "cube stop ID"), args, "stopped", a.client.StopCube)
+}
+
+// cubeOperation runs a deploy, redeploy or stop of a cube and prints the state of its container
+func cubeOperation(a *app, fs *flag.FlagSet, args []string, past string, call func(ctx context.Context, cubeID int) error) error {
+	id, err := parseID(fs, args)
+	if err != nil {
+		return err
+	}
+	if a.output == "table" {
+		fmt.Fprintf(a.stderr, "Waiting for cube %d to be %s...\n", id, past)
+	}
+	if err := call(a.ctx, id); err != nil {
+		return err
+	}
+
+	cube, err := a.client.GetCube(a.ctx, id)
+	if err != nil {
+		return err
+	}
+	return a.done(cube, "Cube %d %s, container %s", id, past, cube.Status)
+}
+
+func commitCube(a *app, args []string) error {
+	fs := newFlagSet(a, "cube commit ID --image IMAGE --tag TAG")
+	var req models.CommitCubeRequest
+	fs.StringVar(&req.Image, "image", "", "Name of the new image")
+	fs.StringVar(&req.Tag, "tag", "latest", "Tag of the new image")
+	id, err := parseID(fs, args)
+	if err != nil {
+		return err
+	}
+	if req.Image == "" {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	if err := a.client.CommitCube(a.ctx, id, req); err != nil {
+		return err
+	}
+	return a.done(req, "Cube %d committed to %s:%s", id, req.Image, req.Tag)
+}
+
+func cubeRevisions(a *app, args []string) error {
+	id, err := parseID(newFlagSet(a, "cube revisions ID"), args)
+	if err != nil {
+		return err
+	}
+
+	revisions, err := a.client.ListCubeRevisions(a.ctx, id)
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, len(revisions))
+	for i, revision := range revisions {
+		created := "-"
+		if revision.CreatedAt != nil {
+			created = revision.CreatedAt.Local().Format(time.DateTime)
+		}
+		rows[i] = []string{strconv.Itoa(revision.Revision), created, revision.Author, revision.Spec.Image, orDash(revision.Note)}
+	}
+	return a.print(revisions, []string{"REVISION", "CREATED", "AUTHOR", "IMAGE", "NOTE"}, rows)
+}
+
+func diffCubeRevisions(a *app, args []string) error {
+	ids, err := parseIDs(newFlagSet(a, "cube diff ID FROM TO"), args, 3)
+	if err != nil {
+		return err
+	}
+
+	diff, err := a.client.DiffCubeRevisions(a.ctx, ids[0], ids[1], ids[2])
+	if err != nil {
+		return err
+	}
+	if a.output == "table" && len(diff.Changes) == 0 {
+		fmt.Fprintf(a.stdout, "Revisions %d and %d of cube %d are identical\n", diff.From, diff.To, diff.CubeID)
+		return nil
+	}
+
+	rows := make([][]string, len(diff.Changes))
+	for i, change := range diff.Changes {
+		rows[i] = []string{change.Field, diffValue(change.Before), diffValue(change.After)}
+	}
+	return a.print(diff, []string{"FIELD", fmt.Sprintf("REVISION %d", diff.From), fmt.Sprintf("REVISION %d", diff.To)}, rows)
+}
+
+// diffValue prints a changed field as JSON, which keeps lists and empty values readable
+func diffValue(value interface{}) string {
+	if value == nil {
+		return "-"
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(data)
+}
+
+func rollbackCube(a *app, args []string) error {
+	fs := newFlagSet(a, "cube rollback ID REVISION [--redeploy]")
+	redeploy := fs.Bool("redeploy", false, "Recreate the container with the restored spec")
+	ids, err := parseIDs(fs, args, 2)
+	if err != nil {
+		return err
+	}
+
+	result, err := a.client.RollbackCube(a.ctx, ids[0], ids[1], *redeploy)
+	if err != nil {
+		return err
+	}
+	for _, warning := range result.Warnings {
+		fmt.Fprintf(a.stderr, "Warning: %s\n", warning)
+	}
+	return a.done(result, "Cube %d rolled back to revision %d as revision %d%s", ids[0], result.RestoredTo, result.Revision, mark(result.Redeployed, ", container recreated"))
+}
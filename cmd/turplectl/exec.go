@@ -0,0 +1,114 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/turplespace/portos/pkg/client"
+	"golang.org/x/term"
+)
+
+// logsInterval is how often the logs are polled with --follow
+const logsInterval = 2 * time.Second
+
+/*
+cubeLogs prints the container logs of a cube. The API returns the last lines only, so
+--follow polls them and prints the lines newer than the last printed one, the Docker
+timestamp prefixing every line keeps them in order.
+*/
+func cubeLogs(a *app, args []string) error {
+	fs := newFlagSet(a, "cube logs ID [flags]")
+	tail := fs.String("tail", "200", "Number of lines to print, or all")
+	follow := fs.Bool("f", false, "Keep printing new lines")
+	timestamps := fs.Bool("timestamps", false, "Keep the timestamp of every line")
+	id, err := parseID(fs, args)
+	if err != nil {
+		return err
+	}
+
+	last := ""
+	print := func(logs string) {
+		scanner := bufio.NewScanner(strings.NewReader(logs))
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := scanner.Text()
+			timestamp, text, _ := strings.Cut(line, " ")
+			if timestamp <= last {
+				continue
+			}
+			last = timestamp
+			if *timestamps {
+				text = line
+			}
+			fmt.Fprintln(a.stdout, text)
+		}
+	}
+
+	logs, err := a.client.CubeLogs(a.ctx, id, *tail)
+	if err != nil {
+		return err
+	}
+	print(logs)
+
+	for *follow {
+		select {
+		case <-a.ctx.Done():
+			return nil
+		case <-time.After(logsInterval):
+		}
+		if logs, err = a.client.CubeLogs(a.ctx, id, "200"); err != nil {
+			if a.ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		print(logs)
+	}
+	return nil
+}
+
+// execCube runs a command in a cube, turplectl exits with the exit code of the command
+func execCube(a *app, args []string) error {
+	fs := newFlagSet(a, "cube exec [-i] [-t] ID [-- COMMAND [ARGS...]]")
+	interactive := fs.Bool("i", false, "Send stdin to the command")
+	tty := fs.Bool("t", false, "Allocate a terminal, the local terminal is put in raw mode")
+	positional, command, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+	id, err := strconv.Atoi(positional[0])
+	if err != nil || id <= 0 {
+		return fmt.Errorf("invalid ID %q", positional[0])
+	}
+
+	options := client.ExecOptions{Command: command, TTY: *tty, Stdout: a.stdout, Stderr: a.stderr}
+	if *interactive {
+		options.Stdin = os.Stdin
+	}
+	if fd := int(os.Stdin.Fd()); *tty && term.IsTerminal(fd) {
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return fmt.Errorf("failed to put the terminal in raw mode: %v", err)
+		}
+		defer term.Restore(fd, state)
+		options.Resize = watchResize(a.ctx, fd)
+	}
+
+	code, err := a.client.Exec(a.ctx, id, options)
+	if err != nil {
+		return err
+	}
+	if code != 0 {
+		return exitError(code)
+	}
+	return nil
+}
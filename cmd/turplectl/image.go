@@ -0,0 +1,18 @@
+package main
+
+func listImages(a *app, args []string) error {
+	if _, _, err := parseArgs(newFlagSet(a, "image list"), args); err != nil {
+		return err
+	}
+
+	images, err := a.client.ListImages(a.ctx)
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, len(images.CustomImages))
+	for i, image := range images.CustomImages {
+		rows[i] = []string{image.Image, orDash(image.Tag), orDash(image.Size), orDash(image.PulledOn), orDash(image.Desc)}
+	}
+	return a.print(images, []string{"IMAGE", "TAG", "SIZE", "PULLED", "DESCRIPTION"}, rows)
+}
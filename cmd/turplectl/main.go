@@ -0,0 +1,190 @@
+/*
+Turplectl manages Turple Cubes from a terminal through the API.
+
+	turplectl config set-context local --server http://localhost:8080 --token tct_...
+	turplectl workspace list
+	turplectl cube add 1 --name web --image nginx:latest --port 8081:80
+	turplectl workspace deploy 1
+	turplectl cube exec -i -t 3 -- sh
+
+Every command accepts -o json to print the API response instead of a table.
+*/
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+
+	"github.com/turplespace/portos/pkg/client"
+)
+
+const usage = `Usage: turplectl [--context NAME] [-o table|json] COMMAND
+
+Commands:
+  config     set-context, use-context, get-contexts, delete-context
+  workspace  list, create, delete, deploy, redeploy, stop, apply, import, spec, export,
+             clone, promote
+  cube       list, get, add, delete, deploy, redeploy, stop, scale, logs, exec,
+             commit, revisions, diff, rollback
+  proxy      list, get, add, edit, delete, deploy
+  image      list
+
+Run turplectl COMMAND SUBCOMMAND -h for the flags of a subcommand.
+The server and token of the current context are overridden by TURPLECTL_SERVER and TURPLECTL_TOKEN.
+`
+
+// app holds what every command needs
+type app struct {
+	ctx     context.Context
+	config  *config
+	context string // Name of the context given with --context, empty for the current one
+	output  string // table or json
+	stdout  io.Writer
+	stderr  io.Writer
+	client  *client.Client
+}
+
+// command runs a subcommand with its arguments
+type command func(a *app, args []string) error
+
+var commands = map[string]map[string]command{
+	"config": {
+		"set-context":    setContext,
+		"use-context":    useContext,
+		"get-contexts":   getContexts,
+		"delete-context": deleteContext,
+	},
+	"workspace": {
+		"list":     listWorkspaces,
+		"create":   createWorkspace,
+		"delete":   deleteWorkspace,
+		"deploy":   deployWorkspace,
+		"redeploy": redeployWorkspace,
+		"stop":     stopWorkspace,
+		"apply":    applyWorkspace,
+		"import":   importCompose,
+		"spec":     workspaceSpec,
+		"export":   exportWorkspace,
+		"clone":    cloneWorkspace,
+		"promote":  promoteWorkspace,
+	},
+	"cube": {
+		"list":      listCubes,
+		"get":       getCube,
+		"add":       addCube,
+		"delete":    deleteCube,
+		"deploy":    deployCube,
+		"redeploy":  redeployCube,
+		"stop":      stopCube,
+		"scale":     scaleCube,
+		"logs":      cubeLogs,
+		"exec":      execCube,
+		"commit":    commitCube,
+		"revisions": cubeRevisions,
+		"diff":      diffCubeRevisions,
+		"rollback":  rollbackCube,
+	},
+	"proxy": {
+		"list":   listProxies,
+		"get":    getProxy,
+		"add":    addProxy,
+		"edit":   editProxy,
+		"delete": deleteProxy,
+		"deploy": deployProxy,
+	},
+	"image": {
+		"list": listImages,
+	},
+}
+
+// exitError ends turplectl with a status without printing anything, such as the exit code of an exec
+type exitError int
+
+func (e exitError) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	err := run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+	var exit exitError
+	switch {
+	case errors.As(err, &exit):
+		os.Exit(int(exit))
+	case errors.Is(err, flag.ErrHelp):
+		os.Exit(2)
+	case err != nil:
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		var apiErr *client.Error
+		if errors.As(err, &apiErr) {
+			for _, field := range apiErr.Fields {
+				fmt.Fprintf(os.Stderr, "  %s: %s\n", field.Field, field.Message)
+			}
+		}
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, stdout io.Writer, stderr io.Writer) error {
+	a := &app{ctx: ctx, stdout: stdout, stderr: stderr}
+
+	global := flag.NewFlagSet("turplectl", flag.ContinueOnError)
+	global.SetOutput(stderr)
+	global.Usage = func() { fmt.Fprint(stderr, usage) }
+	global.StringVar(&a.context, "context", "", "Context to use instead of the current one")
+	global.StringVar(&a.output, "o", "table", "Output format, table or json")
+	if err := global.Parse(args); err != nil {
+		return err
+	}
+	if a.output != "table" && a.output != "json" {
+		return fmt.Errorf("invalid output %q, expected table or json", a.output)
+	}
+
+	args = global.Args()
+	if len(args) < 2 {
+		global.Usage()
+		return flag.ErrHelp
+	}
+	group, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q, run turplectl -h for the list", args[0])
+	}
+	cmd, ok := group[args[1]]
+	if !ok {
+		names := make([]string, 0, len(group))
+		for name := range group {
+			names = append(names, name)
+		}
+		return fmt.Errorf("unknown %s subcommand %q, expected one of %s", args[0], args[1], strings.Join(sorted(names), ", "))
+	}
+
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	a.config = cfg
+	if args[0] != "config" {
+		if err := a.connect(); err != nil {
+			return err
+		}
+	}
+	return cmd(a, args[2:])
+}
+
+// connect creates the API client of the selected context
+func (a *app) connect() error {
+	server, token, err := a.config.credentials(a.context)
+	if err != nil {
+		return err
+	}
+	a.client, err = client.New(server, client.WithToken(token))
+	return err
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/turplespace/portos/pkg/models"
+)
+
+func TestWorkspaceList(t *testing.T) {
+	var mu sync.Mutex
+	var requests []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests = append(requests, r)
+		mu.Unlock()
+		if r.Header.Get("Authorization") != "Bearer tct_test" {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(models.ErrorResponse{Code: "unauthorized", Error: "Authentication required"})
+			return
+		}
+		// Two pages, turplectl follows the cursor without --limit
+		page := models.WorkspaceResponse{TotalWorkspaces: 2, Workspaces: []models.WorkspaceWithContainerCounts{{ID: 1, Name: "shop", TotalContainers: 3, RunningContainers: 2}}}
+		if r.URL.Query().Get("cursor") == "" {
+			w.Header().Set("X-Next-Cursor", "page-2")
+		} else {
+			page.Workspaces = []models.WorkspaceWithContainerCounts{{ID: 2, Name: "blog", Desc: "Personal blog"}}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(page)
+	}))
+	defer server.Close()
+	withConfig(t)
+	if _, err := turplectl(t, "config", "set-context", "test", "--server", server.URL, "--token", "tct_test"); err != nil {
+		t.Fatal(err)
+	}
+
+	output, err := turplectl(t, "workspace", "list", "--sort", "-name")
+	if err != nil {
+		t.Fatalf("workspace list: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "ID") || !strings.Contains(lines[1], "shop") || !strings.Contains(lines[1], "2/3") || !strings.Contains(lines[2], "Personal blog") {
+		t.Errorf("workspace list =\n%s\nwant a header and both workspaces", output)
+	}
+	mu.Lock()
+	if len(requests) != 2 || requests[0].URL.Path != "/api/workspace" || requests[0].URL.Query().Get("sort") != "-name" || requests[1].URL.Query().Get("cursor") != "page-2" {
+		t.Errorf("requests = %v, want the two pages sorted by -name", requests)
+	}
+	mu.Unlock()
+
+	output, err = turplectl(t, "-o", "json", "workspace", "list")
+	var result struct {
+		Workspaces []models.WorkspaceWithContainerCounts `json:"workspaces"`
+	}
+	if err != nil || json.Unmarshal([]byte(output), &result) != nil || len(result.Workspaces) != 2 {
+		t.Errorf("workspace list -o json = %s, %v, want both workspaces", output, err)
+	}
+
+	// The overrides of the environment replace the token of the context
+	t.Setenv("TURPLECTL_TOKEN", "tct_revoked")
+	if _, err := turplectl(t, "workspace", "list"); err == nil || !strings.Contains(err.Error(), "Authentication required") {
+		t.Errorf("workspace list with a revoked token = %v, want the error of the API", err)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// newFlagSet returns the flags of a subcommand, -o can be given after the subcommand too
+func newFlagSet(a *app, usage string) *flag.FlagSet {
+	fs := flag.NewFlagSet(usage, flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(a.stderr, "Usage: turplectl %s\n", usage)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&a.output, "o", a.output, "Output format, table or json")
+	return fs
+}
+
+/*
+parseArgs parses flags given before, between or after the positional arguments, unlike
+flag.Parse which stops at the first one. Arguments after -- are returned apart, unparsed.
+*/
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, []string, error) {
+	var rest []string
+	if i := slices.Index(args, "--"); i >= 0 {
+		args, rest = args[:i], args[i+1:]
+	}
+
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, nil, err
+		}
+		if fs.NArg() == 0 {
+			break
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+
+	output := fs.Lookup("o").Value.String()
+	if output != "table" && output != "json" {
+		return nil, nil, fmt.Errorf("invalid output %q, expected table or json", output)
+	}
+	return positional, rest, nil
+}
+
+// parseIDs parses a subcommand taking the given number of IDs as positional arguments
+func parseIDs(fs *flag.FlagSet, args []string, count int) ([]int, error) {
+	positional, _, err := parseArgs(fs, args)
+	if err != nil {
+		return nil, err
+	}
+	if len(positional) != count {
+		fs.Usage()
+		return nil, flag.ErrHelp
+	}
+
+	ids := make([]int, count)
+	for i, arg := range positional {
+		id, err := strconv.Atoi(arg)
+		if err != nil || id <= 0 {
+			return nil, fmt.Errorf("invalid ID %q", arg)
+		}
+		ids[i] = id
+	}
+	return ids, nil
+}
+
+// parseID parses a subcommand taking a single ID
+func parseID(fs *flag.FlagSet, args []string) (int, error) {
+	ids, err := parseIDs(fs, args, 1)
+	if err != nil {
+		return 0, err
+	}
+	return ids[0], nil
+}
+
+// print writes value as JSON, or the rows as a table under the headers, if any
+func (a *app) print(value interface{}, headers []string, rows [][]string) error {
+	if a.output == "json" {
+		encoder := json.NewEncoder(a.stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	}
+
+	w := tabwriter.NewWriter(a.stdout, 0, 0, 3, ' ', 0)
+	if headers != nil {
+		fmt.Fprintln(w, strings.Join(headers, "\t"))
+	}
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+// done reports the result of a change, value is printed with -o json and message otherwise
+func (a *app) done(value interface{}, format string, args ...interface{}) error {
+	if a.output == "json" {
+		return a.print(value, nil, nil)
+	}
+	fmt.Fprintf(a.stdout, format+"\n", args...)
+	return nil
+}
+
+// stringList is a flag that can be repeated
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func sorted(values []string) []string {
+	slices.Sort(values)
+	return values
+}
+
+func keys[V any](m map[string]V) []string {
+	result := make([]string, 0, len(m))
+	for key := range m {
+		result = append(result, key)
+	}
+	return result
+}
+
+// mark returns text when set is true and an empty string otherwise
+func mark(set bool, text string) string {
+	if set {
+		return text
+	}
+	return ""
+}
+
+// orDash keeps empty table cells visible
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
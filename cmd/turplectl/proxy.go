@@ -0,0 +1,126 @@
+package main
+
+import (
+	"flag"
+	"strconv"
+
+	"github.com/turplespace/portos/pkg/models"
+)
+
+func proxyRows(proxies []models.Proxy) [][]string {
+	rows := make([][]string, len(proxies))
+	for i, proxy := range proxies {
+		rows[i] = []string{strconv.Itoa(proxy.ID), strconv.Itoa(proxy.CubeID), proxy.Domain, strconv.Itoa(proxy.Port), orDash(proxy.Type), mark(proxy.Default, "yes")}
+	}
+	return rows
+}
+
+var proxyHeaders = []string{"ID", "CUBE", "DOMAIN", "PORT", "TYPE", "DEFAULT"}
+
+func listProxies(a *app, args []string) error {
+	cubeID, err := parseID(newFlagSet(a, "proxy list CUBE_ID"), args)
+	if err != nil {
+		return err
+	}
+
+	proxies, err := a.client.ListCubeProxies(a.ctx, cubeID)
+	if err != nil {
+		return err
+	}
+	return a.print(proxies, proxyHeaders, proxyRows(proxies))
+}
+
+func getProxy(a *app, args []string) error {
+	id, err := parseID(newFlagSet(a, "proxy get ID"), args)
+	if err != nil {
+		return err
+	}
+
+	proxy, err := a.client.GetProxy(a.ctx, id)
+	if err != nil {
+		return err
+	}
+	return a.print(proxy, proxyHeaders, proxyRows([]models.Proxy{*proxy}))
+}
+
+// proxyFlags registers the flags shared by proxy add and proxy edit
+func proxyFlags(fs *flag.FlagSet, domain *string, port *int, kind *string, isDefault *bool) {
+	fs.StringVar(domain, "domain", "", "Domain routed to the cube")
+	fs.IntVar(port, "port", 0, "Port of the container")
+	fs.StringVar(kind, "type", "", "Proxy type, such as http")
+	fs.BoolVar(isDefault, "default", false, "Make it the default proxy of the cube")
+}
+
+func addProxy(a *app, args []string) error {
+	fs := newFlagSet(a, "proxy add CUBE_ID --domain DOMAIN --port PORT [flags]")
+	var req models.AddProxyRequest
+	proxyFlags(fs, &req.Domain, &req.Port, &req.Type, &req.Default)
+	cubeID, err := parseID(fs, args)
+	if err != nil {
+		return err
+	}
+	req.CubeID = cubeID
+
+	id, err := a.client.AddProxy(a.ctx, req)
+	if err != nil {
+		return err
+	}
+	return a.done(map[string]int{"id": id}, "Proxy %s added with ID %d, run turplectl proxy deploy %d to route it", req.Domain, id, id)
+}
+
+// editProxy replaces the flags given on the command line, the others keep their current value
+func editProxy(a *app, args []string) error {
+	fs := newFlagSet(a, "proxy edit ID [flags]")
+	var req models.EditProxyByIDRequest
+	proxyFlags(fs, &req.Domain, &req.Port, &req.Type, &req.Default)
+	id, err := parseID(fs, args)
+	if err != nil {
+		return err
+	}
+
+	current, err := a.client.GetProxy(a.ctx, id)
+	if err != nil {
+		return err
+	}
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if !set["domain"] {
+		req.Domain = current.Domain
+	}
+	if !set["port"] {
+		req.Port = current.Port
+	}
+	if !set["type"] {
+		req.Type = current.Type
+	}
+	if !set["default"] {
+		req.Default = current.Default
+	}
+
+	if err := a.client.EditProxy(a.ctx, id, req); err != nil {
+		return err
+	}
+	return a.done(map[string]int{"id": id}, "Proxy %d updated", id)
+}
+
+func deleteProxy(a *app, args []string) error {
+	id, err := parseID(newFlagSet(a, "proxy delete ID"), args)
+	if err != nil {
+		return err
+	}
+	if err := a.client.DeleteProxy(a.ctx, id); err != nil {
+		return err
+	}
+	return a.done(map[string]int{"id": id}, "Proxy %d deleted", id)
+}
+
+func deployProxy(a *app, args []string) error {
+	id, err := parseID(newFlagSet(a, "proxy deploy ID"), args)
+	if err != nil {
+		return err
+	}
+	if err := a.client.DeployProxy(a.ctx, id); err != nil {
+		return err
+	}
+	return a.done(map[string]int{"id": id}, "Proxy %d deployed", id)
+}
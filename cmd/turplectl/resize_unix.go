@@ -0,0 +1,39 @@
+//go:build !windows
+
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/turplespace/portos/pkg/client"
+	"golang.org/x/term"
+)
+
+// watchResize sends the size of the terminal now and every time it changes, until ctx is done
+func watchResize(ctx context.Context, fd int) <-chan client.TerminalSize {
+	sizes := make(chan client.TerminalSize, 1)
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGWINCH)
+
+	go func() {
+		defer signal.Stop(signals)
+		for {
+			if width, height, err := term.GetSize(fd); err == nil {
+				select {
+				case sizes <- client.TerminalSize{Cols: uint(width), Rows: uint(height)}:
+				case <-ctx.Done():
+					return
+				}
+			}
+			select {
+			case <-signals:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return sizes
+}
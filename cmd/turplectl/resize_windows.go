@@ -0,0 +1,17 @@
+package main
+
+import (
+	"context"
+
+	"github.com/turplespace/portos/pkg/client"
+	"golang.org/x/term"
+)
+
+// watchResize sends the size of the terminal once, Windows has no signal for size changes
+func watchResize(ctx context.Context, fd int) <-chan client.TerminalSize {
+	sizes := make(chan client.TerminalSize, 1)
+	if width, height, err := term.GetSize(fd); err == nil {
+		sizes <- client.TerminalSize{Cols: uint(width), Rows: uint(height)}
+	}
+	return sizes
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/turplespace/portos/pkg/client"
+	"github.com/turplespace/portos/pkg/models"
+	"gopkg.in/yaml.v3"
+)
+
+// progressInterval is how often the cube states are polled while a workspace operation runs
+const progressInterval = time.Second
+
+func listWorkspaces(a *app, args []string) error {
+	fs := newFlagSet(a, "workspace list [flags]")
+	search := fs.String("q", "", "Search in the name and description")
+	sort := fs.String("sort", "", "name, created_at, -name or -created_at")
+	limit := fs.Int("limit", 0, "Print a single page of this size, every workspace by default")
+	cursor := fs.String("cursor", "", "Cursor of the page to print, with --limit")
+	if _, _, err := parseArgs(fs, args); err != nil {
+		return err
+	}
+
+	options := &client.ListWorkspacesOptions{Search: *search, Sort: *sort, Limit: *limit, Cursor: *cursor}
+	result, err := a.client.ListWorkspaces(a.ctx, options)
+	if err != nil {
+		return err
+	}
+	for *limit == 0 && result.NextCursor != "" {
+		options.Cursor = result.NextCursor
+		next, err := a.client.ListWorkspaces(a.ctx, options)
+		if err != nil {
+			return err
+		}
+		result.Workspaces = append(result.Workspaces, next.Workspaces...)
+		result.NextCursor = next.NextCursor
+	}
+
+	rows := make([][]string, len(result.Workspaces))
+	for i, workspace := range result.Workspaces {
+		created := "-"
+		if workspace.CreatedAt != nil {
+			created = workspace.CreatedAt.Local().Format(time.DateTime)
+		}
+		rows[i] = []string{
+			strconv.Itoa(workspace.ID),
+			workspace.Name,
+			fmt.Sprintf("%d/%d", workspace.RunningContainers, workspace.TotalContainers),
+			created,
+			orDash(workspace.Desc),
+		}
+	}
+	if err := a.print(result, []string{"ID", "NAME", "RUNNING", "CREATED", "DESCRIPTION"}, rows); err != nil {
+		return err
+	}
+	if a.output == "table" && result.NextCursor != "" {
+		fmt.Fprintf(a.stderr, "Next page: --cursor %s\n", result.NextCursor)
+	}
+	return nil
+}
+
+func createWorkspace(a *app, args []string) error {
+	fs := newFlagSet(a, "workspace create NAME [--desc TEXT]")
+	desc := fs.String("desc", "", "Description")
+	name, err := parseName(fs, args)
+	if err != nil {
+		return err
+	}
+
+	id, err := a.client.CreateWorkspace(a.ctx, models.CreateWorkspaceRequest{Name: name, Desc: *desc})
+	if err != nil {
+		return err
+	}
+	return a.done(map[string]int{"id": id}, "Workspace %s created with ID %d", name, id)
+}
+
+func deleteWorkspace(a *app, args []string) error {
+	id, err := parseID(newFlagSet(a, "workspace delete ID"), args)
+	if err != nil {
+		return err
+	}
+	if err := a.client.DeleteWorkspace(a.ctx, id); err != nil {
+		return err
+	}
+	return a.done(map[string]int{"id": id}, "Workspace %d deleted", id)
+}
+
+func deployWorkspace(a *app, args []string) error {
+	return workspaceOperation(a, args, "deploy", "deployed", a.client.DeployWorkspace)
+}
+
+func redeployWorkspace(a *app, args []string) error {
+	return workspaceOperation(a, args, "redeploy", "redeployed", a.client.RedeployWorkspace)
+}
+
+func stopWorkspace(a *app, args []string) error {
+	return workspaceOperation(a, args, "stop", "stopped", a.client.StopWorkspace)
+}
+
+/*
+workspaceOperation runs a deploy, redeploy or stop of a whole workspace. The server handles
+the workspace in a single request, so progress is shown by polling the state of its cubes
+while the request runs and printing each change to stderr.
+*/
+func workspaceOperation(a *app, args []string, name string, past string, call func(ctx context.Context, workspaceID int) error) error {
+	fs := newFlagSet(a, "workspace "+name+" ID")
+	quiet := fs.Bool("q", false, "Do not print the progress")
+	id, err := parseID(fs, args)
+	if err != nil {
+		return err
+	}
+
+	started := time.Now()
+	states := make(map[string]string)
+	report := func() []models.GetCubesResponse {
+		cubes, err := allCubes(a, id, nil)
+		if err != nil {
+			return nil
+		}
+		for _, cube := range cubes {
+			if previous, ok := states[cube.ContainerName]; ok && previous != cube.Status && !*quiet {
+				fmt.Fprintf(a.stderr, "%6.1fs  %-24s %s -> %s\n", time.Since(started).Seconds(), cube.ContainerName, previous, cube.Status)
+			}
+			states[cube.ContainerName] = cube.Status
+		}
+		return cubes
+	}
+	report()
+
+	result := make(chan error, 1)
+	go func() { result <- call(a.ctx, id) }()
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	for finished := false; !finished; {
+		select {
+		case <-ticker.C:
+			report()
+		case err = <-result:
+			finished = true
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	cubes := report()
+	running := 0
+	for _, cube := range cubes {
+		if cube.Status == "running" {
+			running++
+		}
+	}
+	return a.done(cubes, "Workspace %d %s in %.1fs, %d/%d cubes running", id, past, time.Since(started).Seconds(), running, len(cubes))
+}
+
+// applyWorkspace applies a workspace spec read from a YAML or JSON file, --dry-run prints the plan only
+func applyWorkspace(a *app, args []string) error {
+	fs := newFlagSet(a, "workspace apply -f FILE [--dry-run]")
+	file := fs.String("f", "", "YAML or JSON file with the workspace spec, - for stdin")
+	dryRun := fs.Bool("dry-run", false, "Print the plan without applying it")
+	positional, _, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if *file == "" || len(positional) != 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	data, err := readFile(*file)
+	if err != nil {
+		return err
+	}
+	// JSON is YAML, a single parser reads both
+	var spec models.WorkspaceSpec
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		return fmt.Errorf("failed to parse %s: %v", *file, err)
+	}
+
+	result, err := a.client.ApplyWorkspace(a.ctx, spec, *dryRun)
+	if err != nil {
+		return err
+	}
+	return printPlan(a, result, spec.Name, *dryRun)
+}
+
+// importCompose creates a workspace from a docker-compose file
+func importCompose(a *app, args []string) error {
+	fs := newFlagSet(a, "workspace import -f FILE [--name NAME] [--dry-run]")
+	file := fs.String("f", "", "docker-compose file, - for stdin")
+	name := fs.String("name", "", "Name of the workspace, the name of the compose file by default")
+	dryRun := fs.Bool("dry-run", false, "Print the plan without creating the workspace")
+	positional, _, err := parseArgs(fs, args)
+	if err != nil {
+		return err
+	}
+	if *file == "" || len(positional) != 0 {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	data, err := readFile(*file)
+	if err != nil {
+		return err
+	}
+	result, err := a.client.ImportCompose(a.ctx, data, *name, *dryRun)
+	if err != nil {
+		return err
+	}
+	return printPlan(a, result, *name, *dryRun)
+}
+
+// readFile reads a file given on the command line, - is stdin
+func readFile(file string) ([]byte, error) {
+	var data []byte
+	var err error
+	if file == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(file)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", file, err)
+	}
+	return data, nil
+}
+
+// printPlan prints the changes of an apply or an import, and its warnings on stderr
+func printPlan(a *app, result *models.ApplyResponse, name string, dryRun bool) error {
+	for _, warning := range result.Warnings {
+		fmt.Fprintf(a.stderr, "Warning: %s\n", warning)
+	}
+
+	rows := make([][]string, len(result.Changes))
+	for i, change := range result.Changes {
+		fields := make([]string, len(change.Fields))
+		for j, field := range change.Fields {
+			fields[j] = field.Field
+		}
+		rows[i] = []string{change.Action, change.Kind, change.Name, orDash(strings.Join(fields, ","))}
+	}
+	if a.output == "table" && len(rows) == 0 {
+		fmt.Fprintf(a.stdout, "Workspace %s is up to date\n", name)
+		return nil
+	}
+	if err := a.print(result, []string{"ACTION", "KIND", "NAME", "FIELDS"}, rows); err != nil {
+		return err
+	}
+	if a.output == "table" && dryRun {
+		fmt.Fprintln(a.stderr, "Dry run, nothing was changed")
+	}
+	return nil
+}
+
+// workspaceSpec prints the spec of a workspace as YAML, or as JSON with -o json
+func workspaceSpec(a *app, args []string) error {
+	id, err := parseID(newFlagSet(a, "workspace spec ID"), args)
+	if err != nil {
+		return err
+	}
+
+	spec, err := a.client.GetWorkspaceSpec(a.ctx, id)
+	if err != nil {
+		return err
+	}
+	if a.output == "json" {
+		return a.print(spec, nil, nil)
+	}
+	encoder := yaml.NewEncoder(a.stdout)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(spec); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// exportWorkspace prints a workspace as a docker-compose file or Kubernetes manifests
+func exportWorkspace(a *app, args []string) error {
+	fs := newFlagSet(a, "workspace export ID [--format compose|k8s]")
+	format := fs.String("format", "compose", "compose or k8s")
+	id, err := parseID(fs, args)
+	if err != nil {
+		return err
+	}
+
+	data, err := a.client.ExportWorkspace(a.ctx, id, *format)
+	if err != nil {
+		return err
+	}
+	_, err = a.stdout.Write(data)
+	return err
+}
+
+// cloneWorkspace copies a workspace into a new workspace
+func cloneWorkspace(a *app, args []string) error {
+	return copyWorkspace(a, args, "clone", "Print the plan without creating the workspace")
+}
+
+// promoteWorkspace copies a workspace with overrides into a new or existing workspace
+func promoteWorkspace(a *app, args []string) error {
+	return copyWorkspace(a, args, "promote", "Print the diff without applying it")
+}
+
+func copyWorkspace(a *app, args []string, command string, dryRunUsage string) error {
+	fs := newFlagSet(a, fmt.Sprintf("workspace %s ID --name NAME [-f FILE] [--dry-run]", command))
+	name := fs.String("name", "", "Name of the target workspace")
+	file := fs.String("f", "", "YAML or JSON file with the request: cube_names and domains rules, overrides")
+	dryRun := fs.Bool("dry-run", false, dryRunUsage)
+	id, err := parseID(fs, args)
+	if err != nil {
+		return err
+	}
+
+	var request models.CloneWorkspaceRequest
+	if *file != "" {
+		data, err := readFile(*file)
+		if err != nil {
+			return err
+		}
+		if err := yaml.Unmarshal(data, &request); err != nil {
+			return fmt.Errorf("failed to parse %s: %v", *file, err)
+		}
+	}
+	if *name != "" {
+		request.Name = *name
+	}
+	if request.Name == "" {
+		fs.Usage()
+		return flag.ErrHelp
+	}
+
+	var result *models.ApplyResponse
+	if command == "clone" {
+		result, err = a.client.CloneWorkspace(a.ctx, id, request, *dryRun)
+	} else {
+		result, err = a.client.PromoteWorkspace(a.ctx, id, request, *dryRun)
+	}
+	if err != nil {
+		return err
+	}
+	return printPlan(a, result, request.Name, *dryRun)
+}
@@ -0,0 +1,148 @@
+package config
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config holds the runtime settings of the TurpleCubes API server.
+// Every value is read from the environment once, on first use.
+type Config struct {
+	AllowedOrigins   []string      // Origins allowed for CORS and WebSocket upgrades, empty means same-origin only
+	SecureCookies    bool          // Mark session cookies as Secure even when the request is not TLS
+	SessionTTL       time.Duration // Lifetime of a login session
+	AdminUsername    string        // Username of the admin account created on first run
+	AdminPassword    string        // Password of the admin account created on first run, generated when empty
+	RequireAdminTOTP bool          // Admins must enroll TOTP, or sign in with a second factor at the OIDC provider, before using the API
+	OIDC             OIDCConfig    // Single sign-on settings, disabled when the issuer is empty
+	MasterKey        string        // Base64 encoded 32 byte key encrypting workspace secrets, the secrets store is disabled when empty
+	VolumeRoots      []string      // Host directories that cubes may bind mount besides [DEFAULT], none when empty
+}
+
+// OIDCConfig holds the OpenID Connect single sign-on settings
+type OIDCConfig struct {
+	Issuer         string            // Issuer URL used for discovery
+	ClientID       string            // Client ID registered at the provider
+	ClientSecret   string            // Client secret, may be empty for public clients using PKCE only
+	RedirectURL    string            // Callback URL, must point to /api/auth/oidc/callback
+	Scopes         []string          // Requested scopes, openid is always included
+	UsernameClaim  string            // ID token claim used as the username shown for the account
+	GroupsClaim    string            // ID token claim listing the groups of the user
+	AdminGroups    []string          // Groups whose members are admins
+	WorkspaceRoles []OIDCRoleMapping // Groups granting a role in a workspace
+	RequireMFA     bool              // Every single sign-on login must use a second factor at the provider
+	MFAMethods     []string          // amr claim values showing the provider checked a second factor
+	MFAContexts    []string          // acr claim values showing the provider checked a second factor
+}
+
+// OIDCRoleMapping grants Role in the workspace named Workspace to the members of Group
+type OIDCRoleMapping struct {
+	Group     string
+	Workspace string
+	Role      string
+}
+
+// Enabled reports whether single sign-on is configured
+func (o OIDCConfig) Enabled() bool {
+	return o.Issuer != "" && o.ClientID != "" && o.RedirectURL != ""
+}
+
+var (
+	config     *Config
+	configOnce sync.Once
+)
+
+// Get returns the singleton configuration loaded from the environment
+func Get() *Config {
+	configOnce.Do(func() {
+		config = &Config{
+			AllowedOrigins:   getList("TURPLECUBES_ALLOWED_ORIGINS"),
+			SecureCookies:    getBool("TURPLECUBES_SECURE_COOKIES", false),
+			SessionTTL:       getDuration("TURPLECUBES_SESSION_TTL", 24*time.Hour),
+			AdminUsername:    getString("TURPLECUBES_ADMIN_USERNAME", "admin"),
+			AdminPassword:    os.Getenv("TURPLECUBES_ADMIN_PASSWORD"),
+			RequireAdminTOTP: getBool("TURPLECUBES_REQUIRE_ADMIN_TOTP", false),
+			MasterKey:        os.Getenv("TURPLECUBES_MASTER_KEY"),
+			VolumeRoots:      getList("TURPLECUBES_VOLUME_ROOTS"),
+			OIDC: OIDCConfig{
+				Issuer:         getString("TURPLECUBES_OIDC_ISSUER", ""),
+				ClientID:       getString("TURPLECUBES_OIDC_CLIENT_ID", ""),
+				ClientSecret:   os.Getenv("TURPLECUBES_OIDC_CLIENT_SECRET"),
+				RedirectURL:    getString("TURPLECUBES_OIDC_REDIRECT_URL", ""),
+				Scopes:         getList("TURPLECUBES_OIDC_SCOPES"),
+				UsernameClaim:  getString("TURPLECUBES_OIDC_USERNAME_CLAIM", "preferred_username"),
+				GroupsClaim:    getString("TURPLECUBES_OIDC_GROUPS_CLAIM", "groups"),
+				AdminGroups:    getList("TURPLECUBES_OIDC_ADMIN_GROUPS"),
+				WorkspaceRoles: getRoleMappings("TURPLECUBES_OIDC_WORKSPACE_ROLES"),
+				RequireMFA:     getBool("TURPLECUBES_OIDC_REQUIRE_MFA", false),
+				MFAMethods:     getList("TURPLECUBES_OIDC_MFA_AMR"),
+				MFAContexts:    getList("TURPLECUBES_OIDC_MFA_ACR"),
+			},
+		}
+		if len(config.OIDC.Scopes) == 0 {
+			config.OIDC.Scopes = []string{"profile", "email"}
+		}
+		if len(config.OIDC.MFAMethods) == 0 {
+			config.OIDC.MFAMethods = []string{"mfa", "otp", "hwk"}
+		}
+	})
+	return config
+}
+
+func getString(key, fallback string) string {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getBool(key string, fallback bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func getDuration(key string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+// getList splits a comma separated environment variable and drops empty items
+func getList(key string) []string {
+	var items []string
+	for _, item := range strings.Split(os.Getenv(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// getRoleMappings parses a comma separated list of group=workspace:role items, malformed items are skipped
+func getRoleMappings(key string) []OIDCRoleMapping {
+	var mappings []OIDCRoleMapping
+	for _, item := range getList(key) {
+		group, target, ok := strings.Cut(item, "=")
+		if !ok {
+			continue
+		}
+		workspace, role, ok := strings.Cut(target, ":")
+		if !ok {
+			continue
+		}
+		mappings = append(mappings, OIDCRoleMapping{
+			Group:     strings.TrimSpace(group),
+			Workspace: strings.TrimSpace(workspace),
+			Role:      strings.TrimSpace(role),
+		})
+	}
+	return mappings
+}
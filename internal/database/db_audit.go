@@ -0,0 +1,161 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// FieldChange is one changed field of an audited object, Field is a dotted JSON path
+type FieldChange struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+type AuditEntry struct {
+	ID          int             `json:"id"`
+	CreatedAt   time.Time       `json:"created_at"`
+	Actor       string          `json:"actor"`
+	UserID      *int            `json:"user_id"`
+	TokenID     *int            `json:"token_id"`
+	SourceIP    string          `json:"source_ip"`
+	Action      string          `json:"action"`
+	TargetType  string          `json:"target_type"`
+	TargetID    *int            `json:"target_id"`
+	WorkspaceID *int            `json:"workspace_id"`
+	Before      json.RawMessage `json:"before"`
+	After       json.RawMessage `json:"after"`
+	Diff        []FieldChange   `json:"diff"`
+	Result      string          `json:"result"`
+	Status      int             `json:"status"`
+	Error       string          `json:"error,omitempty"`
+}
+
+// AuditFilter narrows ListAuditEntries, zero values do not filter
+type AuditFilter struct {
+	WorkspaceID int
+	Actor       string
+	Action      string // Exact action, or a prefix when it ends with *
+	Since       time.Time
+	Until       time.Time
+	Limit       int
+}
+
+// InsertAuditEntry appends an entry to the audit log
+func InsertAuditEntry(entry AuditEntry) error {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	diff, err := json.Marshal(entry.Diff)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit diff: %v", err)
+	}
+
+	query := `INSERT INTO audit_log (created_at, actor, user_id, token_id, source_ip, action, target_type, target_id, workspace_id, before, after, diff, result, status, error)
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err = db.Exec(query, entry.CreatedAt.UTC(), entry.Actor, entry.UserID, entry.TokenID, entry.SourceIP, entry.Action,
+		entry.TargetType, entry.TargetID, entry.WorkspaceID, nullableJSON(entry.Before), nullableJSON(entry.After), string(diff),
+		entry.Result, entry.Status, entry.Error)
+	if err != nil {
+		return fmt.Errorf("failed to insert audit entry: %v", err)
+	}
+
+	return nil
+}
+
+// ListAuditEntries returns the newest audit entries matching the filter
+func ListAuditEntries(filter AuditFilter) ([]AuditEntry, error) {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	var conditions []string
+	var args []interface{}
+	if filter.WorkspaceID != 0 {
+		conditions = append(conditions, "workspace_id = ?")
+		args = append(args, filter.WorkspaceID)
+	}
+	if filter.Actor != "" {
+		conditions = append(conditions, "actor = ?")
+		args = append(args, filter.Actor)
+	}
+	if prefix, ok := strings.CutSuffix(filter.Action, "*"); ok {
+		conditions = append(conditions, "action LIKE ? ESCAPE '\\'")
+		args = append(args, escapeLike(prefix)+"%")
+	} else if filter.Action != "" {
+		conditions = append(conditions, "action = ?")
+		args = append(args, filter.Action)
+	}
+	if !filter.Since.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, filter.Since.UTC())
+	}
+	if !filter.Until.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, filter.Until.UTC())
+	}
+
+	query := `SELECT id, created_at, actor, user_id, token_id, source_ip, action, target_type, target_id, workspace_id, before, after, diff, result, status, error FROM audit_log`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, filter.Limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit log: %v", err)
+	}
+	defer rows.Close()
+
+	var entries []AuditEntry
+	for rows.Next() {
+		var entry AuditEntry
+		var sourceIP, targetType, before, after, diff, errText sql.NullString
+		var status sql.NullInt64
+		err = rows.Scan(&entry.ID, &entry.CreatedAt, &entry.Actor, &entry.UserID, &entry.TokenID, &sourceIP, &entry.Action,
+			&targetType, &entry.TargetID, &entry.WorkspaceID, &before, &after, &diff, &entry.Result, &status, &errText)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %v", err)
+		}
+		entry.SourceIP = sourceIP.String
+		entry.TargetType = targetType.String
+		entry.Status = int(status.Int64)
+		entry.Error = errText.String
+		if before.Valid {
+			entry.Before = json.RawMessage(before.String)
+		}
+		if after.Valid {
+			entry.After = json.RawMessage(after.String)
+		}
+		if diff.Valid {
+			json.Unmarshal([]byte(diff.String), &entry.Diff)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// Helper function to store empty JSON documents as NULL
+func nullableJSON(raw json.RawMessage) interface{} {
+	if len(raw) == 0 {
+		return nil
+	}
+	return string(raw)
+}
+
+// Helper function to escape the wildcards of a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -2,16 +2,68 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"slices"
 	"strings"
 
 	_ "github.com/mattn/go-sqlite3"
-	"github.com/turplespace/portos/internal/models"
+	"github.com/turplespace/portos/pkg/models"
 )
 
-// InsertWorkspaceAndCubes inserts a workspace and its associated cubes into the database
-func InsertWorkspaceAndCubes(workspaceID int, cube models.Container) (int64, error) {
+// ErrNameTaken is wrapped by the errors of cubes whose container names another cube, of any workspace, may use
+var ErrNameTaken = errors.New("container name taken")
+
+// ReservedContainerNames are the containers TurpleCubes runs next to the cubes, no cube may take their names
+var ReservedContainerNames = []string{"turplecubes-proxy"}
+
+/*
+CheckContainerNames rejects a cube whose containers could take the name of a container of a cube of
+another workspace, or of a reserved container. Every name a cube may use is compared, with those
+of its replicas and of its blue/green deploys, as Docker container names are unique on the host.
+*/
+func CheckContainerNames(cube models.Container, workspaceID int) error {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	return checkContainerNames(db, cube, `workspace_id != ?`, workspaceID)
+}
+
+// checkContainerNames rejects a cube whose claimed names clash with those of the cubes matching condition
+func checkContainerNames(db querier, cube models.Container, condition string, args ...interface{}) error {
+	claimed := cube.ClaimedNames()
+	for _, name := range ReservedContainerNames {
+		if slices.Contains(claimed, name) {
+			return fmt.Errorf("%w: container name %s of cube %s is reserved", ErrNameTaken, name, cube.Name)
+		}
+	}
+
+	rows, err := db.Query(`SELECT name, replicas FROM container WHERE `+condition, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query container names: %v", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var other models.Container
+		if err := rows.Scan(&other.Name, &other.Replicas); err != nil {
+			return fmt.Errorf("failed to scan container name: %v", err)
+		}
+		for _, name := range other.ClaimedNames() {
+			if slices.Contains(claimed, name) {
+				return fmt.Errorf("%w: container name %s of cube %s is used by another cube", ErrNameTaken, name, cube.Name)
+			}
+		}
+	}
+	return rows.Err()
+}
+
+// InsertWorkspaceAndCubes inserts a workspace and its associated cubes into the database, with their first revision by author
+func InsertWorkspaceAndCubes(workspaceID int, cube models.Container, author string) (int64, error) {
 	db_path, _ := GetPath()
 	db, err := sql.Open("sqlite3", db_path)
 	if err != nil {
@@ -29,12 +81,18 @@ func InsertWorkspaceAndCubes(workspaceID int, cube models.Container) (int64, err
 		return 0, fmt.Errorf("workspace with ID %d does not exist", workspaceID)
 	}
 
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
 	// Insert the cubes
 	var lastInsertedID int64
 
-	result, err := db.Exec(`INSERT INTO container (workspace_id, name, image, ports, environment_vars, cpus, memory, volumes, labels, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`,
+	result, err := tx.Exec(`INSERT INTO container (workspace_id, name, image, ports, environment_vars, cpus, memory, volumes, labels, networks, depends_on, replicas, load_balancing, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`,
 		workspaceID, cube.Name, cube.Image, strings.Join(cube.Ports, ","), strings.Join(cube.EnvironmentVars, ","),
-		cube.ResourceLimits.CPUs, cube.ResourceLimits.Memory, mapToString(cube.Volumes), strings.Join(cube.Labels, ","))
+		cube.ResourceLimits.CPUs, cube.ResourceLimits.Memory, mapToString(cube.Volumes), strings.Join(cube.Labels, ","), strings.Join(cube.Networks, ","), strings.Join(cube.DependsOn, ","), cube.Replicas, cube.LoadBalancing)
 	if err != nil {
 		return 0, fmt.Errorf("failed to insert cube: %v", err)
 	}
@@ -43,6 +101,16 @@ func InsertWorkspaceAndCubes(workspaceID int, cube models.Container) (int64, err
 	if err != nil {
 		return 0, fmt.Errorf("failed to retrieve last insert ID: %v", err)
 	}
+	if err := checkContainerNames(tx, cube, `id != ?`, id); err != nil {
+		return 0, err
+	}
+
+	if _, err := addCubeRevision(tx, int(id), cube, author, RevisionCreate); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit cube: %v", err)
+	}
 
 	lastInsertedID = id
 	log.Printf("Inserted cube with ID %d successfully!", id)
@@ -73,14 +141,14 @@ func GetCubeData(cubeID int) (*models.Container, error) {
 	}
 	defer db.Close()
 
-	query := `SELECT name, image, ports, environment_vars, cpus, memory, volumes, labels 
+	query := `SELECT name, image, ports, environment_vars, cpus, memory, volumes, labels, networks, depends_on, replicas, load_balancing 
               FROM container WHERE id = ?`
 	row := db.QueryRow(query, cubeID)
 
 	var cube models.Container
-	var ports, envVars, volumes, labels string
+	var ports, envVars, volumes, labels, networks, dependsOn string
 
-	err = row.Scan(&cube.Name, &cube.Image, &ports, &envVars, &cube.ResourceLimits.CPUs, &cube.ResourceLimits.Memory, &volumes, &labels)
+	err = row.Scan(&cube.Name, &cube.Image, &ports, &envVars, &cube.ResourceLimits.CPUs, &cube.ResourceLimits.Memory, &volumes, &labels, &networks, &dependsOn, &cube.Replicas, &cube.LoadBalancing)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, fmt.Errorf("cube with ID %d not found", cubeID)
@@ -88,10 +156,13 @@ func GetCubeData(cubeID int) (*models.Container, error) {
 		return nil, fmt.Errorf("failed to query cube data: %v", err)
 	}
 
+	cube.ID = cubeID
 	cube.Ports = splitString(ports)
 	cube.EnvironmentVars = splitString(envVars)
 	cube.Volumes = stringToMap(volumes)
 	cube.Labels = splitString(labels)
+	cube.Networks = splitString(networks)
+	cube.DependsOn = splitString(dependsOn)
 
 	return &cube, nil
 }
@@ -117,24 +188,41 @@ func stringToMap(s string) map[string]string {
 	return m
 }
 
-// UpdateCube updates the data of a cube by its ID
-func UpdateCube(cubeID int, updatedCube models.Container) error {
+// UpdateCube updates the data of a cube by its ID and stores it as a revision by author, note tells
+// what changed it. It returns the number of the revision.
+func UpdateCube(cubeID int, updatedCube models.Container, author string, note string) (int, error) {
 	db_path, _ := GetPath()
 	db, err := sql.Open("sqlite3", db_path)
 	if err != nil {
-		return fmt.Errorf("failed to open database: %v", err)
+		return 0, fmt.Errorf("failed to open database: %v", err)
 	}
 	defer db.Close()
 
-	query := `UPDATE container SET name = ?, image = ?, ports = ?, environment_vars = ?, cpus = ?, memory = ?, volumes = ?, labels = ? WHERE id = ?`
-	_, err = db.Exec(query, updatedCube.Name, updatedCube.Image, strings.Join(updatedCube.Ports, ","), strings.Join(updatedCube.EnvironmentVars, ","),
-		updatedCube.ResourceLimits.CPUs, updatedCube.ResourceLimits.Memory, mapToString(updatedCube.Volumes), strings.Join(updatedCube.Labels, ","), cubeID)
+	tx, err := db.Begin()
 	if err != nil {
-		return fmt.Errorf("failed to update cube: %v", err)
+		return 0, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE container SET name = ?, image = ?, ports = ?, environment_vars = ?, cpus = ?, memory = ?, volumes = ?, labels = ?, networks = ?, depends_on = ?, replicas = ?, load_balancing = ? WHERE id = ?`
+	_, err = tx.Exec(query, updatedCube.Name, updatedCube.Image, strings.Join(updatedCube.Ports, ","), strings.Join(updatedCube.EnvironmentVars, ","),
+		updatedCube.ResourceLimits.CPUs, updatedCube.ResourceLimits.Memory, mapToString(updatedCube.Volumes), strings.Join(updatedCube.Labels, ","), strings.Join(updatedCube.Networks, ","), strings.Join(updatedCube.DependsOn, ","), updatedCube.Replicas, updatedCube.LoadBalancing, cubeID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update cube: %v", err)
+	}
+	if err := checkContainerNames(tx, updatedCube, `id != ?`, cubeID); err != nil {
+		return 0, err
+	}
+	revision, err := addCubeRevision(tx, cubeID, updatedCube, author, note)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit cube: %v", err)
 	}
 
 	log.Println("Cube updated successfully!")
-	return nil
+	return revision, nil
 }
 
 // DeleteCube deletes a cube by its ID
@@ -151,35 +239,82 @@ func DeleteCube(cubeID int) error {
 	if err != nil {
 		return fmt.Errorf("failed to delete cube: %v", err)
 	}
+	if _, err := db.Exec(`DELETE FROM cube_revision WHERE cube_id = ?`, cubeID); err != nil {
+		return fmt.Errorf("failed to delete cube revisions: %v", err)
+	}
 
 	log.Println("Cube deleted successfully!")
 	return nil
 }
 
-// ListCubes retrieves all cubes in a workspace by its ID
-func ListCubes(workspaceID int) ([]models.Container, error) {
+// CubeFilter narrows ListCubes, zero values do not filter
+type CubeFilter struct {
+	Search string   // Substring of the name or image
+	Image  string   // Image reference, without a tag it matches every tag
+	Label  string   // key=value, or a key matching any value
+	Names  []string // Only these cubes when not nil
+	Page
+}
+
+// ListCubes retrieves a page of the cubes in a workspace matching the filter, with the cursor of the next page
+func ListCubes(workspaceID int, filter CubeFilter) ([]models.Container, string, error) {
 	db_path, _ := GetPath()
 	db, err := sql.Open("sqlite3", db_path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %v", err)
+		return nil, "", fmt.Errorf("failed to open database: %v", err)
 	}
 	defer db.Close()
 
-	query := `SELECT id, name, image, ports FROM container WHERE workspace_id = ?`
-	rows, err := db.Query(query, workspaceID)
+	conditions := []string{"workspace_id = ?"}
+	args := []interface{}{workspaceID}
+	if filter.Search != "" {
+		conditions = append(conditions, `(name LIKE ? ESCAPE '\' OR image LIKE ? ESCAPE '\')`)
+		pattern := "%" + escapeLike(filter.Search) + "%"
+		args = append(args, pattern, pattern)
+	}
+	if filter.Image != "" {
+		// An image without a tag or digest matches every tag of it
+		conditions = append(conditions, `(image = ? OR image LIKE ? ESCAPE '\' OR image LIKE ? ESCAPE '\')`)
+		args = append(args, filter.Image, escapeLike(filter.Image)+":%", escapeLike(filter.Image)+"@%")
+	}
+	if filter.Label != "" {
+		// Labels are stored comma separated, a key without a value matches any value
+		labels := `(',' || COALESCE(labels, '') || ',')`
+		if strings.Contains(filter.Label, "=") {
+			conditions = append(conditions, labels+` LIKE ? ESCAPE '\'`)
+			args = append(args, "%,"+escapeLike(filter.Label)+",%")
+		} else {
+			conditions = append(conditions, "("+labels+` LIKE ? ESCAPE '\' OR `+labels+` LIKE ? ESCAPE '\')`)
+			args = append(args, "%,"+escapeLike(filter.Label)+",%", "%,"+escapeLike(filter.Label)+"=%")
+		}
+	}
+	if filter.Names != nil {
+		condition, names := inCondition("name", filter.Names)
+		conditions = append(conditions, condition)
+		args = append(args, names...)
+	}
+
+	query := "SELECT id, name, image, ports, replicas, " + sortKey(filter.Sort) + " FROM container"
+	query, args, err = pageQuery(query, conditions, args, filter.Page)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query cubes: %v", err)
+		return nil, "", err
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to query cubes: %v", err)
 	}
 	defer rows.Close()
 
 	var cubes []models.Container
+	var keys []string
 	for rows.Next() {
 		var cube models.Container
-		var ports, envVars, volumes, labels string
+		var ports, envVars, volumes, labels, key string
 
-		err = rows.Scan(&cube.ID, &cube.Name, &cube.Image, &ports)
+		err = rows.Scan(&cube.ID, &cube.Name, &cube.Image, &ports, &cube.Replicas, &key)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan cube: %v", err)
+			return nil, "", fmt.Errorf("failed to scan cube: %v", err)
 		}
 
 		cube.Ports = splitString(ports)
@@ -188,9 +323,15 @@ func ListCubes(workspaceID int) ([]models.Container, error) {
 		cube.Labels = splitString(labels)
 
 		cubes = append(cubes, cube)
+		keys = append(keys, key)
 	}
 
-	return cubes, nil
+	next := ""
+	if filter.Limit > 0 && len(cubes) > filter.Limit {
+		cubes = cubes[:filter.Limit]
+		next = nextCursor(filter.Sort, cubes[filter.Limit-1].ID, keys[filter.Limit-1])
+	}
+	return cubes, next, nil
 }
 
 // CountContainersByWorkspaceID counts the number of containers associated with a specific workspace by its ID
@@ -239,6 +380,11 @@ func DeleteContainersByWorkspaceID(workspaceID int) error {
 	}
 	defer db.Close()
 
+	_, err = db.Exec(`DELETE FROM cube_revision WHERE cube_id IN (SELECT id FROM container WHERE workspace_id = ?)`, workspaceID)
+	if err != nil {
+		return fmt.Errorf("failed to delete cube revisions for workspace %d: %v", workspaceID, err)
+	}
+
 	query := `DELETE FROM container WHERE workspace_id = ?`
 	_, err = db.Exec(query, workspaceID)
 	if err != nil {
@@ -248,3 +394,24 @@ func DeleteContainersByWorkspaceID(workspaceID int) error {
 	log.Printf("Deleted containers for workspace %d successfully!", workspaceID)
 	return nil
 }
+
+// GetWorkspaceIDByCubeID returns the ID of the workspace a cube belongs to
+func GetWorkspaceIDByCubeID(cubeID int) (int, error) {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	var workspaceID int
+	err = db.QueryRow(`SELECT workspace_id FROM container WHERE id = ?`, cubeID).Scan(&workspaceID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, fmt.Errorf("cube with ID %d not found", cubeID)
+		}
+		return 0, fmt.Errorf("failed to query cube workspace: %v", err)
+	}
+
+	return workspaceID, nil
+}
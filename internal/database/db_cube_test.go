@@ -0,0 +1,52 @@
+package database
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/turplespace/portos/pkg/models"
+)
+
+func TestContainerNamesAreUniqueAcrossWorkspaces(t *testing.T) {
+	owner := newWorkspace(t, "names-owner")
+	other := newWorkspace(t, "names-other")
+
+	webID, err := InsertWorkspaceAndCubes(owner, models.Container{Name: "names-web", Image: "nginx", Replicas: 2}, "test")
+	if err != nil {
+		t.Fatalf("insert names-web: %v", err)
+	}
+
+	// The replica, blue/green and own names of names-web are all taken, and so is the proxy
+	for _, name := range []string{"names-web", "names-web-1", "names-web-2", "names-web-next", "turplecubes-proxy"} {
+		_, err := InsertWorkspaceAndCubes(other, models.Container{Name: name, Image: "nginx"}, "test")
+		if !errors.Is(err, ErrNameTaken) {
+			t.Errorf("insert %s in another workspace = %v, want ErrNameTaken", name, err)
+		}
+	}
+	if err := CheckContainerNames(models.Container{Name: "names-web"}, other); !errors.Is(err, ErrNameTaken) {
+		t.Errorf("check names-web in another workspace = %v, want ErrNameTaken", err)
+	}
+	if err := CheckContainerNames(models.Container{Name: "names-web"}, owner); err != nil {
+		t.Errorf("check names-web in its own workspace = %v, want nil", err)
+	}
+
+	// A cube scaled onto the replica names of another cube is rejected, and so is a rename onto them
+	apiID, err := InsertWorkspaceAndCubes(other, models.Container{Name: "names-web-3", Image: "nginx"}, "test")
+	if err != nil {
+		t.Fatalf("insert names-web-3: %v", err)
+	}
+	if _, err := UpdateCube(int(webID), models.Container{Name: "names-web", Image: "nginx", Replicas: 3}, "test", RevisionEdit); !errors.Is(err, ErrNameTaken) {
+		t.Errorf("scale names-web to 3 = %v, want ErrNameTaken", err)
+	}
+	if _, err := UpdateCube(int(apiID), models.Container{Name: "names-web-1", Image: "nginx"}, "test", RevisionEdit); !errors.Is(err, ErrNameTaken) {
+		t.Errorf("rename names-web-3 to names-web-1 = %v, want ErrNameTaken", err)
+	}
+	if cube, err := GetCubeData(int(apiID)); err != nil || cube.Name != "names-web-3" {
+		t.Errorf("cube after the rejected rename = %+v, %v, want names-web-3 unchanged", cube, err)
+	}
+
+	// A cube keeps its own names when it is edited
+	if _, err := UpdateCube(int(webID), models.Container{Name: "names-web", Image: "nginx:1.27", Replicas: 2}, "test", RevisionEdit); err != nil {
+		t.Errorf("edit names-web = %v, want nil", err)
+	}
+}
@@ -0,0 +1,120 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type WorkspaceMember struct {
+	WorkspaceID int        `json:"workspace_id"`
+	UserID      int        `json:"user_id"`
+	Username    string     `json:"username"`
+	Role        string     `json:"role"`
+	CreatedAt   *time.Time `json:"created_at"`
+}
+
+// SetWorkspaceMember adds a user to a workspace with the given role, or changes the role of an existing member
+func SetWorkspaceMember(workspaceID int, userID int, role string) error {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	query := `INSERT INTO workspace_member (workspace_id, user_id, role) VALUES (?, ?, ?)
+              ON CONFLICT(workspace_id, user_id) DO UPDATE SET role = excluded.role`
+	_, err = db.Exec(query, workspaceID, userID, role)
+	if err != nil {
+		return fmt.Errorf("failed to set workspace member: %v", err)
+	}
+
+	return nil
+}
+
+// RemoveWorkspaceMember removes a user from a workspace
+func RemoveWorkspaceMember(workspaceID int, userID int) error {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`DELETE FROM workspace_member WHERE workspace_id = ? AND user_id = ?`, workspaceID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to remove workspace member: %v", err)
+	}
+
+	return nil
+}
+
+// DeleteWorkspaceMembers removes every member of a workspace
+func DeleteWorkspaceMembers(workspaceID int) error {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`DELETE FROM workspace_member WHERE workspace_id = ?`, workspaceID)
+	if err != nil {
+		return fmt.Errorf("failed to delete members of workspace %d: %v", workspaceID, err)
+	}
+
+	return nil
+}
+
+// ListWorkspaceMembers lists the members of a workspace with their usernames
+func ListWorkspaceMembers(workspaceID int) ([]WorkspaceMember, error) {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	query := `SELECT m.workspace_id, m.user_id, u.username, m.role, m.created_at
+              FROM workspace_member m JOIN user u ON u.id = m.user_id
+              WHERE m.workspace_id = ? ORDER BY u.username`
+	rows, err := db.Query(query, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query workspace members: %v", err)
+	}
+	defer rows.Close()
+
+	var members []WorkspaceMember
+	for rows.Next() {
+		var member WorkspaceMember
+		err = rows.Scan(&member.WorkspaceID, &member.UserID, &member.Username, &member.Role, &member.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan workspace member: %v", err)
+		}
+		members = append(members, member)
+	}
+
+	return members, nil
+}
+
+// GetWorkspaceRole returns the role of a user in a workspace, or an empty string when the user is not a member
+func GetWorkspaceRole(workspaceID int, userID int) (string, error) {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	var role string
+	err = db.QueryRow(`SELECT role FROM workspace_member WHERE workspace_id = ? AND user_id = ?`, workspaceID, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to query workspace role: %v", err)
+	}
+
+	return role, nil
+}
@@ -0,0 +1,57 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// WorkspaceNetwork is a network declared by a workspace, cubes join it by name
+type WorkspaceNetwork struct {
+	Name      string     `json:"name"`
+	Driver    string     `json:"driver"` // Docker network driver, bridge when empty
+	CreatedAt *time.Time `json:"created_at"`
+}
+
+// ListWorkspaceNetworks returns the networks of a workspace ordered by name
+func ListWorkspaceNetworks(workspaceID int) ([]WorkspaceNetwork, error) {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT name, driver, created_at FROM workspace_network WHERE workspace_id = ? ORDER BY name`, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query workspace networks: %v", err)
+	}
+	defer rows.Close()
+
+	networks := []WorkspaceNetwork{}
+	for rows.Next() {
+		var network WorkspaceNetwork
+		if err := rows.Scan(&network.Name, &network.Driver, &network.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan workspace network: %v", err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, rows.Err()
+}
+
+// DeleteWorkspaceNetworks deletes every network of a workspace
+func DeleteWorkspaceNetworks(workspaceID int) error {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`DELETE FROM workspace_network WHERE workspace_id = ?`, workspaceID)
+	if err != nil {
+		return fmt.Errorf("failed to delete workspace networks: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,129 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrInvalidCursor is returned when a cursor was not produced by a previous page of the same sort
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Sort orders of the paged lists, a leading - sorts descending
+var sortColumns = map[string]string{
+	"":           "id",
+	"name":       "COALESCE(name, '')",
+	"created_at": "COALESCE(CAST(created_at AS TEXT), '')",
+}
+
+// Page selects a slice of a list, zero values return the whole list ordered by ID
+type Page struct {
+	Sort   string // name, created_at, -name or -created_at
+	Limit  int    // Maximum number of items, 0 for all
+	Cursor string // Cursor returned with the previous page
+}
+
+// cursor is the position after the last item of a page, encoded as base64 JSON
+type cursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+// ValidSort reports whether a sort order is supported by the paged lists
+func ValidSort(sort string) bool {
+	_, ok := sortColumns[strings.TrimPrefix(sort, "-")]
+	return ok && sort != "-"
+}
+
+// pageQuery appends the keyset condition, the order and the limit of a page to a query.
+// The query must select the sort key as its last column, see sortKey.
+// One row more than the limit is fetched to know whether there is a next page.
+func pageQuery(query string, conditions []string, args []interface{}, page Page) (string, []interface{}, error) {
+	column, descending, err := sortColumn(page.Sort)
+	if err != nil {
+		return "", nil, err
+	}
+	comparison, direction := ">", "ASC"
+	if descending {
+		comparison, direction = "<", "DESC"
+	}
+
+	if page.Cursor != "" {
+		after, err := decodeCursor(page.Cursor, page.Sort)
+		if err != nil {
+			return "", nil, err
+		}
+		if column == "id" {
+			conditions = append(conditions, "id "+comparison+" ?")
+			args = append(args, after.ID)
+		} else {
+			conditions = append(conditions, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", column, comparison))
+			args = append(args, after.Value, after.Value, after.ID)
+		}
+	}
+
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += fmt.Sprintf(" ORDER BY %s %s", column, direction)
+	if column != "id" {
+		query += ", id " + direction
+	}
+	if page.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, page.Limit+1)
+	}
+
+	return query, args, nil
+}
+
+// sortKey returns the expression to select as the last column of a paged query
+func sortKey(sort string) string {
+	column, _, err := sortColumn(sort)
+	if err != nil || column == "id" {
+		return "''"
+	}
+	return column
+}
+
+func sortColumn(sort string) (string, bool, error) {
+	field, descending := strings.CutPrefix(sort, "-")
+	column, ok := sortColumns[field]
+	if !ok {
+		return "", false, fmt.Errorf("unsupported sort order %s", sort)
+	}
+	return column, descending, nil
+}
+
+// nextCursor returns the cursor of the page after the item with the given ID and sort key
+func nextCursor(sort string, lastID int, lastKey string) string {
+	data, _ := json.Marshal(cursor{Sort: sort, Value: lastKey, ID: lastID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(value string, sort string) (*cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var after cursor
+	if err := json.Unmarshal(data, &after); err != nil || after.Sort != sort {
+		return nil, ErrInvalidCursor
+	}
+	return &after, nil
+}
+
+// inCondition returns a column IN (...) condition, matching nothing for an empty list
+func inCondition[T any](column string, values []T) (string, []interface{}) {
+	if len(values) == 0 {
+		return "0", nil
+	}
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		args[i] = value
+	}
+	return fmt.Sprintf("%s IN (%s)", column, strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", ")), args
+}
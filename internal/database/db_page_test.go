@@ -0,0 +1,182 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/turplespace/portos/pkg/models"
+)
+
+// allPages follows the cursors of a paged list from the first page and returns the names of every page
+func allPages(t *testing.T, limit int, list func(cursor string) ([]string, string, error)) [][]string {
+	t.Helper()
+	var pages [][]string
+	cursor := ""
+	for {
+		names, next, err := list(cursor)
+		if err != nil {
+			t.Fatalf("page %d: %v", len(pages)+1, err)
+		}
+		if len(names) > limit {
+			t.Fatalf("page %d = %v, want at most %d items", len(pages)+1, names, limit)
+		}
+		pages = append(pages, names)
+		if next == "" {
+			return pages
+		}
+		if len(pages) > 10 {
+			t.Fatalf("pages = %v, want the cursors to end", pages)
+		}
+		cursor = next
+	}
+}
+
+func cubeNames(cubes []models.Container) []string {
+	names := make([]string, len(cubes))
+	for i, cube := range cubes {
+		names[i] = cube.Name
+	}
+	return names
+}
+
+// newPagedCubes stores cubes named after names in that order, all created at the same time
+func newPagedCubes(t *testing.T, workspace string, names ...string) int {
+	t.Helper()
+	workspaceID := newWorkspace(t, workspace)
+	for _, name := range names {
+		if _, err := InsertWorkspaceAndCubes(workspaceID, models.Container{Name: name, Image: "nginx"}, "test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	path, _ := GetPath()
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`UPDATE container SET created_at = '2026-01-02 03:04:05' WHERE workspace_id = ?`, workspaceID); err != nil {
+		t.Fatal(err)
+	}
+	return workspaceID
+}
+
+func TestListCubesPages(t *testing.T) {
+	// Inserted out of name order, so that the ID order differs from the name order
+	workspaceID := newPagedCubes(t, "pages", "page-b", "page-e", "page-a", "page-d", "page-c")
+	for _, test := range []struct {
+		sort string
+		want [][]string
+	}{
+		{"", [][]string{{"page-b", "page-e"}, {"page-a", "page-d"}, {"page-c"}}},
+		{"name", [][]string{{"page-a", "page-b"}, {"page-c", "page-d"}, {"page-e"}}},
+		{"-name", [][]string{{"page-e", "page-d"}, {"page-c", "page-b"}, {"page-a"}}},
+		// Every cube has the same creation time, the ties are broken by ID in the direction of the sort
+		{"created_at", [][]string{{"page-b", "page-e"}, {"page-a", "page-d"}, {"page-c"}}},
+		{"-created_at", [][]string{{"page-c", "page-d"}, {"page-a", "page-e"}, {"page-b"}}},
+	} {
+		pages := allPages(t, 2, func(cursor string) ([]string, string, error) {
+			cubes, next, err := ListCubes(workspaceID, CubeFilter{Page: Page{Sort: test.sort, Limit: 2, Cursor: cursor}})
+			return cubeNames(cubes), next, err
+		})
+		if !slices.EqualFunc(pages, test.want, slices.Equal) {
+			t.Errorf("pages sorted by %q = %v, want %v", test.sort, pages, test.want)
+		}
+	}
+
+	// A page that ends the list exactly has no next page
+	cubes, next, err := ListCubes(workspaceID, CubeFilter{Page: Page{Sort: "name", Limit: 5}})
+	if err != nil || len(cubes) != 5 || next != "" {
+		t.Errorf("full page = %v, %q, %v, want 5 cubes without a cursor", cubeNames(cubes), next, err)
+	}
+}
+
+func TestListCubesPagesOfNames(t *testing.T) {
+	// The status filter of the API lists the cubes by name, the cursor pages through those only
+	workspaceID := newPagedCubes(t, "pages-by-status", "status-a", "status-b", "status-c", "status-d", "status-e")
+	names := []string{"status-e", "status-a", "status-d", "status-b"}
+	for _, test := range []struct {
+		sort string
+		want [][]string
+	}{
+		{"name", [][]string{{"status-a", "status-b"}, {"status-d", "status-e"}}},
+		{"-created_at", [][]string{{"status-e", "status-d"}, {"status-b", "status-a"}}},
+	} {
+		pages := allPages(t, 2, func(cursor string) ([]string, string, error) {
+			cubes, next, err := ListCubes(workspaceID, CubeFilter{Names: names, Page: Page{Sort: test.sort, Limit: 2, Cursor: cursor}})
+			return cubeNames(cubes), next, err
+		})
+		if !slices.EqualFunc(pages, test.want, slices.Equal) {
+			t.Errorf("pages of %v sorted by %q = %v, want %v", names, test.sort, pages, test.want)
+		}
+	}
+
+	// No matching name, such as no running container, is an empty list
+	if cubes, next, err := ListCubes(workspaceID, CubeFilter{Names: []string{}, Page: Page{Limit: 2}}); err != nil || len(cubes) != 0 || next != "" {
+		t.Errorf("cubes of no names = %v, %q, %v, want none", cubeNames(cubes), next, err)
+	}
+}
+
+func TestListCubesRejectsCursors(t *testing.T) {
+	workspaceID := newPagedCubes(t, "pages-cursors", "cursor-a", "cursor-b", "cursor-c")
+	_, byName, err := ListCubes(workspaceID, CubeFilter{Page: Page{Sort: "name", Limit: 1}})
+	if err != nil || byName == "" {
+		t.Fatalf("first page = %q, %v, want a cursor", byName, err)
+	}
+
+	for _, test := range []struct {
+		name   string
+		sort   string
+		cursor string
+	}{
+		{"not base64", "name", "not a cursor!"},
+		{"not JSON", "name", base64.RawURLEncoding.EncodeToString([]byte("cursor"))},
+		{"descending sort", "-name", byName},
+		{"other column", "created_at", byName},
+		{"default sort", "", byName},
+	} {
+		if _, _, err := ListCubes(workspaceID, CubeFilter{Page: Page{Sort: test.sort, Limit: 1, Cursor: test.cursor}}); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("%s: ListCubes = %v, want ErrInvalidCursor", test.name, err)
+		}
+	}
+	if _, _, err := ListCubes(workspaceID, CubeFilter{Page: Page{Sort: "image"}}); err == nil || errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("unsupported sort = %v, want an error", err)
+	}
+}
+
+func TestGetWorkspacesPages(t *testing.T) {
+	var ids []int
+	for _, name := range []string{"pages-ws-b", "pages-ws-c", "pages-ws-a"} {
+		ids = append(ids, newWorkspace(t, name))
+	}
+	for _, test := range []struct {
+		sort string
+		want [][]string
+	}{
+		{"", [][]string{{"pages-ws-b", "pages-ws-c"}, {"pages-ws-a"}}},
+		{"name", [][]string{{"pages-ws-a", "pages-ws-b"}, {"pages-ws-c"}}},
+		{"-name", [][]string{{"pages-ws-c", "pages-ws-b"}, {"pages-ws-a"}}},
+	} {
+		pages := allPages(t, 2, func(cursor string) ([]string, string, error) {
+			workspaces, next, err := GetWorkspaces(WorkspaceFilter{IDs: ids, Page: Page{Sort: test.sort, Limit: 2, Cursor: cursor}})
+			names := make([]string, len(workspaces))
+			for i, workspace := range workspaces {
+				names[i] = workspace.Name
+			}
+			return names, next, err
+		})
+		if !slices.EqualFunc(pages, test.want, slices.Equal) {
+			t.Errorf("pages sorted by %q = %v, want %v", test.sort, pages, test.want)
+		}
+	}
+
+	_, next, err := GetWorkspaces(WorkspaceFilter{IDs: ids, Page: Page{Sort: "name", Limit: 1}})
+	if err != nil || next == "" {
+		t.Fatalf("first page = %q, %v, want a cursor", next, err)
+	}
+	if _, _, err := GetWorkspaces(WorkspaceFilter{IDs: ids, Page: Page{Sort: "-created_at", Limit: 1, Cursor: next}}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("cursor of another sort = %v, want ErrInvalidCursor", err)
+	}
+}
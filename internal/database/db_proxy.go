@@ -3,19 +3,11 @@ package database
 import (
 	"database/sql"
 	"fmt"
-)
 
-type Proxy struct {
-	ID        int    `json:"id"`
-	CubeID    int    `json:"cube_id"`
-	Domain    string `json:"domain"`
-	Port      int    `json:"port"`
-	Type      string `json:"type"`
-	Default   bool   `json:"default"`
-	CreatedAt string `json:"created_at"`
-}
+	"github.com/turplespace/portos/pkg/models"
+)
 
-func GetProxyByID(id int) (*Proxy, error) {
+func GetProxyByID(id int) (*models.Proxy, error) {
 	db_path, _ := GetPath()
 	db, err := sql.Open("sqlite3", db_path)
 	if err != nil {
@@ -25,7 +17,7 @@ func GetProxyByID(id int) (*Proxy, error) {
 	query := `SELECT id, cube_id, domain, port, type, "default", created_at FROM proxy WHERE id = ?`
 	row := db.QueryRow(query, id)
 
-	var proxy Proxy
+	var proxy models.Proxy
 	err = row.Scan(&proxy.ID, &proxy.CubeID, &proxy.Domain, &proxy.Port, &proxy.Type, &proxy.Default, &proxy.CreatedAt)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get proxy by id: %v", err)
@@ -34,7 +26,7 @@ func GetProxyByID(id int) (*Proxy, error) {
 	return &proxy, nil
 }
 
-func GetProxiesByCubeID(cubeID int) ([]Proxy, error) {
+func GetProxiesByCubeID(cubeID int) ([]models.Proxy, error) {
 	db_path, _ := GetPath()
 	db, err := sql.Open("sqlite3", db_path)
 	if err != nil {
@@ -48,9 +40,9 @@ func GetProxiesByCubeID(cubeID int) ([]Proxy, error) {
 	}
 	defer rows.Close()
 
-	var proxies []Proxy
+	var proxies []models.Proxy
 	for rows.Next() {
-		var proxy Proxy
+		var proxy models.Proxy
 		err := rows.Scan(&proxy.ID, &proxy.CubeID, &proxy.Domain, &proxy.Port, &proxy.Type, &proxy.Default, &proxy.CreatedAt)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan proxy: %v", err)
@@ -61,6 +53,33 @@ func GetProxiesByCubeID(cubeID int) ([]Proxy, error) {
 	return proxies, nil
 }
 
+// ListProxies returns every proxy of every workspace
+func ListProxies() ([]models.Proxy, error) {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+	query := `SELECT id, cube_id, domain, port, type, "default", created_at FROM proxy ORDER BY id`
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list proxies: %v", err)
+	}
+	defer rows.Close()
+
+	proxies := []models.Proxy{}
+	for rows.Next() {
+		var proxy models.Proxy
+		err := rows.Scan(&proxy.ID, &proxy.CubeID, &proxy.Domain, &proxy.Port, &proxy.Type, &proxy.Default, &proxy.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan proxy: %v", err)
+		}
+		proxies = append(proxies, proxy)
+	}
+	return proxies, rows.Err()
+}
+
 func AddProxy(cubeID int, domain string, port int, proxyType string, isDefault bool) (int64, error) {
 	db_path, _ := GetPath()
 	db, err := sql.Open("sqlite3", db_path)
@@ -148,3 +167,43 @@ func GetProxyIDByDomain(domain string) (int, error) {
 
 	return id, nil
 }
+
+// GetWorkspaceIDByProxyID returns the ID of the workspace owning the cube a proxy points to
+func GetWorkspaceIDByProxyID(proxyID int) (int, error) {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	query := `SELECT c.workspace_id FROM proxy p JOIN container c ON c.id = p.cube_id WHERE p.id = ?`
+	var workspaceID int
+	err = db.QueryRow(query, proxyID).Scan(&workspaceID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, fmt.Errorf("proxy with ID %d not found", proxyID)
+		}
+		return 0, fmt.Errorf("failed to query proxy workspace: %v", err)
+	}
+
+	return workspaceID, nil
+}
+
+// CountProxiesByWorkspaceID counts the proxies pointing to the cubes of a workspace
+func CountProxiesByWorkspaceID(workspaceID int) (int, error) {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	query := `SELECT COUNT(*) FROM proxy p JOIN container c ON c.id = p.cube_id WHERE c.workspace_id = ?`
+	var count int
+	if err := db.QueryRow(query, workspaceID).Scan(&count); err != nil {
+		return 0, fmt.Errorf("failed to count proxies: %v", err)
+	}
+
+	return count, nil
+}
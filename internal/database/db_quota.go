@@ -0,0 +1,66 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/turplespace/portos/pkg/models"
+)
+
+// SetWorkspaceQuota creates or replaces the quota of a workspace
+func SetWorkspaceQuota(workspaceID int, quota models.WorkspaceQuota) error {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	query := `INSERT OR REPLACE INTO workspace_quota (workspace_id, max_cubes, cpus, memory, max_ports, max_proxies)
+              VALUES (?, ?, ?, ?, ?, ?)`
+	_, err = db.Exec(query, workspaceID, quota.MaxCubes, quota.CPUs, quota.Memory, quota.MaxPorts, quota.MaxProxies)
+	if err != nil {
+		return fmt.Errorf("failed to set workspace quota: %v", err)
+	}
+
+	return nil
+}
+
+// GetWorkspaceQuota returns the quota of a workspace, or nil when it has none
+func GetWorkspaceQuota(workspaceID int) (*models.WorkspaceQuota, error) {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	var quota models.WorkspaceQuota
+	query := `SELECT max_cubes, cpus, memory, max_ports, max_proxies FROM workspace_quota WHERE workspace_id = ?`
+	err = db.QueryRow(query, workspaceID).Scan(&quota.MaxCubes, &quota.CPUs, &quota.Memory, &quota.MaxPorts, &quota.MaxProxies)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to query workspace quota: %v", err)
+	}
+
+	return &quota, nil
+}
+
+// DeleteWorkspaceQuota removes the quota of a workspace
+func DeleteWorkspaceQuota(workspaceID int) error {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`DELETE FROM workspace_quota WHERE workspace_id = ?`, workspaceID)
+	if err != nil {
+		return fmt.Errorf("failed to delete workspace quota: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/turplespace/portos/pkg/models"
+)
+
+// Notes of the cube revisions, telling what stored them
+const (
+	RevisionCreate  = "create"
+	RevisionEdit    = "edit"
+	RevisionApply   = "apply"
+	RevisionInitial = "initial"
+)
+
+// querier is a *sql.DB or a *sql.Tx, so that a revision is stored with the change it records
+type querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// addCubeRevision stores the spec of a cube as its next revision and returns its number
+func addCubeRevision(db querier, cubeID int, cube models.Container, author string, note string) (int, error) {
+	cube.ID = 0
+	spec, err := json.Marshal(cube)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode cube revision: %v", err)
+	}
+
+	var revision int
+	err = db.QueryRow(`SELECT COALESCE(MAX(revision), 0) + 1 FROM cube_revision WHERE cube_id = ?`, cubeID).Scan(&revision)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query cube revision: %v", err)
+	}
+	_, err = db.Exec(`INSERT INTO cube_revision (cube_id, revision, spec, author, note) VALUES (?, ?, ?, ?, ?)`, cubeID, revision, string(spec), author, note)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert cube revision: %v", err)
+	}
+	return revision, nil
+}
+
+// addInitialCubeRevisions stores the current spec of the cubes without a revision as their first revision
+func addInitialCubeRevisions(db *sql.DB) error {
+	rows, err := db.Query(`SELECT id FROM container WHERE id NOT IN (SELECT cube_id FROM cube_revision)`)
+	if err != nil {
+		return fmt.Errorf("failed to query cubes without revision: %v", err)
+	}
+	var cubeIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan cube: %v", err)
+		}
+		cubeIDs = append(cubeIDs, id)
+	}
+	rows.Close()
+
+	for _, id := range cubeIDs {
+		cube, err := GetCubeData(id)
+		if err != nil {
+			return err
+		}
+		if _, err := addCubeRevision(db, id, *cube, "system", RevisionInitial); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListCubeRevisions returns the revisions of a cube, newest first
+func ListCubeRevisions(cubeID int) ([]models.CubeRevision, error) {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT cube_id, revision, spec, author, note, created_at FROM cube_revision WHERE cube_id = ? ORDER BY revision DESC`, cubeID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query cube revisions: %v", err)
+	}
+	defer rows.Close()
+
+	revisions := []models.CubeRevision{}
+	for rows.Next() {
+		revision, err := scanCubeRevision(rows)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, *revision)
+	}
+	return revisions, rows.Err()
+}
+
+// GetCubeRevision fetches a revision of a cube, a missing revision wraps ErrNotFound
+func GetCubeRevision(cubeID int, revision int) (*models.CubeRevision, error) {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	row := db.QueryRow(`SELECT cube_id, revision, spec, author, note, created_at FROM cube_revision WHERE cube_id = ? AND revision = ?`, cubeID, revision)
+	stored, err := scanCubeRevision(row)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("revision %d of cube %d %w", revision, cubeID, ErrNotFound)
+	}
+	return stored, err
+}
+
+func scanCubeRevision(row interface{ Scan(...interface{}) error }) (*models.CubeRevision, error) {
+	var revision models.CubeRevision
+	var spec string
+	err := row.Scan(&revision.CubeID, &revision.Revision, &spec, &revision.Author, &revision.Note, &revision.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan cube revision: %v", err)
+	}
+	if err := json.Unmarshal([]byte(spec), &revision.Spec); err != nil {
+		return nil, fmt.Errorf("failed to decode revision %d of cube %d: %v", revision.Revision, revision.CubeID, err)
+	}
+	revision.Spec.ID = revision.CubeID
+	return &revision, nil
+}
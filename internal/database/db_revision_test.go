@@ -0,0 +1,39 @@
+package database
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/turplespace/portos/pkg/models"
+)
+
+func TestCubeRevisions(t *testing.T) {
+	workspaceID := newWorkspace(t, "revisions")
+	id, err := InsertWorkspaceAndCubes(workspaceID, models.Container{Name: "revision-web", Image: "nginx:1.26", Ports: []string{"8081:80"}}, "alice")
+	if err != nil {
+		t.Fatalf("insert cube: %v", err)
+	}
+	cubeID := int(id)
+	for i, image := range []string{"nginx:1.27", "nginx:broken"} {
+		revision, err := UpdateCube(cubeID, models.Container{Name: "revision-web", Image: image}, "bob", RevisionEdit)
+		if err != nil || revision != i+2 {
+			t.Fatalf("edit cube = %d, %v, want revision %d", revision, err, i+2)
+		}
+	}
+
+	revisions, err := ListCubeRevisions(cubeID)
+	if err != nil {
+		t.Fatalf("list revisions: %v", err)
+	}
+	if len(revisions) != 3 || revisions[0].Revision != 3 || revisions[0].Author != "bob" || revisions[2].Author != "alice" || revisions[2].Note != RevisionCreate {
+		t.Fatalf("revisions = %+v, want 3 revisions, newest first", revisions)
+	}
+
+	first, err := GetCubeRevision(cubeID, 1)
+	if err != nil || first.Spec.Image != "nginx:1.26" || len(first.Spec.Ports) != 1 {
+		t.Errorf("revision 1 = %+v, %v, want the created spec", first, err)
+	}
+	if _, err := GetCubeRevision(cubeID, 9); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing revision = %v, want ErrNotFound", err)
+	}
+}
@@ -0,0 +1,131 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Secret is a named value of a workspace, only the encrypted value is stored
+type Secret struct {
+	ID          int        `json:"id"`
+	WorkspaceID int        `json:"workspace_id"`
+	Name        string     `json:"name"`
+	Ciphertext  []byte     `json:"-"`
+	Version     int        `json:"version"`
+	CreatedAt   *time.Time `json:"created_at"`
+	UpdatedAt   *time.Time `json:"updated_at"`
+}
+
+// SetSecret stores the encrypted value of a secret, replacing an existing value bumps its version.
+// It returns the version of the stored value.
+func SetSecret(workspaceID int, name string, ciphertext []byte) (int, error) {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	query := `INSERT INTO secret (workspace_id, name, ciphertext) VALUES (?, ?, ?)
+              ON CONFLICT(workspace_id, name) DO UPDATE SET ciphertext = excluded.ciphertext,
+              version = version + 1, updated_at = CURRENT_TIMESTAMP`
+	_, err = db.Exec(query, workspaceID, name, ciphertext)
+	if err != nil {
+		return 0, fmt.Errorf("failed to set secret: %v", err)
+	}
+
+	var version int
+	err = db.QueryRow(`SELECT version FROM secret WHERE workspace_id = ? AND name = ?`, workspaceID, name).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query secret version: %v", err)
+	}
+
+	return version, nil
+}
+
+// GetSecret fetches a secret of a workspace by its name
+func GetSecret(workspaceID int, name string) (*Secret, error) {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	var secret Secret
+	err = db.QueryRow(`SELECT id, workspace_id, name, ciphertext, version, created_at, updated_at FROM secret WHERE workspace_id = ? AND name = ?`, workspaceID, name).
+		Scan(&secret.ID, &secret.WorkspaceID, &secret.Name, &secret.Ciphertext, &secret.Version, &secret.CreatedAt, &secret.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("secret %s not found", name)
+		}
+		return nil, fmt.Errorf("failed to query secret: %v", err)
+	}
+
+	return &secret, nil
+}
+
+// ListSecrets returns the secrets of a workspace, without their values
+func ListSecrets(workspaceID int) ([]Secret, error) {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT id, workspace_id, name, version, created_at, updated_at FROM secret WHERE workspace_id = ? ORDER BY name`, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query secrets: %v", err)
+	}
+	defer rows.Close()
+
+	secrets := []Secret{}
+	for rows.Next() {
+		var secret Secret
+		if err := rows.Scan(&secret.ID, &secret.WorkspaceID, &secret.Name, &secret.Version, &secret.CreatedAt, &secret.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan secret: %v", err)
+		}
+		secrets = append(secrets, secret)
+	}
+
+	return secrets, nil
+}
+
+// DeleteSecret deletes a secret of a workspace by its name
+func DeleteSecret(workspaceID int, name string) error {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`DELETE FROM secret WHERE workspace_id = ? AND name = ?`, workspaceID, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete secret: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("secret %s not found", name)
+	}
+
+	return nil
+}
+
+// DeleteWorkspaceSecrets deletes every secret of a workspace
+func DeleteWorkspaceSecrets(workspaceID int) error {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`DELETE FROM secret WHERE workspace_id = ?`, workspaceID)
+	if err != nil {
+		return fmt.Errorf("failed to delete workspace secrets: %v", err)
+	}
+
+	return nil
+}
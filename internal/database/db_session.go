@@ -0,0 +1,100 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// CreateSession stores the hash of a session token for the given user
+func CreateSession(userID int, tokenHash string, expiresAt time.Time) error {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`INSERT INTO session (user_id, token_hash, expires_at) VALUES (?, ?, ?)`, userID, tokenHash, expiresAt.UTC())
+	if err != nil {
+		return fmt.Errorf("failed to create session: %v", err)
+	}
+
+	return nil
+}
+
+// GetSessionUser returns the user owning a session that has not expired yet
+func GetSessionUser(tokenHash string) (*User, error) {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	query := `SELECT u.id, u.username, u.password_hash, u.is_admin, u.auth_source, u.totp_secret, u.totp_enabled, u.totp_last_step, u.created_at
+              FROM session s JOIN user u ON u.id = s.user_id
+              WHERE s.token_hash = ? AND s.expires_at > ?`
+
+	var user User
+	err = db.QueryRow(query, tokenHash, time.Now().UTC()).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.IsAdmin, &user.AuthSource, &user.TOTPSecret, &user.TOTPEnabled, &user.TOTPLastStep, &user.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("session not found or expired")
+		}
+		return nil, fmt.Errorf("failed to query session: %v", err)
+	}
+
+	return &user, nil
+}
+
+// DeleteSession deletes a session by its token hash
+func DeleteSession(tokenHash string) error {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`DELETE FROM session WHERE token_hash = ?`, tokenHash)
+	if err != nil {
+		return fmt.Errorf("failed to delete session: %v", err)
+	}
+
+	return nil
+}
+
+// DeleteUserSessions deletes every session of a user, e.g. after a password change
+func DeleteUserSessions(userID int) error {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`DELETE FROM session WHERE user_id = ?`, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete user sessions: %v", err)
+	}
+
+	return nil
+}
+
+// DeleteExpiredSessions removes the sessions whose expiry is in the past
+func DeleteExpiredSessions() error {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`DELETE FROM session WHERE expires_at <= ?`, time.Now().UTC())
+	if err != nil {
+		return fmt.Errorf("failed to delete expired sessions: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,189 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/turplespace/portos/pkg/models"
+)
+
+// SpecProxy is a proxy stored by a workspace spec, its cube is given by name as new cubes have no ID yet
+type SpecProxy struct {
+	ID       int // Set for updates
+	CubeName string
+	Domain   string
+	Port     int
+	Type     string
+	Default  bool
+}
+
+// SpecChanges are the stored changes of a workspace spec, see ApplySpecChanges
+type SpecChanges struct {
+	WorkspaceID     int // 0 creates the workspace
+	Name            string
+	Desc            string
+	CreateCubes     []models.Container
+	UpdateCubes     []models.Container // Matched by ID
+	DeleteCubes     []int
+	CreateProxies   []SpecProxy
+	UpdateProxies   []SpecProxy // Matched by ID
+	DeleteProxies   []int
+	SetVariables    map[string]string
+	DeleteVariables []string
+	SetNetworks     []WorkspaceNetwork
+	DeleteNetworks  []string
+	Author          string // Author of the cube revisions stored by the changes
+}
+
+/*
+ApplySpecChanges stores the changes of a workspace spec in a single transaction, so a failure
+leaves the workspace as it was. It returns the ID of the workspace.
+*/
+func ApplySpecChanges(changes SpecChanges) (int, error) {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	workspaceID := changes.WorkspaceID
+	if workspaceID == 0 {
+		result, err := tx.Exec(`INSERT INTO workspace (name, desc) VALUES (?, ?)`, changes.Name, changes.Desc)
+		if err != nil {
+			return 0, fmt.Errorf("failed to create workspace: %v", err)
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return 0, fmt.Errorf("failed to retrieve last insert id: %v", err)
+		}
+		workspaceID = int(id)
+	} else if _, err := tx.Exec(`UPDATE workspace SET desc = ? WHERE id = ?`, changes.Desc, workspaceID); err != nil {
+		return 0, fmt.Errorf("failed to update workspace: %v", err)
+	}
+
+	// Proxies go first so that a domain can move to a cube created below
+	for _, id := range changes.DeleteProxies {
+		if _, err := tx.Exec(`DELETE FROM proxy WHERE id = ?`, id); err != nil {
+			return 0, fmt.Errorf("failed to delete proxy: %v", err)
+		}
+	}
+	for _, id := range changes.DeleteCubes {
+		if _, err := tx.Exec(`DELETE FROM proxy WHERE cube_id = ?`, id); err != nil {
+			return 0, fmt.Errorf("failed to delete proxies of cube: %v", err)
+		}
+		if _, err := tx.Exec(`DELETE FROM container WHERE id = ? AND workspace_id = ?`, id, workspaceID); err != nil {
+			return 0, fmt.Errorf("failed to delete cube: %v", err)
+		}
+		if _, err := tx.Exec(`DELETE FROM cube_revision WHERE cube_id = ?`, id); err != nil {
+			return 0, fmt.Errorf("failed to delete cube revisions: %v", err)
+		}
+	}
+
+	for _, cube := range changes.UpdateCubes {
+		_, err := tx.Exec(`UPDATE container SET name = ?, image = ?, ports = ?, environment_vars = ?, cpus = ?, memory = ?, volumes = ?, labels = ?, networks = ?, depends_on = ?, replicas = ?, load_balancing = ? WHERE id = ? AND workspace_id = ?`,
+			cube.Name, cube.Image, strings.Join(cube.Ports, ","), strings.Join(cube.EnvironmentVars, ","),
+			cube.ResourceLimits.CPUs, cube.ResourceLimits.Memory, mapToString(cube.Volumes), strings.Join(cube.Labels, ","), strings.Join(cube.Networks, ","),
+			strings.Join(cube.DependsOn, ","), cube.Replicas, cube.LoadBalancing, cube.ID, workspaceID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to update cube %s: %v", cube.Name, err)
+		}
+		if err := checkContainerNames(tx, cube, `id != ?`, cube.ID); err != nil {
+			return 0, err
+		}
+		if _, err := addCubeRevision(tx, cube.ID, cube, changes.Author, RevisionApply); err != nil {
+			return 0, err
+		}
+	}
+	for _, cube := range changes.CreateCubes {
+		result, err := tx.Exec(`INSERT INTO container (workspace_id, name, image, ports, environment_vars, cpus, memory, volumes, labels, networks, depends_on, replicas, load_balancing, created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`,
+			workspaceID, cube.Name, cube.Image, strings.Join(cube.Ports, ","), strings.Join(cube.EnvironmentVars, ","),
+			cube.ResourceLimits.CPUs, cube.ResourceLimits.Memory, mapToString(cube.Volumes), strings.Join(cube.Labels, ","), strings.Join(cube.Networks, ","), strings.Join(cube.DependsOn, ","), cube.Replicas, cube.LoadBalancing)
+		if err != nil {
+			return 0, fmt.Errorf("failed to create cube %s: %v", cube.Name, err)
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return 0, fmt.Errorf("failed to retrieve last insert id: %v", err)
+		}
+		if err := checkContainerNames(tx, cube, `id != ?`, id); err != nil {
+			return 0, err
+		}
+		if _, err := addCubeRevision(tx, int(id), cube, changes.Author, RevisionApply); err != nil {
+			return 0, err
+		}
+	}
+	if _, err := tx.Exec(`UPDATE workspace SET total_containers = (SELECT COUNT(*) FROM container WHERE workspace_id = ?) WHERE id = ?`, workspaceID, workspaceID); err != nil {
+		return 0, fmt.Errorf("failed to count cubes: %v", err)
+	}
+
+	// Proxies reference their cube by name as created cubes only get their ID now
+	cubeIDs := make(map[string]int)
+	rows, err := tx.Query(`SELECT id, name FROM container WHERE workspace_id = ?`, workspaceID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query cubes: %v", err)
+	}
+	for rows.Next() {
+		var id int
+		var name string
+		if err := rows.Scan(&id, &name); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to scan cube: %v", err)
+		}
+		cubeIDs[name] = id
+	}
+	rows.Close()
+
+	for _, proxy := range changes.UpdateProxies {
+		_, err := tx.Exec(`UPDATE proxy SET cube_id = ?, domain = ?, port = ?, type = ?, "default" = ? WHERE id = ?`,
+			cubeIDs[proxy.CubeName], proxy.Domain, proxy.Port, proxy.Type, proxy.Default, proxy.ID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to update proxy %s: %v", proxy.Domain, err)
+		}
+	}
+	for _, proxy := range changes.CreateProxies {
+		_, err := tx.Exec(`INSERT INTO proxy (cube_id, domain, port, type, "default", created_at) VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)`,
+			cubeIDs[proxy.CubeName], proxy.Domain, proxy.Port, proxy.Type, proxy.Default)
+		if err != nil {
+			return 0, fmt.Errorf("failed to create proxy %s: %v", proxy.Domain, err)
+		}
+	}
+
+	for name, value := range changes.SetVariables {
+		_, err := tx.Exec(`INSERT INTO workspace_variable (workspace_id, name, value) VALUES (?, ?, ?)
+              ON CONFLICT(workspace_id, name) DO UPDATE SET value = excluded.value, updated_at = CURRENT_TIMESTAMP`, workspaceID, name, value)
+		if err != nil {
+			return 0, fmt.Errorf("failed to set variable %s: %v", name, err)
+		}
+	}
+	for _, name := range changes.DeleteVariables {
+		if _, err := tx.Exec(`DELETE FROM workspace_variable WHERE workspace_id = ? AND name = ?`, workspaceID, name); err != nil {
+			return 0, fmt.Errorf("failed to delete variable %s: %v", name, err)
+		}
+	}
+
+	for _, network := range changes.SetNetworks {
+		_, err := tx.Exec(`INSERT INTO workspace_network (workspace_id, name, driver) VALUES (?, ?, ?)
+              ON CONFLICT(workspace_id, name) DO UPDATE SET driver = excluded.driver`, workspaceID, network.Name, network.Driver)
+		if err != nil {
+			return 0, fmt.Errorf("failed to set network %s: %v", network.Name, err)
+		}
+	}
+	for _, name := range changes.DeleteNetworks {
+		if _, err := tx.Exec(`DELETE FROM workspace_network WHERE workspace_id = ? AND name = ?`, workspaceID, name); err != nil {
+			return 0, fmt.Errorf("failed to delete network %s: %v", name, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit transaction: %v", err)
+	}
+	return workspaceID, nil
+}
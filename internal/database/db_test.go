@@ -0,0 +1,30 @@
+package database
+
+import (
+	"log"
+	"os"
+	"testing"
+)
+
+// TestMain runs the tests against a fresh database next to the test binary
+func TestMain(m *testing.M) {
+	path, err := GetPath()
+	if err != nil {
+		log.Fatal(err)
+	}
+	os.Remove(path)
+	Init()
+
+	code := m.Run()
+	os.Remove(path)
+	os.Exit(code)
+}
+
+func newWorkspace(t *testing.T, name string) int {
+	t.Helper()
+	id, err := CreateWorkspace(name, "created by "+t.Name())
+	if err != nil {
+		t.Fatalf("create workspace %s: %v", name, err)
+	}
+	return int(id)
+}
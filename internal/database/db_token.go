@@ -0,0 +1,199 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type APIToken struct {
+	ID           int        `json:"id"`
+	UserID       int        `json:"user_id"`
+	Name         string     `json:"name"`
+	Kind         string     `json:"kind"`
+	TokenHash    string     `json:"-"`
+	Prefix       string     `json:"prefix"`
+	Scopes       []string   `json:"scopes"`
+	WorkspaceIDs []int      `json:"workspace_ids"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+	RevokedAt    *time.Time `json:"revoked_at"`
+	CreatedAt    *time.Time `json:"created_at"`
+}
+
+const apiTokenColumns = `id, user_id, name, kind, token_hash, prefix, scopes, workspace_ids, expires_at, last_used_at, revoked_at, created_at`
+
+// CreateAPIToken stores a new API token, only the hash of the secret is kept
+func CreateAPIToken(token APIToken) (int64, error) {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	query := `INSERT INTO api_token (user_id, name, kind, token_hash, prefix, scopes, workspace_ids, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := db.Exec(query, token.UserID, token.Name, token.Kind, token.TokenHash, token.Prefix,
+		strings.Join(token.Scopes, ","), joinInts(token.WorkspaceIDs), token.ExpiresAt)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create api token: %v", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve last insert id: %v", err)
+	}
+
+	return id, nil
+}
+
+// GetAPITokenByHash fetches a token by the hash of its secret
+func GetAPITokenByHash(tokenHash string) (*APIToken, error) {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	row := db.QueryRow(`SELECT `+apiTokenColumns+` FROM api_token WHERE token_hash = ?`, tokenHash)
+	token, err := scanAPIToken(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("api token not found")
+		}
+		return nil, fmt.Errorf("failed to query api token: %v", err)
+	}
+
+	return token, nil
+}
+
+// GetAPITokenByID fetches a token by its ID
+func GetAPITokenByID(id int) (*APIToken, error) {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	row := db.QueryRow(`SELECT `+apiTokenColumns+` FROM api_token WHERE id = ?`, id)
+	token, err := scanAPIToken(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("api token with ID %d not found", id)
+		}
+		return nil, fmt.Errorf("failed to query api token: %v", err)
+	}
+
+	return token, nil
+}
+
+// ListAPITokens lists the tokens created by a user, or every token when userID is 0
+func ListAPITokens(userID int) ([]APIToken, error) {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	query := `SELECT ` + apiTokenColumns + ` FROM api_token`
+	var args []interface{}
+	if userID != 0 {
+		query += ` WHERE user_id = ?`
+		args = append(args, userID)
+	}
+	query += ` ORDER BY id`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query api tokens: %v", err)
+	}
+	defer rows.Close()
+
+	var tokens []APIToken
+	for rows.Next() {
+		token, err := scanAPIToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan api token: %v", err)
+		}
+		tokens = append(tokens, *token)
+	}
+
+	return tokens, nil
+}
+
+// RevokeAPIToken marks a token as revoked, revoked tokens are kept for reference
+func RevokeAPIToken(id int) error {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`UPDATE api_token SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`, time.Now().UTC(), id)
+	if err != nil {
+		return fmt.Errorf("failed to revoke api token: %v", err)
+	}
+
+	return nil
+}
+
+// TouchAPIToken records the time a token was last used
+func TouchAPIToken(id int) error {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`UPDATE api_token SET last_used_at = ? WHERE id = ?`, time.Now().UTC(), id)
+	if err != nil {
+		return fmt.Errorf("failed to update api token usage: %v", err)
+	}
+
+	return nil
+}
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAPIToken(row rowScanner) (*APIToken, error) {
+	var token APIToken
+	var scopes, workspaceIDs sql.NullString
+	err := row.Scan(&token.ID, &token.UserID, &token.Name, &token.Kind, &token.TokenHash, &token.Prefix,
+		&scopes, &workspaceIDs, &token.ExpiresAt, &token.LastUsedAt, &token.RevokedAt, &token.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	token.Scopes = splitString(scopes.String)
+	token.WorkspaceIDs = splitInts(workspaceIDs.String)
+	return &token, nil
+}
+
+// Helper function to join ints by comma
+func joinInts(values []int) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.Itoa(v)
+	}
+	return strings.Join(parts, ",")
+}
+
+// Helper function to split a comma separated list of ints, invalid items are skipped
+func splitInts(s string) []int {
+	var values []int
+	for _, part := range splitString(s) {
+		if v, err := strconv.Atoi(part); err == nil {
+			values = append(values, v)
+		}
+	}
+	return values
+}
@@ -0,0 +1,335 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type User struct {
+	ID           int        `json:"id"`
+	Username     string     `json:"username"`
+	PasswordHash string     `json:"-"`
+	IsAdmin      bool       `json:"is_admin"`
+	AuthSource   string     `json:"auth_source"` // local for password accounts, oidc for single sign-on accounts
+	TOTPSecret   string     `json:"-"`
+	TOTPEnabled  bool       `json:"totp_enabled"`
+	TOTPLastStep int64      `json:"-"` // Last TOTP time step used to log in, codes are single use
+	CreatedAt    *time.Time `json:"created_at"`
+}
+
+// CreateUser inserts a new local user with an already hashed password
+func CreateUser(username string, passwordHash string, isAdmin bool) (int64, error) {
+	return createUser(username, passwordHash, isAdmin, "local", "", "")
+}
+
+// CreateOIDCUser inserts a user provisioned by single sign-on for the subject of an issuer, it has no password
+func CreateOIDCUser(username string, issuer string, subject string, isAdmin bool) (int64, error) {
+	return createUser(username, "", isAdmin, "oidc", issuer, subject)
+}
+
+func createUser(username string, passwordHash string, isAdmin bool, authSource string, issuer string, subject string) (int64, error) {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`INSERT INTO user (username, password_hash, is_admin, auth_source, oidc_issuer, oidc_subject) VALUES (?, ?, ?, ?, ?, ?)`, username, passwordHash, isAdmin, authSource, issuer, subject)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create user: %v", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to retrieve last insert id: %v", err)
+	}
+
+	return id, nil
+}
+
+// GetUserByID fetches a user by its ID
+func GetUserByID(id int) (*User, error) {
+	return getUser(`SELECT id, username, password_hash, is_admin, auth_source, totp_secret, totp_enabled, totp_last_step, created_at FROM user WHERE id = ?`, id)
+}
+
+// GetUserByUsername fetches a user by its username
+func GetUserByUsername(username string) (*User, error) {
+	return getUser(`SELECT id, username, password_hash, is_admin, auth_source, totp_secret, totp_enabled, totp_last_step, created_at FROM user WHERE username = ?`, username)
+}
+
+// GetUserByOIDCIdentity fetches the single sign-on user of the subject of an issuer
+func GetUserByOIDCIdentity(issuer string, subject string) (*User, error) {
+	return getUser(`SELECT id, username, password_hash, is_admin, auth_source, totp_secret, totp_enabled, totp_last_step, created_at FROM user WHERE auth_source = 'oidc' AND oidc_issuer = ? AND oidc_subject = ?`, issuer, subject)
+}
+
+// GetUnlinkedOIDCUser fetches a single sign-on user by its username, when it was provisioned before
+// identities were stored and has none
+func GetUnlinkedOIDCUser(username string) (*User, error) {
+	return getUser(`SELECT id, username, password_hash, is_admin, auth_source, totp_secret, totp_enabled, totp_last_step, created_at FROM user WHERE auth_source = 'oidc' AND oidc_subject = '' AND username = ?`, username)
+}
+
+func getUser(query string, args ...interface{}) (*User, error) {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	var user User
+	err = db.QueryRow(query, args...).Scan(&user.ID, &user.Username, &user.PasswordHash, &user.IsAdmin, &user.AuthSource, &user.TOTPSecret, &user.TOTPEnabled, &user.TOTPLastStep, &user.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("user %w", ErrNotFound)
+		}
+		return nil, fmt.Errorf("failed to query user: %v", err)
+	}
+
+	return &user, nil
+}
+
+// ListUsers fetches all the users
+func ListUsers() ([]User, error) {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT id, username, password_hash, is_admin, auth_source, totp_secret, totp_enabled, totp_last_step, created_at FROM user ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query users: %v", err)
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var user User
+		err = rows.Scan(&user.ID, &user.Username, &user.PasswordHash, &user.IsAdmin, &user.AuthSource, &user.TOTPSecret, &user.TOTPEnabled, &user.TOTPLastStep, &user.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %v", err)
+		}
+		users = append(users, user)
+	}
+
+	return users, nil
+}
+
+// UpdateUserPassword replaces the password hash of a user
+func UpdateUserPassword(id int, passwordHash string) error {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`UPDATE user SET password_hash = ? WHERE id = ?`, passwordHash, id)
+	if err != nil {
+		return fmt.Errorf("failed to update user password: %v", err)
+	}
+
+	return nil
+}
+
+// SetUserOIDCIdentity links a single sign-on user to the subject of an issuer
+func SetUserOIDCIdentity(id int, issuer string, subject string) error {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`UPDATE user SET oidc_issuer = ?, oidc_subject = ? WHERE id = ?`, issuer, subject, id)
+	if err != nil {
+		return fmt.Errorf("failed to update user identity: %v", err)
+	}
+
+	return nil
+}
+
+// RenameUser replaces the username of a user
+func RenameUser(id int, username string) error {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`UPDATE user SET username = ? WHERE id = ?`, username, id)
+	if err != nil {
+		return fmt.Errorf("failed to rename user: %v", err)
+	}
+
+	return nil
+}
+
+// SetUserAdmin grants or removes the admin flag of a user
+func SetUserAdmin(id int, isAdmin bool) error {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`UPDATE user SET is_admin = ? WHERE id = ?`, isAdmin, id)
+	if err != nil {
+		return fmt.Errorf("failed to update user admin flag: %v", err)
+	}
+
+	return nil
+}
+
+// SetUserTOTP stores the TOTP secret of a user and whether second factor logins are enabled
+func SetUserTOTP(id int, secret string, enabled bool) error {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`UPDATE user SET totp_secret = ?, totp_enabled = ?, totp_last_step = 0, second_factor_failures = 0, second_factor_locked_until = 0 WHERE id = ?`, secret, enabled, id)
+	if err != nil {
+		return fmt.Errorf("failed to update user TOTP: %v", err)
+	}
+
+	return nil
+}
+
+// ClaimTOTPStep records a used TOTP time step. It fails when the step is not newer than the last
+// one, which rejects a code that was already used.
+func ClaimTOTPStep(id int, step int64) (bool, error) {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return false, fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`UPDATE user SET totp_last_step = ? WHERE id = ? AND totp_last_step < ?`, step, id, step)
+	if err != nil {
+		return false, fmt.Errorf("failed to update TOTP step: %v", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to update TOTP step: %v", err)
+	}
+
+	return affected == 1, nil
+}
+
+/*
+ClaimSecondFactorAttempt counts a second factor check of a user as failed until it succeeds. It
+refuses the attempt while the checks of the user are locked, or when maxFailures attempts already
+failed or are still running, so that concurrent guesses cannot go past the limit.
+*/
+func ClaimSecondFactorAttempt(id int, maxFailures int, now time.Time) (bool, error) {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return false, fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`UPDATE user SET second_factor_failures = second_factor_failures + 1 WHERE id = ? AND second_factor_locked_until <= ? AND second_factor_failures < ?`, id, now.Unix(), maxFailures)
+	if err != nil {
+		return false, fmt.Errorf("failed to count second factor attempt: %v", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to count second factor attempt: %v", err)
+	}
+
+	return affected == 1, nil
+}
+
+// LockSecondFactor locks the second factor checks of a user until the given time once maxFailures
+// attempts failed, and starts counting again from zero
+func LockSecondFactor(id int, maxFailures int, until time.Time) error {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`UPDATE user SET second_factor_locked_until = ?, second_factor_failures = 0 WHERE id = ? AND second_factor_failures >= ?`, until.Unix(), id, maxFailures)
+	if err != nil {
+		return fmt.Errorf("failed to lock second factor: %v", err)
+	}
+
+	return nil
+}
+
+// ResetSecondFactorFailures forgets the failed second factor attempts of a user after a successful one
+func ResetSecondFactorFailures(id int) error {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`UPDATE user SET second_factor_failures = 0 WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to reset second factor failures: %v", err)
+	}
+
+	return nil
+}
+
+// DeleteUser deletes a user together with all of its sessions, recovery codes and workspace memberships
+func DeleteUser(id int) error {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`DELETE FROM session WHERE user_id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete user sessions: %v", err)
+	}
+
+	_, err = db.Exec(`DELETE FROM recovery_code WHERE user_id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete user recovery codes: %v", err)
+	}
+
+	_, err = db.Exec(`DELETE FROM workspace_member WHERE user_id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete user memberships: %v", err)
+	}
+
+	_, err = db.Exec(`DELETE FROM user WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %v", err)
+	}
+
+	return nil
+}
+
+// CountUsers counts the number of user accounts
+func CountUsers() (int, error) {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	var count int
+	err = db.QueryRow(`SELECT COUNT(*) FROM user`).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count users: %v", err)
+	}
+	return count, nil
+}
@@ -0,0 +1,97 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// WorkspaceVariable is an environment variable inherited by every cube of a workspace
+type WorkspaceVariable struct {
+	Name      string     `json:"name"`
+	Value     string     `json:"value"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+// SetWorkspaceVariable creates or updates a variable of a workspace
+func SetWorkspaceVariable(workspaceID int, name string, value string) error {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	query := `INSERT INTO workspace_variable (workspace_id, name, value) VALUES (?, ?, ?)
+              ON CONFLICT(workspace_id, name) DO UPDATE SET value = excluded.value, updated_at = CURRENT_TIMESTAMP`
+	_, err = db.Exec(query, workspaceID, name, value)
+	if err != nil {
+		return fmt.Errorf("failed to set workspace variable: %v", err)
+	}
+
+	return nil
+}
+
+// ListWorkspaceVariables returns the variables of a workspace ordered by name
+func ListWorkspaceVariables(workspaceID int) ([]WorkspaceVariable, error) {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`SELECT name, value, updated_at FROM workspace_variable WHERE workspace_id = ? ORDER BY name`, workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query workspace variables: %v", err)
+	}
+	defer rows.Close()
+
+	variables := []WorkspaceVariable{}
+	for rows.Next() {
+		var variable WorkspaceVariable
+		if err := rows.Scan(&variable.Name, &variable.Value, &variable.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan workspace variable: %v", err)
+		}
+		variables = append(variables, variable)
+	}
+
+	return variables, nil
+}
+
+// DeleteWorkspaceVariable deletes a variable of a workspace by its name
+func DeleteWorkspaceVariable(workspaceID int, name string) error {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	result, err := db.Exec(`DELETE FROM workspace_variable WHERE workspace_id = ? AND name = ?`, workspaceID, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete workspace variable: %v", err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return fmt.Errorf("variable %s not found", name)
+	}
+
+	return nil
+}
+
+// DeleteWorkspaceVariables deletes every variable of a workspace
+func DeleteWorkspaceVariables(workspaceID int) error {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(`DELETE FROM workspace_variable WHERE workspace_id = ?`, workspaceID)
+	if err != nil {
+		return fmt.Errorf("failed to delete workspace variables: %v", err)
+	}
+
+	return nil
+}
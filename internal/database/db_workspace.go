@@ -2,15 +2,19 @@ package database
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 
-	"github.com/turplespace/portos/internal/models"
+	"github.com/turplespace/portos/pkg/models"
 )
 
+// ErrNotFound is wrapped by the lookups that report a missing row as an error
+var ErrNotFound = errors.New("not found")
+
 type Workspace struct {
 	ID              int        `json:"id"`
 	Name            string     `json:"name"`
@@ -19,6 +23,13 @@ type Workspace struct {
 	CreatedAt       *time.Time `json:"created_at"`
 }
 
+// WorkspaceFilter narrows GetWorkspaces, zero values do not filter
+type WorkspaceFilter struct {
+	Search string // Substring of the name or description
+	IDs    []int  // Only these workspaces when not nil
+	Page
+}
+
 // CreateWorkspace to create a new workspace
 func CreateWorkspace(name string, desc string) (int64, error) {
 	db_path, _ := GetPath()
@@ -82,33 +93,61 @@ func DecContainerCount(workspaceName string, count int) error {
 	return nil
 }
 
-// GetWorkspaces to fetch all the workspaces
-func GetWorkspaces() ([]Workspace, error) {
+// GetWorkspaces to fetch a page of the workspaces matching the filter, with the cursor of the next page
+func GetWorkspaces(filter WorkspaceFilter) ([]Workspace, string, error) {
 	db_path, _ := GetPath()
 	db, err := sql.Open("sqlite3", db_path)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open database: %v", err)
+		return nil, "", fmt.Errorf("failed to open database: %v", err)
 	}
 	defer db.Close()
 
-	rows, err := db.Query("SELECT id, name, desc, total_containers, created_at FROM workspace")
+	var conditions []string
+	var args []interface{}
+	if filter.Search != "" {
+		conditions = append(conditions, `(name LIKE ? ESCAPE '\' OR desc LIKE ? ESCAPE '\')`)
+		pattern := "%" + escapeLike(filter.Search) + "%"
+		args = append(args, pattern, pattern)
+	}
+	if filter.IDs != nil {
+		condition, ids := inCondition("id", filter.IDs)
+		conditions = append(conditions, condition)
+		args = append(args, ids...)
+	}
+
+	query := "SELECT id, name, desc, total_containers, created_at, " + sortKey(filter.Sort) + " FROM workspace"
+	query, args, err = pageQuery(query, conditions, args, filter.Page)
+	if err != nil {
+		return nil, "", err
+	}
+
+	rows, err := db.Query(query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to query workspaces: %v", err)
+		return nil, "", fmt.Errorf("failed to query workspaces: %v", err)
 	}
 	defer rows.Close()
 
 	var workspaces []Workspace
+	var keys []string
 	// Iterate over the rows and scan the data into a Workspace struct
 	for rows.Next() {
 		var workspace Workspace
+		var key string
 
-		err = rows.Scan(&workspace.ID, &workspace.Name, &workspace.Desc, &workspace.TotalContainers, &workspace.CreatedAt)
+		err = rows.Scan(&workspace.ID, &workspace.Name, &workspace.Desc, &workspace.TotalContainers, &workspace.CreatedAt, &key)
 		if err != nil {
-			return nil, fmt.Errorf("failed to scan workspace: %v", err)
+			return nil, "", fmt.Errorf("failed to scan workspace: %v", err)
 		}
 		workspaces = append(workspaces, workspace)
+		keys = append(keys, key)
 	}
-	return workspaces, nil
+
+	next := ""
+	if filter.Limit > 0 && len(workspaces) > filter.Limit {
+		workspaces = workspaces[:filter.Limit]
+		next = nextCursor(filter.Sort, workspaces[filter.Limit-1].ID, keys[filter.Limit-1])
+	}
+	return workspaces, next, nil
 }
 
 // DeleteWorkspace to delete a workspace
@@ -156,7 +195,7 @@ func ListContainersInWorkspace(workspaceID int) ([]models.Container, error) {
 	}
 	defer db.Close()
 
-	query := `SELECT id, name, image, ports, environment_vars, cpus, memory, volumes, labels 
+	query := `SELECT id, name, image, ports, environment_vars, cpus, memory, volumes, labels, networks, depends_on, replicas, load_balancing 
               FROM container WHERE workspace_id = ?`
 	rows, err := db.Query(query, workspaceID)
 	if err != nil {
@@ -167,9 +206,9 @@ func ListContainersInWorkspace(workspaceID int) ([]models.Container, error) {
 	var containers []models.Container
 	for rows.Next() {
 		var container models.Container
-		var ports, envVars, volumes, labels string
+		var ports, envVars, volumes, labels, networks, dependsOn string
 
-		err = rows.Scan(&container.ID, &container.Name, &container.Image, &ports, &envVars, &container.ResourceLimits.CPUs, &container.ResourceLimits.Memory, &volumes, &labels)
+		err = rows.Scan(&container.ID, &container.Name, &container.Image, &ports, &envVars, &container.ResourceLimits.CPUs, &container.ResourceLimits.Memory, &volumes, &labels, &networks, &dependsOn, &container.Replicas, &container.LoadBalancing)
 		if err != nil {
 			return nil, fmt.Errorf("failed to scan container: %v", err)
 		}
@@ -178,6 +217,8 @@ func ListContainersInWorkspace(workspaceID int) ([]models.Container, error) {
 		container.EnvironmentVars = splitString(envVars)
 		container.Volumes = stringToMap(volumes)
 		container.Labels = splitString(labels)
+		container.Networks = splitString(networks)
+		container.DependsOn = splitString(dependsOn)
 
 		containers = append(containers, container)
 	}
@@ -207,3 +248,46 @@ func CountWorkspaces() (int, error) {
 	}
 	return count, nil
 }
+
+// GetWorkspaceIDByName returns the ID of a workspace by its unique name
+func GetWorkspaceIDByName(name string) (int, error) {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	var id int
+	err = db.QueryRow(`SELECT id FROM workspace WHERE name = ?`, name).Scan(&id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, fmt.Errorf("workspace %q %w", name, ErrNotFound)
+		}
+		return 0, fmt.Errorf("failed to query workspace: %v", err)
+	}
+
+	return id, nil
+}
+
+// GetWorkspaceByID fetches a workspace by its ID
+func GetWorkspaceByID(id int) (*Workspace, error) {
+	db_path, _ := GetPath()
+	db, err := sql.Open("sqlite3", db_path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	defer db.Close()
+
+	var workspace Workspace
+	err = db.QueryRow(`SELECT id, name, desc, total_containers, created_at FROM workspace WHERE id = ?`, id).
+		Scan(&workspace.ID, &workspace.Name, &workspace.Desc, &workspace.TotalContainers, &workspace.CreatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("workspace with ID %d not found", id)
+		}
+		return nil, fmt.Errorf("failed to query workspace: %v", err)
+	}
+
+	return &workspace, nil
+}
@@ -55,6 +55,10 @@ func Init() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS container_workspace_name ON container (workspace_id, name)`)
+	if err != nil {
+		log.Fatal(err)
+	}
 
 	// Create the proxy table
 	createProxyTableSQL := `CREATE TABLE IF NOT EXISTS proxy (
@@ -72,9 +76,243 @@ func Init() {
 		log.Fatal(err)
 	}
 
+	// Create the user table
+	createUserTableSQL := `CREATE TABLE IF NOT EXISTS user (
+        "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+        "username" TEXT UNIQUE NOT NULL,
+        "password_hash" TEXT NOT NULL,
+        "is_admin" BOOLEAN DEFAULT 0,
+        "created_at" DATETIME DEFAULT CURRENT_TIMESTAMP
+    );`
+	_, err = db.Exec(createUserTableSQL)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create the session table
+	createSessionTableSQL := `CREATE TABLE IF NOT EXISTS session (
+        "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+        "user_id" INTEGER NOT NULL,
+        "token_hash" TEXT UNIQUE NOT NULL,
+        "expires_at" DATETIME NOT NULL,
+        "created_at" DATETIME DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY(user_id) REFERENCES user(id) ON DELETE CASCADE
+    );`
+	_, err = db.Exec(createSessionTableSQL)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create the workspace member table
+	createWorkspaceMemberTableSQL := `CREATE TABLE IF NOT EXISTS workspace_member (
+        "workspace_id" INTEGER NOT NULL,
+        "user_id" INTEGER NOT NULL,
+        "role" TEXT NOT NULL,
+        "created_at" DATETIME DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY(workspace_id, user_id),
+        FOREIGN KEY(workspace_id) REFERENCES workspace(id) ON DELETE CASCADE,
+        FOREIGN KEY(user_id) REFERENCES user(id) ON DELETE CASCADE
+    );`
+	_, err = db.Exec(createWorkspaceMemberTableSQL)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create the api token table
+	createAPITokenTableSQL := `CREATE TABLE IF NOT EXISTS api_token (
+        "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+        "user_id" INTEGER NOT NULL,
+        "name" TEXT NOT NULL,
+        "kind" TEXT NOT NULL,
+        "token_hash" TEXT UNIQUE NOT NULL,
+        "prefix" TEXT NOT NULL,
+        "scopes" TEXT,
+        "workspace_ids" TEXT,
+        "expires_at" DATETIME,
+        "last_used_at" DATETIME,
+        "revoked_at" DATETIME,
+        "created_at" DATETIME DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY(user_id) REFERENCES user(id) ON DELETE CASCADE
+    );`
+	_, err = db.Exec(createAPITokenTableSQL)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create the recovery code table
+	createRecoveryCodeTableSQL := `CREATE TABLE IF NOT EXISTS recovery_code (
+        "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+        "user_id" INTEGER NOT NULL,
+        "code_hash" TEXT NOT NULL,
+        "used_at" DATETIME,
+        "created_at" DATETIME DEFAULT CURRENT_TIMESTAMP,
+        FOREIGN KEY(user_id) REFERENCES user(id) ON DELETE CASCADE
+    );`
+	_, err = db.Exec(createRecoveryCodeTableSQL)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create the audit log table
+	createAuditLogTableSQL := `CREATE TABLE IF NOT EXISTS audit_log (
+        "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+        "created_at" DATETIME NOT NULL,
+        "actor" TEXT NOT NULL,
+        "user_id" INTEGER,
+        "token_id" INTEGER,
+        "source_ip" TEXT,
+        "action" TEXT NOT NULL,
+        "target_type" TEXT,
+        "target_id" INTEGER,
+        "workspace_id" INTEGER,
+        "before" TEXT,
+        "after" TEXT,
+        "diff" TEXT,
+        "result" TEXT NOT NULL,
+        "status" INTEGER,
+        "error" TEXT
+    );`
+	_, err = db.Exec(createAuditLogTableSQL)
+	if err != nil {
+		log.Fatal(err)
+	}
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS audit_log_workspace_created ON audit_log (workspace_id, created_at)`)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create the secret table, values are encrypted with the master key
+	createSecretTableSQL := `CREATE TABLE IF NOT EXISTS secret (
+        "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+        "workspace_id" INTEGER NOT NULL,
+        "name" TEXT NOT NULL,
+        "ciphertext" BLOB NOT NULL,
+        "version" INTEGER DEFAULT 1,
+        "created_at" DATETIME DEFAULT CURRENT_TIMESTAMP,
+        "updated_at" DATETIME DEFAULT CURRENT_TIMESTAMP,
+        UNIQUE(workspace_id, name),
+        FOREIGN KEY(workspace_id) REFERENCES workspace(id) ON DELETE CASCADE
+    );`
+	_, err = db.Exec(createSecretTableSQL)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create the workspace variable table
+	createWorkspaceVariableTableSQL := `CREATE TABLE IF NOT EXISTS workspace_variable (
+        "workspace_id" INTEGER NOT NULL,
+        "name" TEXT NOT NULL,
+        "value" TEXT NOT NULL,
+        "updated_at" DATETIME DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY(workspace_id, name),
+        FOREIGN KEY(workspace_id) REFERENCES workspace(id) ON DELETE CASCADE
+    );`
+	_, err = db.Exec(createWorkspaceVariableTableSQL)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create the workspace quota table, a zero or empty limit means unlimited
+	createWorkspaceQuotaTableSQL := `CREATE TABLE IF NOT EXISTS workspace_quota (
+        "workspace_id" INTEGER PRIMARY KEY,
+        "max_cubes" INTEGER DEFAULT 0,
+        "cpus" TEXT DEFAULT '',
+        "memory" TEXT DEFAULT '',
+        "max_ports" INTEGER DEFAULT 0,
+        "max_proxies" INTEGER DEFAULT 0,
+        FOREIGN KEY(workspace_id) REFERENCES workspace(id) ON DELETE CASCADE
+    );`
+	_, err = db.Exec(createWorkspaceQuotaTableSQL)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create the workspace network table, the networks cubes of the workspace can join
+	createWorkspaceNetworkTableSQL := `CREATE TABLE IF NOT EXISTS workspace_network (
+        "workspace_id" INTEGER NOT NULL,
+        "name" TEXT NOT NULL,
+        "driver" TEXT DEFAULT '',
+        "created_at" DATETIME DEFAULT CURRENT_TIMESTAMP,
+        PRIMARY KEY(workspace_id, name),
+        FOREIGN KEY(workspace_id) REFERENCES workspace(id) ON DELETE CASCADE
+    );`
+	_, err = db.Exec(createWorkspaceNetworkTableSQL)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Create the cube revision table, every change of a cube spec is kept as a revision
+	createCubeRevisionTableSQL := `CREATE TABLE IF NOT EXISTS cube_revision (
+        "id" INTEGER PRIMARY KEY AUTOINCREMENT,
+        "cube_id" INTEGER NOT NULL,
+        "revision" INTEGER NOT NULL,
+        "spec" TEXT NOT NULL,
+        "author" TEXT NOT NULL,
+        "note" TEXT DEFAULT '',
+        "created_at" DATETIME DEFAULT CURRENT_TIMESTAMP,
+        UNIQUE(cube_id, revision),
+        FOREIGN KEY(cube_id) REFERENCES container(id) ON DELETE CASCADE
+    );`
+	_, err = db.Exec(createCubeRevisionTableSQL)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Columns added after the first release, older databases are migrated in place
+	addColumnIfNotExists(db, "user", "auth_source", `TEXT DEFAULT 'local'`)
+	addColumnIfNotExists(db, "user", "totp_secret", `TEXT DEFAULT ''`)
+	addColumnIfNotExists(db, "user", "totp_enabled", `BOOLEAN DEFAULT 0`)
+	addColumnIfNotExists(db, "user", "totp_last_step", `INTEGER DEFAULT 0`)
+	addColumnIfNotExists(db, "user", "second_factor_failures", `INTEGER DEFAULT 0`)
+	addColumnIfNotExists(db, "user", "second_factor_locked_until", `INTEGER DEFAULT 0`)
+	addColumnIfNotExists(db, "user", "oidc_issuer", `TEXT DEFAULT ''`)
+	addColumnIfNotExists(db, "user", "oidc_subject", `TEXT DEFAULT ''`)
+	addColumnIfNotExists(db, "container", "networks", `TEXT DEFAULT ''`)
+	addColumnIfNotExists(db, "container", "depends_on", `TEXT DEFAULT ''`)
+	addColumnIfNotExists(db, "container", "replicas", `INTEGER DEFAULT 0`)
+	addColumnIfNotExists(db, "container", "load_balancing", `TEXT DEFAULT ''`)
+
+	// A single sign-on identity belongs to one account
+	_, err = db.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS user_oidc_identity ON user (oidc_issuer, oidc_subject) WHERE oidc_subject != ''`)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Cubes created before revisions were kept start their history with their current spec
+	if err := addInitialCubeRevisions(db); err != nil {
+		log.Fatal(err)
+	}
+
 	log.Println("Tables created successfully!")
 }
 
+// addColumnIfNotExists adds a column to an existing table unless it is already there
+func addColumnIfNotExists(db *sql.DB, table string, column string, definition string) {
+	rows, err := db.Query(fmt.Sprintf(`PRAGMA table_info("%s")`, table))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, columnType string
+		var defaultValue sql.NullString
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultValue, &pk); err != nil {
+			log.Fatal(err)
+		}
+		if name == column {
+			return
+		}
+	}
+
+	_, err = db.Exec(fmt.Sprintf(`ALTER TABLE "%s" ADD COLUMN "%s" %s`, table, column, definition))
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Added column %s.%s", table, column)
+}
+
 func GetPath() (string, error) {
 	ex, err := os.Executable()
 	if err != nil {
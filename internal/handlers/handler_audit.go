@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/internal/middleware"
+	"github.com/turplespace/portos/internal/response"
+	"github.com/turplespace/portos/internal/services/auth"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+/*
+HandleGetAuditLog returns the newest audit entries, filtered by the workspace_id, actor, action,
+since and until query params. An action ending with * matches every action with that prefix and
+since/until are RFC 3339 timestamps. Admins can read the whole log, other users must pass a
+workspace they own. format=csv returns the entries as a CSV file instead of JSON.
+*/
+func HandleGetAuditLog(c echo.Context) error {
+	filter := database.AuditFilter{
+		Actor:  c.QueryParam("actor"),
+		Action: c.QueryParam("action"),
+		Limit:  defaultAuditLimit,
+	}
+
+	if value := c.QueryParam("workspace_id"); value != "" {
+		id, err := strconv.Atoi(value)
+		if err != nil {
+			return response.Error(c, http.StatusBadRequest, "Invalid workspace ID")
+		}
+		filter.WorkspaceID = id
+	}
+	if value := c.QueryParam("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return response.Error(c, http.StatusBadRequest, "Invalid limit")
+		}
+		filter.Limit = min(limit, maxAuditLimit)
+	}
+	for param, target := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		value := c.QueryParam(param)
+		if value == "" {
+			continue
+		}
+		at, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return response.Error(c, http.StatusBadRequest, fmt.Sprintf("Invalid %s, expected an RFC 3339 timestamp", param))
+		}
+		*target = at
+	}
+
+	// The whole log is for admins, anyone else reads the log of a workspace they own
+	if filter.WorkspaceID == 0 {
+		if !readsWholeAuditLog(c) {
+			return response.Error(c, http.StatusForbidden, "A workspace ID is required to read the audit log")
+		}
+	} else if err := middleware.Authorize(c, filter.WorkspaceID, auth.ActionWorkspaceWrite); err != nil {
+		return response.Error(c, http.StatusForbidden, err.Error())
+	}
+
+	entries, err := database.ListAuditEntries(filter)
+	if err != nil {
+		log.Printf("[*] Error: Failed to list audit entries: %v", err)
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to get audit log: %v", err))
+	}
+
+	if c.QueryParam("format") == "csv" {
+		return writeAuditCSV(c, entries)
+	}
+	if entries == nil {
+		entries = []database.AuditEntry{}
+	}
+	return c.JSON(http.StatusOK, entries)
+}
+
+// readsWholeAuditLog reports whether the request may read the audit log of every workspace. Admins
+// may, with the admin scope when they use a token. Service tokens have no user, their scope decides.
+func readsWholeAuditLog(c echo.Context) bool {
+	token := middleware.CurrentToken(c)
+	if token != nil && token.Kind == auth.TokenKindService {
+		return auth.TokenHasScope(token, auth.ScopeAdmin)
+	}
+	user := middleware.CurrentUser(c)
+	if user == nil || !user.IsAdmin {
+		return false
+	}
+	return token == nil || auth.TokenHasScope(token, auth.ScopeAdmin)
+}
+
+// writeAuditCSV streams the entries as a CSV attachment, the diff is kept as its JSON encoding
+func writeAuditCSV(c echo.Context, entries []database.AuditEntry) error {
+	c.Response().Header().Set(echo.HeaderContentType, "text/csv")
+	c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="audit.csv"`)
+	c.Response().WriteHeader(http.StatusOK)
+
+	writer := csv.NewWriter(c.Response())
+	writer.Write([]string{"id", "created_at", "actor", "source_ip", "action", "target_type", "target_id", "workspace_id", "result", "status", "error", "diff"})
+	for _, entry := range entries {
+		writer.Write([]string{
+			strconv.Itoa(entry.ID),
+			entry.CreatedAt.UTC().Format(time.RFC3339),
+			entry.Actor,
+			entry.SourceIP,
+			entry.Action,
+			entry.TargetType,
+			optionalInt(entry.TargetID),
+			optionalInt(entry.WorkspaceID),
+			entry.Result,
+			strconv.Itoa(entry.Status),
+			entry.Error,
+			diffJSON(entry.Diff),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func optionalInt(value *int) string {
+	if value == nil {
+		return ""
+	}
+	return strconv.Itoa(*value)
+}
+
+func diffJSON(diff []database.FieldChange) string {
+	if len(diff) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(diff)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
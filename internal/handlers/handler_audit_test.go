@@ -0,0 +1,42 @@
+package handlers_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/internal/services/auth"
+)
+
+func TestAuditLogAccess(t *testing.T) {
+	workspaceID, err := database.CreateWorkspace("audit-access", "created by "+t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	userID := newUser(t, "audit-viewer")
+
+	admin := newToken(t, database.APIToken{UserID: 1, Kind: auth.TokenKindPersonal, Scopes: []string{auth.ScopeAdmin, string(auth.ActionWorkspaceWrite)}})
+	adminWithoutScope := newToken(t, database.APIToken{UserID: 1, Kind: auth.TokenKindPersonal, Scopes: []string{string(auth.ActionWorkspaceWrite)}})
+	user := newToken(t, database.APIToken{UserID: userID, Kind: auth.TokenKindPersonal, Scopes: []string{string(auth.ActionWorkspaceWrite)}})
+	service := newToken(t, database.APIToken{UserID: 1, Kind: auth.TokenKindService, Scopes: []string{string(auth.ActionWorkspaceWrite)}, WorkspaceIDs: []int{int(workspaceID)}})
+
+	workspaceLog := fmt.Sprintf("/api/audit?workspace_id=%d", workspaceID)
+	for _, test := range []struct {
+		name   string
+		token  string
+		path   string
+		status int
+	}{
+		{"admin reads the whole log", admin, "/api/audit", http.StatusOK},
+		{"admin token without the admin scope", adminWithoutScope, "/api/audit", http.StatusForbidden},
+		{"user reads the whole log", user, "/api/audit", http.StatusForbidden},
+		{"service token reads the whole log", service, "/api/audit", http.StatusForbidden},
+		{"service token reads its workspace", service, workspaceLog, http.StatusOK},
+		{"user reads a workspace they are not member of", user, workspaceLog, http.StatusForbidden},
+	} {
+		if status, body := call(t, http.MethodGet, test.path, test.token, nil); status != test.status {
+			t.Errorf("%s: status = %d %s, want %d", test.name, status, body, test.status)
+		}
+	}
+}
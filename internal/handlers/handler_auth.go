@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/turplespace/portos/internal/config"
+	"github.com/turplespace/portos/internal/middleware"
+	"github.com/turplespace/portos/internal/response"
+	"github.com/turplespace/portos/internal/services/auth"
+	"github.com/turplespace/portos/internal/validation"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+// HandleLogin checks the username and password in the request body and sets the session cookie
+func HandleLogin(c echo.Context) error {
+	log.Println("[*] Starting login request")
+
+	var req models.LoginRequest
+	if err := validation.Bind(c, &req); err != nil {
+		log.Printf("[*] Error: Invalid request body - %v", err)
+		return response.Invalid(c, err)
+	}
+	middleware.AuditActor(c, req.Username)
+
+	user, token, expiresAt, err := auth.Login(req.Username, req.Password, req.Code, req.RecoveryCode)
+	if errors.Is(err, auth.ErrSecondFactorRequired) {
+		return response.ErrorCode(c, http.StatusUnauthorized, response.CodeTwoFactorRequired, "Two-factor code required")
+	}
+	if errors.Is(err, auth.ErrInvalidSecondFactor) {
+		log.Printf("[*] Failed two-factor login attempt for user %q from %s", req.Username, c.RealIP())
+		return response.ErrorCode(c, http.StatusUnauthorized, response.CodeInvalidTwoFactorCode, "Invalid two-factor code")
+	}
+	if errors.Is(err, auth.ErrSecondFactorLocked) {
+		log.Printf("[*] Refused two-factor login attempt for locked user %q from %s", req.Username, c.RealIP())
+		return secondFactorLocked(c)
+	}
+	if err != nil {
+		log.Printf("[*] Failed login attempt for user %q from %s: %v", req.Username, c.RealIP(), err)
+		return response.Error(c, http.StatusUnauthorized, "Invalid username or password")
+	}
+
+	middleware.AuditTarget(c, user.ID, 0)
+	setSessionCookie(c, token, expiresAt)
+	log.Printf("[*] User %q logged in", user.Username)
+	return c.JSON(http.StatusOK, user)
+}
+
+// HandleLogout deletes the current session and clears the session cookie
+func HandleLogout(c echo.Context) error {
+	cookie, err := c.Cookie(auth.SessionCookieName)
+	if err == nil {
+		if user, err := auth.UserFromSession(cookie.Value); err == nil {
+			middleware.AuditActor(c, user.Username)
+			middleware.AuditTarget(c, user.ID, 0)
+		}
+		if err := auth.Logout(cookie.Value); err != nil {
+			log.Printf("[*] Error: Failed to delete session: %v", err)
+			return response.Error(c, http.StatusInternalServerError, "Failed to logout")
+		}
+	}
+
+	setSessionCookie(c, "", time.Unix(0, 0))
+	return c.JSON(http.StatusOK, map[string]string{"message": "Logged out successfully"})
+}
+
+// HandleGetCurrentUser returns the user owning the current session
+func HandleGetCurrentUser(c echo.Context) error {
+	return c.JSON(http.StatusOK, middleware.CurrentUser(c))
+}
+
+// setSessionCookie writes the session cookie, an expiry in the past removes it
+func setSessionCookie(c echo.Context, token string, expiresAt time.Time) {
+	c.SetCookie(&http.Cookie{
+		Name:     auth.SessionCookieName,
+		Value:    token,
+		Path:     "/",
+		Expires:  expiresAt,
+		HttpOnly: true,
+		Secure:   config.Get().SecureCookies || c.IsTLS(),
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// HandleOIDCLogin redirects the browser to the single sign-on provider
+func HandleOIDCLogin(c echo.Context) error {
+	if !config.Get().OIDC.Enabled() {
+		return response.Error(c, http.StatusNotFound, "Single sign-on is not configured")
+	}
+
+	url, state, err := auth.OIDCAuthURL(c.Request().Context())
+	if err != nil {
+		log.Printf("[*] Error: Failed to start single sign-on: %v", err)
+		return response.Error(c, http.StatusBadGateway, fmt.Sprintf("Failed to start single sign-on: %v", err))
+	}
+
+	c.SetCookie(&http.Cookie{
+		Name:     auth.OIDCStateCookieName,
+		Value:    state,
+		Path:     "/api/auth/oidc",
+		MaxAge:   600,
+		HttpOnly: true,
+		Secure:   config.Get().SecureCookies || c.IsTLS(),
+		SameSite: http.SameSiteLaxMode,
+	})
+	return c.Redirect(http.StatusFound, url)
+}
+
+/*
+oidcDonePage takes the browser to the web UI once the session cookie is set. A redirect would not
+do: it would continue the cross-site navigation back from the provider, on which the browser does
+not send the SameSite=Strict session cookie.
+*/
+const oidcDonePage = `<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta http-equiv="refresh" content="0; url=/"><title>Signed in</title></head>
+<body><a href="/">Continue to TurpleCubes</a></body></html>
+`
+
+// HandleOIDCCallback completes the single sign-on login, opens a session and sends the browser to the web UI
+func HandleOIDCCallback(c echo.Context) error {
+	if errParam := c.QueryParam("error"); errParam != "" {
+		log.Printf("[*] Single sign-on refused: %s %s", errParam, c.QueryParam("error_description"))
+		return response.Error(c, http.StatusUnauthorized, fmt.Sprintf("Single sign-on refused: %s", errParam))
+	}
+
+	state := c.QueryParam("state")
+	cookie, err := c.Cookie(auth.OIDCStateCookieName)
+	if err != nil || state == "" || cookie.Value != state {
+		return response.Error(c, http.StatusBadRequest, "Invalid single sign-on state")
+	}
+
+	user, err := auth.OIDCCallback(c.Request().Context(), state, c.QueryParam("code"))
+	if errors.Is(err, auth.ErrProviderMFARequired) {
+		log.Printf("[*] Single sign-on refused without a second factor from %s", c.RealIP())
+		return response.Error(c, http.StatusForbidden, "Single sign-on requires a second factor at the identity provider")
+	}
+	if err != nil {
+		log.Printf("[*] Error: Single sign-on failed: %v", err)
+		return response.Error(c, http.StatusUnauthorized, "Single sign-on failed")
+	}
+
+	token, expiresAt, err := auth.NewSession(user.ID)
+	if err != nil {
+		log.Printf("[*] Error: Failed to create session: %v", err)
+		return response.Error(c, http.StatusInternalServerError, "Failed to create session")
+	}
+
+	setSessionCookie(c, token, expiresAt)
+	log.Printf("[*] User %q logged in with single sign-on", user.Username)
+	return c.HTML(http.StatusOK, oidcDonePage)
+}
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -8,8 +9,14 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/turplespace/portos/internal/database"
-	"github.com/turplespace/portos/internal/models"
+	"github.com/turplespace/portos/internal/middleware"
+	"github.com/turplespace/portos/internal/response"
+	"github.com/turplespace/portos/internal/services/auth"
+	"github.com/turplespace/portos/internal/services/deploy"
 	"github.com/turplespace/portos/internal/services/docker"
+	"github.com/turplespace/portos/internal/services/quota"
+	"github.com/turplespace/portos/internal/validation"
+	"github.com/turplespace/portos/pkg/models"
 )
 
 /*
@@ -21,30 +28,50 @@ func HandleGetCubeData(c echo.Context) error {
 	cubeIDStr := c.Param("cubeID")
 	if cubeIDStr == "" {
 		log.Printf("[*] Error: No cube ID provided in request")
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Missing cube ID"})
+		return response.Error(c, http.StatusBadRequest, "Missing cube ID")
 	}
 
 	cubeID, err := strconv.Atoi(cubeIDStr)
 	if err != nil {
 		log.Printf("[*] Error: Invalid cube ID format: %s - %v", cubeIDStr, err)
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid cube ID"})
+		return response.Error(c, http.StatusBadRequest, "Invalid cube ID")
 	}
 
 	var getCubesByIdResponse models.GetCubesByIdResponse
 	cube, err := database.GetCubeData(cubeID)
 	if err != nil {
 		log.Printf("[*] Database error while fetching cube data: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to get cube data: %v", err)})
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to get cube data: %v", err))
 	}
 	log.Printf("[*] Successfully retrieved cube data for ID: %d", cubeID)
 
-	status, err := docker.GetContainerStatus(cube.Name)
+	var status, ipAddress string
+	if cube.ReplicaCount() == 1 {
+		status, err = docker.GetContainerStatus(cube.Name)
+		if err != nil {
+			log.Printf("[*] Warning: Unable to get container status: %v", err)
+			status = "unknown"
+		}
+		if status == "running" {
+			getCubesByIdResponse.ReadyReplicas = 1
+		}
+		ipAddress, _ = docker.GetContainerIPAddress(cube.Name)
+	} else {
+		// The replicas are listed with a single Docker call, the IP address is that of the first one running
+		states, err := docker.ListManagedContainers(middleware.CurrentWorkspaceID(c))
+		if err != nil {
+			log.Printf("[*] Warning: Unable to list the replicas of cube %d: %v", cubeID, err)
+		}
+		status, getCubesByIdResponse.ReadyReplicas = deploy.ReplicaStatus(states, *cube)
+		if ips := deploy.RunningIPs(deploy.Replicas(states, *cube)); len(ips) > 0 {
+			ipAddress = ips[0]
+		}
+	}
+	getCubesByIdResponse.Replicas = cube.ReplicaCount()
+	getCubesByIdResponse.PendingChanges, _, err = deploy.PendingChanges(middleware.CurrentWorkspaceID(c), *cube)
 	if err != nil {
-		log.Printf("[*] Warning: Unable to get container status: %v", err)
-		status = "unknown"
+		log.Printf("[*] Warning: Unable to compare cube %d with its container: %v", cubeID, err)
 	}
-
-	ipAddress, err := docker.GetContainerIPAddress(cube.Name)
 	getCubesByIdResponse.IPAddress = ipAddress
 	getCubesByIdResponse.Status = status
 	getCubesByIdResponse.ContainerData = cube
@@ -59,18 +86,31 @@ func HandleAddCubes(c echo.Context) error {
 	log.Printf("[*] Starting add cubes request")
 
 	var req models.AddCubesRequest
-	if err := c.Bind(&req); err != nil {
+	if err := validation.Bind(c, &req); err != nil {
 		log.Printf("[*] Error: Invalid request body - %v", err)
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Invalid request: %v", err)})
+		return response.Invalid(c, err)
+	}
+	middleware.AuditTarget(c, 0, req.WorkspaceID)
+	middleware.AuditChange(c, nil, req.Cube)
+	if err := middleware.Authorize(c, req.WorkspaceID, auth.ActionCubeWrite); err != nil {
+		return response.Error(c, http.StatusForbidden, err.Error())
 	}
 	log.Printf("[*] Attempting to add %s cubes to workspace %d", req.Cube.Name, req.WorkspaceID)
 
-	id, err := database.InsertWorkspaceAndCubes(req.WorkspaceID, req.Cube)
+	added := req.Cube
+	added.ID = 0
+	if err := quota.CheckCube(req.WorkspaceID, added); err != nil {
+		log.Printf("[*] Error: Cube %s rejected by quota: %v", req.Cube.Name, err)
+		return quotaError(c, err, err.Error())
+	}
+
+	id, err := database.InsertWorkspaceAndCubes(req.WorkspaceID, req.Cube, middleware.Actor(c))
 	if err != nil {
 		log.Printf("[*] Database error while inserting cubes: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to insert cubes: %v", err)})
+		return cubeStoreError(c, err, fmt.Sprintf("Failed to insert cubes: %v", err))
 	}
 
+	middleware.AuditTarget(c, int(id), req.WorkspaceID)
 	log.Printf("[*] Successfully added %s cubes to workspace %d", req.Cube.Name, req.WorkspaceID)
 	return c.JSON(http.StatusOK, map[string]int{"id": int(id)})
 }
@@ -83,34 +123,55 @@ func HandleEditCube(c echo.Context) error {
 	cubeIDStr := c.Param("cubeID")
 	if cubeIDStr == "" {
 		log.Printf("[*] Error: Missing workspace ID in request")
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Missing workspace ID"})
+		return response.Error(c, http.StatusBadRequest, "Missing workspace ID")
 	}
 
 	cubeID, err := strconv.Atoi(cubeIDStr)
 	if err != nil {
 		log.Printf("[*] Error: Invalid workspace ID format: %d - %v", cubeID, err)
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid workspace ID"})
+		return response.Error(c, http.StatusBadRequest, "Invalid workspace ID")
 	}
 
 	var req models.EditCubeRequest
 
-	if err := c.Bind(&req); err != nil {
+	if err := validation.Bind(c, &req); err != nil {
 		log.Printf("[*] Error: Invalid request body - %v", err)
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Invalid request: %v", err)})
+		return response.Invalid(c, err)
 	}
 
 	log.Printf("[*] Attempting to update cube ID: %d", cubeID)
 
-	err = database.UpdateCube(cubeID, req.UpdatedCube)
+	before, err := database.GetCubeData(cubeID)
+	if err != nil {
+		log.Printf("[*] Warning: Unable to get cube data before update: %v", err)
+	}
+	after := req.UpdatedCube
+	after.ID = cubeID
+	middleware.AuditChange(c, before, after)
+
+	if err := quota.CheckCube(middleware.CurrentWorkspaceID(c), after); err != nil {
+		log.Printf("[*] Error: Update of cube %d rejected by quota: %v", cubeID, err)
+		return quotaError(c, err, err.Error())
+	}
+
+	_, err = database.UpdateCube(cubeID, req.UpdatedCube, middleware.Actor(c), database.RevisionEdit)
 	if err != nil {
 		log.Printf("[*] Database error while updating cube: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to update cube: %v", err)})
+		return cubeStoreError(c, err, fmt.Sprintf("Failed to update cube: %v", err))
 	}
 
 	log.Printf("[*] Successfully updated cube ID: %d", cubeID)
 	return c.JSON(http.StatusOK, map[string]string{"message": "Cube updated successfully"})
 }
 
+// cubeStoreError answers a failed write of a cube, a container name used by another cube is a conflict
+func cubeStoreError(c echo.Context, err error, message string) error {
+	if errors.Is(err, database.ErrNameTaken) {
+		return response.Error(c, http.StatusConflict, err.Error())
+	}
+	return response.Error(c, http.StatusInternalServerError, message)
+}
+
 /*
 HandleDeleteCube function receives cube_id in query params and restarts the cube
 */
@@ -120,23 +181,24 @@ func HandleDeleteCube(c echo.Context) error {
 	cubeIDStr := c.Param("cubeID")
 	if cubeIDStr == "" {
 		log.Printf("[*] Error: Missing cube ID in request")
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Missing cube ID"})
+		return response.Error(c, http.StatusBadRequest, "Missing cube ID")
 	}
 
 	cubeID, err := strconv.Atoi(cubeIDStr)
 	if err != nil {
 		log.Printf("[*] Error: Invalid cube ID format: %s - %v", cubeIDStr, err)
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid cube ID"})
+		return response.Error(c, http.StatusBadRequest, "Invalid cube ID")
 	}
 
 	cube, err := database.GetCubeData(cubeID)
 	if err != nil {
 		log.Printf("[*] Database error while fetching cube data: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to get cube data: %v", err)})
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to get cube data: %v", err))
 	}
 	log.Printf("[*] Retrieved cube data for deletion, container name: %s", cube.Name)
+	middleware.AuditChange(c, cube, nil)
 
-	err = docker.StopContainer(cube.Name)
+	err = deploy.StopCube(*cube)
 	if err != nil {
 		log.Printf("[*] Warning: Error stopping container %s: %v", cube.Name, err)
 	}
@@ -144,7 +206,7 @@ func HandleDeleteCube(c echo.Context) error {
 	err = database.DeleteCube(cubeID)
 	if err != nil {
 		log.Printf("[*] Database error while deleting cube: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to delete cube: %v", err)})
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to delete cube: %v", err))
 	}
 
 	log.Printf("[*] Successfully deleted cube ID: %d", cubeID)
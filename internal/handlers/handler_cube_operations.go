@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
@@ -9,24 +10,36 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/turplespace/portos/internal/database"
-	"github.com/turplespace/portos/internal/models"
+	"github.com/turplespace/portos/internal/middleware"
+	"github.com/turplespace/portos/internal/response"
+	"github.com/turplespace/portos/internal/services/auth"
+	"github.com/turplespace/portos/internal/services/deploy"
 	"github.com/turplespace/portos/internal/services/docker"
+	"github.com/turplespace/portos/internal/services/proxy"
+	"github.com/turplespace/portos/internal/services/quota"
 	"github.com/turplespace/portos/internal/services/repositories"
+	"github.com/turplespace/portos/internal/validation"
+	"github.com/turplespace/portos/pkg/models"
 )
 
-// HandleDeployCube function receives cube_id in query params and deploys the cube
+// HandleDeployCube function receives cube_id in query params and deploys the cube, strategy=blue-green
+// replaces a running container without dropping the traffic of its proxies
 func HandleDeployCube(c echo.Context) error {
 	// Get cube ID from query parameters
 	cubeIDStr := c.Param("cubeID")
 	if cubeIDStr == "" {
 		log.Printf("[*] Error: No cube ID provided in request")
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Missing cube ID"})
+		return response.Error(c, http.StatusBadRequest, "Missing cube ID")
 	}
 
 	cubeID, err := strconv.Atoi(cubeIDStr)
 	if err != nil {
 		log.Printf("[*] Error: Invalid cube ID format: %s - %v", cubeIDStr, err)
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid cube ID"})
+		return response.Error(c, http.StatusBadRequest, "Invalid cube ID")
+	}
+	strategy, err := deployStrategy(c)
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, err.Error())
 	}
 	log.Printf("[*] Processing deployment for cube ID: %d", cubeID)
 
@@ -34,79 +47,189 @@ func HandleDeployCube(c echo.Context) error {
 	container, err := database.GetCubeData(cubeID)
 	if err != nil {
 		log.Printf("[*] Database error while fetching cube data: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to get cube data: %v", err)})
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to get cube data: %v", err))
 	}
 	log.Printf("[*] Successfully retrieved cube data for ID: %d", cubeID)
 
 	// Start the container using the retrieved cube data
-	err = docker.StartContainer(*container)
+	if strategy == deploy.StrategyBlueGreen {
+		err = deploy.DeployBlueGreen(middleware.CurrentWorkspaceID(c), *container)
+	} else {
+		err = deploy.DeployCube(middleware.CurrentWorkspaceID(c), *container)
+	}
 	if err != nil {
 		log.Printf("[*] Docker error while starting container: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to deploy cube: %v", err)})
+		return deployError(c, err, fmt.Sprintf("Failed to deploy cube: %v", err))
 	}
 	log.Printf("[*] Successfully started container for cube ID: %d", cubeID)
 
 	return c.JSON(http.StatusOK, map[string]string{"message": "Cube deployed successfully"})
 }
 
-// HandleRedeployCube function receives cube_id in query params and redeploys the cube
+// HandleRedeployCube function receives cube_id in query params and redeploys the cube, its container
+// is recreated when the cube has pending changes and restarted otherwise. strategy=blue-green always
+// replaces it, without dropping the traffic of its proxies
 func HandleRedeployCube(c echo.Context) error {
 	cubeIDStr := c.Param("cubeID")
 	if cubeIDStr == "" {
 		log.Printf("[*] Error: No cube ID provided in request")
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Missing cube ID"})
+		return response.Error(c, http.StatusBadRequest, "Missing cube ID")
 	}
 
 	cubeID, err := strconv.Atoi(cubeIDStr)
 	if err != nil {
 		log.Printf("[*] Error: Invalid cube ID format: %s - %v", cubeIDStr, err)
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid cube ID"})
+		return response.Error(c, http.StatusBadRequest, "Invalid cube ID")
+	}
+	strategy, err := deployStrategy(c)
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, err.Error())
 	}
 	log.Printf("[*] Processing redeployment for cube ID: %d", cubeID)
 
 	container, err := database.GetCubeData(cubeID)
 	if err != nil {
 		log.Printf("[*] Database error while fetching cube data: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to get cube data: %v", err)})
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to get cube data: %v", err))
 	}
 	log.Printf("[*] Successfully retrieved cube data for ID: %d", cubeID)
 
-	err = docker.RestartContainer(container.Name)
+	if strategy == deploy.StrategyBlueGreen {
+		if err := deploy.DeployBlueGreen(middleware.CurrentWorkspaceID(c), *container); err != nil {
+			log.Printf("[*] Docker error while replacing container: %v", err)
+			return deployError(c, err, fmt.Sprintf("Failed to redeploy cube: %v", err))
+		}
+		log.Printf("[*] Successfully replaced container for cube ID: %d", cubeID)
+		return c.JSON(http.StatusOK, map[string]string{"message": "Cube replaced without downtime"})
+	}
+
+	// Edits only reach the container by recreating it, a restart keeps its old configuration
+	recreated, err := deploy.Redeploy(middleware.CurrentWorkspaceID(c), *container)
 	if err != nil {
-		log.Printf("[*] Docker error while restarting container: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to redeploy cube: %v", err)})
+		log.Printf("[*] Docker error while redeploying container: %v", err)
+		return quotaError(c, err, fmt.Sprintf("Failed to redeploy cube: %v", err))
+	}
+	if recreated {
+		log.Printf("[*] Successfully recreated container for cube ID: %d", cubeID)
+		return c.JSON(http.StatusOK, map[string]string{"message": "Cube recreated with its pending changes"})
 	}
 	log.Printf("[*] Successfully restarted container for cube ID: %d", cubeID)
 
 	return c.JSON(http.StatusOK, map[string]string{"message": "Cube redeployed successfully"})
 }
 
+/*
+HandleScaleCube sets the number of replicas of a cube, stored as a new revision, then starts or
+removes containers to match it and points the proxies of the cube at the running replicas. Running
+replicas are kept, so the containers are only recreated when the cube goes from one to several.
+*/
+func HandleScaleCube(c echo.Context) error {
+	cubeID, err := strconv.Atoi(c.Param("cubeID"))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid cube ID")
+	}
+	var req models.ScaleCubeRequest
+	if err := validation.Bind(c, &req); err != nil {
+		log.Printf("[*] Error: Invalid request body - %v", err)
+		return response.Invalid(c, err)
+	}
+	log.Printf("[*] Scaling cube %d to %d replicas", cubeID, req.Replicas)
+
+	// Scaling stores the cube, which needs the cube write permission on top of deploy
+	workspaceID := middleware.CurrentWorkspaceID(c)
+	if err := middleware.Authorize(c, workspaceID, auth.ActionCubeWrite); err != nil {
+		return response.Error(c, http.StatusForbidden, err.Error())
+	}
+
+	before, err := database.GetCubeData(cubeID)
+	if err != nil {
+		log.Printf("[*] Database error while fetching cube data: %v", err)
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to get cube data: %v", err))
+	}
+	scaled := *before
+	scaled.Replicas = req.Replicas
+	if req.LoadBalancing != "" {
+		scaled.LoadBalancing = req.LoadBalancing
+	}
+	middleware.AuditChange(c, before, scaled)
+
+	if err := deploy.CheckReplicas(scaled); err != nil {
+		return response.Error(c, http.StatusBadRequest, err.Error())
+	}
+	if err := quota.CheckCube(workspaceID, scaled); err != nil {
+		log.Printf("[*] Error: Scale of cube %d rejected by quota: %v", cubeID, err)
+		return quotaError(c, err, err.Error())
+	}
+
+	revision, err := database.UpdateCube(cubeID, scaled, middleware.Actor(c), fmt.Sprintf("scale to %d", req.Replicas))
+	if err != nil {
+		log.Printf("[*] Database error while scaling cube: %v", err)
+		return cubeStoreError(c, err, fmt.Sprintf("Failed to update cube: %v", err))
+	}
+	if err := deploy.Scale(workspaceID, scaled); err != nil {
+		log.Printf("[*] Docker error while scaling cube %d: %v", cubeID, err)
+		return deployError(c, err, fmt.Sprintf("Failed to scale cube: %v", err))
+	}
+
+	result := models.ScaleCubeResponse{Revision: revision, Status: "unknown", Replicas: scaled.ReplicaCount()}
+	if states, err := docker.ListManagedContainers(workspaceID); err == nil {
+		result.Status, result.ReadyReplicas = deploy.ReplicaStatus(states, scaled)
+	}
+
+	log.Printf("[*] Successfully scaled cube %d to %d replicas", cubeID, req.Replicas)
+	return c.JSON(http.StatusOK, result)
+}
+
+// deployStrategy reads the strategy query param of a deploy, recreate when missing
+func deployStrategy(c echo.Context) (string, error) {
+	switch strategy := c.QueryParam("strategy"); strategy {
+	case "", deploy.StrategyRecreate:
+		return deploy.StrategyRecreate, nil
+	case deploy.StrategyBlueGreen:
+		return strategy, nil
+	default:
+		return "", fmt.Errorf("Invalid strategy %q, expected %s or %s", strategy, deploy.StrategyRecreate, deploy.StrategyBlueGreen)
+	}
+}
+
+// deployError answers a failed deploy, a cube that cannot be deployed blue/green or with its replicas is a bad request,
+// and so is a proxy configuration rejected by Nginx
+func deployError(c echo.Context, err error, message string) error {
+	if errors.Is(err, deploy.ErrBlueGreenUnsupported) || errors.Is(err, deploy.ErrReplicatedHostPort) {
+		return response.Error(c, http.StatusBadRequest, message)
+	}
+	if errors.Is(err, proxy.ErrInvalidConfig) {
+		return proxyError(c, err, message)
+	}
+	return quotaError(c, err, message)
+}
+
 // HandleStopCube function receives cube_id in query params and stops the cube
 func HandleStopCube(c echo.Context) error {
 	cubeIDStr := c.Param("cubeID")
 	if cubeIDStr == "" {
 		log.Printf("[*] Error: No cube ID provided in request")
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Missing cube ID"})
+		return response.Error(c, http.StatusBadRequest, "Missing cube ID")
 	}
 
 	cubeID, err := strconv.Atoi(cubeIDStr)
 	if err != nil {
 		log.Printf("[*] Error: Invalid cube ID format: %s - %v", cubeIDStr, err)
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid cube ID"})
+		return response.Error(c, http.StatusBadRequest, "Invalid cube ID")
 	}
 	log.Printf("[*] Processing stop request for cube ID: %d", cubeID)
 
 	container, err := database.GetCubeData(cubeID)
 	if err != nil {
 		log.Printf("[*] Database error while fetching cube data: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to get cube data: %v", err)})
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to get cube data: %v", err))
 	}
 	log.Printf("[*] Successfully retrieved cube data for ID: %d", cubeID)
 
-	err = docker.StopContainer(container.Name)
+	err = deploy.StopCube(*container)
 	if err != nil {
 		log.Printf("[*] Docker error while stopping container: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to stop cube: %v", err)})
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to stop cube: %v", err))
 	}
 	log.Printf("[*] Successfully stopped container for cube ID: %d", cubeID)
 
@@ -116,40 +239,39 @@ func HandleStopCube(c echo.Context) error {
 // HandleCommitCube function receives cube_id, new image and tag in query params and commits the cube
 func HandleCommitCube(c echo.Context) error {
 	cubeIDStr := c.Param("cubeID")
-	var req struct {
-		Image string `json:"image"`
-		Tag   string `json:"tag"`
-	}
+	var req models.CommitCubeRequest
 
 	if cubeIDStr == "" {
 		log.Printf("[*] Error: Missing image cube_id or name or tag  in request")
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Missing new image or tag"})
+		return response.Error(c, http.StatusBadRequest, "Missing new image or tag")
 	}
 
 	cubeID, err := strconv.Atoi(cubeIDStr)
 	if err != nil {
 		log.Printf("[*] Error: Invalid cube ID format: %s - %v", cubeIDStr, err)
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid cube ID"})
+		return response.Error(c, http.StatusBadRequest, "Invalid cube ID")
 	}
 
-	if err := c.Bind(&req); err != nil {
+	if err := validation.Bind(c, &req); err != nil {
 		log.Printf("[*] Error: Invalid request body - %v", err)
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Invalid request: %v", err)})
+		return response.Invalid(c, err)
 	}
 
 	log.Printf("[*] Processing commit for cube ID: %d with image: %s and tag: %s", cubeID, req.Image, req.Tag)
+	middleware.AuditChange(c, nil, req)
 
 	container, err := database.GetCubeData(cubeID)
 	if err != nil {
 		log.Printf("[*] Database error while fetching cube data: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to get cube data: %v", err)})
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to get cube data: %v", err))
 	}
 	log.Printf("[*] Successfully retrieved cube data for ID: %d", cubeID)
 
-	err = docker.CommitContainer(container.Name, req.Image, req.Tag)
+	// A cube with replicas is committed from its first replica
+	err = docker.CommitContainer(deploy.ContainerNames(*container)[0], req.Image, req.Tag)
 	if err != nil {
 		log.Printf("[*] Docker error while committing container: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to commit cube: %v", err)})
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to commit cube: %v", err))
 	}
 	log.Printf("[*] Successfully committed container for cube ID: %d", cubeID)
 	repositories.AppendImages(models.Image{Image: req.Image, Tag: req.Tag, PulledOn: time.Now().UTC().Format(time.RFC3339)})
@@ -0,0 +1,55 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/internal/services/auth"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+func TestScaleCubeRejects(t *testing.T) {
+	workspaceID, err := database.CreateWorkspace("handler-replicas", "created by "+t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cubeID, err := database.InsertWorkspaceAndCubes(int(workspaceID), models.Container{Name: "handler-replica-published", Image: "nginx", Ports: []string{"8084:80"}}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := fmt.Sprintf("/api/cube/%d/scale", cubeID)
+
+	for _, test := range []struct {
+		name    string
+		token   string
+		request models.ScaleCubeRequest
+		status  int
+		code    string
+	}{
+		{"no replicas", newToken(t, database.APIToken{UserID: 1, Kind: auth.TokenKindPersonal, Scopes: []string{string(auth.ActionDeploy), string(auth.ActionCubeWrite)}}),
+			models.ScaleCubeRequest{Replicas: 0}, http.StatusBadRequest, "validation_failed"},
+		{"replicas publishing a host port", newToken(t, database.APIToken{UserID: 1, Kind: auth.TokenKindPersonal, Scopes: []string{string(auth.ActionDeploy), string(auth.ActionCubeWrite)}}),
+			models.ScaleCubeRequest{Replicas: 2}, http.StatusBadRequest, "invalid_request"},
+		{"without the cube write permission", newToken(t, database.APIToken{UserID: 1, Kind: auth.TokenKindPersonal, Scopes: []string{string(auth.ActionDeploy)}}),
+			models.ScaleCubeRequest{Replicas: 2}, http.StatusForbidden, "forbidden"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			status, body := call(t, http.MethodPost, path, test.token, test.request)
+			var failure models.ErrorResponse
+			if status != test.status || json.Unmarshal(body, &failure) != nil || failure.Code != test.code {
+				t.Errorf("scale = %d %s, want %d %s", status, body, test.status, test.code)
+			}
+		})
+	}
+
+	// Nothing was stored by the rejected scales
+	if cube, err := database.GetCubeData(int(cubeID)); err != nil || cube.Replicas != 0 {
+		t.Errorf("cube after the rejected scales = %+v, %v", cube, err)
+	}
+	if revisions, err := database.ListCubeRevisions(int(cubeID)); err != nil || len(revisions) != 1 {
+		t.Errorf("revisions after the rejected scales = %+v, %v, want only the first", revisions, err)
+	}
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/internal/middleware"
+	"github.com/turplespace/portos/internal/response"
+	"github.com/turplespace/portos/internal/services/audit"
+	"github.com/turplespace/portos/internal/services/auth"
+	"github.com/turplespace/portos/internal/services/deploy"
+	"github.com/turplespace/portos/internal/services/quota"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+// HandleListCubeRevisions returns the revisions of a cube, newest first
+func HandleListCubeRevisions(c echo.Context) error {
+	cubeID, err := strconv.Atoi(c.Param("cubeID"))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid cube ID")
+	}
+
+	revisions, err := database.ListCubeRevisions(cubeID)
+	if err != nil {
+		log.Printf("[*] Error: Failed to list revisions of cube %d: %v", cubeID, err)
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to list revisions: %v", err))
+	}
+	return c.JSON(http.StatusOK, revisions)
+}
+
+// HandleDiffCubeRevisions returns the fields of a cube changed from the revision from to the revision to
+func HandleDiffCubeRevisions(c echo.Context) error {
+	cubeID, err := strconv.Atoi(c.Param("cubeID"))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid cube ID")
+	}
+	from, err := strconv.Atoi(c.QueryParam("from"))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid from, expected a revision number")
+	}
+	to, err := strconv.Atoi(c.QueryParam("to"))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid to, expected a revision number")
+	}
+
+	revisions := make([]*models.CubeRevision, 2)
+	for i, number := range []int{from, to} {
+		if revisions[i], err = database.GetCubeRevision(cubeID, number); err != nil {
+			return revisionError(c, cubeID, err)
+		}
+	}
+
+	diff := models.CubeRevisionDiff{CubeID: cubeID, From: from, To: to, Changes: []models.FieldChange{}}
+	for _, change := range audit.Diff(audit.Snapshot(revisions[0].Spec), audit.Snapshot(revisions[1].Spec)) {
+		diff.Changes = append(diff.Changes, models.FieldChange{Field: change.Field, Before: change.Before, After: change.After})
+	}
+	return c.JSON(http.StatusOK, diff)
+}
+
+/*
+HandleRollbackCube restores the spec of a cube from one of its revisions, which stores it as a new
+revision so the rollback can be undone too. redeploy=true then recreates the container, which
+needs the deploy permission. A failed redeploy is returned as a warning as the spec stays restored.
+*/
+func HandleRollbackCube(c echo.Context) error {
+	cubeID, err := strconv.Atoi(c.Param("cubeID"))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid cube ID")
+	}
+	number, err := strconv.Atoi(c.Param("rev"))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid revision")
+	}
+	redeploy := false
+	if value := c.QueryParam("redeploy"); value != "" {
+		if redeploy, err = strconv.ParseBool(value); err != nil {
+			return response.Error(c, http.StatusBadRequest, "Invalid redeploy, expected true or false")
+		}
+	}
+	log.Printf("[*] Rolling back cube %d to revision %d", cubeID, number)
+
+	workspaceID := middleware.CurrentWorkspaceID(c)
+	if redeploy {
+		if err := middleware.Authorize(c, workspaceID, auth.ActionDeploy); err != nil {
+			return response.Error(c, http.StatusForbidden, err.Error())
+		}
+	}
+
+	revision, err := database.GetCubeRevision(cubeID, number)
+	if err != nil {
+		return revisionError(c, cubeID, err)
+	}
+	before, err := database.GetCubeData(cubeID)
+	if err != nil {
+		log.Printf("[*] Database error while fetching cube data: %v", err)
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to get cube data: %v", err))
+	}
+	restored := revision.Spec
+	restored.ID = cubeID
+	middleware.AuditChange(c, before, restored)
+
+	if err := quota.CheckCube(workspaceID, restored); err != nil {
+		log.Printf("[*] Error: Rollback of cube %d rejected by quota: %v", cubeID, err)
+		return quotaError(c, err, err.Error())
+	}
+
+	stored, err := database.UpdateCube(cubeID, restored, middleware.Actor(c), fmt.Sprintf("rollback to %d", number))
+	if err != nil {
+		log.Printf("[*] Database error while restoring cube: %v", err)
+		return cubeStoreError(c, err, fmt.Sprintf("Failed to restore cube: %v", err))
+	}
+
+	result := models.RollbackCubeResponse{Revision: stored, RestoredTo: number}
+	if redeploy {
+		// The container of a renamed cube goes by its old name
+		if before.Name != restored.Name {
+			if err := deploy.StopCube(*before); err != nil {
+				log.Printf("[*] Warning: Error stopping container %s: %v", before.Name, err)
+			}
+		}
+		if err := deploy.DeployCube(workspaceID, restored); err != nil {
+			log.Printf("[*] Warning: Failed to redeploy cube %d after rollback: %v", cubeID, err)
+			result.Warnings = append(result.Warnings, fmt.Sprintf("failed to recreate container %s: %v", restored.Name, err))
+		} else {
+			result.Redeployed = true
+		}
+	}
+
+	log.Printf("[*] Successfully rolled back cube %d to revision %d", cubeID, number)
+	return c.JSON(http.StatusOK, result)
+}
+
+// revisionError answers a failed revision lookup, a missing revision is not found
+func revisionError(c echo.Context, cubeID int, err error) error {
+	if errors.Is(err, database.ErrNotFound) {
+		return response.Error(c, http.StatusNotFound, err.Error())
+	}
+	log.Printf("[*] Error: Failed to get revision of cube %d: %v", cubeID, err)
+	return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to get revision: %v", err))
+}
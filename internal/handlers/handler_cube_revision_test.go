@@ -0,0 +1,60 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/internal/services/auth"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+func TestCubeRevisions(t *testing.T) {
+	token := newToken(t, database.APIToken{UserID: 1, Kind: auth.TokenKindPersonal, Scopes: []string{string(auth.ActionView), string(auth.ActionCubeWrite)}})
+	workspaceID, err := database.CreateWorkspace("handler-revisions", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := database.InsertWorkspaceAndCubes(int(workspaceID), models.Container{Name: "handler-revision-web", Image: "nginx:1.26", Ports: []string{"8081:80"}}, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cubeID := int(id)
+	for _, image := range []string{"nginx:1.27", "nginx:broken"} {
+		if _, err := database.UpdateCube(cubeID, models.Container{Name: "handler-revision-web", Image: image}, "admin", database.RevisionEdit); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	status, body := call(t, http.MethodGet, fmt.Sprintf("/api/cube/%d/revisions/diff?from=1&to=3", cubeID), token, nil)
+	var diff models.CubeRevisionDiff
+	if status != http.StatusOK || json.Unmarshal(body, &diff) != nil || len(diff.Changes) != 2 || diff.Changes[0].Field != "image" || diff.Changes[1].Field != "ports" {
+		t.Errorf("diff = %d %s, want the image and ports", status, body)
+	}
+	if status, body := call(t, http.MethodGet, fmt.Sprintf("/api/cube/%d/revisions/diff?from=1&to=9", cubeID), token, nil); status != http.StatusNotFound {
+		t.Errorf("diff with a missing revision = %d %s, want 404", status, body)
+	}
+
+	// A rollback is stored as a new revision by the caller
+	status, body = call(t, http.MethodPost, fmt.Sprintf("/api/cube/%d/rollback/1", cubeID), token, nil)
+	var result models.RollbackCubeResponse
+	if status != http.StatusOK || json.Unmarshal(body, &result) != nil || result.Revision != 4 || result.RestoredTo != 1 || result.Redeployed {
+		t.Fatalf("rollback = %d %s, want revision 4 restoring 1", status, body)
+	}
+	if cube, err := database.GetCubeData(cubeID); err != nil || cube.Image != "nginx:1.26" || len(cube.Ports) != 1 {
+		t.Errorf("rolled back cube = %+v, %v", cube, err)
+	}
+	if revision, err := database.GetCubeRevision(cubeID, 4); err != nil || revision.Author != "admin (token:"+t.Name()+")" || revision.Note != "rollback to 1" {
+		t.Errorf("rollback revision = %+v, %v", revision, err)
+	}
+
+	// Redeploying needs the deploy permission, which the token lacks
+	if status, body := call(t, http.MethodPost, fmt.Sprintf("/api/cube/%d/rollback/1?redeploy=true", cubeID), token, nil); status != http.StatusForbidden {
+		t.Errorf("rollback with a redeploy = %d %s, want 403", status, body)
+	}
+	if status, body := call(t, http.MethodPost, fmt.Sprintf("/api/cube/%d/rollback/9", cubeID), token, nil); status != http.StatusNotFound {
+		t.Errorf("rollback to a missing revision = %d %s, want 404", status, body)
+	}
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"embed"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/turplespace/portos/internal/openapi"
+)
+
+// swaggerUI holds the vendored Swagger UI files, see swagger-ui/README.md. The page shares the
+// origin and the session cookie of the API, so it loads no script from another origin.
+//
+//go:embed swagger-ui/swagger-ui.css swagger-ui/swagger-ui-bundle.js
+var swaggerUI embed.FS
+
+// docsPage renders /api/openapi.json with Swagger UI
+const docsPage = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Turple Cubes API</title>
+  <link rel="stylesheet" href="/api/docs/swagger-ui.css">
+</head>
+<body>
+  <div id="docs"></div>
+  <script src="/api/docs/swagger-ui-bundle.js"></script>
+  <script>
+    window.onload = () => {
+      window.ui = SwaggerUIBundle({ url: "/api/openapi.json", dom_id: "#docs", withCredentials: true });
+    };
+  </script>
+</body>
+</html>
+`
+
+// HandleGetOpenAPISpec returns the OpenAPI 3 document of the API
+func HandleGetOpenAPISpec(c echo.Context) error {
+	return c.JSON(http.StatusOK, openapi.Spec())
+}
+
+// HandleGetDocs serves the interactive API documentation
+func HandleGetDocs(c echo.Context) error {
+	return c.HTML(http.StatusOK, docsPage)
+}
+
+// HandleGetDocsFile serves a file of Swagger UI for the documentation page
+func HandleGetDocsFile(c echo.Context) error {
+	return echo.StaticFileHandler("swagger-ui/"+c.Param("file"), swaggerUI)(c)
+}
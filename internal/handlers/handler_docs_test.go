@@ -0,0 +1,32 @@
+package handlers_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestDocsLoadNoScriptFromAnotherOrigin(t *testing.T) {
+	status, page := call(t, http.MethodGet, "/api/docs", "", nil)
+	if status != http.StatusOK {
+		t.Fatalf("docs page = %d, want 200", status)
+	}
+	for _, file := range []string{"/api/docs/swagger-ui.css", "/api/docs/swagger-ui-bundle.js"} {
+		if !strings.Contains(string(page), `"`+file+`"`) {
+			t.Errorf("docs page does not load %s", file)
+		}
+		if status, body := call(t, http.MethodGet, file, "", nil); status != http.StatusOK || len(body) == 0 {
+			t.Errorf("GET %s = %d with %d bytes, want the vendored file", file, status, len(body))
+		}
+	}
+	if strings.Contains(string(page), "://") {
+		t.Errorf("docs page references another origin:\n%s", page)
+	}
+
+	// Only the embedded files are served
+	for _, file := range []string{"README.md", "LICENSE", "..%2Fhandler_docs.go"} {
+		if status, _ := call(t, http.MethodGet, "/api/docs/"+file, "", nil); status != http.StatusNotFound {
+			t.Errorf("GET /api/docs/%s = %d, want 404", file, status)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/labstack/echo/v4"
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/internal/middleware"
+	"github.com/turplespace/portos/internal/response"
+	"github.com/turplespace/portos/internal/services/deploy"
+	"github.com/turplespace/portos/internal/services/docker"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+// execWriter sends the output of an exec as binary messages prefixed with the stream
+type execWriter struct {
+	conn   *websocket.Conn
+	mu     *sync.Mutex
+	stream byte
+}
+
+func (w execWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err := w.conn.WriteMessage(websocket.BinaryMessage, append([]byte{w.stream}, p...)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+/*
+HandleExecCube runs a command in the running container of a cube over a WebSocket, see
+models.ExecMessage for the protocol. The command is given by repeated cmd query params and
+defaults to sh, tty=true allocates a terminal.
+*/
+func HandleExecCube(c echo.Context) error {
+	cubeID, err := strconv.Atoi(c.Param("cubeID"))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid cube ID")
+	}
+
+	cmd := c.QueryParams()["cmd"]
+	if len(cmd) == 0 {
+		cmd = []string{"sh"}
+	}
+	tty := false
+	if value := c.QueryParam("tty"); value != "" {
+		if tty, err = strconv.ParseBool(value); err != nil {
+			return response.Error(c, http.StatusBadRequest, "Invalid tty, expected true or false")
+		}
+	}
+	middleware.AuditChange(c, nil, models.ExecRequest{Command: cmd, TTY: tty})
+
+	cube, err := database.GetCubeData(cubeID)
+	if err != nil {
+		log.Printf("[*] Database error while fetching cube data: %v", err)
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to get cube data: %v", err))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// A cube with replicas runs the command in its first replica
+	session, err := docker.StartExec(ctx, deploy.ContainerNames(*cube)[0], cmd, tty)
+	if err != nil {
+		log.Printf("[*] Docker error while starting exec in %s: %v", cube.Name, err)
+		return response.Error(c, http.StatusConflict, fmt.Sprintf("Failed to exec in cube: %v", err))
+	}
+	defer session.Close()
+
+	conn, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
+	if err != nil {
+		log.Printf("[*] Failed to upgrade exec connection: %v", err)
+		return nil
+	}
+	defer conn.Close()
+	log.Printf("[*] Started exec %v in cube %s", cmd, cube.Name)
+
+	// Forward stdin and control messages until the client goes away
+	go func() {
+		defer session.Close()
+		for {
+			kind, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if kind == websocket.BinaryMessage {
+				if _, err := session.Write(data); err != nil {
+					return
+				}
+				continue
+			}
+
+			var message models.ExecMessage
+			if err := json.Unmarshal(data, &message); err != nil {
+				log.Printf("[*] Error: Invalid exec message from client: %v", err)
+				continue
+			}
+			switch message.Type {
+			case models.ExecResize:
+				if err := session.Resize(ctx, message.Cols, message.Rows); err != nil {
+					log.Printf("[*] Error: Failed to resize exec terminal: %v", err)
+				}
+			case models.ExecEOF:
+				if err := session.CloseStdin(); err != nil {
+					log.Printf("[*] Error: Failed to close exec stdin: %v", err)
+				}
+			}
+		}
+	}()
+
+	var mu sync.Mutex
+	if err := session.CopyOutput(execWriter{conn, &mu, models.ExecStdout}, execWriter{conn, &mu, models.ExecStderr}); err != nil {
+		log.Printf("[*] Exec output of cube %s ended: %v", cube.Name, err)
+	}
+
+	exit := models.ExecMessage{Type: models.ExecExit}
+	if exit.ExitCode, err = session.ExitCode(ctx); err != nil {
+		exit.Error = err.Error()
+	}
+	log.Printf("[*] Exec %v in cube %s exited with %d", cmd, cube.Name, exit.ExitCode)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if err := conn.WriteJSON(exit); err == nil {
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+	}
+	return nil
+}
@@ -6,8 +6,9 @@ import (
 	"time"
 
 	"github.com/labstack/echo/v4"
-	"github.com/turplespace/portos/internal/models"
+	"github.com/turplespace/portos/internal/response"
 	"github.com/turplespace/portos/internal/services/repositories"
+	"github.com/turplespace/portos/pkg/models"
 )
 
 // HandleGetImages function returns all the images in the repository
@@ -18,7 +19,7 @@ func HandleGetImages(c echo.Context) error {
 	images, err := repositories.ReadImages()
 	if err != nil {
 		log.Printf("[*] Error: Unable to read images from file: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Unable to open images.json file"})
+		return response.Error(c, http.StatusInternalServerError, "Unable to open images.json file")
 	}
 	log.Printf("[*] Successfully read images from repository")
 
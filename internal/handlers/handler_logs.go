@@ -1,20 +1,44 @@
 package handlers
 
 import (
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
 
 	"github.com/gorilla/websocket"
 	"github.com/labstack/echo/v4"
+	"github.com/turplespace/portos/internal/config"
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/internal/response"
 	"github.com/turplespace/portos/internal/services"
+	"github.com/turplespace/portos/internal/services/deploy"
+	"github.com/turplespace/portos/internal/services/docker"
 )
 
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all origins for development
-	},
+	CheckOrigin:     checkOrigin,
+}
+
+// checkOrigin accepts WebSocket upgrades from the same host or from one of the configured origins
+func checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range config.Get().AllowedOrigins {
+		if origin == allowed {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return u.Host == r.Host
 }
 
 // HandleLogStream handles WebSocket connections for real-time log streaming
@@ -22,7 +46,7 @@ func HandleLogStream(c echo.Context) error {
 	conn, err := upgrader.Upgrade(c.Response(), c.Request(), nil)
 	if err != nil {
 		log.Printf("Failed to upgrade connection: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Could not upgrade connection"})
+		return response.Error(c, http.StatusInternalServerError, "Could not upgrade connection")
 	}
 	defer conn.Close()
 
@@ -52,3 +76,33 @@ func HandleLogStream(c echo.Context) error {
 
 	return nil
 }
+
+// HandleGetCubeLogs returns the last lines of the container logs of a cube, tail defaults to 200
+func HandleGetCubeLogs(c echo.Context) error {
+	cubeID, err := strconv.Atoi(c.Param("cubeID"))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid cube ID")
+	}
+
+	tail := c.QueryParam("tail")
+	if tail == "" {
+		tail = "200"
+	} else if _, err := strconv.Atoi(tail); err != nil && tail != "all" {
+		return response.Error(c, http.StatusBadRequest, "Invalid tail, expected a number or all")
+	}
+
+	cube, err := database.GetCubeData(cubeID)
+	if err != nil {
+		log.Printf("[*] Database error while fetching cube data: %v", err)
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to get cube data: %v", err))
+	}
+
+	// A cube with replicas shows the logs of its first replica
+	logs, err := docker.GetContainerLogs(deploy.ContainerNames(*cube)[0], tail)
+	if err != nil {
+		log.Printf("[*] Docker error while reading logs of %s: %v", cube.Name, err)
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to get cube logs: %v", err))
+	}
+
+	return c.String(http.StatusOK, logs)
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/internal/middleware"
+	"github.com/turplespace/portos/internal/response"
+	"github.com/turplespace/portos/internal/validation"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+// HandleGetWorkspaceMembers returns the members of a workspace with their roles
+func HandleGetWorkspaceMembers(c echo.Context) error {
+	workspaceID, err := strconv.Atoi(c.Param("workspaceID"))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid workspace ID")
+	}
+
+	members, err := database.ListWorkspaceMembers(workspaceID)
+	if err != nil {
+		log.Printf("[*] Error: Failed to list members of workspace %d: %v", workspaceID, err)
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to list members: %v", err))
+	}
+
+	return c.JSON(http.StatusOK, members)
+}
+
+// HandleSetWorkspaceMember adds a user to a workspace or changes its role
+func HandleSetWorkspaceMember(c echo.Context) error {
+	workspaceID, err := strconv.Atoi(c.Param("workspaceID"))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid workspace ID")
+	}
+	userID, err := strconv.Atoi(c.Param("userID"))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid user ID")
+	}
+
+	var req models.SetWorkspaceMemberRequest
+	if err := validation.Bind(c, &req); err != nil {
+		return response.Invalid(c, err)
+	}
+
+	if _, err := database.GetUserByID(userID); err != nil {
+		return response.Error(c, http.StatusNotFound, "User not found")
+	}
+
+	before, _ := database.GetWorkspaceRole(workspaceID, userID)
+	middleware.AuditChange(c, map[string]string{"role": before}, map[string]string{"role": req.Role})
+	if err := database.SetWorkspaceMember(workspaceID, userID, req.Role); err != nil {
+		log.Printf("[*] Error: Failed to set member %d of workspace %d: %v", userID, workspaceID, err)
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to set member: %v", err))
+	}
+
+	log.Printf("[*] User %d is now %s of workspace %d", userID, req.Role, workspaceID)
+	return c.JSON(http.StatusOK, map[string]string{"message": "Member updated successfully"})
+}
+
+// HandleRemoveWorkspaceMember removes a user from a workspace
+func HandleRemoveWorkspaceMember(c echo.Context) error {
+	workspaceID, err := strconv.Atoi(c.Param("workspaceID"))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid workspace ID")
+	}
+	userID, err := strconv.Atoi(c.Param("userID"))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid user ID")
+	}
+
+	if before, err := database.GetWorkspaceRole(workspaceID, userID); err == nil {
+		middleware.AuditChange(c, map[string]string{"role": before}, nil)
+	}
+	if err := database.RemoveWorkspaceMember(workspaceID, userID); err != nil {
+		log.Printf("[*] Error: Failed to remove member %d of workspace %d: %v", userID, workspaceID, err)
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to remove member: %v", err))
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Member removed successfully"})
+}
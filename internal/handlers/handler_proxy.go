@@ -1,24 +1,31 @@
 package handlers
 
 import (
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
 
 	"github.com/labstack/echo/v4"
 	"github.com/turplespace/portos/internal/database"
-	"github.com/turplespace/portos/internal/models"
+	"github.com/turplespace/portos/internal/middleware"
+	"github.com/turplespace/portos/internal/response"
+	"github.com/turplespace/portos/internal/services/auth"
+	"github.com/turplespace/portos/internal/services/deploy"
+	"github.com/turplespace/portos/internal/services/quota"
+	"github.com/turplespace/portos/internal/validation"
+	"github.com/turplespace/portos/pkg/models"
 )
 
 func HandleGetProxyByID(c echo.Context) error {
 	id, err := strconv.Atoi(c.Param("proxyID"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid proxy ID"})
+		return response.Error(c, http.StatusBadRequest, "Invalid proxy ID")
 	}
 
 	proxy, err := database.GetProxyByID(id)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to get proxy"})
+		return response.Error(c, http.StatusInternalServerError, "Failed to get proxy")
 	}
 
 	return c.JSON(http.StatusOK, proxy)
@@ -27,12 +34,12 @@ func HandleGetProxyByID(c echo.Context) error {
 func HandleGetProxiesByCubeID(c echo.Context) error {
 	cubeID, err := strconv.Atoi(c.Param("cubeID"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid cube ID"})
+		return response.Error(c, http.StatusBadRequest, "Invalid cube ID")
 	}
 
 	proxies, err := database.GetProxiesByCubeID(cubeID)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to get proxies"})
+		return response.Error(c, http.StatusInternalServerError, "Failed to get proxies")
 	}
 
 	return c.JSON(http.StatusOK, proxies)
@@ -40,8 +47,21 @@ func HandleGetProxiesByCubeID(c echo.Context) error {
 
 func HandleAddProxy(c echo.Context) error {
 	var req models.AddProxyRequest
-	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request payload"})
+	if err := validation.Bind(c, &req); err != nil {
+		return response.Invalid(c, err)
+	}
+
+	middleware.AuditChange(c, nil, req)
+	workspaceID, err := database.GetWorkspaceIDByCubeID(req.CubeID)
+	if err != nil {
+		return response.Error(c, http.StatusNotFound, "Cube not found")
+	}
+	middleware.AuditTarget(c, 0, workspaceID)
+	if err := middleware.Authorize(c, workspaceID, auth.ActionProxyWrite); err != nil {
+		return response.Error(c, http.StatusForbidden, err.Error())
+	}
+	if err := quota.CheckProxy(workspaceID); err != nil {
+		return quotaError(c, err, err.Error())
 	}
 
 	// Check if the domain already exists
@@ -53,11 +73,20 @@ func HandleAddProxy(c echo.Context) error {
 		})
 	}
 
+	cube, err := database.GetCubeData(req.CubeID)
+	if err != nil {
+		return response.Error(c, http.StatusNotFound, "Cube not found")
+	}
+	if err := deploy.CheckProxyDomain(workspaceID, cube.Name, req.Domain, 0); err != nil {
+		return proxyError(c, err, fmt.Sprintf("Failed to add proxy: %v", err))
+	}
+
 	id, err := database.AddProxy(req.CubeID, req.Domain, req.Port, req.Type, req.Default)
 	if err != nil {
 		log.Printf("Failed to add proxy: %s", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to add proxy"})
+		return response.Error(c, http.StatusInternalServerError, "Failed to add proxy")
 	}
+	middleware.AuditTarget(c, int(id), workspaceID)
 
 	return c.JSON(http.StatusOK, map[string]interface{}{"id": id})
 }
@@ -65,15 +94,30 @@ func HandleAddProxy(c echo.Context) error {
 func HandleEditProxyByID(c echo.Context) error {
 	id, err := strconv.Atoi(c.Param("proxyID"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid proxy ID"})
+		return response.Error(c, http.StatusBadRequest, "Invalid proxy ID")
 	}
 	var req models.EditProxyByIDRequest
-	if err := c.Bind(&req); err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid request payload"})
+	if err := validation.Bind(c, &req); err != nil {
+		return response.Invalid(c, err)
+	}
+
+	before, err := database.GetProxyByID(id)
+	if err != nil {
+		return response.Error(c, http.StatusNotFound, "Proxy not found")
 	}
+	after := *before
+	after.Domain, after.Port, after.Type, after.Default = req.Domain, req.Port, req.Type, req.Default
+	middleware.AuditChange(c, before, after)
 
+	cube, err := database.GetCubeData(before.CubeID)
+	if err != nil {
+		return response.Error(c, http.StatusNotFound, "Cube not found")
+	}
+	if err := deploy.CheckProxyDomain(middleware.CurrentWorkspaceID(c), cube.Name, req.Domain, id); err != nil {
+		return proxyError(c, err, fmt.Sprintf("Failed to edit proxy: %v", err))
+	}
 	if err := database.EditProxyByID(id, req.Domain, req.Port, req.Type, req.Default); err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to edit proxy"})
+		return response.Error(c, http.StatusInternalServerError, "Failed to edit proxy")
 	}
 
 	return c.JSON(http.StatusOK, map[string]string{"message": "Proxy updated successfully"})
@@ -82,11 +126,13 @@ func HandleEditProxyByID(c echo.Context) error {
 func HandleDeleteProxyByID(c echo.Context) error {
 	id, err := strconv.Atoi(c.Param("proxyID"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid proxy ID"})
+		return response.Error(c, http.StatusBadRequest, "Invalid proxy ID")
 	}
 
+	before, _ := database.GetProxyByID(id)
+	middleware.AuditChange(c, before, nil)
 	if err := database.DeleteProxyByID(id); err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete proxy"})
+		return response.Error(c, http.StatusInternalServerError, "Failed to delete proxy")
 	}
 
 	return c.JSON(http.StatusOK, map[string]string{"message": "Proxy deleted successfully"})
@@ -95,11 +141,13 @@ func HandleDeleteProxyByID(c echo.Context) error {
 func HandleDeleteProxiesByCubeID(c echo.Context) error {
 	cubeID, err := strconv.Atoi(c.Param("cubeID"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid cube ID"})
+		return response.Error(c, http.StatusBadRequest, "Invalid cube ID")
 	}
 
+	before, _ := database.GetProxiesByCubeID(cubeID)
+	middleware.AuditChange(c, before, nil)
 	if err := database.DeleteProxiesByCubeID(cubeID); err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to delete proxies"})
+		return response.Error(c, http.StatusInternalServerError, "Failed to delete proxies")
 	}
 
 	return c.JSON(http.StatusOK, map[string]string{"message": "Proxies deleted successfully"})
@@ -1,13 +1,17 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 
 	"github.com/labstack/echo/v4"
 	"github.com/turplespace/portos/internal/database"
-	"github.com/turplespace/portos/internal/services/docker"
+	"github.com/turplespace/portos/internal/middleware"
+	"github.com/turplespace/portos/internal/response"
+	"github.com/turplespace/portos/internal/services/deploy"
 	"github.com/turplespace/portos/internal/services/proxy"
 )
 
@@ -16,37 +20,55 @@ func HandlePostStartProxy(c echo.Context) error {
 
 	proxyIDStr := c.Param("proxyID")
 	if proxyIDStr == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Missing proxy ID"})
+		return response.Error(c, http.StatusBadRequest, "Missing proxy ID")
 	}
 
 	proxyID, err := strconv.Atoi(proxyIDStr)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid proxy ID"})
+		return response.Error(c, http.StatusBadRequest, "Invalid proxy ID")
 	}
 	proxyData, err := database.GetProxyByID(proxyID)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to fetch proxy data"})
+		return response.Error(c, http.StatusInternalServerError, "Failed to fetch proxy data")
 	}
 
 	// Get cube data from the database
 	container, err := database.GetCubeData(proxyData.CubeID)
 	if err != nil {
 
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to get cube data: %v", err)})
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to get cube data: %v", err))
 	}
-	ipAddress, err := docker.GetContainerIPAddress(container.Name)
+	// Requests are spread over the running replicas of the cube
+	ipAddresses, err := deploy.ReplicaIPs(middleware.CurrentWorkspaceID(c), *container)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to get container IP address: %v", err)})
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to get container IP address: %v", err))
 	}
-	if err := proxy.GenerateNginxProxyConfig(ipAddress, proxyData.Port, proxyData.Domain); err != nil {
-		fmt.Println(err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to generate proxy config"})
+	domain, err := deploy.ProxyDomain(proxyData.ID)
+	if err != nil {
+		return proxyError(c, err, fmt.Sprintf("Failed to expand proxy domain: %v", err))
 	}
-
-	if err := proxy.RestartNginxService(); err != nil {
-		fmt.Println(err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": "Failed to restart Nginx service"})
+	batch, err := proxy.NewBatch()
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to generate proxy config: %v", err))
+	}
+	if err := batch.Write(ipAddresses, proxyData.Port, domain, container.LoadBalancing); err != nil {
+		batch.Discard()
+		log.Printf("[*] Error: Failed to generate proxy config of %s: %v", domain, err)
+		return proxyError(c, err, fmt.Sprintf("Failed to generate proxy config: %v", err))
+	}
+	// The previous configuration is restored when Nginx rejects the new one or fails to reload
+	if err := batch.Apply(); err != nil {
+		log.Printf("[*] Error: Failed to apply proxy config of %s: %v", domain, err)
+		return proxyError(c, err, fmt.Sprintf("Failed to apply proxy config: %v", err))
 	}
 
 	return c.JSON(http.StatusOK, map[string]string{"message": "Proxy configuration generated successfully"})
 }
+
+// proxyError writes a 400 invalid_proxy_config response for configurations rejected by Nginx and a 500 response for any other error
+func proxyError(c echo.Context, err error, message string) error {
+	if errors.Is(err, proxy.ErrInvalidConfig) {
+		return response.ErrorCode(c, http.StatusBadRequest, response.CodeInvalidProxyConfig, message)
+	}
+	return response.Error(c, http.StatusInternalServerError, message)
+}
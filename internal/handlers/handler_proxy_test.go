@@ -0,0 +1,61 @@
+package handlers_test
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/internal/services/auth"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+func TestProxyDomainsAreCheckedOnceExpanded(t *testing.T) {
+	workspaceID, err := database.CreateWorkspace("domains", "created by "+t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cubeID, err := database.InsertWorkspaceAndCubes(int(workspaceID), models.Container{Name: "domains-web", Image: "nginx"}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := newToken(t, database.APIToken{UserID: 1, Kind: auth.TokenKindPersonal, Scopes: []string{string(auth.ActionProxyWrite), string(auth.ActionWorkspaceWrite)}})
+	variable := fmt.Sprintf("/api/workspace/%d/variables/", workspaceID)
+	addProxy := func(domain string) (int, []byte) {
+		return call(t, http.MethodPost, "/api/proxy", token, models.AddProxyRequest{CubeID: int(cubeID), Domain: domain, Port: 80})
+	}
+
+	if status, body := call(t, http.MethodPut, variable+"ZONE", token, models.SetWorkspaceVariableRequest{Value: "example.com"}); status != http.StatusOK {
+		t.Fatalf("set ZONE = %d %s", status, body)
+	}
+	for _, domain := range []string{"app.example.com", "web.${ZONE}"} {
+		if status, body := addProxy(domain); status != http.StatusOK {
+			t.Fatalf("add %s = %d %s", domain, status, body)
+		}
+	}
+	for _, test := range []struct {
+		name, path string
+		body       interface{}
+	}{
+		{"variable injecting Nginx directives", variable + "ZONE", models.SetWorkspaceVariableRequest{Value: "x; }\nserver { listen 80"}},
+		{"variable leaving an empty label", variable + "ZONE", models.SetWorkspaceVariableRequest{Value: ""}},
+		{"deleting a referenced variable", variable + "ZONE", nil},
+		{"proxy with an unknown variable", "/api/proxy", models.AddProxyRequest{CubeID: int(cubeID), Domain: "web.${UNKNOWN}", Port: 80}},
+		{"proxy expanding to the domain of another", "/api/proxy", models.AddProxyRequest{CubeID: int(cubeID), Domain: "app.${ZONE}", Port: 80}},
+	} {
+		method := http.MethodPut
+		if test.body == nil {
+			method = http.MethodDelete
+		} else if test.path == "/api/proxy" {
+			method = http.MethodPost
+		}
+		status, body := call(t, method, test.path, token, test.body)
+		if status != http.StatusBadRequest {
+			t.Errorf("%s = %d %s, want 400", test.name, status, body)
+		}
+	}
+
+	if status, body := call(t, http.MethodPut, variable+"ZONE", token, models.SetWorkspaceVariableRequest{Value: "example.org"}); status != http.StatusOK {
+		t.Errorf("set ZONE to another valid domain = %d %s", status, body)
+	}
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/internal/middleware"
+	"github.com/turplespace/portos/internal/response"
+	"github.com/turplespace/portos/internal/services/quota"
+	"github.com/turplespace/portos/internal/validation"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+// HandleGetWorkspaceQuota returns the quota of a workspace and what its cubes currently use
+func HandleGetWorkspaceQuota(c echo.Context) error {
+	workspaceID, err := strconv.Atoi(c.Param("workspaceID"))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid workspace ID")
+	}
+
+	workspaceQuota, err := database.GetWorkspaceQuota(workspaceID)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to get quota: %v", err))
+	}
+	usage, err := quota.Usage(workspaceID)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to get quota usage: %v", err))
+	}
+
+	return c.JSON(http.StatusOK, models.WorkspaceQuotaResponse{Quota: workspaceQuota, Usage: usage})
+}
+
+/*
+HandleSetWorkspaceQuota sets the quota of a workspace from the request body.
+A quota lower than the current usage is accepted, it blocks further changes and deploys
+until the workspace is back under it.
+*/
+func HandleSetWorkspaceQuota(c echo.Context) error {
+	workspaceID, err := strconv.Atoi(c.Param("workspaceID"))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid workspace ID")
+	}
+
+	var req models.WorkspaceQuota
+	if err := validation.Bind(c, &req); err != nil {
+		return response.Invalid(c, err)
+	}
+	if err := quota.Validate(req); err != nil {
+		return response.Error(c, http.StatusBadRequest, err.Error())
+	}
+
+	before, _ := database.GetWorkspaceQuota(workspaceID)
+	middleware.AuditChange(c, before, req)
+
+	if err := database.SetWorkspaceQuota(workspaceID, req); err != nil {
+		log.Printf("[*] Error: Failed to set quota of workspace %d: %v", workspaceID, err)
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to set quota: %v", err))
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Quota updated successfully"})
+}
+
+// HandleDeleteWorkspaceQuota removes the quota of a workspace
+func HandleDeleteWorkspaceQuota(c echo.Context) error {
+	workspaceID, err := strconv.Atoi(c.Param("workspaceID"))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid workspace ID")
+	}
+
+	before, _ := database.GetWorkspaceQuota(workspaceID)
+	middleware.AuditChange(c, before, nil)
+
+	if err := database.DeleteWorkspaceQuota(workspaceID); err != nil {
+		log.Printf("[*] Error: Failed to delete quota of workspace %d: %v", workspaceID, err)
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to delete quota: %v", err))
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Quota removed successfully"})
+}
+
+// quotaError writes a 403 quota_exceeded response for quota errors and a 500 response for any other error
+func quotaError(c echo.Context, err error, message string) error {
+	var exceeded *quota.ExceededError
+	if errors.As(err, &exceeded) {
+		return response.ErrorCode(c, http.StatusForbidden, response.CodeQuotaExceeded, message)
+	}
+	return response.Error(c, http.StatusInternalServerError, message)
+}
@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/internal/middleware"
+	"github.com/turplespace/portos/internal/response"
+	"github.com/turplespace/portos/internal/services/deploy"
+	"github.com/turplespace/portos/internal/services/secrets"
+	"github.com/turplespace/portos/internal/validation"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+// HandleGetSecrets returns the names and versions of the secrets of a workspace, never their values
+func HandleGetSecrets(c echo.Context) error {
+	workspaceID, err := strconv.Atoi(c.Param("workspaceID"))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid workspace ID")
+	}
+
+	list, err := database.ListSecrets(workspaceID)
+	if err != nil {
+		log.Printf("[*] Error: Failed to list secrets of workspace %d: %v", workspaceID, err)
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to get secrets: %v", err))
+	}
+
+	return c.JSON(http.StatusOK, list)
+}
+
+/*
+HandleSetSecret creates or rotates a secret of a workspace from the value in the request body.
+Rotating a secret recreates the running containers referencing it so they pick up the new value.
+*/
+func HandleSetSecret(c echo.Context) error {
+	workspaceID, err := strconv.Atoi(c.Param("workspaceID"))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid workspace ID")
+	}
+	name := c.Param("name")
+
+	var req models.SetSecretRequest
+	if err := validation.Bind(c, &req); err != nil {
+		return response.Invalid(c, err)
+	}
+
+	version, err := secrets.Set(workspaceID, name, req.Value)
+	if errors.Is(err, secrets.ErrNoMasterKey) {
+		return response.Error(c, http.StatusServiceUnavailable, err.Error())
+	}
+	if err != nil {
+		log.Printf("[*] Error: Failed to set secret %s of workspace %d: %v", name, workspaceID, err)
+		return response.Error(c, http.StatusBadRequest, fmt.Sprintf("Failed to set secret: %v", err))
+	}
+	middleware.AuditChange(c, nil, map[string]interface{}{"name": name, "version": version})
+
+	result := models.SetSecretResponse{Name: name, Version: version, Recreated: []string{}}
+	if version > 1 {
+		result.Recreated, err = deploy.RecreateSecretConsumers(workspaceID, name)
+		if err != nil {
+			log.Printf("[*] Error: Failed to recreate containers using secret %s: %v", name, err)
+			return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Secret rotated but %v", err))
+		}
+	}
+
+	log.Printf("[*] Secret %s of workspace %d set to version %d", name, workspaceID, version)
+	return c.JSON(http.StatusOK, result)
+}
+
+// HandleDeleteSecret deletes a secret of a workspace, cubes still referencing it will fail to deploy
+func HandleDeleteSecret(c echo.Context) error {
+	workspaceID, err := strconv.Atoi(c.Param("workspaceID"))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid workspace ID")
+	}
+	name := c.Param("name")
+
+	if err := database.DeleteSecret(workspaceID, name); err != nil {
+		return response.Error(c, http.StatusNotFound, err.Error())
+	}
+	middleware.AuditChange(c, map[string]string{"name": name}, nil)
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Secret deleted successfully"})
+}
@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/internal/middleware"
+	"github.com/turplespace/portos/internal/response"
+	"github.com/turplespace/portos/internal/services/auth"
+	"github.com/turplespace/portos/internal/services/export"
+	"github.com/turplespace/portos/internal/services/spec"
+	"github.com/turplespace/portos/internal/validation"
+	"github.com/turplespace/portos/pkg/models"
+	"gopkg.in/yaml.v3"
+)
+
+// maxSpecSize caps the size of a workspace spec
+const maxSpecSize = 1 << 20
+
+/*
+HandleApplyWorkspace applies a workspace spec sent as JSON, or as YAML with a YAML content type.
+The spec is matched with the workspace of the same name, which is created when missing.
+dry_run=true returns the plan without changing anything.
+*/
+func HandleApplyWorkspace(c echo.Context) error {
+	log.Println("[*] Starting apply workspace request")
+
+	dryRun, err := dryRunParam(c)
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid dry_run, expected true or false")
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, maxSpecSize+1))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Failed to read request body")
+	}
+	if len(body) > maxSpecSize {
+		return response.Error(c, http.StatusRequestEntityTooLarge, "Workspace spec is too large")
+	}
+
+	var workspaceSpec models.WorkspaceSpec
+	if strings.Contains(c.Request().Header.Get(echo.HeaderContentType), "yaml") {
+		err = yaml.Unmarshal(body, &workspaceSpec)
+	} else {
+		err = json.Unmarshal(body, &workspaceSpec)
+	}
+	if err != nil {
+		log.Printf("[*] Error: Invalid workspace spec - %v", err)
+		return response.Error(c, http.StatusBadRequest, fmt.Sprintf("Invalid workspace spec: %v", err))
+	}
+	if err := validation.Struct(&workspaceSpec); err != nil {
+		return response.Invalid(c, err)
+	}
+
+	return applySpec(c, workspaceSpec, specApply{dryRun: dryRun})
+}
+
+// specApply tells applySpec how to apply a spec
+type specApply struct {
+	dryRun   bool
+	create   bool     // An existing workspace of the same name is a conflict
+	warnings []string // Found while building the spec, listed before those of the apply
+}
+
+/*
+applySpec plans a spec, checks that the current user may make its changes and applies them,
+or returns the plan of a dry run. The creator of a new workspace becomes its owner.
+*/
+func applySpec(c echo.Context, workspaceSpec models.WorkspaceSpec, options specApply) error {
+	plan, err := spec.NewPlan(workspaceSpec)
+	if err != nil {
+		var invalid *spec.InvalidError
+		if errors.As(err, &invalid) {
+			return response.Error(c, http.StatusBadRequest, err.Error())
+		}
+		log.Printf("[*] Error: Failed to plan workspace %s: %v", workspaceSpec.Name, err)
+		return quotaError(c, err, fmt.Sprintf("Failed to plan workspace: %v", err))
+	}
+	if options.create && plan.WorkspaceID != 0 {
+		return response.Error(c, http.StatusConflict, fmt.Sprintf("Workspace %s already exists", workspaceSpec.Name))
+	}
+
+	var before *models.WorkspaceSpec
+	if plan.WorkspaceID != 0 {
+		middleware.AuditTarget(c, plan.WorkspaceID, plan.WorkspaceID)
+		if before, err = spec.Export(plan.WorkspaceID); err != nil {
+			log.Printf("[*] Warning: Unable to export workspace before apply: %v", err)
+		}
+	}
+	middleware.AuditChange(c, before, workspaceSpec)
+	if err := authorizeApply(c, plan); err != nil {
+		return response.Error(c, http.StatusForbidden, err.Error())
+	}
+
+	if options.dryRun {
+		result := plan.Response(true)
+		result.Warnings = options.warnings
+		return c.JSON(http.StatusOK, result)
+	}
+
+	created := plan.WorkspaceID == 0
+	result, err := plan.Apply(middleware.Actor(c))
+	if err != nil {
+		log.Printf("[*] Error: Failed to apply workspace %s: %v", workspaceSpec.Name, err)
+		return cubeStoreError(c, err, fmt.Sprintf("Failed to apply workspace: %v", err))
+	}
+	result.Warnings = append(options.warnings, result.Warnings...)
+	if created {
+		middleware.AuditTarget(c, result.WorkspaceID, result.WorkspaceID)
+		// The creator becomes the owner of the workspace
+		if user := middleware.CurrentUser(c); user != nil {
+			if err := database.SetWorkspaceMember(result.WorkspaceID, user.ID, string(auth.RoleOwner)); err != nil {
+				log.Printf("[*] Warning: Failed to add workspace owner: %v", err)
+			}
+		}
+	}
+
+	log.Printf("[*] Successfully applied workspace %s with %d changes", workspaceSpec.Name, len(result.Changes))
+	return c.JSON(http.StatusOK, result)
+}
+
+/*
+HandleImportCompose creates a workspace from a docker-compose file sent as the request body. The
+workspace is named after the name query parameter, or the name of the compose file. Compose keys
+that have no equivalent are reported as warnings. dry_run=true returns the plan without creating it.
+*/
+func HandleImportCompose(c echo.Context) error {
+	log.Println("[*] Starting import compose request")
+
+	dryRun, err := dryRunParam(c)
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid dry_run, expected true or false")
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request().Body, maxSpecSize+1))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Failed to read request body")
+	}
+	if len(body) > maxSpecSize {
+		return response.Error(c, http.StatusRequestEntityTooLarge, "Compose file is too large")
+	}
+
+	workspaceSpec, warnings, err := spec.ParseCompose(body)
+	if err != nil {
+		log.Printf("[*] Error: Invalid compose file - %v", err)
+		return response.Error(c, http.StatusBadRequest, err.Error())
+	}
+	if name := c.QueryParam("name"); name != "" {
+		workspaceSpec.Name = name
+	}
+	if workspaceSpec.Name == "" {
+		return response.Error(c, http.StatusBadRequest, "Workspace name is required, set the name query parameter or the name of the compose file")
+	}
+	workspaceSpec.Desc = c.QueryParam("desc")
+	if workspaceSpec.Desc == "" {
+		workspaceSpec.Desc = "Imported from a compose file"
+	}
+	if err := validation.Struct(workspaceSpec); err != nil {
+		return response.Invalid(c, err)
+	}
+
+	return applySpec(c, *workspaceSpec, specApply{dryRun: dryRun, create: true, warnings: warnings})
+}
+
+// dryRunParam parses the dry_run query parameter, false when it is missing
+func dryRunParam(c echo.Context) (bool, error) {
+	value := c.QueryParam("dry_run")
+	if value == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+/*
+authorizeApply checks that the current user may make the changes of a plan: creating a workspace
+needs an admin like POST /api/workspace, changes to an existing one need the permission of the
+matching route for each kind of object, and deploy when running cubes are recreated.
+*/
+func authorizeApply(c echo.Context, plan *spec.Plan) error {
+	if plan.WorkspaceID == 0 {
+		user := middleware.CurrentUser(c)
+		if user == nil || !user.IsAdmin {
+			return errors.New("admin privileges required to create a workspace")
+		}
+		if token := middleware.CurrentToken(c); token != nil && !auth.TokenHasScope(token, auth.ScopeAdmin) {
+			return errors.New("API token lacks the admin scope")
+		}
+		return nil
+	}
+
+	actions := map[auth.Action]bool{auth.ActionWorkspaceWrite: true}
+	for _, change := range plan.Changes {
+		switch change.Kind {
+		case "cube":
+			actions[auth.ActionCubeWrite] = true
+		case "proxy":
+			actions[auth.ActionProxyWrite] = true
+		}
+		if change.Action == models.PlanRecreate {
+			actions[auth.ActionDeploy] = true
+		}
+	}
+	for _, action := range []auth.Action{auth.ActionWorkspaceWrite, auth.ActionCubeWrite, auth.ActionProxyWrite, auth.ActionDeploy} {
+		if !actions[action] {
+			continue
+		}
+		if err := middleware.Authorize(c, plan.WorkspaceID, action); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// HandleGetWorkspaceSpec returns the spec of a workspace, applying it leaves the workspace unchanged
+func HandleGetWorkspaceSpec(c echo.Context) error {
+	workspaceID, err := strconv.Atoi(c.Param("workspaceID"))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid workspace ID")
+	}
+
+	workspaceSpec, err := spec.Export(workspaceID)
+	if err != nil {
+		log.Printf("[*] Error: Failed to export workspace %d: %v", workspaceID, err)
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to export workspace: %v", err))
+	}
+
+	if strings.Contains(c.Request().Header.Get(echo.HeaderAccept), "yaml") {
+		var data bytes.Buffer
+		encoder := yaml.NewEncoder(&data)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(workspaceSpec); err != nil {
+			return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to encode workspace spec: %v", err))
+		}
+		encoder.Close()
+		return c.Blob(http.StatusOK, "application/yaml", data.Bytes())
+	}
+	return c.JSON(http.StatusOK, workspaceSpec)
+}
+
+/*
+HandleExportWorkspace returns the workspace rendered as a docker-compose file with format=compose,
+the default, or as Kubernetes manifests with format=k8s, so that it can run outside TurpleCubes.
+*/
+func HandleExportWorkspace(c echo.Context) error {
+	workspaceID, err := strconv.Atoi(c.Param("workspaceID"))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid workspace ID")
+	}
+	format := c.QueryParam("format")
+	if format == "" {
+		format = export.FormatCompose
+	}
+	if format != export.FormatCompose && format != export.FormatKubernetes {
+		return response.Error(c, http.StatusBadRequest, "Invalid format, expected compose or k8s")
+	}
+
+	workspaceSpec, err := spec.Export(workspaceID)
+	if err != nil {
+		log.Printf("[*] Error: Failed to export workspace %d: %v", workspaceID, err)
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to export workspace: %v", err))
+	}
+	data, err := export.Render(workspaceSpec, format)
+	if err != nil {
+		log.Printf("[*] Error: Failed to render workspace %d as %s: %v", workspaceID, format, err)
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to export workspace: %v", err))
+	}
+
+	c.Response().Header().Set(echo.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s-%s.yaml"`, export.FileName(workspaceSpec.Name), format))
+	return c.Blob(http.StatusOK, "application/yaml", data)
+}
@@ -0,0 +1,142 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/internal/services/auth"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+func TestApplyWorkspace(t *testing.T) {
+	token := newToken(t, database.APIToken{UserID: 1, Kind: auth.TokenKindPersonal, Scopes: []string{auth.ScopeAdmin}})
+	spec := models.WorkspaceSpec{Name: "handler-applied", Cubes: []models.CubeSpec{{Name: "handler-applied-web", Image: "nginx:1.27"}}}
+
+	status, body := call(t, http.MethodPost, "/api/workspace/apply?dry_run=true", token, spec)
+	var plan models.ApplyResponse
+	if status != http.StatusOK || json.Unmarshal(body, &plan) != nil || !plan.DryRun || len(plan.Changes) != 2 {
+		t.Fatalf("dry run = %d %s, want the workspace and cube to create", status, body)
+	}
+	if _, err := database.GetWorkspaceIDByName(spec.Name); err == nil {
+		t.Fatal("dry run created the workspace")
+	}
+
+	status, body = call(t, http.MethodPost, "/api/workspace/apply", token, spec)
+	var result models.ApplyResponse
+	if status != http.StatusOK || json.Unmarshal(body, &result) != nil || result.DryRun || result.WorkspaceID == 0 {
+		t.Fatalf("apply = %d %s", status, body)
+	}
+
+	// Specs contradicting themselves are refused before anything is stored
+	spec.Cubes[0].DependsOn = []string{"handler-applied-db"}
+	status, body = call(t, http.MethodPost, "/api/workspace/apply", token, spec)
+	var failure models.ErrorResponse
+	if status != http.StatusBadRequest || json.Unmarshal(body, &failure) != nil || failure.Code != "invalid_request" {
+		t.Fatalf("apply with an undeclared dependency = %d %s, want 400 invalid_request", status, body)
+	}
+}
+
+func TestImportCompose(t *testing.T) {
+	token := newToken(t, database.APIToken{UserID: 1, Kind: auth.TokenKindPersonal, Scopes: []string{auth.ScopeAdmin}})
+	compose := []byte("services:\n  handler-imported-web:\n    image: nginx:1.27\n")
+
+	if status, body := call(t, http.MethodPost, "/api/workspace/import/compose", token, compose); status != http.StatusBadRequest {
+		t.Fatalf("import without a name = %d %s, want 400", status, body)
+	}
+	status, body := call(t, http.MethodPost, "/api/workspace/import/compose?name=handler-imported", token, compose)
+	var result models.ApplyResponse
+	if status != http.StatusOK || json.Unmarshal(body, &result) != nil || result.WorkspaceID == 0 {
+		t.Fatalf("import = %d %s", status, body)
+	}
+	if workspace, err := database.GetWorkspaceByID(result.WorkspaceID); err != nil || workspace.Desc != "Imported from a compose file" {
+		t.Errorf("imported workspace = %+v, %v", workspace, err)
+	}
+
+	// An import only creates workspaces
+	if status, body := call(t, http.MethodPost, "/api/workspace/import/compose?name=handler-imported", token, compose); status != http.StatusConflict {
+		t.Errorf("second import = %d %s, want 409", status, body)
+	}
+}
+
+func TestExportWorkspace(t *testing.T) {
+	token := newToken(t, database.APIToken{UserID: 1, Kind: auth.TokenKindPersonal, Scopes: []string{auth.ScopeAdmin, string(auth.ActionView)}})
+	spec := models.WorkspaceSpec{Name: "handler-exported", Cubes: []models.CubeSpec{{Name: "handler-exported-web", Image: "nginx:1.27"}}}
+	status, body := call(t, http.MethodPost, "/api/workspace/apply", token, spec)
+	var result models.ApplyResponse
+	if status != http.StatusOK || json.Unmarshal(body, &result) != nil {
+		t.Fatalf("apply = %d %s", status, body)
+	}
+	path := fmt.Sprintf("/api/workspace/%d/export", result.WorkspaceID)
+
+	if status, body := call(t, http.MethodGet, path, token, nil); status != http.StatusOK || !strings.Contains(string(body), "handler-exported-web:") {
+		t.Errorf("export = %d %s, want the compose file", status, body)
+	}
+	if status, body := call(t, http.MethodGet, path+"?format=k8s", token, nil); status != http.StatusOK || !strings.Contains(string(body), "kind: Deployment") {
+		t.Errorf("k8s export = %d %s, want the manifests", status, body)
+	}
+	status, body = call(t, http.MethodGet, path+"?format=helm", token, nil)
+	var failure models.ErrorResponse
+	if status != http.StatusBadRequest || json.Unmarshal(body, &failure) != nil || failure.Code != "invalid_request" {
+		t.Errorf("helm export = %d %s, want 400 invalid_request", status, body)
+	}
+}
+
+func TestExportWorkspaceLegacyHostPath(t *testing.T) {
+	token := newToken(t, database.APIToken{UserID: 1, Kind: auth.TokenKindPersonal, Scopes: []string{auth.ScopeAdmin, string(auth.ActionView)}})
+	workspaceID, err := database.CreateWorkspace("handler-legacy", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Stored before the volume roots, which the API would now reject
+	legacy := models.Container{Name: "handler-legacy-web", Image: "nginx:1.27", Volumes: map[string]string{"/srv/legacy/html": "/usr/share/nginx/html"}}
+	if _, err := database.InsertWorkspaceAndCubes(int(workspaceID), legacy, "test"); err != nil {
+		t.Fatal(err)
+	}
+
+	status, body := call(t, http.MethodGet, fmt.Sprintf("/api/workspace/%d/export", workspaceID), token, nil)
+	if status != http.StatusOK || !strings.Contains(string(body), "/srv/legacy/html:/usr/share/nginx/html") {
+		t.Errorf("export = %d %s, want the compose file with the legacy volume", status, body)
+	}
+}
+
+func TestCloneWorkspace(t *testing.T) {
+	token := newToken(t, database.APIToken{UserID: 1, Kind: auth.TokenKindPersonal, Scopes: []string{
+		auth.ScopeAdmin, string(auth.ActionView), string(auth.ActionWorkspaceWrite), string(auth.ActionCubeWrite), string(auth.ActionProxyWrite),
+	}})
+	spec := models.WorkspaceSpec{Name: "hsource", Cubes: []models.CubeSpec{{Name: "handler-web-hsource", Image: "nginx:1.27"}}}
+	status, body := call(t, http.MethodPost, "/api/workspace/apply", token, spec)
+	var source models.ApplyResponse
+	if status != http.StatusOK || json.Unmarshal(body, &source) != nil {
+		t.Fatalf("apply = %d %s", status, body)
+	}
+	request := models.CloneWorkspaceRequest{Name: "hcopy"}
+
+	status, body = call(t, http.MethodPost, fmt.Sprintf("/api/workspace/%d/clone", source.WorkspaceID), token, request)
+	var cloned models.ApplyResponse
+	if status != http.StatusOK || json.Unmarshal(body, &cloned) != nil || cloned.WorkspaceID == 0 {
+		t.Fatalf("clone = %d %s", status, body)
+	}
+	if cubes, _, err := database.ListCubes(cloned.WorkspaceID, database.CubeFilter{}); err != nil || len(cubes) != 1 || cubes[0].Name != "handler-web-hcopy" {
+		t.Errorf("cloned cubes = %+v, %v", cubes, err)
+	}
+
+	// A clone only creates workspaces, a promotion updates them
+	if status, body := call(t, http.MethodPost, fmt.Sprintf("/api/workspace/%d/clone", source.WorkspaceID), token, request); status != http.StatusConflict {
+		t.Errorf("second clone = %d %s, want 409", status, body)
+	}
+	if status, body := call(t, http.MethodPost, fmt.Sprintf("/api/workspace/%d/promote", source.WorkspaceID), token, request); status != http.StatusOK {
+		t.Errorf("promote = %d %s", status, body)
+	}
+
+	// Copies onto the source itself are refused
+	request.Name = spec.Name
+	status, body = call(t, http.MethodPost, fmt.Sprintf("/api/workspace/%d/promote", source.WorkspaceID), token, request)
+	var failure models.ErrorResponse
+	if status != http.StatusBadRequest || json.Unmarshal(body, &failure) != nil || failure.Code != "invalid_request" {
+		t.Errorf("promote onto the source = %d %s, want 400 invalid_request", status, body)
+	}
+}
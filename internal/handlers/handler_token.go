@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/internal/middleware"
+	"github.com/turplespace/portos/internal/response"
+	"github.com/turplespace/portos/internal/services/auth"
+	"github.com/turplespace/portos/internal/validation"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+// HandleGetAPITokens lists the API tokens of the current user, admins get every token with all=true
+func HandleGetAPITokens(c echo.Context) error {
+	user := middleware.CurrentUser(c)
+	userID := user.ID
+	if user.IsAdmin && c.QueryParam("all") == "true" {
+		userID = 0
+	}
+
+	tokens, err := database.ListAPITokens(userID)
+	if err != nil {
+		log.Printf("[*] Error: Failed to list api tokens: %v", err)
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to list api tokens: %v", err))
+	}
+
+	return c.JSON(http.StatusOK, tokens)
+}
+
+/*
+HandleCreateAPIToken creates a personal token for the current user, or a service token when the
+user is an admin. The plaintext token is part of the response and cannot be retrieved later.
+*/
+func HandleCreateAPIToken(c echo.Context) error {
+	log.Println("[*] Starting create api token request")
+
+	var req models.CreateAPITokenRequest
+	if err := validation.Bind(c, &req); err != nil {
+		log.Printf("[*] Error: Invalid request body - %v", err)
+		return response.Invalid(c, err)
+	}
+	middleware.AuditChange(c, nil, req)
+	if req.Kind == "" {
+		req.Kind = auth.TokenKindPersonal
+	}
+	if req.ExpiresAt != nil && req.ExpiresAt.Before(time.Now()) {
+		return response.Error(c, http.StatusBadRequest, "Expiry must be in the future")
+	}
+
+	user := middleware.CurrentUser(c)
+	if req.Kind == auth.TokenKindService && !user.IsAdmin {
+		return response.Error(c, http.StatusForbidden, "Only admins can create service tokens")
+	}
+	for _, scope := range req.Scopes {
+		if scope == auth.ScopeAdmin && !user.IsAdmin {
+			return response.Error(c, http.StatusForbidden, "Only admins can create tokens with the admin scope")
+		}
+	}
+
+	plaintext, id, err := auth.CreateToken(database.APIToken{
+		UserID:       user.ID,
+		Name:         req.Name,
+		Kind:         req.Kind,
+		Scopes:       req.Scopes,
+		WorkspaceIDs: req.WorkspaceIDs,
+		ExpiresAt:    req.ExpiresAt,
+	})
+	if err != nil {
+		log.Printf("[*] Error: Failed to create api token: %v", err)
+		return response.Error(c, http.StatusBadRequest, fmt.Sprintf("Failed to create api token: %v", err))
+	}
+
+	middleware.AuditTarget(c, int(id), 0)
+	log.Printf("[*] User %q created %s api token %q", user.Username, req.Kind, req.Name)
+	return c.JSON(http.StatusOK, models.CreateAPITokenResponse{ID: int(id), Token: plaintext})
+}
+
+// HandleRevokeAPIToken revokes a token, users can revoke their own tokens and admins any token
+func HandleRevokeAPIToken(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("tokenID"))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid token ID")
+	}
+
+	token, err := database.GetAPITokenByID(id)
+	if err != nil {
+		return response.Error(c, http.StatusNotFound, "API token not found")
+	}
+	middleware.AuditChange(c, token, nil)
+
+	user := middleware.CurrentUser(c)
+	if token.UserID != user.ID && !user.IsAdmin {
+		return response.Error(c, http.StatusForbidden, "You can only revoke your own tokens")
+	}
+
+	if err := database.RevokeAPIToken(id); err != nil {
+		log.Printf("[*] Error: Failed to revoke api token %d: %v", id, err)
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to revoke api token: %v", err))
+	}
+
+	log.Printf("[*] User %q revoked api token %d", user.Username, id)
+	return c.JSON(http.StatusOK, map[string]string{"message": "API token revoked successfully"})
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/turplespace/portos/internal/config"
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/internal/middleware"
+	"github.com/turplespace/portos/internal/response"
+	"github.com/turplespace/portos/internal/services/auth"
+	"github.com/turplespace/portos/internal/validation"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+// secondFactorLocked answers a request refused because the second factor of the user is locked
+func secondFactorLocked(c echo.Context) error {
+	return response.ErrorCode(c, http.StatusTooManyRequests, response.CodeTwoFactorLocked, "Too many invalid two-factor codes, try again later")
+}
+
+// HandleStartTOTPEnrollment generates a pending TOTP secret for the current user
+func HandleStartTOTPEnrollment(c echo.Context) error {
+	user := middleware.CurrentUser(c)
+	if user.AuthSource != "local" {
+		return response.Error(c, http.StatusBadRequest, "Single sign-on accounts use the second factor of their identity provider")
+	}
+
+	secret, uri, err := auth.StartTOTPEnrollment(user)
+	if err != nil {
+		log.Printf("[*] Error: Failed to start TOTP enrollment for %q: %v", user.Username, err)
+		return response.Error(c, http.StatusConflict, err.Error())
+	}
+
+	return c.JSON(http.StatusOK, models.TOTPEnrollmentResponse{Secret: secret, ProvisioningURI: uri})
+}
+
+// HandleConfirmTOTPEnrollment enables TOTP when the code matches the pending secret and returns the recovery codes
+func HandleConfirmTOTPEnrollment(c echo.Context) error {
+	var req models.TwoFactorCodeRequest
+	if err := validation.Bind(c, &req); err != nil {
+		return response.Invalid(c, err)
+	}
+
+	user := middleware.CurrentUser(c)
+	codes, err := auth.ConfirmTOTPEnrollment(user, req.Code)
+	if errors.Is(err, auth.ErrInvalidSecondFactor) {
+		return response.Error(c, http.StatusBadRequest, "Invalid two-factor code")
+	}
+	if errors.Is(err, auth.ErrSecondFactorLocked) {
+		return secondFactorLocked(c)
+	}
+	if err != nil {
+		log.Printf("[*] Error: Failed to confirm TOTP enrollment for %q: %v", user.Username, err)
+		return response.Error(c, http.StatusConflict, err.Error())
+	}
+
+	log.Printf("[*] User %q enabled two-factor authentication", user.Username)
+	return c.JSON(http.StatusOK, models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// HandleRegenerateRecoveryCodes replaces the recovery codes of the current user, it requires a valid code
+func HandleRegenerateRecoveryCodes(c echo.Context) error {
+	var req models.TwoFactorCodeRequest
+	if err := validation.Bind(c, &req); err != nil {
+		return response.Invalid(c, err)
+	}
+
+	user := middleware.CurrentUser(c)
+	if !user.TOTPEnabled {
+		return response.Error(c, http.StatusConflict, "Two-factor authentication is not enabled")
+	}
+	if err := auth.VerifySecondFactor(user, req.Code, req.RecoveryCode); errors.Is(err, auth.ErrSecondFactorLocked) {
+		return secondFactorLocked(c)
+	} else if err != nil {
+		return response.Error(c, http.StatusForbidden, "Invalid two-factor code")
+	}
+
+	codes, err := auth.RegenerateRecoveryCodes(user.ID)
+	if err != nil {
+		log.Printf("[*] Error: Failed to regenerate recovery codes for %q: %v", user.Username, err)
+		return response.Error(c, http.StatusInternalServerError, "Failed to regenerate recovery codes")
+	}
+
+	return c.JSON(http.StatusOK, models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// HandleDisableTOTP turns two-factor authentication off for the current user, it requires a valid code
+func HandleDisableTOTP(c echo.Context) error {
+	var req models.TwoFactorCodeRequest
+	if err := validation.Bind(c, &req); err != nil {
+		return response.Invalid(c, err)
+	}
+
+	user := middleware.CurrentUser(c)
+	if !user.TOTPEnabled {
+		return response.Error(c, http.StatusConflict, "Two-factor authentication is not enabled")
+	}
+	if user.IsAdmin && config.Get().RequireAdminTOTP {
+		return response.Error(c, http.StatusForbidden, "Two-factor authentication is required for admins")
+	}
+	if err := auth.VerifySecondFactor(user, req.Code, req.RecoveryCode); errors.Is(err, auth.ErrSecondFactorLocked) {
+		return secondFactorLocked(c)
+	} else if err != nil {
+		return response.Error(c, http.StatusForbidden, "Invalid two-factor code")
+	}
+
+	if err := auth.DisableTOTP(user); err != nil {
+		log.Printf("[*] Error: Failed to disable TOTP for %q: %v", user.Username, err)
+		return response.Error(c, http.StatusInternalServerError, "Failed to disable two-factor authentication")
+	}
+
+	log.Printf("[*] User %q disabled two-factor authentication", user.Username)
+	return c.JSON(http.StatusOK, map[string]string{"message": "Two-factor authentication disabled"})
+}
+
+// HandleResetUserTOTP lets an admin turn off two-factor authentication of a user who lost the device and the
+// recovery codes, which also lifts its lockout
+func HandleResetUserTOTP(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("userID"))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid user ID")
+	}
+
+	user, err := database.GetUserByID(id)
+	if err != nil {
+		return response.Error(c, http.StatusNotFound, "User not found")
+	}
+
+	if err := auth.DisableTOTP(user); err != nil {
+		log.Printf("[*] Error: Failed to reset TOTP for %q: %v", user.Username, err)
+		return response.Error(c, http.StatusInternalServerError, "Failed to reset two-factor authentication")
+	}
+	if err := database.DeleteUserSessions(id); err != nil {
+		log.Printf("[*] Warning: Failed to close sessions of user %d: %v", id, err)
+	}
+
+	log.Printf("[*] Admin %q reset two-factor authentication of %q", middleware.CurrentUser(c).Username, user.Username)
+	return c.JSON(http.StatusOK, map[string]string{"message": "Two-factor authentication reset"})
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/internal/middleware"
+	"github.com/turplespace/portos/internal/response"
+	"github.com/turplespace/portos/internal/services/auth"
+	"github.com/turplespace/portos/internal/validation"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+// HandleGetUsers returns all the user accounts
+func HandleGetUsers(c echo.Context) error {
+	users, err := database.ListUsers()
+	if err != nil {
+		log.Printf("[*] Error: Failed to list users: %v", err)
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to list users: %v", err))
+	}
+	return c.JSON(http.StatusOK, users)
+}
+
+// HandleCreateUser creates a new user account from the username and password in the request body
+func HandleCreateUser(c echo.Context) error {
+	log.Println("[*] Starting create user request")
+
+	var req models.CreateUserRequest
+	if err := validation.Bind(c, &req); err != nil {
+		log.Printf("[*] Error: Invalid request body - %v", err)
+		return response.Invalid(c, err)
+	}
+	middleware.AuditChange(c, nil, map[string]interface{}{"username": req.Username, "is_admin": req.IsAdmin})
+
+	hash, err := auth.HashPassword(req.Password)
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, err.Error())
+	}
+
+	id, err := database.CreateUser(req.Username, hash, req.IsAdmin)
+	if err != nil {
+		log.Printf("[*] Error: Failed to create user: %v", err)
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to create user: %v", err))
+	}
+
+	middleware.AuditTarget(c, int(id), 0)
+	log.Printf("[*] Created user %q", req.Username)
+	return c.JSON(http.StatusOK, map[string]int{"id": int(id)})
+}
+
+// HandleDeleteUser deletes a user account, admins cannot delete themselves
+func HandleDeleteUser(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("userID"))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid user ID")
+	}
+	if id == middleware.CurrentUser(c).ID {
+		return response.Error(c, http.StatusBadRequest, "You cannot delete your own account")
+	}
+
+	if before, err := database.GetUserByID(id); err == nil {
+		middleware.AuditChange(c, before, nil)
+	}
+	if err := database.DeleteUser(id); err != nil {
+		log.Printf("[*] Error: Failed to delete user %d: %v", id, err)
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to delete user: %v", err))
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "User deleted successfully"})
+}
+
+/*
+HandleChangePassword changes the password of a user.
+Users changing their own password must send the current one, admins can reset any password.
+All the sessions of the user are closed afterwards.
+*/
+func HandleChangePassword(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("userID"))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid user ID")
+	}
+
+	var req models.ChangePasswordRequest
+	if err := validation.Bind(c, &req); err != nil {
+		return response.Invalid(c, err)
+	}
+
+	current := middleware.CurrentUser(c)
+	if current.ID != id && !current.IsAdmin {
+		return response.Error(c, http.StatusForbidden, "Admin privileges required")
+	}
+
+	user, err := database.GetUserByID(id)
+	if err != nil {
+		return response.Error(c, http.StatusNotFound, "User not found")
+	}
+	if user.AuthSource != "local" {
+		return response.Error(c, http.StatusBadRequest, "Single sign-on accounts have no password")
+	}
+	if current.ID == id && !auth.CheckPassword(user.PasswordHash, req.CurrentPassword) {
+		return response.Error(c, http.StatusForbidden, "Current password is incorrect")
+	}
+
+	hash, err := auth.HashPassword(req.NewPassword)
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, err.Error())
+	}
+	if err := database.UpdateUserPassword(id, hash); err != nil {
+		log.Printf("[*] Error: Failed to update password of user %d: %v", id, err)
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to update password: %v", err))
+	}
+	if err := database.DeleteUserSessions(id); err != nil {
+		log.Printf("[*] Warning: Failed to close sessions of user %d: %v", id, err)
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Password updated successfully"})
+}
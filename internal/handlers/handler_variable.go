@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/internal/middleware"
+	"github.com/turplespace/portos/internal/response"
+	"github.com/turplespace/portos/internal/services/deploy"
+	"github.com/turplespace/portos/internal/validation"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+// HandleGetWorkspaceVariables returns the variables inherited by the cubes of a workspace
+func HandleGetWorkspaceVariables(c echo.Context) error {
+	workspaceID, err := strconv.Atoi(c.Param("workspaceID"))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid workspace ID")
+	}
+
+	variables, err := database.ListWorkspaceVariables(workspaceID)
+	if err != nil {
+		log.Printf("[*] Error: Failed to list variables of workspace %d: %v", workspaceID, err)
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to get variables: %v", err))
+	}
+
+	return c.JSON(http.StatusOK, variables)
+}
+
+// HandleSetWorkspaceVariable creates or updates a workspace variable, cubes pick it up on their next deploy
+func HandleSetWorkspaceVariable(c echo.Context) error {
+	workspaceID, err := strconv.Atoi(c.Param("workspaceID"))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid workspace ID")
+	}
+	name := c.Param("name")
+	if !deploy.ValidVariableName(name) {
+		return response.Error(c, http.StatusBadRequest, fmt.Sprintf("Invalid variable name %q, use letters, digits and underscores other than the built-in %s and %s", name, deploy.VariableWorkspaceName, deploy.VariableCubeName))
+	}
+
+	var req models.SetWorkspaceVariableRequest
+	if err := validation.Bind(c, &req); err != nil {
+		return response.Invalid(c, err)
+	}
+
+	before := map[string]string{}
+	variables, err := database.ListWorkspaceVariables(workspaceID)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to get variables: %v", err))
+	}
+	after := []database.WorkspaceVariable{{Name: name, Value: req.Value}}
+	for _, variable := range variables {
+		if variable.Name == name {
+			before[name] = variable.Value
+		} else {
+			after = append(after, variable)
+		}
+	}
+	middleware.AuditChange(c, before, map[string]string{name: req.Value})
+
+	// The value ends up in the domains of the proxies that reference it
+	if err := deploy.CheckVariables(workspaceID, after); err != nil {
+		return proxyError(c, err, fmt.Sprintf("Failed to set variable: %v", err))
+	}
+
+	if err := database.SetWorkspaceVariable(workspaceID, name, req.Value); err != nil {
+		log.Printf("[*] Error: Failed to set variable %s of workspace %d: %v", name, workspaceID, err)
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to set variable: %v", err))
+	}
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Variable updated successfully"})
+}
+
+// HandleDeleteWorkspaceVariable deletes a workspace variable
+func HandleDeleteWorkspaceVariable(c echo.Context) error {
+	workspaceID, err := strconv.Atoi(c.Param("workspaceID"))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid workspace ID")
+	}
+	name := c.Param("name")
+
+	variables, err := database.ListWorkspaceVariables(workspaceID)
+	if err != nil {
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to get variables: %v", err))
+	}
+	after := []database.WorkspaceVariable{}
+	for _, variable := range variables {
+		if variable.Name != name {
+			after = append(after, variable)
+		}
+	}
+	// Proxies whose domain references the variable would be left with an unknown reference
+	if err := deploy.CheckVariables(workspaceID, after); err != nil {
+		return proxyError(c, err, fmt.Sprintf("Failed to delete variable: %v", err))
+	}
+
+	if err := database.DeleteWorkspaceVariable(workspaceID, name); err != nil {
+		return response.Error(c, http.StatusNotFound, err.Error())
+	}
+	middleware.AuditChange(c, map[string]string{"name": name}, nil)
+
+	return c.JSON(http.StatusOK, map[string]string{"message": "Variable deleted successfully"})
+}
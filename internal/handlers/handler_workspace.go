@@ -1,84 +1,159 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/labstack/echo/v4"
 	"github.com/turplespace/portos/internal/database"
-	"github.com/turplespace/portos/internal/models"
+	"github.com/turplespace/portos/internal/middleware"
+	"github.com/turplespace/portos/internal/response"
+	"github.com/turplespace/portos/internal/services/auth"
+	"github.com/turplespace/portos/internal/services/deploy"
 	"github.com/turplespace/portos/internal/services/docker"
+	"github.com/turplespace/portos/internal/services/quota"
+	"github.com/turplespace/portos/internal/validation"
+	"github.com/turplespace/portos/pkg/models"
 )
 
-// HandleGetWorkspaces handles the HTTP request to get the list of workspaces
+/*
+HandleGetWorkspaces handles the HTTP request to get the list of workspaces.
+q searches the name and description, sort orders by name or created_at (descending with a leading -)
+and limit and cursor page through the list, the cursor of the next page is returned in the X-Next-Cursor header.
+*/
 func HandleGetWorkspaces(c echo.Context) error {
 	log.Println("[*] Starting get workspaces request")
 
-	// Retrieve the list of workspaces
-	workspaces, err := database.GetWorkspaces()
+	page, err := parsePage(c)
 	if err != nil {
-		log.Printf("[*] Error: Failed to get workspaces: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to get workspaces: %v", err)})
+		return response.Error(c, http.StatusBadRequest, err.Error())
 	}
+	filter := database.WorkspaceFilter{Search: c.QueryParam("q"), Page: page}
 
 	// Get the total counts
 	totalWorkspaces, err := database.CountWorkspaces()
 	if err != nil {
 		log.Printf("[*] Error: Failed to count workspaces: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to count workspaces: %v", err)})
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to count workspaces: %v", err))
 	}
 
 	totalCubes, err := database.CountCubes()
 	if err != nil {
 		log.Printf("[*] Error: Failed to count cubes: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to count cubes: %v", err)})
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to count cubes: %v", err))
 	}
 
-	totalRunningCubes, err := docker.CountContainersByLabel("service", "turplespace")
+	// The containers of every workspace, listed with a single Docker call
+	containers, err := docker.ListManagedContainers(0)
 	if err != nil {
-		log.Printf("[*] Error: Failed to count running containers: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to count running containers: %v", err)})
+		log.Printf("[*] Error: Failed to list containers: %v", err)
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to list containers: %v", err))
+	}
+	totalRunningCubes := 0
+	runningCounts := make(map[string]int)
+	counted := make(map[string]bool) // The replicas of a cube count once, by cube ID
+	for _, container := range containers {
+		if cubeID := container.Labels[docker.LabelCubeID]; container.State == "running" && (cubeID == "" || !counted[cubeID]) {
+			counted[cubeID] = cubeID != ""
+			totalRunningCubes++
+			runningCounts[container.Labels[docker.LabelWorkspaceID]]++
+		}
+	}
+
+	// Users that are not admins, and API tokens, only see the workspaces they may view
+	user := middleware.CurrentUser(c)
+	restricted := user == nil || !user.IsAdmin || middleware.CurrentToken(c) != nil
+	if restricted {
+		all, _, err := database.GetWorkspaces(database.WorkspaceFilter{})
+		if err != nil {
+			log.Printf("[*] Error: Failed to get workspaces: %v", err)
+			return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to get workspaces: %v", err))
+		}
+
+		totalWorkspaces, totalCubes, totalRunningCubes = 0, 0, 0
+		filter.IDs = []int{}
+		for _, workspace := range all {
+			if middleware.Authorize(c, workspace.ID, auth.ActionView) != nil {
+				continue
+			}
+
+			totalCount, err := database.CountContainersByWorkspaceID(workspace.ID)
+			if err != nil {
+				log.Printf("[*] Error: Failed to count containers for workspace %d: %v", workspace.ID, err)
+				return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to count containers for workspace %d: %v", workspace.ID, err))
+			}
+
+			filter.IDs = append(filter.IDs, workspace.ID)
+			totalWorkspaces++
+			totalCubes += totalCount
+			totalRunningCubes += runningCounts[strconv.Itoa(workspace.ID)]
+		}
+	}
+
+	// Retrieve the requested page of workspaces
+	workspaces, nextCursor, err := database.GetWorkspaces(filter)
+	if errors.Is(err, database.ErrInvalidCursor) {
+		return response.Error(c, http.StatusBadRequest, "Invalid cursor")
+	}
+	if err != nil {
+		log.Printf("[*] Error: Failed to get workspaces: %v", err)
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to get workspaces: %v", err))
 	}
 
 	// Create a slice to hold workspaces with container counts
-	var workspacesWithCounts []models.WorkspaceWithContainerCounts
+	workspacesWithCounts := []models.WorkspaceWithContainerCounts{}
 
 	// For each workspace, count the number of total and running containers
 	for _, workspace := range workspaces {
 		totalCount, err := database.CountContainersByWorkspaceID(workspace.ID)
 		if err != nil {
 			log.Printf("[*] Error: Failed to count containers for workspace %d: %v", workspace.ID, err)
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to count containers for workspace %d: %v", workspace.ID, err)})
-		}
-
-		runningCount, err := docker.CountContainersByLabel("workspace_id", fmt.Sprintf("%d", workspace.ID))
-		if err != nil {
-			log.Printf("[*] Error: Failed to count running containers for workspace %d: %v", workspace.ID, err)
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to count running containers for workspace %d: %v", workspace.ID, err)})
+			return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to count containers for workspace %d: %v", workspace.ID, err))
 		}
 
-		workspacesWithCounts = append(workspacesWithCounts, models.WorkspaceWithContainerCounts{
+		workspaceWithCounts := models.WorkspaceWithContainerCounts{
 			ID:                workspace.ID,
 			Name:              workspace.Name,
 			Desc:              workspace.Desc,
 			TotalContainers:   totalCount,
-			RunningContainers: runningCount,
+			RunningContainers: runningCounts[strconv.Itoa(workspace.ID)],
 			CreatedAt:         workspace.CreatedAt,
-		})
+		}
+
+		// Report the usage of workspaces with a quota
+		workspaceQuota, err := database.GetWorkspaceQuota(workspace.ID)
+		if err != nil {
+			log.Printf("[*] Warning: Failed to get quota for workspace %d: %v", workspace.ID, err)
+		}
+		if workspaceQuota != nil {
+			workspaceWithCounts.Quota = workspaceQuota
+			workspaceWithCounts.Usage, err = quota.Usage(workspace.ID)
+			if err != nil {
+				log.Printf("[*] Warning: Failed to get quota usage for workspace %d: %v", workspace.ID, err)
+			}
+		}
+
+		workspacesWithCounts = append(workspacesWithCounts, workspaceWithCounts)
 	}
 
 	// Create the response object
-	response := models.WorkspaceResponse{
+	result := models.WorkspaceResponse{
 		TotalWorkspaces:   totalWorkspaces,
 		TotalCubes:        totalCubes,
 		TotalRunningCubes: totalRunningCubes,
 		Workspaces:        workspacesWithCounts,
 	}
 
+	if nextCursor != "" {
+		c.Response().Header().Set("X-Next-Cursor", nextCursor)
+	}
 	// Encode the response as JSON
-	return c.JSON(http.StatusOK, response)
+	return c.JSON(http.StatusOK, result)
 }
 
 // HandleCreateWorkspace handles the HTTP request to create a new workspace
@@ -87,15 +162,23 @@ func HandleCreateWorkspace(c echo.Context) error {
 
 	var req models.CreateWorkspaceRequest
 
-	if err := c.Bind(&req); err != nil {
+	if err := validation.Bind(c, &req); err != nil {
 		log.Printf("[*] Error: Invalid request body - %v", err)
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Invalid request: %v", err)})
+		return response.Invalid(c, err)
 	}
+	middleware.AuditChange(c, nil, req)
 
 	id, err := database.CreateWorkspace(req.Name, req.Desc)
 	if err != nil {
 		log.Printf("[*] Error: Failed to create workspace: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to create workspace: %v", err)})
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to create workspace: %v", err))
+	}
+
+	middleware.AuditTarget(c, int(id), int(id))
+
+	// The creator becomes the owner of the workspace
+	if err := database.SetWorkspaceMember(int(id), middleware.CurrentUser(c).ID, string(auth.RoleOwner)); err != nil {
+		log.Printf("[*] Warning: Failed to add workspace owner: %v", err)
 	}
 
 	return c.JSON(http.StatusOK, map[string]int{"id": int(id)})
@@ -110,24 +193,33 @@ func HandleEditWorkspace(c echo.Context) error {
 	idStr := c.Param("workspaceID")
 	if idStr == "" {
 		log.Println("[*] Error: Missing workspace ID")
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Missing workspace ID"})
+		return response.Error(c, http.StatusBadRequest, "Missing workspace ID")
 	}
 
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
 		log.Printf("[*] Error: Invalid workspace ID format: %s - %v", idStr, err)
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid workspace ID"})
+		return response.Error(c, http.StatusBadRequest, "Invalid workspace ID")
 	}
 	var req models.EditWorkspaceRequest
-	if err := c.Bind(&req); err != nil {
+	if err := validation.Bind(c, &req); err != nil {
 		log.Printf("[*] Error: Invalid request body - %v", err)
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("Invalid request: %v", err)})
+		return response.Invalid(c, err)
+	}
+
+	before, err := database.GetWorkspaceByID(id)
+	if err != nil {
+		log.Printf("[*] Warning: Unable to get workspace before update: %v", err)
+	} else {
+		after := *before
+		after.Name, after.Desc = req.Name, req.Desc
+		middleware.AuditChange(c, before, after)
 	}
 
 	err = database.EditWorkspace(id, req.Name, req.Desc)
 	if err != nil {
 		log.Printf("[*] Error: Failed to edit workspace: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to edit workspace: %v", err)})
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to edit workspace: %v", err))
 	}
 
 	return c.JSON(http.StatusOK, map[string]string{"message": "Workspace updated successfully"})
@@ -143,24 +235,27 @@ func HandleDeleteWorkspace(c echo.Context) error {
 	idStr := c.Param("workspaceID")
 	if idStr == "" {
 		log.Println("[*] Error: Missing workspace ID")
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Missing workspace ID"})
+		return response.Error(c, http.StatusBadRequest, "Missing workspace ID")
 	}
 
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
 		log.Printf("[*] Error: Invalid workspace ID format: %s - %v", idStr, err)
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid workspace ID"})
+		return response.Error(c, http.StatusBadRequest, "Invalid workspace ID")
 	}
 
 	// Stopping Cubes
-	cubes, err := database.ListCubes(id)
+	cubes, _, err := database.ListCubes(id, database.CubeFilter{})
 	if err != nil {
 		log.Printf("[*] Error: Failed to get cubes for workspace ID %d: %v", id, err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to get cubes: %v", err)})
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to get cubes: %v", err))
+	}
+	if before, err := database.GetWorkspaceByID(id); err == nil {
+		middleware.AuditChange(c, map[string]interface{}{"workspace": before, "cubes": cubes}, nil)
 	}
 
 	for _, cube := range cubes {
-		err = docker.StopContainer(cube.Name)
+		err = deploy.StopCube(cube)
 		if err != nil {
 			log.Printf("[*] Warning: Error stopping container %s: %v", cube.Name, err)
 		}
@@ -170,21 +265,62 @@ func HandleDeleteWorkspace(c echo.Context) error {
 	err = database.DeleteContainersByWorkspaceID(id)
 	if err != nil {
 		log.Printf("[*] Error: Failed to delete containers for workspace ID %d: %v", id, err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to delete containers: %v", err)})
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to delete containers: %v", err))
+	}
+
+	// Deleting the quota of the workspace
+	err = database.DeleteWorkspaceQuota(id)
+	if err != nil {
+		log.Printf("[*] Error: Failed to delete quota for workspace ID %d: %v", id, err)
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to delete quota: %v", err))
+	}
+
+	// Deleting the variables of the workspace
+	err = database.DeleteWorkspaceVariables(id)
+	if err != nil {
+		log.Printf("[*] Error: Failed to delete variables for workspace ID %d: %v", id, err)
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to delete variables: %v", err))
+	}
+
+	// Deleting the networks of the workspace, the Docker networks are removed once the containers are gone
+	err = database.DeleteWorkspaceNetworks(id)
+	if err != nil {
+		log.Printf("[*] Error: Failed to delete networks for workspace ID %d: %v", id, err)
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to delete networks: %v", err))
+	}
+	if err := docker.RemoveWorkspaceNetworks(id); err != nil {
+		log.Printf("[*] Warning: Failed to remove Docker networks of workspace ID %d: %v", id, err)
+	}
+
+	// Deleting the secrets of the workspace
+	err = database.DeleteWorkspaceSecrets(id)
+	if err != nil {
+		log.Printf("[*] Error: Failed to delete secrets for workspace ID %d: %v", id, err)
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to delete secrets: %v", err))
+	}
+
+	// Deleting the members of the workspace
+	err = database.DeleteWorkspaceMembers(id)
+	if err != nil {
+		log.Printf("[*] Error: Failed to delete members for workspace ID %d: %v", id, err)
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to delete members: %v", err))
 	}
 
 	// Deleting Workspace from the DB
 	err = database.DeleteWorkspace(id)
 	if err != nil {
 		log.Printf("[*] Error: Failed to delete workspace ID %d: %v", id, err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to delete workspace: %v", err)})
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to delete workspace: %v", err))
 	}
 
 	return c.JSON(http.StatusOK, map[string]string{"message": "Workspace deleted successfully"})
 }
 
 /*
-HandleGetCubes function returns all the cubes in a workspace
+HandleGetWorkspaceData returns the cubes of a workspace.
+q searches the name and image, image, label (key or key=value) and status (running, exited, ...)
+filter the cubes, sort orders by name or created_at (descending with a leading -) and limit and
+cursor page through them, the cursor of the next page is returned in the X-Next-Cursor header.
 */
 func HandleGetWorkspaceData(c echo.Context) error {
 	log.Printf("[*] Starting get cubes request ")
@@ -192,33 +328,69 @@ func HandleGetWorkspaceData(c echo.Context) error {
 	workspaceIDStr := c.Param("workspaceID")
 	if workspaceIDStr == "" {
 		log.Printf("[*] Error: Missing workspace ID in request")
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Missing workspace ID"})
+		return response.Error(c, http.StatusBadRequest, "Missing workspace ID")
 	}
 
 	workspaceID, err := strconv.Atoi(workspaceIDStr)
 	if err != nil {
 		log.Printf("[*] Error: Invalid workspace ID format: %s - %v", workspaceIDStr, err)
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid workspace ID"})
+		return response.Error(c, http.StatusBadRequest, "Invalid workspace ID")
 	}
 
-	cubes, err := database.ListCubes(workspaceID)
+	page, err := parsePage(c)
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, err.Error())
+	}
+	filter := database.CubeFilter{
+		Search: c.QueryParam("q"),
+		Image:  c.QueryParam("image"),
+		Label:  c.QueryParam("label"),
+		Page:   page,
+	}
+
+	// The state of the containers of the workspace, listed with a single Docker call
+	containers, err := docker.ListManagedContainers(workspaceID)
+	if err != nil {
+		log.Printf("[*] Error: Failed to list containers of workspace %d: %v", workspaceID, err)
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to list containers: %v", err))
+	}
+
+	// The status lives in Docker, it is turned into the list of matching cube names, a cube with
+	// replicas matches the state of any of them
+	if status := c.QueryParam("status"); status != "" {
+		if !slices.Contains(containerStates, status) {
+			return response.Error(c, http.StatusBadRequest, fmt.Sprintf("Invalid status, expected one of %s", strings.Join(containerStates, ", ")))
+		}
+		filter.Names = []string{}
+		for name, container := range containers {
+			if container.State == status {
+				if replica := container.Labels[docker.LabelReplica]; replica != "" {
+					name = strings.TrimSuffix(name, "-"+replica)
+				}
+				filter.Names = append(filter.Names, name)
+			}
+		}
+	}
+
+	cubes, nextCursor, err := database.ListCubes(workspaceID, filter)
+	if errors.Is(err, database.ErrInvalidCursor) {
+		return response.Error(c, http.StatusBadRequest, "Invalid cursor")
+	}
 	if err != nil {
 		log.Printf("[*] Database error while fetching cubes: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to get cubes: %v", err)})
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to get cubes: %v", err))
 	}
 	log.Printf("[*] Successfully retrieved %d cubes for workspace ID: %d", len(cubes), workspaceID)
 
-	var cubesResponse []models.GetCubesResponse
+	cubesResponse := []models.GetCubesResponse{}
 	for _, cube := range cubes {
-		status, err := docker.GetContainerStatus(cube.Name)
-		if err != nil {
-			log.Printf("[*] Warning: Unable to get status for container %s: %v", cube.Name, err)
-			status = "unknown"
-		}
-		ipAddress, err := docker.GetContainerIPAddress(cube.Name)
-		if err != nil {
-			log.Printf("[*] Warning: Unable to get IP address for container %s: %v", cube.Name, err)
-			ipAddress = "unknown"
+		status, ready := deploy.ReplicaStatus(containers, cube)
+		ipAddress := "unknown"
+		for _, replica := range deploy.Replicas(containers, cube) {
+			if replica.IPAddress != "" {
+				ipAddress = replica.IPAddress
+				break
+			}
 		}
 		cubesResponse = append(cubesResponse, models.GetCubesResponse{
 			ContainerID:   cube.ID,
@@ -226,8 +398,38 @@ func HandleGetWorkspaceData(c echo.Context) error {
 			ContainerName: cube.Name,
 			IPAddress:     ipAddress,
 			Status:        status,
+			ReadyReplicas: ready,
+			Replicas:      cube.ReplicaCount(),
 		})
 	}
 
+	if nextCursor != "" {
+		c.Response().Header().Set("X-Next-Cursor", nextCursor)
+	}
 	return c.JSON(http.StatusOK, cubesResponse)
 }
+
+// maxPageLimit caps the limit query param of paged lists
+const maxPageLimit = 500
+
+// containerStates are the Docker container states accepted by the status filter
+var containerStates = []string{"created", "running", "paused", "restarting", "removing", "exited", "dead"}
+
+// parsePage reads the sort, limit and cursor query params of a paged list
+func parsePage(c echo.Context) (database.Page, error) {
+	page := database.Page{
+		Sort:   c.QueryParam("sort"),
+		Cursor: c.QueryParam("cursor"),
+	}
+	if !database.ValidSort(page.Sort) {
+		return page, errors.New("Invalid sort, expected name, created_at, -name or -created_at")
+	}
+	if value := c.QueryParam("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return page, errors.New("Invalid limit")
+		}
+		page.Limit = min(limit, maxPageLimit)
+	}
+	return page, nil
+}
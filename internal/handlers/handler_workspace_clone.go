@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/turplespace/portos/internal/response"
+	"github.com/turplespace/portos/internal/services/spec"
+	"github.com/turplespace/portos/internal/validation"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+/*
+HandleCloneWorkspace copies the cubes, proxies, variables and networks of a workspace into a new
+workspace. Cubes get unique names and proxy domains are rewritten by the rules of the request.
+dry_run=true returns the plan without creating the workspace.
+*/
+func HandleCloneWorkspace(c echo.Context) error {
+	log.Println("[*] Starting clone workspace request")
+	return handleCopyWorkspace(c, true)
+}
+
+/*
+HandlePromoteWorkspace copies a workspace like HandleCloneWorkspace with the overrides of the
+request, into the target workspace named by the request, which is updated when it exists. The
+changes are the diff between the source and the target, dry_run=true only returns them.
+*/
+func HandlePromoteWorkspace(c echo.Context) error {
+	log.Println("[*] Starting promote workspace request")
+	return handleCopyWorkspace(c, false)
+}
+
+func handleCopyWorkspace(c echo.Context, create bool) error {
+	workspaceID, err := strconv.Atoi(c.Param("workspaceID"))
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid workspace ID")
+	}
+	dryRun, err := dryRunParam(c)
+	if err != nil {
+		return response.Error(c, http.StatusBadRequest, "Invalid dry_run, expected true or false")
+	}
+
+	var req models.CloneWorkspaceRequest
+	if err := validation.Bind(c, &req); err != nil {
+		log.Printf("[*] Error: Invalid request body - %v", err)
+		return response.Invalid(c, err)
+	}
+
+	workspaceSpec, warnings, err := spec.Derive(workspaceID, req)
+	if err != nil {
+		var invalid *spec.InvalidError
+		if errors.As(err, &invalid) {
+			return response.Error(c, http.StatusBadRequest, err.Error())
+		}
+		log.Printf("[*] Error: Failed to copy workspace %d: %v", workspaceID, err)
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to copy workspace: %v", err))
+	}
+	if err := validation.Struct(workspaceSpec); err != nil {
+		return response.Invalid(c, err)
+	}
+
+	return applySpec(c, *workspaceSpec, specApply{dryRun: dryRun, create: create, warnings: warnings})
+}
@@ -4,11 +4,14 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"slices"
 	"strconv"
 
 	"github.com/labstack/echo/v4"
 	"github.com/turplespace/portos/internal/database"
-	"github.com/turplespace/portos/internal/services/docker"
+	"github.com/turplespace/portos/internal/response"
+	"github.com/turplespace/portos/internal/services/deploy"
+	"github.com/turplespace/portos/internal/services/quota"
 )
 
 // HandleDeployWorkspace function receives workspace_id in query params and deploys the workspace
@@ -16,28 +19,34 @@ func HandleDeployWorkspace(c echo.Context) error {
 	// Get workspace ID from query parameters
 	workspaceIDStr := c.Param("workspaceID")
 	if workspaceIDStr == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Missing workspace ID"})
+		return response.Error(c, http.StatusBadRequest, "Missing workspace ID")
 	}
 
 	workspaceID, err := strconv.Atoi(workspaceIDStr)
 	if err != nil {
 		log.Printf("Failed to convert workspace ID to integer: %v", err)
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid workspace ID"})
+		return response.Error(c, http.StatusBadRequest, "Invalid workspace ID")
 	}
 
 	// Get all containers in the workspace
 	containers, err := database.ListContainersInWorkspace(workspaceID)
 	if err != nil {
 		log.Printf("Failed to list containers: %v", err)
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to list containers: %v", err)})
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to list containers: %v", err))
 	}
 
-	// Start each container
-	for _, container := range containers {
-		err := docker.StartContainer(container)
+	// Check the quota once for the whole workspace, before any container is started
+	if err := quota.CheckWorkspace(workspaceID); err != nil {
+		log.Printf("Workspace %d rejected by quota: %v", workspaceID, err)
+		return quotaError(c, err, err.Error())
+	}
+
+	// Start each container after the containers it depends on
+	for _, container := range deploy.Order(containers) {
+		err := deploy.DeployCube(workspaceID, container)
 		if err != nil {
 			log.Printf("Failed to deploy container %s: %v", container.Name, err)
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to deploy container %s: %v", container.Name, err)})
+			return quotaError(c, err, fmt.Sprintf("Failed to deploy container %s: %v", container.Name, err))
 		}
 	}
 
@@ -48,25 +57,24 @@ func HandleRedeployWorkspace(c echo.Context) error {
 	// Get workspace ID from query parameters
 	workspaceIDStr := c.Param("workspaceID")
 	if workspaceIDStr == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Missing workspace ID"})
+		return response.Error(c, http.StatusBadRequest, "Missing workspace ID")
 	}
 
 	workspaceID, err := strconv.Atoi(workspaceIDStr)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid workspace ID"})
+		return response.Error(c, http.StatusBadRequest, "Invalid workspace ID")
 	}
 
 	// Get all containers in the workspace
 	containers, err := database.ListContainersInWorkspace(workspaceID)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to list containers: %v", err)})
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to list containers: %v", err))
 	}
 
-	// Redeploy each container
-	for _, container := range containers {
-		err := docker.RestartContainer(container.Name)
-		if err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to redeploy container %s: %v", container.Name, err)})
+	// Redeploy each container after the containers it depends on, recreating those with pending changes
+	for _, container := range deploy.Order(containers) {
+		if _, err := deploy.Redeploy(workspaceID, container); err != nil {
+			return quotaError(c, err, fmt.Sprintf("Failed to redeploy container %s: %v", container.Name, err))
 		}
 	}
 
@@ -77,25 +85,27 @@ func HandleStopWorkspace(c echo.Context) error {
 	// Get workspace ID from query parameters
 	workspaceIDStr := c.Param("workspaceID")
 	if workspaceIDStr == "" {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Missing workspace ID"})
+		return response.Error(c, http.StatusBadRequest, "Missing workspace ID")
 	}
 
 	workspaceID, err := strconv.Atoi(workspaceIDStr)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, map[string]string{"error": "Invalid workspace ID"})
+		return response.Error(c, http.StatusBadRequest, "Invalid workspace ID")
 	}
 
 	// Get all containers in the workspace
 	containers, err := database.ListContainersInWorkspace(workspaceID)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to list containers: %v", err)})
+		return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to list containers: %v", err))
 	}
 
-	// Stop each container
+	// Stop each container before the containers it depends on
+	containers = deploy.Order(containers)
+	slices.Reverse(containers)
 	for _, container := range containers {
-		err := docker.StopContainer(container.Name)
+		err := deploy.StopCube(container)
 		if err != nil {
-			return c.JSON(http.StatusInternalServerError, map[string]string{"error": fmt.Sprintf("Failed to stop container %s: %v", container.Name, err)})
+			return response.Error(c, http.StatusInternalServerError, fmt.Sprintf("Failed to stop container %s: %v", container.Name, err))
 		}
 	}
 
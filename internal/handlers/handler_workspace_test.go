@@ -0,0 +1,41 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/internal/services/auth"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+func TestWorkspacesListContainersOnce(t *testing.T) {
+	token := newToken(t, database.APIToken{UserID: 1, Kind: auth.TokenKindPersonal, Scopes: []string{auth.ScopeAdmin, string(auth.ActionView)}})
+	spec := models.WorkspaceSpec{Name: "handler-states", Cubes: []models.CubeSpec{
+		{Name: "handler-states-web", Image: "nginx"},
+		{Name: "handler-states-api", Image: "nginx", Replicas: 3},
+		{Name: "handler-states-db", Image: "postgres"},
+	}}
+	status, body := call(t, http.MethodPost, "/api/workspace/apply", token, spec)
+	var result models.ApplyResponse
+	if status != http.StatusOK || json.Unmarshal(body, &result) != nil {
+		t.Fatalf("apply = %d %s", status, body)
+	}
+
+	// However many cubes and replicas, a request lists the containers once
+	for _, path := range []string{
+		"/api/workspace",
+		fmt.Sprintf("/api/workspace/%d", result.WorkspaceID),
+		fmt.Sprintf("/api/workspace/%d?status=running", result.WorkspaceID),
+	} {
+		containerLists.Store(0)
+		if status, body := call(t, http.MethodGet, path, token, nil); status != http.StatusOK {
+			t.Fatalf("GET %s = %d %s", path, status, body)
+		}
+		if n := containerLists.Load(); n != 1 {
+			t.Errorf("GET %s listed the containers %d times, want 1", path, n)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/internal/routes"
+	"github.com/turplespace/portos/internal/services/auth"
+)
+
+var serverURL string
+
+// containerLists counts the container lists answered by fakeDocker
+var containerLists atomic.Int32
+
+// TestMain runs the real router against a fresh database and a fake Docker daemon
+func TestMain(m *testing.M) {
+	docker := httptest.NewServer(http.HandlerFunc(fakeDocker))
+	defer docker.Close()
+	os.Setenv("DOCKER_HOST", "tcp://"+strings.TrimPrefix(docker.URL, "http://"))
+	os.Setenv("TURPLECUBES_ADMIN_USERNAME", "admin")
+	os.Setenv("TURPLECUBES_ADMIN_PASSWORD", "handlers-test-password")
+
+	path, err := database.GetPath()
+	if err != nil {
+		log.Fatal(err)
+	}
+	os.Remove(path)
+	database.Init()
+	if err := auth.EnsureAdmin(); err != nil {
+		log.Fatal(err)
+	}
+
+	e := echo.New()
+	routes.SetupRoutes(e)
+	server := httptest.NewServer(e)
+	serverURL = server.URL
+
+	code := m.Run()
+	server.Close()
+	os.Remove(path)
+	os.Exit(code)
+}
+
+// fakeDocker answers the Docker API calls of the server with no containers
+func fakeDocker(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("API-Version", "1.45")
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/_ping"):
+		w.Write([]byte("OK"))
+	case strings.HasSuffix(r.URL.Path, "/containers/json"):
+		containerLists.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("[]"))
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message":"No such container"}`))
+	}
+}
+
+// newToken creates an API token and returns its plaintext
+func newToken(t *testing.T, token database.APIToken) string {
+	t.Helper()
+	if token.Name == "" {
+		token.Name = t.Name()
+	}
+	plaintext, _, err := auth.CreateToken(token)
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+	return plaintext
+}
+
+// newUser creates a user that is not an admin and returns its ID
+func newUser(t *testing.T, username string) int {
+	t.Helper()
+	hash, err := auth.HashPassword("handlers-test-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := database.CreateUser(username, hash, false)
+	if err != nil {
+		t.Fatalf("create user %s: %v", username, err)
+	}
+	return int(id)
+}
+
+// call sends a request authenticated with the bearer token, body is sent as is when it is a []byte
+// and encoded as JSON unless nil, and returns the status and the response body
+func call(t *testing.T, method string, path string, token string, body interface{}) (int, []byte) {
+	t.Helper()
+	var reader io.Reader
+	contentType := echo.MIMEApplicationJSON
+	switch body := body.(type) {
+	case nil:
+	case []byte:
+		reader, contentType = bytes.NewReader(body), "application/yaml"
+	default:
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequest(method, serverURL+path, reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body != nil {
+		req.Header.Set(echo.HeaderContentType, contentType)
+	}
+	if token != "" {
+		req.Header.Set(echo.HeaderAuthorization, "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, data
+}
@@ -0,0 +1,197 @@
+package middleware
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/internal/services/audit"
+)
+
+// contextAuditKey is the echo context key holding the *auditRecord of the request
+const contextAuditKey = "audit"
+
+// auditErrorBodyLimit caps how much of a failed response is kept as the error of an entry
+const auditErrorBodyLimit = 2048
+
+// auditTargetParams are the path parameters naming the target of a request, by target type
+var auditTargetParams = map[string]string{
+	"workspace": "workspaceID",
+	"cube":      "cubeID",
+	"proxy":     "proxyID",
+	"user":      "userID",
+	"token":     "tokenID",
+}
+
+// auditRecord collects what handlers report about the request being audited
+type auditRecord struct {
+	actor       string
+	targetID    *int
+	workspaceID *int
+	before      interface{}
+	after       interface{}
+}
+
+// Audit records the request in the audit log once the handler returns, whatever its outcome.
+// The result is derived from the response status, the error from the body of failed responses.
+func Audit(action string, targetType string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			record := &auditRecord{}
+			c.Set(contextAuditKey, record)
+
+			recorder := &auditResponseRecorder{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = recorder
+
+			err := next(c)
+
+			status := c.Response().Status
+			if he, ok := err.(*echo.HTTPError); ok {
+				status = he.Code
+			}
+			entry := database.AuditEntry{
+				CreatedAt:  time.Now(),
+				SourceIP:   c.RealIP(),
+				Action:     action,
+				TargetType: targetType,
+				Before:     audit.Snapshot(record.before),
+				After:      audit.Snapshot(record.after),
+				Status:     status,
+				Result:     "success",
+			}
+			entry.Diff = audit.Diff(entry.Before, entry.After)
+			if status >= http.StatusBadRequest || err != nil {
+				entry.Result = "failure"
+				entry.Error = auditErrorMessage(recorder.body.Bytes(), err)
+			}
+
+			if user := CurrentUser(c); user != nil {
+				entry.UserID = &user.ID
+			}
+			if token := CurrentToken(c); token != nil {
+				entry.TokenID = &token.ID
+			}
+			entry.Actor = Actor(c)
+			if entry.Actor == "" {
+				entry.Actor = record.actor
+			}
+			if entry.Actor == "" {
+				entry.Actor = "anonymous"
+			}
+
+			entry.TargetID = record.targetID
+			if entry.TargetID == nil {
+				if id, err := strconv.Atoi(c.Param(auditTargetParams[targetType])); err == nil {
+					entry.TargetID = &id
+				}
+			}
+			entry.WorkspaceID = record.workspaceID
+			if workspaceID := CurrentWorkspaceID(c); entry.WorkspaceID == nil && workspaceID != 0 {
+				entry.WorkspaceID = &workspaceID
+			}
+
+			if err := database.InsertAuditEntry(entry); err != nil {
+				log.Printf("[*] Error: Failed to write audit entry for %s: %v", action, err)
+			}
+			return err
+		}
+	}
+}
+
+// Actor names who makes an authenticated request: the user, the API token, or the user of the token
+func Actor(c echo.Context) string {
+	user, token := CurrentUser(c), CurrentToken(c)
+	switch {
+	case user != nil && token != nil:
+		return user.Username + " (token:" + token.Name + ")"
+	case token != nil:
+		return "token:" + token.Name
+	case user != nil:
+		return user.Username
+	}
+	return ""
+}
+
+// AuditActor names the actor of a request that is not authenticated yet, such as a login
+func AuditActor(c echo.Context, actor string) {
+	if record, ok := c.Get(contextAuditKey).(*auditRecord); ok {
+		record.actor = actor
+	}
+}
+
+// AuditTarget sets the target and the workspace of the audited request, for routes where they
+// are not path parameters. IDs of 0 are ignored.
+func AuditTarget(c echo.Context, targetID int, workspaceID int) {
+	if record, ok := c.Get(contextAuditKey).(*auditRecord); ok {
+		if targetID != 0 {
+			record.targetID = &targetID
+		}
+		if workspaceID != 0 {
+			record.workspaceID = &workspaceID
+		}
+	}
+}
+
+// AuditChange stores the state of the target before and after the request, either may be nil
+func AuditChange(c echo.Context, before interface{}, after interface{}) {
+	if record, ok := c.Get(contextAuditKey).(*auditRecord); ok {
+		record.before = before
+		record.after = after
+	}
+}
+
+// auditErrorMessage extracts the error of a failed response, preferring the error field of a JSON body
+func auditErrorMessage(body []byte, err error) string {
+	var payload struct {
+		Error interface{} `json:"error"`
+	}
+	if json.Unmarshal(body, &payload) == nil && payload.Error != nil {
+		if message, ok := payload.Error.(string); ok {
+			return message
+		}
+		raw, _ := json.Marshal(payload.Error)
+		return string(raw)
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return string(body)
+}
+
+// auditResponseRecorder keeps the beginning of the response body so failures can be recorded
+type auditResponseRecorder struct {
+	http.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *auditResponseRecorder) Write(b []byte) (int, error) {
+	if remaining := auditErrorBodyLimit - r.body.Len(); remaining > 0 {
+		if len(b) < remaining {
+			remaining = len(b)
+		}
+		r.body.Write(b[:remaining])
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *auditResponseRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (r *auditResponseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	return hijacker.Hijack()
+}
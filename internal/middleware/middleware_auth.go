@@ -0,0 +1,104 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/internal/response"
+	"github.com/turplespace/portos/internal/services/auth"
+)
+
+const (
+	// contextUserKey is the echo context key holding the authenticated *database.User
+	contextUserKey = "user"
+	// contextTokenKey is the echo context key holding the *database.APIToken of token authenticated requests
+	contextTokenKey = "api_token"
+)
+
+/*
+RequireAuth rejects requests without a valid session cookie or bearer API token and stores the
+user in the context. Requests made with a service token have a token but no user.
+*/
+func RequireAuth(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if header := c.Request().Header.Get(echo.HeaderAuthorization); header != "" {
+			bearer, ok := strings.CutPrefix(header, "Bearer ")
+			if !ok {
+				return response.Error(c, http.StatusUnauthorized, "Unsupported authorization scheme")
+			}
+
+			user, token, err := auth.UserFromToken(strings.TrimSpace(bearer))
+			if err != nil {
+				log.Printf("[*] Rejected request to %s: %v", c.Request().URL.Path, err)
+				return response.Error(c, http.StatusUnauthorized, "Invalid or expired API token")
+			}
+			if user != nil && auth.EnrollmentRequired(user) {
+				return response.ErrorCode(c, http.StatusForbidden, response.CodeTwoFactorEnrollmentRequired, "Two-factor authentication must be enrolled")
+			}
+
+			c.Set(contextUserKey, user)
+			c.Set(contextTokenKey, token)
+			return next(c)
+		}
+
+		cookie, err := c.Cookie(auth.SessionCookieName)
+		if err != nil {
+			return response.Error(c, http.StatusUnauthorized, "Authentication required")
+		}
+
+		user, err := auth.UserFromSession(cookie.Value)
+		if err != nil {
+			log.Printf("[*] Rejected request to %s: %v", c.Request().URL.Path, err)
+			return response.Error(c, http.StatusUnauthorized, "Authentication required")
+		}
+
+		// Users that must enroll a second factor can only reach the auth routes until they do
+		if auth.EnrollmentRequired(user) && !strings.HasPrefix(c.Path(), "/api/auth/") {
+			return response.ErrorCode(c, http.StatusForbidden, response.CodeTwoFactorEnrollmentRequired, "Two-factor authentication must be enrolled")
+		}
+
+		c.Set(contextUserKey, user)
+		return next(c)
+	}
+}
+
+// RequireAdmin rejects requests from users that are not admins, it must run after RequireAuth.
+// Token authenticated requests also need the admin scope.
+func RequireAdmin(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		user := CurrentUser(c)
+		if user == nil || !user.IsAdmin {
+			return response.Error(c, http.StatusForbidden, "Admin privileges required")
+		}
+		if token := CurrentToken(c); token != nil && !auth.TokenHasScope(token, auth.ScopeAdmin) {
+			return response.Error(c, http.StatusForbidden, "API token lacks the admin scope")
+		}
+		return next(c)
+	}
+}
+
+// RequireSession rejects token authenticated requests, for routes such as password changes and
+// token management that must only be reachable with an interactive login
+func RequireSession(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if CurrentToken(c) != nil || CurrentUser(c) == nil {
+			return response.Error(c, http.StatusForbidden, "This route requires a login session")
+		}
+		return next(c)
+	}
+}
+
+// CurrentUser returns the user authenticated by RequireAuth, or nil
+func CurrentUser(c echo.Context) *database.User {
+	user, _ := c.Get(contextUserKey).(*database.User)
+	return user
+}
+
+// CurrentToken returns the API token the request was authenticated with, or nil
+func CurrentToken(c echo.Context) *database.APIToken {
+	token, _ := c.Get(contextTokenKey).(*database.APIToken)
+	return token
+}
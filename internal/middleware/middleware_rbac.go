@@ -0,0 +1,99 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/internal/response"
+	"github.com/turplespace/portos/internal/services/auth"
+)
+
+// contextWorkspaceKey is the echo context key holding the workspace ID resolved by RequireWorkspaceAction
+const contextWorkspaceKey = "workspace_id"
+
+// WorkspaceResolver resolves the workspace a request operates on from its path parameters
+type WorkspaceResolver func(c echo.Context) (int, error)
+
+// WorkspaceFromParam resolves the workspace from the workspaceID path parameter
+func WorkspaceFromParam(c echo.Context) (int, error) {
+	return strconv.Atoi(c.Param("workspaceID"))
+}
+
+// CubeFromParam resolves the workspace owning the cube of the cubeID path parameter
+func CubeFromParam(c echo.Context) (int, error) {
+	cubeID, err := strconv.Atoi(c.Param("cubeID"))
+	if err != nil {
+		return 0, err
+	}
+	return database.GetWorkspaceIDByCubeID(cubeID)
+}
+
+// ProxyFromParam resolves the workspace owning the proxy of the proxyID path parameter
+func ProxyFromParam(c echo.Context) (int, error) {
+	proxyID, err := strconv.Atoi(c.Param("proxyID"))
+	if err != nil {
+		return 0, err
+	}
+	return database.GetWorkspaceIDByProxyID(proxyID)
+}
+
+// RequireWorkspaceAction rejects requests whose user may not perform the action in the resolved workspace
+func RequireWorkspaceAction(action auth.Action, resolve WorkspaceResolver) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			workspaceID, err := resolve(c)
+			var numErr *strconv.NumError
+			if errors.As(err, &numErr) {
+				return response.Error(c, http.StatusBadRequest, fmt.Sprintf("Invalid ID: %s", numErr.Num))
+			}
+			if err != nil {
+				return response.Error(c, http.StatusNotFound, fmt.Sprintf("Resource not found: %v", err))
+			}
+
+			// Set before the check so that denied requests are audited against the workspace
+			c.Set(contextWorkspaceKey, workspaceID)
+			if err := Authorize(c, workspaceID, action); err != nil {
+				return response.Error(c, http.StatusForbidden, err.Error())
+			}
+
+			return next(c)
+		}
+	}
+}
+
+/*
+Authorize checks that the current user may perform the action in the workspace.
+Requests made with an API token also need the token to cover the action and the workspace,
+service tokens are only limited by their scopes and workspaces.
+Handlers call it directly when the workspace comes from the request body.
+*/
+func Authorize(c echo.Context, workspaceID int, action auth.Action) error {
+	token := CurrentToken(c)
+	if token != nil && !auth.TokenAllows(token, workspaceID, action) {
+		return fmt.Errorf("API token lacks permission %q on workspace %d", action, workspaceID)
+	}
+	if token != nil && token.Kind == auth.TokenKindService {
+		return nil
+	}
+
+	allowed, err := auth.Can(CurrentUser(c), workspaceID, action)
+	if err != nil {
+		log.Printf("[*] Error: Failed to check permissions: %v", err)
+		return fmt.Errorf("failed to check permissions")
+	}
+	if !allowed {
+		return fmt.Errorf("permission %q required on workspace %d", action, workspaceID)
+	}
+	return nil
+}
+
+// CurrentWorkspaceID returns the workspace ID resolved by RequireWorkspaceAction
+func CurrentWorkspaceID(c echo.Context) int {
+	workspaceID, _ := c.Get(contextWorkspaceKey).(int)
+	return workspaceID
+}
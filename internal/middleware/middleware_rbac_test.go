@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"log"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/internal/services/auth"
+)
+
+// TestMain runs the tests against a fresh database next to the test binary
+func TestMain(m *testing.M) {
+	path, err := database.GetPath()
+	if err != nil {
+		log.Fatal(err)
+	}
+	os.Remove(path)
+	database.Init()
+
+	code := m.Run()
+	os.Remove(path)
+	os.Exit(code)
+}
+
+// newContext returns the context of a request made by the user, with the token when not nil
+func newContext(user *database.User, token *database.APIToken) echo.Context {
+	c := echo.New().NewContext(httptest.NewRequest("GET", "/", nil), httptest.NewRecorder())
+	c.Set(contextUserKey, user)
+	if token != nil {
+		c.Set(contextTokenKey, token)
+	}
+	return c
+}
+
+// newMember creates a user with a role in the workspace, no role for none
+func newMember(t *testing.T, name string, workspaceID int, role auth.Role) *database.User {
+	t.Helper()
+	id, err := database.CreateUser(name, "hash", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role != "" {
+		if err := database.SetWorkspaceMember(workspaceID, int(id), string(role)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &database.User{ID: int(id), Username: name}
+}
+
+func TestAuthorize(t *testing.T) {
+	id, err := database.CreateWorkspace("authorize", "created by "+t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	workspaceID := int(id)
+	viewer := newMember(t, "authorize-viewer", workspaceID, auth.RoleViewer)
+	owner := newMember(t, "authorize-owner", workspaceID, auth.RoleOwner)
+	stranger := newMember(t, "authorize-stranger", workspaceID, "")
+
+	for _, test := range []struct {
+		user   *database.User
+		action auth.Action
+		ok     bool
+	}{
+		{viewer, auth.ActionLogs, true},
+		{viewer, auth.ActionDeploy, false},
+		{owner, auth.ActionWorkspaceWrite, true},
+		{stranger, auth.ActionView, false},
+		{&database.User{ID: 1, IsAdmin: true}, auth.ActionWorkspaceWrite, true},
+	} {
+		if err := Authorize(newContext(test.user, nil), workspaceID, test.action); (err == nil) != test.ok {
+			t.Errorf("Authorize(%s, %s) = %v, want ok %v", test.user.Username, test.action, err, test.ok)
+		}
+	}
+}
+
+func TestAuthorizeTokens(t *testing.T) {
+	id, err := database.CreateWorkspace("authorize-tokens", "created by "+t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	workspaceID := int(id)
+	viewer := newMember(t, "authorize-token-viewer", workspaceID, auth.RoleViewer)
+	owner := newMember(t, "authorize-token-owner", workspaceID, auth.RoleOwner)
+
+	for _, test := range []struct {
+		name   string
+		user   *database.User
+		token  *database.APIToken
+		action auth.Action
+		ok     bool
+	}{
+		{"personal token within its scopes", owner, &database.APIToken{Kind: auth.TokenKindPersonal, Scopes: []string{"deploy"}}, auth.ActionDeploy, true},
+		{"personal token beyond its scopes", owner, &database.APIToken{Kind: auth.TokenKindPersonal, Scopes: []string{"view"}}, auth.ActionDeploy, false},
+		{"personal token beyond the role of its owner", viewer, &database.APIToken{Kind: auth.TokenKindPersonal, Scopes: []string{"deploy"}}, auth.ActionDeploy, false},
+		{"personal token of another workspace", owner, &database.APIToken{Kind: auth.TokenKindPersonal, Scopes: []string{"view"}, WorkspaceIDs: []int{workspaceID + 1}}, auth.ActionView, false},
+		{"service token", nil, &database.APIToken{Kind: auth.TokenKindService, Scopes: []string{"deploy"}, WorkspaceIDs: []int{workspaceID}}, auth.ActionDeploy, true},
+		{"service token beyond its scopes", nil, &database.APIToken{Kind: auth.TokenKindService, Scopes: []string{"deploy"}, WorkspaceIDs: []int{workspaceID}}, auth.ActionCubeWrite, false},
+		{"service token of another workspace", nil, &database.APIToken{Kind: auth.TokenKindService, Scopes: []string{"deploy"}, WorkspaceIDs: []int{workspaceID + 1}}, auth.ActionDeploy, false},
+	} {
+		if err := Authorize(newContext(test.user, test.token), workspaceID, test.action); (err == nil) != test.ok {
+			t.Errorf("%s: Authorize = %v, want ok %v", test.name, err, test.ok)
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package openapi
+
+import (
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/turplespace/portos/internal/services/auth"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+// Document is an OpenAPI 3.0 document
+type Document struct {
+	OpenAPI    string                          `json:"openapi"`
+	Info       Info                            `json:"info"`
+	Tags       []Tag                           `json:"tags"`
+	Paths      map[string]map[string]*Endpoint `json:"paths"`
+	Components Components                      `json:"components"`
+	Security   []map[string][]string           `json:"security"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description"`
+}
+
+type Tag struct {
+	Name string `json:"name"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type   string `json:"type"`
+	Scheme string `json:"scheme,omitempty"`
+	In     string `json:"in,omitempty"`
+	Name   string `json:"name,omitempty"`
+}
+
+// Endpoint is an OpenAPI operation object
+type Endpoint struct {
+	Tags        []string               `json:"tags"`
+	Summary     string                 `json:"summary"`
+	OperationID string                 `json:"operationId"`
+	Parameters  []Parameter            `json:"parameters,omitempty"`
+	RequestBody *RequestBody           `json:"requestBody,omitempty"`
+	Responses   map[string]Response    `json:"responses"`
+	Security    *[]map[string][]string `json:"security,omitempty"` // Empty for public operations
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Headers     map[string]Header    `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type Header struct {
+	Description string  `json:"description"`
+	Schema      *Schema `json:"schema"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// Message is the body of the responses that only confirm an action
+type Message struct {
+	Message string `json:"message"`
+}
+
+// Created is the body of the responses to a create request, holding the ID of the new object
+type Created struct {
+	ID int `json:"id"`
+}
+
+var (
+	document    *Document
+	documentSet sync.Once
+
+	pathParam = regexp.MustCompile(`:([A-Za-z]+)`)
+)
+
+// Spec returns the OpenAPI document of the API, built once from the operations and the models
+func Spec() *Document {
+	documentSet.Do(func() {
+		document = build()
+	})
+	return document
+}
+
+// Path converts an echo route path such as /api/cube/:cubeID to its OpenAPI form /api/cube/{cubeID}
+func Path(route string) string {
+	return pathParam.ReplaceAllString(route, "{$1}")
+}
+
+func build() *Document {
+	components := schemas{}
+	doc := &Document{
+		OpenAPI: "3.0.3",
+		Info: Info{
+			Title:       "Turple Cubes API",
+			Version:     "1.0.0",
+			Description: "Manage workspaces of Docker containers (cubes) and the nginx proxies in front of them. Errors always use the ErrorResponse body.",
+		},
+		Paths: map[string]map[string]*Endpoint{},
+		Components: Components{
+			Schemas: components,
+			SecuritySchemes: map[string]*SecurityScheme{
+				"session": {Type: "apiKey", In: "cookie", Name: auth.SessionCookieName},
+				"token":   {Type: "http", Scheme: "bearer"},
+			},
+		},
+		Security: []map[string][]string{{"session": {}}, {"token": {}}},
+	}
+
+	errorSchema := components.of(reflect.TypeOf(models.ErrorResponse{}))
+	tags := map[string]bool{}
+	for _, op := range operations {
+		endpoint := &Endpoint{
+			Tags:        []string{op.Tag},
+			Summary:     op.Summary,
+			OperationID: op.ID,
+			Responses: map[string]Response{
+				"default": {Description: "Error", Content: jsonContent(errorSchema)},
+			},
+		}
+		tags[op.Tag] = true
+
+		for _, match := range pathParam.FindAllStringSubmatch(op.Path, -1) {
+			schema := &Schema{Type: "string"}
+			if strings.HasSuffix(match[1], "ID") {
+				schema = &Schema{Type: "integer", Format: "int32"}
+			}
+			endpoint.Parameters = append(endpoint.Parameters, Parameter{Name: match[1], In: "path", Required: true, Schema: schema})
+		}
+		for _, query := range op.Query {
+			endpoint.Parameters = append(endpoint.Parameters, Parameter{Name: query.Name, In: "query", Description: query.Description, Schema: &Schema{Type: "string"}})
+		}
+
+		switch request := op.Request.(type) {
+		case nil:
+		case rawRequest:
+			endpoint.RequestBody = &RequestBody{Required: true, Content: map[string]MediaType{request.ContentType: {Schema: &Schema{Type: "string"}}}}
+		default:
+			endpoint.RequestBody = &RequestBody{Required: true, Content: jsonContent(components.of(reflect.TypeOf(op.Request)))}
+		}
+
+		switch response := op.Response.(type) {
+		case nil:
+			endpoint.Responses["200"] = Response{Description: "Success"}
+		case rawResponse:
+			endpoint.Responses[response.Status] = Response{Description: response.Description}
+			if response.ContentType != "" {
+				schema := &Schema{Type: "string"}
+				if response.ContentType == "application/json" {
+					schema = &Schema{Type: "object"}
+				}
+				endpoint.Responses[response.Status] = Response{
+					Description: response.Description,
+					Content:     map[string]MediaType{response.ContentType: {Schema: schema}},
+				}
+			}
+		default:
+			endpoint.Responses["200"] = Response{Description: "Success", Content: jsonContent(components.of(reflect.TypeOf(response)))}
+		}
+
+		if op.Paged {
+			success := endpoint.Responses["200"]
+			success.Headers = map[string]Header{
+				"X-Next-Cursor": {Description: "Cursor of the next page, missing on the last page", Schema: &Schema{Type: "string"}},
+			}
+			endpoint.Responses["200"] = success
+		}
+
+		if op.Public {
+			endpoint.Security = &[]map[string][]string{}
+		}
+
+		path := Path(op.Path)
+		if doc.Paths[path] == nil {
+			doc.Paths[path] = map[string]*Endpoint{}
+		}
+		doc.Paths[path][strings.ToLower(op.Method)] = endpoint
+	}
+
+	for tag := range tags {
+		doc.Tags = append(doc.Tags, Tag{Name: tag})
+	}
+	sort.Slice(doc.Tags, func(i, j int) bool { return doc.Tags[i].Name < doc.Tags[j].Name })
+
+	return doc
+}
+
+func jsonContent(schema *Schema) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: schema}}
+}
+
+// rawRequest documents a request body that is not a JSON model, such as a YAML file
+type rawRequest struct {
+	ContentType string
+}
+
+var yamlFile = rawRequest{ContentType: "application/yaml"}
+
+// rawResponse documents a response that is not a JSON model, such as a redirect or plain text
+type rawResponse struct {
+	Status      string
+	Description string
+	ContentType string
+}
+
+var (
+	redirect  = rawResponse{Status: "302", Description: "Redirect"}
+	plainText = rawResponse{Status: "200", Description: "Success", ContentType: "text/plain"}
+	yamlText  = rawResponse{Status: "200", Description: "Success", ContentType: "application/yaml"}
+	websocket = rawResponse{Status: "101", Description: "WebSocket stream"}
+	htmlPage  = rawResponse{Status: "200", Description: "Success", ContentType: "text/html"}
+	spec      = rawResponse{Status: "200", Description: "OpenAPI 3 document", ContentType: "application/json"}
+	docsFile  = rawResponse{Status: "200", Description: "Swagger UI stylesheet or script"}
+)
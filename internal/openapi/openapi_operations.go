@@ -0,0 +1,144 @@
+package openapi
+
+import (
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+// operation documents one route of routes.SetupRoutes, the route test fails when one is missing
+type operation struct {
+	Method   string
+	Path     string // echo path, such as /api/cube/:cubeID
+	ID       string
+	Tag      string
+	Summary  string
+	Query    []query
+	Request  interface{} // Zero value of the JSON request body, a rawRequest, or nil when there is none
+	Response interface{} // Zero value of the JSON response body, or a rawResponse
+	Public   bool        // Does not need a session or a token
+	Paged    bool        // Takes pageQuery and returns the cursor of the next page in the X-Next-Cursor header
+}
+
+type query struct {
+	Name        string
+	Description string
+}
+
+var strategyQuery = query{"strategy", "recreate by default, or blue-green to replace the container without dropping the traffic of its proxies"}
+
+var pageQuery = []query{
+	{"sort", "name or created_at, descending with a leading -"},
+	{"limit", "Page size, at most 500"},
+	{"cursor", "Cursor of the next page, from the X-Next-Cursor header of the previous page"},
+}
+
+var operations = []operation{
+	// Auth
+	{Method: "POST", Path: "/api/auth/login", ID: "login", Tag: "auth", Summary: "Log in and set the session cookie", Request: models.LoginRequest{}, Response: database.User{}, Public: true},
+	{Method: "POST", Path: "/api/auth/logout", ID: "logout", Tag: "auth", Summary: "End the session", Response: Message{}, Public: true},
+	{Method: "GET", Path: "/api/auth/me", ID: "getCurrentUser", Tag: "auth", Summary: "Get the logged in user", Response: database.User{}},
+	{Method: "POST", Path: "/api/auth/2fa/enroll", ID: "startTOTPEnrollment", Tag: "auth", Summary: "Start the TOTP enrollment", Response: models.TOTPEnrollmentResponse{}},
+	{Method: "POST", Path: "/api/auth/2fa/verify", ID: "confirmTOTPEnrollment", Tag: "auth", Summary: "Enable TOTP with a first code", Request: models.TwoFactorCodeRequest{}, Response: models.RecoveryCodesResponse{}},
+	{Method: "POST", Path: "/api/auth/2fa/recovery-codes", ID: "regenerateRecoveryCodes", Tag: "auth", Summary: "Replace the recovery codes", Request: models.TwoFactorCodeRequest{}, Response: models.RecoveryCodesResponse{}},
+	{Method: "POST", Path: "/api/auth/2fa/disable", ID: "disableTOTP", Tag: "auth", Summary: "Disable TOTP", Request: models.TwoFactorCodeRequest{}, Response: Message{}},
+	{Method: "GET", Path: "/api/auth/oidc/login", ID: "oidcLogin", Tag: "auth", Summary: "Start a single sign-on login", Response: redirect, Public: true},
+	{Method: "GET", Path: "/api/auth/oidc/callback", ID: "oidcCallback", Tag: "auth", Summary: "Finish a single sign-on login", Query: []query{{"code", "Authorization code"}, {"state", "State of the login"}}, Response: htmlPage, Public: true},
+
+	// Users
+	{Method: "GET", Path: "/api/user", ID: "listUsers", Tag: "users", Summary: "List the users", Response: []database.User{}},
+	{Method: "POST", Path: "/api/user", ID: "createUser", Tag: "users", Summary: "Create a user", Request: models.CreateUserRequest{}, Response: Created{}},
+	{Method: "DELETE", Path: "/api/user/:userID", ID: "deleteUser", Tag: "users", Summary: "Delete a user", Response: Message{}},
+	{Method: "PUT", Path: "/api/user/:userID/password", ID: "changePassword", Tag: "users", Summary: "Change the password of a user", Request: models.ChangePasswordRequest{}, Response: Message{}},
+	{Method: "DELETE", Path: "/api/user/:userID/2fa", ID: "resetUserTOTP", Tag: "users", Summary: "Reset the TOTP of a user", Response: Message{}},
+
+	// API tokens
+	{Method: "GET", Path: "/api/token", ID: "listAPITokens", Tag: "tokens", Summary: "List the API tokens", Response: []database.APIToken{}},
+	{Method: "POST", Path: "/api/token", ID: "createAPIToken", Tag: "tokens", Summary: "Create an API token, the value is only returned once", Request: models.CreateAPITokenRequest{}, Response: models.CreateAPITokenResponse{}},
+	{Method: "DELETE", Path: "/api/token/:tokenID", ID: "revokeAPIToken", Tag: "tokens", Summary: "Revoke an API token", Response: Message{}},
+
+	// Workspaces
+	{Method: "GET", Path: "/api/workspace", ID: "listWorkspaces", Tag: "workspaces", Summary: "List the workspaces", Query: append([]query{{"q", "Search in the name and description"}}, pageQuery...), Response: models.WorkspaceResponse{}, Paged: true},
+	{Method: "POST", Path: "/api/workspace", ID: "createWorkspace", Tag: "workspaces", Summary: "Create a workspace", Request: models.CreateWorkspaceRequest{}, Response: Created{}},
+	{Method: "GET", Path: "/api/workspace/:workspaceID", ID: "listCubes", Tag: "workspaces", Summary: "List the cubes of a workspace", Query: append([]query{
+		{"q", "Search in the name and image"},
+		{"image", "Image, without a tag it matches every tag"},
+		{"label", "key=value, or a key matching any value"},
+		{"status", "Container state such as running or exited"},
+	}, pageQuery...), Response: []models.GetCubesResponse{}, Paged: true},
+	{Method: "PUT", Path: "/api/workspace/:workspaceID", ID: "editWorkspace", Tag: "workspaces", Summary: "Edit a workspace", Request: models.EditWorkspaceRequest{}, Response: Message{}},
+	{Method: "DELETE", Path: "/api/workspace/:workspaceID", ID: "deleteWorkspace", Tag: "workspaces", Summary: "Delete a workspace and its cubes", Response: Message{}},
+	{Method: "POST", Path: "/api/workspace/:workspaceID/deploy", ID: "deployWorkspace", Tag: "workspaces", Summary: "Deploy every cube of a workspace", Response: Message{}},
+	{Method: "POST", Path: "/api/workspace/:workspaceID/redeploy", ID: "redeployWorkspace", Tag: "workspaces", Summary: "Redeploy every cube of a workspace", Response: Message{}},
+	{Method: "POST", Path: "/api/workspace/:workspaceID/stop", ID: "stopWorkspace", Tag: "workspaces", Summary: "Stop every cube of a workspace", Response: Message{}},
+	{Method: "POST", Path: "/api/workspace/apply", ID: "applyWorkspace", Tag: "workspaces", Summary: "Create or update a workspace from a spec, sent as JSON or YAML", Query: []query{{"dry_run", "Return the plan without applying it, true or false"}}, Request: models.WorkspaceSpec{}, Response: models.ApplyResponse{}},
+	{Method: "POST", Path: "/api/workspace/import/compose", ID: "importCompose", Tag: "workspaces", Summary: "Create a workspace from a docker-compose file, ignored keys are returned as warnings", Query: []query{{"name", "Name of the workspace, the name of the compose file by default"}, {"desc", "Description of the workspace"}, {"dry_run", "Return the plan without creating the workspace, true or false"}}, Request: yamlFile, Response: models.ApplyResponse{}},
+	{Method: "GET", Path: "/api/workspace/:workspaceID/spec", ID: "getWorkspaceSpec", Tag: "workspaces", Summary: "Get the spec of a workspace, as YAML with a YAML Accept header", Response: models.WorkspaceSpec{}},
+	{Method: "GET", Path: "/api/workspace/:workspaceID/export", ID: "exportWorkspace", Tag: "workspaces", Summary: "Export a workspace as a docker-compose file or Kubernetes manifests", Query: []query{{"format", "compose, the default, or k8s"}}, Response: yamlText},
+	{Method: "POST", Path: "/api/workspace/:workspaceID/clone", ID: "cloneWorkspace", Tag: "workspaces", Summary: "Copy a workspace into a new workspace", Query: []query{{"dry_run", "Return the plan without creating the workspace, true or false"}}, Request: models.CloneWorkspaceRequest{}, Response: models.ApplyResponse{}},
+	{Method: "POST", Path: "/api/workspace/:workspaceID/promote", ID: "promoteWorkspace", Tag: "workspaces", Summary: "Copy a workspace with overrides into a new or existing workspace, the changes are the diff between them", Query: []query{{"dry_run", "Return the diff without applying it, true or false"}}, Request: models.CloneWorkspaceRequest{}, Response: models.ApplyResponse{}},
+
+	// Members
+	{Method: "GET", Path: "/api/workspace/:workspaceID/members", ID: "listWorkspaceMembers", Tag: "members", Summary: "List the members of a workspace", Response: []database.WorkspaceMember{}},
+	{Method: "PUT", Path: "/api/workspace/:workspaceID/members/:userID", ID: "setWorkspaceMember", Tag: "members", Summary: "Add a member or change its role", Request: models.SetWorkspaceMemberRequest{}, Response: Message{}},
+	{Method: "DELETE", Path: "/api/workspace/:workspaceID/members/:userID", ID: "removeWorkspaceMember", Tag: "members", Summary: "Remove a member", Response: Message{}},
+
+	// Quotas
+	{Method: "GET", Path: "/api/workspace/:workspaceID/quota", ID: "getWorkspaceQuota", Tag: "quotas", Summary: "Get the quota and usage of a workspace", Response: models.WorkspaceQuotaResponse{}},
+	{Method: "PUT", Path: "/api/workspace/:workspaceID/quota", ID: "setWorkspaceQuota", Tag: "quotas", Summary: "Set the quota of a workspace", Request: models.WorkspaceQuota{}, Response: Message{}},
+	{Method: "DELETE", Path: "/api/workspace/:workspaceID/quota", ID: "deleteWorkspaceQuota", Tag: "quotas", Summary: "Remove the quota of a workspace", Response: Message{}},
+
+	// Variables
+	{Method: "GET", Path: "/api/workspace/:workspaceID/variables", ID: "listWorkspaceVariables", Tag: "variables", Summary: "List the variables of a workspace", Response: []database.WorkspaceVariable{}},
+	{Method: "PUT", Path: "/api/workspace/:workspaceID/variables/:name", ID: "setWorkspaceVariable", Tag: "variables", Summary: "Create or update a variable", Request: models.SetWorkspaceVariableRequest{}, Response: Message{}},
+	{Method: "DELETE", Path: "/api/workspace/:workspaceID/variables/:name", ID: "deleteWorkspaceVariable", Tag: "variables", Summary: "Delete a variable", Response: Message{}},
+
+	// Secrets
+	{Method: "GET", Path: "/api/workspace/:workspaceID/secrets", ID: "listSecrets", Tag: "secrets", Summary: "List the names and versions of the secrets", Response: []database.Secret{}},
+	{Method: "PUT", Path: "/api/workspace/:workspaceID/secrets/:name", ID: "setSecret", Tag: "secrets", Summary: "Create or rotate a secret", Request: models.SetSecretRequest{}, Response: models.SetSecretResponse{}},
+	{Method: "DELETE", Path: "/api/workspace/:workspaceID/secrets/:name", ID: "deleteSecret", Tag: "secrets", Summary: "Delete a secret", Response: Message{}},
+
+	// Cubes
+	{Method: "POST", Path: "/api/cube", ID: "addCube", Tag: "cubes", Summary: "Add a cube to a workspace", Request: models.AddCubesRequest{}, Response: Created{}},
+	{Method: "GET", Path: "/api/cube/:cubeID", ID: "getCube", Tag: "cubes", Summary: "Get a cube with its status", Response: models.GetCubesByIdResponse{}},
+	{Method: "PUT", Path: "/api/cube/:cubeID", ID: "editCube", Tag: "cubes", Summary: "Edit a cube", Request: models.EditCubeRequest{}, Response: Message{}},
+	{Method: "DELETE", Path: "/api/cube/:cubeID", ID: "deleteCube", Tag: "cubes", Summary: "Delete a cube", Response: Message{}},
+	{Method: "GET", Path: "/api/cube/:cubeID/logs", ID: "getCubeLogs", Tag: "cubes", Summary: "Get the last lines of the container logs", Query: []query{{"tail", "Number of lines or all, 200 by default"}}, Response: plainText},
+	{Method: "GET", Path: "/api/cube/:cubeID/exec", ID: "execCube", Tag: "cubes", Summary: "Run a command in the container over a WebSocket, see the README for the message format", Query: []query{{"cmd", "Command and arguments, repeated, sh by default"}, {"tty", "Allocate a terminal, true or false"}}, Response: websocket},
+	{Method: "POST", Path: "/api/cube/:cubeID/deploy", ID: "deployCube", Tag: "cubes", Summary: "Deploy a cube", Query: []query{strategyQuery}, Response: Message{}},
+	{Method: "POST", Path: "/api/cube/:cubeID/redeploy", ID: "redeployCube", Tag: "cubes", Summary: "Redeploy a cube", Query: []query{strategyQuery}, Response: Message{}},
+	{Method: "POST", Path: "/api/cube/:cubeID/stop", ID: "stopCube", Tag: "cubes", Summary: "Stop a cube", Response: Message{}},
+	{Method: "POST", Path: "/api/cube/:cubeID/scale", ID: "scaleCube", Tag: "cubes", Summary: "Set the number of replicas of a cube and start or remove containers to match", Request: models.ScaleCubeRequest{}, Response: models.ScaleCubeResponse{}},
+	{Method: "POST", Path: "/api/cube/:cubeID/commit", ID: "commitCube", Tag: "cubes", Summary: "Commit the container of a cube to an image", Request: models.CommitCubeRequest{}, Response: Message{}},
+	{Method: "GET", Path: "/api/cube/:cubeID/revisions", ID: "listCubeRevisions", Tag: "cubes", Summary: "List the revisions of a cube spec, newest first", Response: []models.CubeRevision{}},
+	{Method: "GET", Path: "/api/cube/:cubeID/revisions/diff", ID: "diffCubeRevisions", Tag: "cubes", Summary: "Compare two revisions of a cube", Query: []query{{"from", "Revision number"}, {"to", "Revision number"}}, Response: models.CubeRevisionDiff{}},
+	{Method: "POST", Path: "/api/cube/:cubeID/rollback/:rev", ID: "rollbackCube", Tag: "cubes", Summary: "Restore the spec of a cube from a revision, stored as a new revision", Query: []query{{"redeploy", "Recreate the container, true or false"}}, Response: models.RollbackCubeResponse{}},
+
+	// Proxies
+	{Method: "POST", Path: "/api/proxy", ID: "addProxy", Tag: "proxies", Summary: "Add a proxy to a cube", Request: models.AddProxyRequest{}, Response: Created{}},
+	{Method: "GET", Path: "/api/proxy/:proxyID", ID: "getProxy", Tag: "proxies", Summary: "Get a proxy", Response: models.Proxy{}},
+	{Method: "PUT", Path: "/api/proxy/:proxyID", ID: "editProxy", Tag: "proxies", Summary: "Edit a proxy", Request: models.EditProxyByIDRequest{}, Response: Message{}},
+	{Method: "DELETE", Path: "/api/proxy/:proxyID", ID: "deleteProxy", Tag: "proxies", Summary: "Delete a proxy", Response: Message{}},
+	{Method: "POST", Path: "/api/proxy/:proxyID/deploy", ID: "deployProxy", Tag: "proxies", Summary: "Generate the nginx configuration of a proxy", Response: Message{}},
+	{Method: "GET", Path: "/api/proxy/by-cube/:cubeID", ID: "listCubeProxies", Tag: "proxies", Summary: "List the proxies of a cube", Response: []models.Proxy{}},
+	{Method: "DELETE", Path: "/api/proxy/by-cube/:cubeID", ID: "deleteCubeProxies", Tag: "proxies", Summary: "Delete the proxies of a cube", Response: Message{}},
+
+	// Audit log
+	{Method: "GET", Path: "/api/audit", ID: "getAuditLog", Tag: "audit", Summary: "Read the audit log, newest first", Query: []query{
+		{"workspace_id", "Entries of one workspace, required for non-admins"},
+		{"actor", "Username, or token:<name> for service tokens"},
+		{"action", "Exact action, or a prefix such as cube.*"},
+		{"since", "RFC 3339 timestamp"},
+		{"until", "RFC 3339 timestamp"},
+		{"limit", "Number of entries, 100 by default and 1000 at most"},
+		{"format", "csv to download a CSV file"},
+	}, Response: []database.AuditEntry{}},
+
+	// Images and logs
+	{Method: "GET", Path: "/api/repo/local", ID: "listImages", Tag: "images", Summary: "List the custom images", Response: models.ImagesResponse{}},
+	{Method: "GET", Path: "/api/logs/stream", ID: "streamServerLogs", Tag: "logs", Summary: "Stream the server log over a WebSocket", Response: websocket},
+
+	// Docs
+	{Method: "GET", Path: "/api/openapi.json", ID: "getOpenAPISpec", Tag: "docs", Summary: "Get this OpenAPI document", Response: spec, Public: true},
+	{Method: "GET", Path: "/api/docs", ID: "getDocs", Tag: "docs", Summary: "Interactive API documentation", Response: htmlPage, Public: true},
+	{Method: "GET", Path: "/api/docs/:file", ID: "getDocsFile", Tag: "docs", Summary: "Get a stylesheet or script of the documentation page", Response: docsFile, Public: true},
+}
@@ -0,0 +1,201 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema is an OpenAPI 3.0 schema object
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// customFormats are the validation rules of internal/validation, documented as string formats
+var customFormats = map[string]bool{
+	"container_name": true,
+	"workspace_name": true,
+	"username":       true,
+	"image_ref":      true,
+	"image_name":     true,
+	"image_tag":      true,
+	"cpus":           true,
+	"memory":         true,
+	"port_mapping":   true,
+	"env_var":        true,
+	"label":          true,
+	"volume_path":    true,
+	"host_path":      true,
+	"proxy_domain":   true,
+}
+
+// schemas collects the named struct schemas referenced by the document
+type schemas map[string]*Schema
+
+// of returns the schema of a Go value, named structs are added to the components and referenced
+func (s schemas) of(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == rawMessageType:
+		return &Schema{Description: "Any JSON value"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: s.of(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.of(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.object(t)
+		}
+		if _, ok := s[t.Name()]; !ok {
+			s[t.Name()] = nil // Reserve the name first, so recursive types terminate
+			s[t.Name()] = s.object(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + t.Name()}
+	default:
+		return &Schema{}
+	}
+}
+
+// object returns the schema of the JSON encoding of a struct, embedded structs are flattened
+func (s schemas) object(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	s.addFields(schema, t)
+	return schema
+}
+
+func (s schemas) addFields(schema *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+
+		name, options, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			s.addFields(schema, field.Type)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := s.of(field.Type)
+		if applyRules(property, field.Tag.Get("validate")) && !strings.Contains(options, "omitempty") {
+			schema.Required = append(schema.Required, name)
+		}
+		schema.Properties[name] = property
+	}
+}
+
+/*
+applyRules documents the validate tag of a field on its schema and reports whether the field is
+required. Rules after dive apply to the items of a slice, the keys and values of maps are left out.
+*/
+func applyRules(schema *Schema, tag string) bool {
+	if tag == "" || schema.Ref != "" {
+		return strings.HasPrefix(tag, "required")
+	}
+
+	rules := strings.Split(tag, ",")
+	itemRules := []string{}
+	if dive := slices.Index(rules, "dive"); dive >= 0 {
+		rules, itemRules = rules[:dive], rules[dive+1:]
+	}
+
+	required := false
+	for _, rule := range rules {
+		if rule == "required" {
+			required = true
+		}
+		applyRule(schema, rule)
+	}
+	if schema.Items != nil {
+		for _, rule := range itemRules {
+			applyRule(schema.Items, rule)
+		}
+	}
+	return required
+}
+
+func applyRule(schema *Schema, rule string) {
+	name, param, _ := strings.Cut(rule, "=")
+	switch name {
+	case "oneof":
+		schema.Enum = strings.Fields(param)
+	case "min", "max", "gt":
+		value, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return
+		}
+		if name == "gt" {
+			value++
+		}
+		switch schema.Type {
+		case "string":
+			length := int(value)
+			if name == "max" {
+				schema.MaxLength = &length
+			} else {
+				schema.MinLength = &length
+			}
+		case "array":
+			if name != "max" {
+				count := int(value)
+				schema.MinItems = &count
+			}
+		case "integer", "number":
+			if name == "max" {
+				schema.Maximum = &value
+			} else {
+				schema.Minimum = &value
+			}
+		}
+	default:
+		if customFormats[name] && schema.Type == "string" {
+			schema.Format = name
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package response
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/turplespace/portos/internal/validation"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+// Error codes, clients switch on these instead of parsing messages
+const (
+	CodeInvalidRequest   = "invalid_request"
+	CodeValidationFailed = "validation_failed"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeConflict         = "conflict"
+	CodeInternal         = "internal_error"
+	CodeUnavailable      = "unavailable"
+
+	CodeQuotaExceeded               = "quota_exceeded"
+	CodeInvalidProxyConfig          = "invalid_proxy_config"
+	CodeTwoFactorRequired           = "two_factor_required"
+	CodeInvalidTwoFactorCode        = "invalid_two_factor_code"
+	CodeTwoFactorEnrollmentRequired = "two_factor_enrollment_required"
+	CodeTwoFactorLocked             = "two_factor_locked"
+)
+
+// statusCodes gives the default code of an HTTP status
+var statusCodes = map[int]string{
+	http.StatusBadRequest:          CodeInvalidRequest,
+	http.StatusUnauthorized:        CodeUnauthorized,
+	http.StatusForbidden:           CodeForbidden,
+	http.StatusNotFound:            CodeNotFound,
+	http.StatusMethodNotAllowed:    CodeInvalidRequest,
+	http.StatusConflict:            CodeConflict,
+	http.StatusServiceUnavailable:  CodeUnavailable,
+	http.StatusInternalServerError: CodeInternal,
+}
+
+// Error writes an error response with the default code of the status
+func Error(c echo.Context, status int, message string) error {
+	code, ok := statusCodes[status]
+	if !ok {
+		code = CodeInternal
+		if status < http.StatusInternalServerError {
+			code = CodeInvalidRequest
+		}
+	}
+	return ErrorCode(c, status, code, message)
+}
+
+// ErrorCode writes an error response with a specific code
+func ErrorCode(c echo.Context, status int, code string, message string) error {
+	return c.JSON(status, models.ErrorResponse{Error: message, Code: code})
+}
+
+// Invalid writes the 400 response of a request that failed to bind or validate
+func Invalid(c echo.Context, err error) error {
+	if fields := validation.Fields(err); fields != nil {
+		return c.JSON(http.StatusBadRequest, models.ErrorResponse{
+			Error:  "Request validation failed",
+			Code:   CodeValidationFailed,
+			Fields: fields,
+		})
+	}
+
+	message := err.Error()
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		message = "Invalid request body"
+		if text, ok := he.Message.(string); ok {
+			message = text
+		}
+	}
+	return ErrorCode(c, http.StatusBadRequest, CodeInvalidRequest, message)
+}
+
+// HTTPErrorHandler renders the errors returned by echo itself, such as unknown routes, as error responses
+func HTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	status, message := http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError)
+	var he *echo.HTTPError
+	if errors.As(err, &he) {
+		status = he.Code
+		message = http.StatusText(he.Code)
+		if text, ok := he.Message.(string); ok {
+			message = text
+		}
+	}
+
+	if c.Request().Method == http.MethodHead {
+		c.NoContent(status)
+		return
+	}
+	Error(c, status, message)
+}
@@ -0,0 +1,93 @@
+package response
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/turplespace/portos/internal/validation"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+// record runs write against a new request and returns the status and decoded envelope of its response
+func record(t *testing.T, method string, write func(c echo.Context)) (int, models.ErrorResponse, string) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	write(echo.New().NewContext(httptest.NewRequest(method, "/", nil), recorder))
+	var envelope models.ErrorResponse
+	if recorder.Header().Get(echo.HeaderContentType) == echo.MIMEApplicationJSON {
+		if err := json.Unmarshal(recorder.Body.Bytes(), &envelope); err != nil {
+			t.Fatalf("response %s is not an error envelope: %v", recorder.Body, err)
+		}
+	}
+	return recorder.Code, envelope, recorder.Body.String()
+}
+
+func TestError(t *testing.T) {
+	for status, code := range map[int]string{
+		http.StatusBadRequest:          CodeInvalidRequest,
+		http.StatusNotFound:            CodeNotFound,
+		http.StatusConflict:            CodeConflict,
+		http.StatusTeapot:              CodeInvalidRequest,
+		http.StatusBadGateway:          CodeInternal,
+		http.StatusServiceUnavailable:  CodeUnavailable,
+		http.StatusInternalServerError: CodeInternal,
+	} {
+		got, envelope, _ := record(t, http.MethodGet, func(c echo.Context) { Error(c, status, "message") })
+		if got != status || envelope.Code != code || envelope.Error != "message" {
+			t.Errorf("Error(%d) = %d %+v, want code %s", status, got, envelope, code)
+		}
+	}
+
+	status, envelope, _ := record(t, http.MethodGet, func(c echo.Context) { ErrorCode(c, http.StatusTooManyRequests, CodeTwoFactorLocked, "locked") })
+	if status != http.StatusTooManyRequests || envelope.Code != CodeTwoFactorLocked {
+		t.Errorf("ErrorCode = %d %+v", status, envelope)
+	}
+}
+
+func TestInvalid(t *testing.T) {
+	validationErr := validation.Struct(models.ScaleCubeRequest{Replicas: 0})
+	for _, test := range []struct {
+		name    string
+		err     error
+		code    string
+		message string
+		fields  int
+	}{
+		{"validation errors", validationErr, CodeValidationFailed, "Request validation failed", 1},
+		{"bind error", echo.NewHTTPError(http.StatusBadRequest, "Unmarshal type error"), CodeInvalidRequest, "Unmarshal type error", 0},
+		{"bind error without a message", echo.NewHTTPError(http.StatusBadRequest, errors.New("internal")), CodeInvalidRequest, "Invalid request body", 0},
+		{"other error", errors.New("name is missing"), CodeInvalidRequest, "name is missing", 0},
+	} {
+		status, envelope, _ := record(t, http.MethodPost, func(c echo.Context) { Invalid(c, test.err) })
+		if status != http.StatusBadRequest || envelope.Code != test.code || envelope.Error != test.message || len(envelope.Fields) != test.fields {
+			t.Errorf("%s: Invalid = %d %+v, want %s %q with %d fields", test.name, status, envelope, test.code, test.message, test.fields)
+		}
+	}
+	if _, envelope, _ := record(t, http.MethodPost, func(c echo.Context) { Invalid(c, validationErr) }); envelope.Fields[0].Field != "replicas" || envelope.Fields[0].Code != "min" {
+		t.Errorf("field = %+v, want the min rule of replicas", envelope.Fields[0])
+	}
+}
+
+func TestHTTPErrorHandler(t *testing.T) {
+	status, envelope, _ := record(t, http.MethodGet, func(c echo.Context) { HTTPErrorHandler(echo.ErrNotFound, c) })
+	if status != http.StatusNotFound || envelope.Code != CodeNotFound || envelope.Error != "Not Found" {
+		t.Errorf("unknown route = %d %+v", status, envelope)
+	}
+	status, envelope, _ = record(t, http.MethodGet, func(c echo.Context) { HTTPErrorHandler(errors.New("boom"), c) })
+	if status != http.StatusInternalServerError || envelope.Code != CodeInternal || envelope.Error == "boom" {
+		t.Errorf("internal error = %d %+v, want a generic message", status, envelope)
+	}
+	if status, _, body := record(t, http.MethodHead, func(c echo.Context) { HTTPErrorHandler(echo.ErrMethodNotAllowed, c) }); status != http.StatusMethodNotAllowed || body != "" {
+		t.Errorf("HEAD = %d %q, want no body", status, body)
+	}
+	if status, _, body := record(t, http.MethodGet, func(c echo.Context) {
+		c.String(http.StatusAccepted, "done")
+		HTTPErrorHandler(echo.ErrNotFound, c)
+	}); status != http.StatusAccepted || body != "done" {
+		t.Errorf("committed response = %d %q, want it untouched", status, body)
+	}
+}
@@ -5,8 +5,12 @@ import (
 	"os"
 
 	"github.com/labstack/echo/v4"
-	"github.com/labstack/echo/v4/middleware"
+	echomiddleware "github.com/labstack/echo/v4/middleware"
+	"github.com/turplespace/portos/internal/config"
 	"github.com/turplespace/portos/internal/handlers"
+	"github.com/turplespace/portos/internal/middleware"
+	"github.com/turplespace/portos/internal/response"
+	"github.com/turplespace/portos/internal/services/auth"
 )
 
 func SetupRoutes(e *echo.Echo) {
@@ -17,52 +21,138 @@ func SetupRoutes(e *echo.Echo) {
 	fmt.Println(ex)
 	path := fmt.Sprintf("%s_web", ex)
 
-	// Middleware
-	e.Use(middleware.CORSWithConfig(middleware.CORSConfig{
-		AllowOrigins: []string{"*"},
-		AllowMethods: []string{echo.GET, echo.POST, echo.PUT, echo.DELETE, echo.OPTIONS},
-	}))
+	// Errors returned by echo itself, such as unknown routes, use the same body as handler errors
+	e.HTTPErrorHandler = response.HTTPErrorHandler
+
+	// Middleware, cross origin requests are only allowed for the configured origins
+	if origins := config.Get().AllowedOrigins; len(origins) > 0 {
+		e.Use(echomiddleware.CORSWithConfig(echomiddleware.CORSConfig{
+			AllowOrigins:     origins,
+			AllowMethods:     []string{echo.GET, echo.POST, echo.PUT, echo.DELETE, echo.OPTIONS},
+			AllowCredentials: true,
+			ExposeHeaders:    []string{"X-Next-Cursor"}, // Paged lists
+		}))
+	}
 
 	// Static files
 	e.Static("/", path)
 
-	// Workspace routes
-	workspaceGroup := e.Group("/api/workspace")
+	// Auth routes
+	authGroup := e.Group("/api/auth")
+	authGroup.POST("/login", handlers.HandleLogin, middleware.Audit("auth.login", "user"))
+	authGroup.POST("/logout", handlers.HandleLogout, middleware.Audit("auth.logout", "user"))
+	authGroup.GET("/me", handlers.HandleGetCurrentUser, middleware.RequireAuth)
+	authGroup.POST("/2fa/enroll", handlers.HandleStartTOTPEnrollment, middleware.RequireAuth, middleware.Audit("auth.2fa_enroll", "user"), middleware.RequireSession)
+	authGroup.POST("/2fa/verify", handlers.HandleConfirmTOTPEnrollment, middleware.RequireAuth, middleware.Audit("auth.2fa_verify", "user"), middleware.RequireSession)
+	authGroup.POST("/2fa/recovery-codes", handlers.HandleRegenerateRecoveryCodes, middleware.RequireAuth, middleware.Audit("auth.2fa_recovery_codes", "user"), middleware.RequireSession)
+	authGroup.POST("/2fa/disable", handlers.HandleDisableTOTP, middleware.RequireAuth, middleware.Audit("auth.2fa_disable", "user"), middleware.RequireSession)
+	authGroup.GET("/oidc/login", handlers.HandleOIDCLogin)
+	authGroup.GET("/oidc/callback", handlers.HandleOIDCCallback)
+
+	// User routes
+	userGroup := e.Group("/api/user", middleware.RequireAuth)
+	userGroup.GET("", handlers.HandleGetUsers, middleware.RequireAdmin)
+	userGroup.POST("", handlers.HandleCreateUser, middleware.Audit("user.create", "user"), middleware.RequireAdmin)
+	userGroup.DELETE("/:userID", handlers.HandleDeleteUser, middleware.Audit("user.delete", "user"), middleware.RequireAdmin)
+	userGroup.PUT("/:userID/password", handlers.HandleChangePassword, middleware.Audit("user.password", "user"), middleware.RequireSession)
+	userGroup.DELETE("/:userID/2fa", handlers.HandleResetUserTOTP, middleware.Audit("user.reset_2fa", "user"), middleware.RequireAdmin, middleware.RequireSession)
+
+	// API token routes, tokens cannot be managed with a token
+	tokenGroup := e.Group("/api/token", middleware.RequireAuth, middleware.RequireSession)
+	tokenGroup.GET("", handlers.HandleGetAPITokens)
+	tokenGroup.POST("", handlers.HandleCreateAPIToken, middleware.Audit("token.create", "token"))
+	tokenGroup.DELETE("/:tokenID", handlers.HandleRevokeAPIToken, middleware.Audit("token.revoke", "token"))
+
+	// Workspace routes, mutating routes are audited before the role check so denials are recorded too
+	workspaceGroup := e.Group("/api/workspace", middleware.RequireAuth)
 	workspaceGroup.GET("", handlers.HandleGetWorkspaces)
-	workspaceGroup.POST("", handlers.HandleCreateWorkspace)
-	workspaceGroup.PUT("/:workspaceID", handlers.HandleEditWorkspace)
-	workspaceGroup.DELETE("/:workspaceID", handlers.HandleDeleteWorkspace)
-	workspaceGroup.GET("/:workspaceID", handlers.HandleGetWorkspaceData)
-	workspaceGroup.POST("/:workspaceID/deploy", handlers.HandleDeployWorkspace)
-	workspaceGroup.POST("/:workspaceID/redeploy", handlers.HandleRedeployWorkspace)
-	workspaceGroup.POST("/:workspaceID/stop", handlers.HandleStopWorkspace)
-
-	// Cube routes
-	cubeGroup := e.Group("/api/cube")
-
-	cubeGroup.POST("", handlers.HandleAddCubes)
-	cubeGroup.PUT("/:cubeID", handlers.HandleEditCube)
-	cubeGroup.DELETE("/:cubeID", handlers.HandleDeleteCube)
-	cubeGroup.GET("/:cubeID", handlers.HandleGetCubeData)
-	cubeGroup.POST("/:cubeID/deploy", handlers.HandleDeployCube)
-	cubeGroup.POST("/:cubeID/redeploy", handlers.HandleRedeployCube)
-	cubeGroup.POST("/:cubeID/stop", handlers.HandleStopCube)
-	cubeGroup.POST("/:cubeID/commit", handlers.HandleCommitCube)
-
-	// Proxy route
-	proxyGroup := e.Group("/api/proxy")
-	proxyGroup.POST("", handlers.HandleAddProxy)
-	proxyGroup.GET("/:proxyID", handlers.HandleGetProxyByID)
-	proxyGroup.PUT("/:proxyID", handlers.HandleEditProxyByID)
-	proxyGroup.DELETE("/:proxyID", handlers.HandleDeleteProxyByID)
-
-	proxyGroup.POST("/:proxyID/deploy", handlers.HandlePostStartProxy)
-
-	proxyGroup.GET("/by-cube/:cubeID", handlers.HandleGetProxiesByCubeID)
-	proxyGroup.DELETE("/by-cube/:cubeID", handlers.HandleDeleteProxiesByCubeID)
+	workspaceGroup.POST("", handlers.HandleCreateWorkspace, middleware.Audit("workspace.create", "workspace"), middleware.RequireAdmin)
+	workspaceGroup.PUT("/:workspaceID", handlers.HandleEditWorkspace, middleware.Audit("workspace.edit", "workspace"), requireWorkspace(auth.ActionWorkspaceWrite))
+	workspaceGroup.DELETE("/:workspaceID", handlers.HandleDeleteWorkspace, middleware.Audit("workspace.delete", "workspace"), requireWorkspace(auth.ActionWorkspaceWrite))
+	workspaceGroup.GET("/:workspaceID", handlers.HandleGetWorkspaceData, requireWorkspace(auth.ActionView))
+	workspaceGroup.POST("/:workspaceID/deploy", handlers.HandleDeployWorkspace, middleware.Audit("workspace.deploy", "workspace"), requireWorkspace(auth.ActionDeploy))
+	workspaceGroup.POST("/:workspaceID/redeploy", handlers.HandleRedeployWorkspace, middleware.Audit("workspace.redeploy", "workspace"), requireWorkspace(auth.ActionDeploy))
+	workspaceGroup.POST("/:workspaceID/stop", handlers.HandleStopWorkspace, middleware.Audit("workspace.stop", "workspace"), requireWorkspace(auth.ActionDeploy))
+	// Authorized by the handler, applying a spec creates the workspace or changes an existing one
+	workspaceGroup.POST("/apply", handlers.HandleApplyWorkspace, middleware.Audit("workspace.apply", "workspace"))
+	workspaceGroup.POST("/import/compose", handlers.HandleImportCompose, middleware.Audit("workspace.import", "workspace"), middleware.RequireAdmin)
+	workspaceGroup.GET("/:workspaceID/spec", handlers.HandleGetWorkspaceSpec, requireWorkspace(auth.ActionView))
+	workspaceGroup.GET("/:workspaceID/export", handlers.HandleExportWorkspace, requireWorkspace(auth.ActionView))
+	workspaceGroup.POST("/:workspaceID/clone", handlers.HandleCloneWorkspace, middleware.Audit("workspace.clone", "workspace"), requireWorkspace(auth.ActionView))
+	workspaceGroup.POST("/:workspaceID/promote", handlers.HandlePromoteWorkspace, middleware.Audit("workspace.promote", "workspace"), requireWorkspace(auth.ActionView))
+
+	workspaceGroup.GET("/:workspaceID/members", handlers.HandleGetWorkspaceMembers, requireWorkspace(auth.ActionView))
+	workspaceGroup.PUT("/:workspaceID/members/:userID", handlers.HandleSetWorkspaceMember, middleware.Audit("member.set", "user"), requireWorkspace(auth.ActionWorkspaceWrite))
+	workspaceGroup.DELETE("/:workspaceID/members/:userID", handlers.HandleRemoveWorkspaceMember, middleware.Audit("member.remove", "user"), requireWorkspace(auth.ActionWorkspaceWrite))
+
+	// Quota routes, quotas are set by admins
+	workspaceGroup.GET("/:workspaceID/quota", handlers.HandleGetWorkspaceQuota, requireWorkspace(auth.ActionView))
+	workspaceGroup.PUT("/:workspaceID/quota", handlers.HandleSetWorkspaceQuota, middleware.Audit("quota.set", "workspace"), middleware.RequireAdmin, requireWorkspace(auth.ActionView))
+	workspaceGroup.DELETE("/:workspaceID/quota", handlers.HandleDeleteWorkspaceQuota, middleware.Audit("quota.delete", "workspace"), middleware.RequireAdmin, requireWorkspace(auth.ActionView))
+
+	// Variable routes, the variables are inherited by every cube of the workspace
+	workspaceGroup.GET("/:workspaceID/variables", handlers.HandleGetWorkspaceVariables, requireWorkspace(auth.ActionView))
+	workspaceGroup.PUT("/:workspaceID/variables/:name", handlers.HandleSetWorkspaceVariable, middleware.Audit("variable.set", "workspace"), requireWorkspace(auth.ActionWorkspaceWrite))
+	workspaceGroup.DELETE("/:workspaceID/variables/:name", handlers.HandleDeleteWorkspaceVariable, middleware.Audit("variable.delete", "workspace"), requireWorkspace(auth.ActionWorkspaceWrite))
+
+	// Secret routes, values can be written but never read back
+	workspaceGroup.GET("/:workspaceID/secrets", handlers.HandleGetSecrets, requireWorkspace(auth.ActionView))
+	workspaceGroup.PUT("/:workspaceID/secrets/:name", handlers.HandleSetSecret, middleware.Audit("secret.set", "workspace"), requireWorkspace(auth.ActionWorkspaceWrite))
+	workspaceGroup.DELETE("/:workspaceID/secrets/:name", handlers.HandleDeleteSecret, middleware.Audit("secret.delete", "workspace"), requireWorkspace(auth.ActionWorkspaceWrite))
+
+	// Cube routes, adding a cube checks the workspace of the request body in the handler
+	cubeGroup := e.Group("/api/cube", middleware.RequireAuth)
+
+	cubeGroup.POST("", handlers.HandleAddCubes, middleware.Audit("cube.create", "cube"))
+	cubeGroup.PUT("/:cubeID", handlers.HandleEditCube, middleware.Audit("cube.edit", "cube"), requireCube(auth.ActionCubeWrite))
+	cubeGroup.DELETE("/:cubeID", handlers.HandleDeleteCube, middleware.Audit("cube.delete", "cube"), requireCube(auth.ActionCubeWrite))
+	cubeGroup.GET("/:cubeID", handlers.HandleGetCubeData, requireCube(auth.ActionView))
+	cubeGroup.GET("/:cubeID/logs", handlers.HandleGetCubeLogs, requireCube(auth.ActionLogs))
+	cubeGroup.GET("/:cubeID/exec", handlers.HandleExecCube, middleware.Audit("cube.exec", "cube"), requireCube(auth.ActionExec))
+	cubeGroup.POST("/:cubeID/deploy", handlers.HandleDeployCube, middleware.Audit("cube.deploy", "cube"), requireCube(auth.ActionDeploy))
+	cubeGroup.POST("/:cubeID/redeploy", handlers.HandleRedeployCube, middleware.Audit("cube.redeploy", "cube"), requireCube(auth.ActionDeploy))
+	cubeGroup.POST("/:cubeID/stop", handlers.HandleStopCube, middleware.Audit("cube.stop", "cube"), requireCube(auth.ActionDeploy))
+	cubeGroup.POST("/:cubeID/scale", handlers.HandleScaleCube, middleware.Audit("cube.scale", "cube"), requireCube(auth.ActionDeploy))
+	cubeGroup.POST("/:cubeID/commit", handlers.HandleCommitCube, middleware.Audit("cube.commit", "cube"), requireCube(auth.ActionCommit))
+	cubeGroup.GET("/:cubeID/revisions", handlers.HandleListCubeRevisions, requireCube(auth.ActionView))
+	cubeGroup.GET("/:cubeID/revisions/diff", handlers.HandleDiffCubeRevisions, requireCube(auth.ActionView))
+	cubeGroup.POST("/:cubeID/rollback/:rev", handlers.HandleRollbackCube, middleware.Audit("cube.rollback", "cube"), requireCube(auth.ActionCubeWrite))
+
+	// Proxy route, adding a proxy checks the workspace of the cube in the request body in the handler
+	proxyGroup := e.Group("/api/proxy", middleware.RequireAuth)
+	proxyGroup.POST("", handlers.HandleAddProxy, middleware.Audit("proxy.create", "proxy"))
+	proxyGroup.GET("/:proxyID", handlers.HandleGetProxyByID, requireProxy(auth.ActionView))
+	proxyGroup.PUT("/:proxyID", handlers.HandleEditProxyByID, middleware.Audit("proxy.edit", "proxy"), requireProxy(auth.ActionProxyWrite))
+	proxyGroup.DELETE("/:proxyID", handlers.HandleDeleteProxyByID, middleware.Audit("proxy.delete", "proxy"), requireProxy(auth.ActionProxyWrite))
+
+	proxyGroup.POST("/:proxyID/deploy", handlers.HandlePostStartProxy, middleware.Audit("proxy.deploy", "proxy"), requireProxy(auth.ActionDeploy))
+
+	proxyGroup.GET("/by-cube/:cubeID", handlers.HandleGetProxiesByCubeID, requireCube(auth.ActionView))
+	proxyGroup.DELETE("/by-cube/:cubeID", handlers.HandleDeleteProxiesByCubeID, middleware.Audit("proxy.delete_by_cube", "cube"), requireCube(auth.ActionProxyWrite))
+
+	// Audit log route, workspace owners can read the entries of their workspace
+	e.GET("/api/audit", handlers.HandleGetAuditLog, middleware.RequireAuth)
+
 	// Images route
-	e.GET("/api/repo/local", handlers.HandleGetImages)
+	e.GET("/api/repo/local", handlers.HandleGetImages, middleware.RequireAuth)
+
+	// Logs route, the server log stream spans every workspace so it is restricted to admins
+	e.GET("/api/logs/stream", handlers.HandleLogStream, middleware.RequireAuth, middleware.RequireAdmin)
+
+	// API documentation, public so integrators can read it before they have an account
+	e.GET("/api/openapi.json", handlers.HandleGetOpenAPISpec)
+	e.GET("/api/docs", handlers.HandleGetDocs)
+	e.GET("/api/docs/:file", handlers.HandleGetDocsFile)
+}
+
+func requireWorkspace(action auth.Action) echo.MiddlewareFunc {
+	return middleware.RequireWorkspaceAction(action, middleware.WorkspaceFromParam)
+}
+
+func requireCube(action auth.Action) echo.MiddlewareFunc {
+	return middleware.RequireWorkspaceAction(action, middleware.CubeFromParam)
+}
 
-	// Logs route
-	e.GET("/api/logs/stream", handlers.HandleLogStream)
+func requireProxy(action auth.Action) echo.MiddlewareFunc {
+	return middleware.RequireWorkspaceAction(action, middleware.ProxyFromParam)
 }
@@ -0,0 +1,85 @@
+package routes
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/turplespace/portos/internal/openapi"
+)
+
+// apiRoutes returns the /api routes registered by SetupRoutes as "METHOD /path" in OpenAPI form
+func apiRoutes(t *testing.T) map[string]bool {
+	t.Helper()
+
+	e := echo.New()
+	SetupRoutes(e)
+
+	routes := make(map[string]bool)
+	for _, route := range e.Routes() {
+		// Groups with middleware register catch-all not found routes, they are not part of the API
+		if route.Method != echo.RouteNotFound && strings.HasPrefix(route.Path, "/api/") {
+			routes[route.Method+" "+openapi.Path(route.Path)] = true
+		}
+	}
+	return routes
+}
+
+func TestEveryRouteHasSpec(t *testing.T) {
+	spec := openapi.Spec()
+	for route := range apiRoutes(t) {
+		method, path, _ := strings.Cut(route, " ")
+		if spec.Paths[path][strings.ToLower(method)] == nil {
+			t.Errorf("route %s has no entry in the OpenAPI spec, add it to internal/openapi/openapi_operations.go", route)
+		}
+	}
+}
+
+func TestEverySpecEntryHasRoute(t *testing.T) {
+	routes := apiRoutes(t)
+	for path, endpoints := range openapi.Spec().Paths {
+		for method := range endpoints {
+			route := strings.ToUpper(method) + " " + path
+			if !routes[route] {
+				t.Errorf("spec entry %s has no route", route)
+			}
+		}
+	}
+}
+
+func TestSpecReferencesResolve(t *testing.T) {
+	spec := openapi.Spec()
+	var check func(where string, schema *openapi.Schema)
+	check = func(where string, schema *openapi.Schema) {
+		if schema == nil {
+			return
+		}
+		if name, ok := strings.CutPrefix(schema.Ref, "#/components/schemas/"); ok && spec.Components.Schemas[name] == nil {
+			t.Errorf("%s references unknown schema %s", where, name)
+		}
+		check(where, schema.Items)
+		check(where, schema.AdditionalProperties)
+		for _, property := range schema.Properties {
+			check(where, property)
+		}
+	}
+
+	for name, schema := range spec.Components.Schemas {
+		check("schema "+name, schema)
+	}
+	for path, endpoints := range spec.Paths {
+		for method, endpoint := range endpoints {
+			where := strings.ToUpper(method) + " " + path
+			if endpoint.RequestBody != nil {
+				for _, media := range endpoint.RequestBody.Content {
+					check(where, media.Schema)
+				}
+			}
+			for _, response := range endpoint.Responses {
+				for _, media := range response.Content {
+					check(where, media.Schema)
+				}
+			}
+		}
+	}
+}
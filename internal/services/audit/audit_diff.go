@@ -0,0 +1,76 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/turplespace/portos/internal/database"
+)
+
+// Snapshot encodes an audited object as JSON, nil stays empty
+func Snapshot(v interface{}) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	raw, err := json.Marshal(v)
+	if err != nil || string(raw) == "null" {
+		return nil
+	}
+	return raw
+}
+
+/*
+Diff compares two JSON snapshots field by field. Objects are walked recursively and
+reported with dotted paths such as resource_limits.memory, lists and scalars are compared
+as a whole. Fields only present on one side are reported with a nil counterpart.
+*/
+func Diff(before json.RawMessage, after json.RawMessage) []database.FieldChange {
+	var b, a interface{}
+	if len(before) > 0 {
+		json.Unmarshal(before, &b)
+	}
+	if len(after) > 0 {
+		json.Unmarshal(after, &a)
+	}
+
+	var changes []database.FieldChange
+	diffValues("", b, a, &changes)
+	return changes
+}
+
+func diffValues(path string, before interface{}, after interface{}, changes *[]database.FieldChange) {
+	beforeMap, beforeIsMap := before.(map[string]interface{})
+	afterMap, afterIsMap := after.(map[string]interface{})
+	if beforeIsMap && afterIsMap || beforeIsMap && after == nil || before == nil && afterIsMap {
+		keys := make(map[string]bool)
+		for key := range beforeMap {
+			keys[key] = true
+		}
+		for key := range afterMap {
+			keys[key] = true
+		}
+		sorted := make([]string, 0, len(keys))
+		for key := range keys {
+			sorted = append(sorted, key)
+		}
+		sort.Strings(sorted)
+
+		for _, key := range sorted {
+			diffValues(joinPath(path, key), beforeMap[key], afterMap[key], changes)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(before, after) {
+		*changes = append(*changes, database.FieldChange{Field: path, Before: before, After: after})
+	}
+}
+
+func joinPath(path string, key string) string {
+	if path == "" {
+		return key
+	}
+	return fmt.Sprintf("%s.%s", path, key)
+}
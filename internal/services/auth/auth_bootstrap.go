@@ -0,0 +1,48 @@
+package auth
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/turplespace/portos/internal/config"
+	"github.com/turplespace/portos/internal/database"
+)
+
+/*
+EnsureAdmin creates the admin account on the first run, when the user table is empty.
+The password is taken from TURPLECUBES_ADMIN_PASSWORD or generated, in which case it is
+printed once to stdout only so it never reaches the log stream.
+*/
+func EnsureAdmin() error {
+	count, err := database.CountUsers()
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return nil
+	}
+
+	cfg := config.Get()
+	password := cfg.AdminPassword
+	generated := password == ""
+	if generated {
+		password, err = RandomToken(18)
+		if err != nil {
+			return err
+		}
+	}
+
+	hash, err := HashPassword(password)
+	if err != nil {
+		return err
+	}
+	if _, err := database.CreateUser(cfg.AdminUsername, hash, true); err != nil {
+		return err
+	}
+
+	log.Printf("[*] Created initial admin account %q", cfg.AdminUsername)
+	if generated {
+		fmt.Printf("Initial admin password for %q: %s\n", cfg.AdminUsername, password)
+	}
+	return nil
+}
@@ -0,0 +1,331 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/turplespace/portos/internal/config"
+	"github.com/turplespace/portos/internal/database"
+	"golang.org/x/oauth2"
+)
+
+// OIDCStateCookieName is the cookie binding an OIDC login to the browser that started it
+const OIDCStateCookieName = "turplecubes_oidc_state"
+
+// ErrProviderMFARequired is returned by OIDCCallback when a second factor is required and the ID token
+// does not show that the provider checked one
+var ErrProviderMFARequired = errors.New("the identity provider did not check a second factor")
+
+// oidcLoginTTL is how long a started OIDC login can be completed
+const oidcLoginTTL = 10 * time.Minute
+
+// oidcLogin is an OIDC login waiting for its callback
+type oidcLogin struct {
+	nonce     string
+	verifier  string
+	expiresAt time.Time
+}
+
+var (
+	oidcMu       sync.Mutex
+	oidcProvider *oidc.Provider
+	oidcPending  = make(map[string]oidcLogin)
+)
+
+// getOIDCProvider discovers the provider on first use, failed discoveries are retried on the next login
+func getOIDCProvider(ctx context.Context) (*oidc.Provider, *oauth2.Config, error) {
+	cfg := config.Get().OIDC
+	if !cfg.Enabled() {
+		return nil, nil, fmt.Errorf("single sign-on is not configured")
+	}
+
+	oidcMu.Lock()
+	defer oidcMu.Unlock()
+	if oidcProvider == nil {
+		provider, err := oidc.NewProvider(ctx, cfg.Issuer)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to discover OIDC provider %s: %v", cfg.Issuer, err)
+		}
+		oidcProvider = provider
+	}
+
+	oauthConfig := &oauth2.Config{
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		RedirectURL:  cfg.RedirectURL,
+		Endpoint:     oidcProvider.Endpoint(),
+		Scopes:       append([]string{oidc.ScopeOpenID}, cfg.Scopes...),
+	}
+	return oidcProvider, oauthConfig, nil
+}
+
+// OIDCAuthURL starts an authorization code login with PKCE and returns the provider URL and the state
+func OIDCAuthURL(ctx context.Context) (string, string, error) {
+	_, oauthConfig, err := getOIDCProvider(ctx)
+	if err != nil {
+		return "", "", err
+	}
+
+	state, err := RandomToken(24)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := RandomToken(24)
+	if err != nil {
+		return "", "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	oidcMu.Lock()
+	now := time.Now()
+	for key, pending := range oidcPending {
+		if now.After(pending.expiresAt) {
+			delete(oidcPending, key)
+		}
+	}
+	oidcPending[state] = oidcLogin{nonce: nonce, verifier: verifier, expiresAt: now.Add(oidcLoginTTL)}
+	oidcMu.Unlock()
+
+	url := oauthConfig.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+	return url, state, nil
+}
+
+/*
+OIDCCallback completes a login: it exchanges the code, validates the ID token signature, audience,
+expiry and nonce, then provisions the user of the issuer and subject of the token and syncs its
+username, admin flag and workspace roles from its claims.
+*/
+func OIDCCallback(ctx context.Context, state string, code string) (*database.User, error) {
+	provider, oauthConfig, err := getOIDCProvider(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	oidcMu.Lock()
+	pending, ok := oidcPending[state]
+	delete(oidcPending, state)
+	oidcMu.Unlock()
+	if !ok || time.Now().After(pending.expiresAt) {
+		return nil, fmt.Errorf("unknown or expired login state")
+	}
+
+	token, err := oauthConfig.Exchange(ctx, code, oauth2.VerifierOption(pending.verifier))
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange authorization code: %v", err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("token response has no id_token")
+	}
+
+	idToken, err := provider.Verifier(&oidc.Config{ClientID: oauthConfig.ClientID}).Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ID token: %v", err)
+	}
+	if idToken.Nonce != pending.nonce {
+		return nil, fmt.Errorf("ID token nonce does not match")
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("failed to decode ID token claims: %v", err)
+	}
+
+	cfg := config.Get().OIDC
+	username, _ := claims[cfg.UsernameClaim].(string)
+	if username == "" {
+		return nil, fmt.Errorf("ID token has no %q claim", cfg.UsernameClaim)
+	}
+	groups := claimStrings(claims[cfg.GroupsClaim])
+
+	// Single sign-on sessions skip the TOTP check, so when a second factor is required the
+	// provider must have checked it. The account is left as it is until then.
+	if !providerMFA(claims) {
+		required := cfg.RequireMFA
+		if !required && config.Get().RequireAdminTOTP {
+			if required, err = oidcAdmin(idToken.Issuer, idToken.Subject, username, groups); err != nil {
+				return nil, err
+			}
+		}
+		if required {
+			return nil, ErrProviderMFARequired
+		}
+	}
+	return provisionOIDCUser(idToken.Issuer, idToken.Subject, username, groups)
+}
+
+// oidcAdmin reports whether the account of a single sign-on user is an administrator once
+// provisionOIDCUser has synced it, without changing it
+func oidcAdmin(issuer string, subject string, username string, groups []string) (bool, error) {
+	if len(config.Get().OIDC.AdminGroups) > 0 {
+		return inAdminGroup(groups), nil
+	}
+	user, err := database.GetUserByOIDCIdentity(issuer, subject)
+	if errors.Is(err, database.ErrNotFound) {
+		user, err = database.GetUnlinkedOIDCUser(username)
+	}
+	if errors.Is(err, database.ErrNotFound) {
+		// New accounts are only made administrators by the admin groups
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return user.IsAdmin, nil
+}
+
+// inAdminGroup reports whether any of the groups of a single sign-on user is an admin group
+func inAdminGroup(groups []string) bool {
+	for _, group := range config.Get().OIDC.AdminGroups {
+		if slices.Contains(groups, group) {
+			return true
+		}
+	}
+	return false
+}
+
+// providerMFA reports whether the amr or acr claim of an ID token shows a second factor
+func providerMFA(claims map[string]interface{}) bool {
+	cfg := config.Get().OIDC
+	for _, method := range claimStrings(claims["amr"]) {
+		if slices.Contains(cfg.MFAMethods, method) {
+			return true
+		}
+	}
+	acr, _ := claims["acr"].(string)
+	return acr != "" && slices.Contains(cfg.MFAContexts, acr)
+}
+
+/*
+provisionOIDCUser creates or updates the account of a single sign-on user from its claims. The
+account belongs to the subject of the issuer, which never changes, the username is only its display
+name: the provider may let users pick it, and it follows their renames.
+*/
+func provisionOIDCUser(issuer string, subject string, username string, groups []string) (*database.User, error) {
+	cfg := config.Get().OIDC
+	inGroup := make(map[string]bool)
+	for _, group := range groups {
+		inGroup[group] = true
+	}
+	isAdmin := inAdminGroup(groups)
+
+	user, err := database.GetUserByOIDCIdentity(issuer, subject)
+	if errors.Is(err, database.ErrNotFound) {
+		// Accounts provisioned before identities were stored are linked on their next login
+		if user, err = database.GetUnlinkedOIDCUser(username); err == nil {
+			if err := database.SetUserOIDCIdentity(user.ID, issuer, subject); err != nil {
+				return nil, err
+			}
+			log.Printf("[*] Linked single sign-on user %q to subject %q of %s", user.Username, subject, issuer)
+		}
+	}
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		return nil, err
+	}
+	if err != nil {
+		// The username of a local account or of another subject is never taken over
+		name, err := freeUsername(username, 0)
+		if err != nil {
+			return nil, err
+		}
+		id, err := database.CreateOIDCUser(name, issuer, subject, isAdmin)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("[*] Provisioned single sign-on user %q for subject %q of %s", name, subject, issuer)
+		user, err = database.GetUserByID(int(id))
+		if err != nil {
+			return nil, err
+		}
+	} else if user.Username != username {
+		name, err := freeUsername(username, user.ID)
+		if err != nil {
+			return nil, err
+		}
+		if name != user.Username {
+			if err := database.RenameUser(user.ID, name); err != nil {
+				return nil, err
+			}
+			log.Printf("[*] Renamed single sign-on user %q to %q", user.Username, name)
+			user.Username = name
+		}
+	}
+
+	if len(cfg.AdminGroups) > 0 && user.IsAdmin != isAdmin {
+		if err := database.SetUserAdmin(user.ID, isAdmin); err != nil {
+			return nil, err
+		}
+		user.IsAdmin = isAdmin
+	}
+
+	// The highest role granted by any group wins, workspaces managed by a mapping but not
+	// granted by any group of the user lose the membership
+	roles := make(map[string]Role)
+	for _, mapping := range cfg.WorkspaceRoles {
+		if _, ok := roles[mapping.Workspace]; !ok {
+			roles[mapping.Workspace] = ""
+		}
+		if inGroup[mapping.Group] && ValidRole(mapping.Role) && roleRank[Role(mapping.Role)] > roleRank[roles[mapping.Workspace]] {
+			roles[mapping.Workspace] = Role(mapping.Role)
+		}
+	}
+	for workspace, role := range roles {
+		workspaceID, err := database.GetWorkspaceIDByName(workspace)
+		if err != nil {
+			log.Printf("[*] Warning: OIDC role mapping: %v", err)
+			continue
+		}
+		if role == "" {
+			err = database.RemoveWorkspaceMember(workspaceID, user.ID)
+		} else {
+			err = database.SetWorkspaceMember(workspaceID, user.ID, string(role))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+// freeUsername returns username, or username with a number suffix when it belongs to a user other than userID.
+// Only a username without any user is free, a failed lookup is returned.
+func freeUsername(username string, userID int) (string, error) {
+	for i := 1; i <= 100; i++ {
+		name := username
+		if i > 1 {
+			name = fmt.Sprintf("%s-%d", username, i)
+		}
+		user, err := database.GetUserByUsername(name)
+		if errors.Is(err, database.ErrNotFound) || (err == nil && user.ID == userID) {
+			return name, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return "", fmt.Errorf("no free username left for %q", username)
+}
+
+// claimStrings converts a claim holding a string or a list of strings to a slice
+func claimStrings(claim interface{}) []string {
+	switch value := claim.(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		var values []string
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
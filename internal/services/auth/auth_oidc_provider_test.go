@@ -0,0 +1,342 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/turplespace/portos/internal/config"
+	"github.com/turplespace/portos/internal/database"
+)
+
+/*
+mockIssuer is an OpenID provider answering discovery, the signing keys and the token endpoint.
+The tests play the browser: authorize hands out a code for the next login, as the authorization
+endpoint would after the user signs in.
+*/
+type mockIssuer struct {
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	mu     sync.Mutex
+	codes  map[string]mockGrant
+}
+
+// mockGrant is an authorization code waiting for its exchange
+type mockGrant struct {
+	challenge string
+	claims    map[string]interface{}
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	issuer := &mockIssuer{key: key, codes: map[string]mockGrant{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":                                issuer.server.URL,
+			"authorization_endpoint":                issuer.server.URL + "/authorize",
+			"token_endpoint":                        issuer.server.URL + "/token",
+			"jwks_uri":                              issuer.server.URL + "/keys",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/keys", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{{
+			"kty": "RSA", "alg": "RS256", "use": "sig", "kid": "test",
+			"n": base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e": base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", issuer.token)
+	issuer.server = httptest.NewServer(mux)
+	t.Cleanup(issuer.server.Close)
+	return issuer
+}
+
+/*
+authorize checks the authorization request of a login URL and returns a code whose ID token has
+the given claims, next to the nonce of the request unless the claims set one.
+*/
+func (m *mockIssuer) authorize(t *testing.T, authURL string, claims map[string]interface{}) string {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	if !strings.HasPrefix(authURL, m.server.URL+"/authorize?") || query.Get("response_type") != "code" ||
+		query.Get("client_id") != "portos" || query.Get("code_challenge_method") != "S256" ||
+		query.Get("code_challenge") == "" || query.Get("nonce") == "" || query.Get("state") == "" ||
+		!strings.Contains(query.Get("scope"), "openid") {
+		t.Fatalf("unexpected authorization request %s", authURL)
+	}
+
+	full := map[string]interface{}{"nonce": query.Get("nonce")}
+	for name, value := range claims {
+		full[name] = value
+	}
+	code, err := RandomToken(16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.mu.Lock()
+	m.codes[code] = mockGrant{challenge: query.Get("code_challenge"), claims: full}
+	m.mu.Unlock()
+	return code
+}
+
+// token exchanges a code once, when the PKCE verifier matches the challenge of its request
+func (m *mockIssuer) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	m.mu.Lock()
+	grant, ok := m.codes[r.PostForm.Get("code")]
+	delete(m.codes, r.PostForm.Get("code"))
+	m.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" || base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := map[string]interface{}{
+		"iss": m.server.URL, "aud": "portos",
+		"iat": time.Now().Unix(), "exp": time.Now().Add(time.Minute).Unix(),
+	}
+	for name, value := range grant.claims {
+		claims[name] = value
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access", "token_type": "Bearer", "expires_in": 60, "id_token": m.sign(claims),
+	})
+}
+
+// sign returns claims as an RS256 JWT
+func (m *mockIssuer) sign(claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": "test"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, _ := rsa.SignPKCS1v15(rand.Reader, m.key, crypto.SHA256, digest[:])
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// useMockIssuer points the single sign-on settings at a new mock issuer until the end of the test
+func useMockIssuer(t *testing.T) *mockIssuer {
+	t.Helper()
+	issuer := newMockIssuer(t)
+	cfg := config.Get()
+	saved, savedTOTP := cfg.OIDC, cfg.RequireAdminTOTP
+	cfg.OIDC = config.OIDCConfig{
+		Issuer:        issuer.server.URL,
+		ClientID:      "portos",
+		ClientSecret:  "secret",
+		RedirectURL:   "http://portos.test/api/auth/oidc/callback",
+		Scopes:        []string{"profile"},
+		UsernameClaim: "preferred_username",
+		GroupsClaim:   "groups",
+		AdminGroups:   []string{"platform"},
+		WorkspaceRoles: []config.OIDCRoleMapping{
+			{Group: "developers", Workspace: "oidc-shop", Role: "operator"},
+			{Group: "leads", Workspace: "oidc-shop", Role: "owner"},
+		},
+		MFAMethods: []string{"mfa"},
+	}
+	oidcMu.Lock()
+	oidcProvider = nil
+	oidcMu.Unlock()
+	t.Cleanup(func() {
+		cfg.OIDC, cfg.RequireAdminTOTP = saved, savedTOTP
+		oidcMu.Lock()
+		oidcProvider = nil
+		oidcMu.Unlock()
+	})
+	return issuer
+}
+
+// login runs a login through the mock issuer, as the browser and the callback would
+func (m *mockIssuer) login(t *testing.T, claims map[string]interface{}) (*database.User, error) {
+	t.Helper()
+	authURL, state, err := OIDCAuthURL(context.Background())
+	if err != nil {
+		t.Fatalf("start login: %v", err)
+	}
+	return OIDCCallback(context.Background(), state, m.authorize(t, authURL, claims))
+}
+
+func TestOIDCLoginMapsGroups(t *testing.T) {
+	issuer := useMockIssuer(t)
+	workspaceID, err := database.CreateWorkspace("oidc-shop", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims := map[string]interface{}{"sub": "erin-1", "preferred_username": "erin", "groups": []string{"developers", "platform"}}
+	user, err := issuer.login(t, claims)
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	if user.Username != "erin" || user.AuthSource != "oidc" || !user.IsAdmin {
+		t.Fatalf("user = %+v, want admin erin provisioned by single sign-on", user)
+	}
+	if role, _ := database.GetWorkspaceRole(int(workspaceID), user.ID); role != "operator" {
+		t.Fatalf("role = %q, want operator", role)
+	}
+
+	// The highest role wins, and groups the user left take their grants with them
+	claims["groups"] = []string{"developers", "leads"}
+	if user, err = issuer.login(t, claims); err != nil {
+		t.Fatalf("second login: %v", err)
+	}
+	if role, _ := database.GetWorkspaceRole(int(workspaceID), user.ID); role != "owner" || user.IsAdmin {
+		t.Fatalf("role = %q, admin %v, want owner without admin", role, user.IsAdmin)
+	}
+	claims["groups"] = "guests"
+	if user, err = issuer.login(t, claims); err != nil {
+		t.Fatalf("third login: %v", err)
+	}
+	if role, _ := database.GetWorkspaceRole(int(workspaceID), user.ID); role != "" {
+		t.Fatalf("role = %q, want no membership", role)
+	}
+}
+
+func TestOIDCLoginChecks(t *testing.T) {
+	issuer := useMockIssuer(t)
+	claims := map[string]interface{}{"sub": "frank-1", "preferred_username": "frank"}
+
+	t.Run("state is single use", func(t *testing.T) {
+		authURL, state, err := OIDCAuthURL(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := OIDCCallback(context.Background(), "forged", issuer.authorize(t, authURL, claims)); err == nil {
+			t.Fatal("login with an unknown state succeeded")
+		}
+		if _, err := OIDCCallback(context.Background(), state, issuer.authorize(t, authURL, claims)); err != nil {
+			t.Fatalf("login: %v", err)
+		}
+		if _, err := OIDCCallback(context.Background(), state, issuer.authorize(t, authURL, claims)); err == nil {
+			t.Fatal("replayed state succeeded")
+		}
+	})
+
+	t.Run("PKCE verifier must match", func(t *testing.T) {
+		authURL, _, err := OIDCAuthURL(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		// The code was requested by another login, whose verifier this one does not have
+		_, state, err := OIDCAuthURL(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := OIDCCallback(context.Background(), state, issuer.authorize(t, authURL, claims)); err == nil || !strings.Contains(err.Error(), "exchange") {
+			t.Fatalf("err = %v, want a failed code exchange", err)
+		}
+	})
+
+	t.Run("nonce must match", func(t *testing.T) {
+		replayed := map[string]interface{}{"nonce": "from-another-login"}
+		for name, value := range claims {
+			replayed[name] = value
+		}
+		if _, err := issuer.login(t, replayed); err == nil || !strings.Contains(err.Error(), "nonce") {
+			t.Fatalf("err = %v, want a nonce mismatch", err)
+		}
+	})
+
+	t.Run("signature must be the issuer's", func(t *testing.T) {
+		key := issuer.key
+		forged, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		issuer.key = forged
+		defer func() { issuer.key = key }()
+		if _, err := issuer.login(t, claims); err == nil || !strings.Contains(err.Error(), "invalid ID token") {
+			t.Fatalf("err = %v, want an invalid ID token", err)
+		}
+	})
+
+	t.Run("second factor at the provider", func(t *testing.T) {
+		config.Get().OIDC.RequireMFA = true
+		defer func() { config.Get().OIDC.RequireMFA = false }()
+		if _, err := issuer.login(t, claims); !errors.Is(err, ErrProviderMFARequired) {
+			t.Fatalf("err = %v, want ErrProviderMFARequired", err)
+		}
+		withMFA := map[string]interface{}{"amr": []string{"pwd", "mfa"}}
+		for name, value := range claims {
+			withMFA[name] = value
+		}
+		if _, err := issuer.login(t, withMFA); err != nil {
+			t.Fatalf("login with mfa: %v", err)
+		}
+	})
+}
+
+func TestOIDCLoginWithoutMFAKeepsTheAccount(t *testing.T) {
+	issuer := useMockIssuer(t)
+	workspaceID, err := database.CreateWorkspace("oidc-mfa", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.Get().OIDC.WorkspaceRoles = append(config.Get().OIDC.WorkspaceRoles, config.OIDCRoleMapping{Group: "developers", Workspace: "oidc-mfa", Role: "operator"})
+	config.Get().RequireAdminTOTP = true
+
+	// A new administrator is not provisioned
+	if _, err := issuer.login(t, map[string]interface{}{"sub": "grace-1", "preferred_username": "grace", "groups": []string{"platform"}}); !errors.Is(err, ErrProviderMFARequired) {
+		t.Fatalf("err = %v, want ErrProviderMFARequired", err)
+	}
+	if _, err := database.GetUserByOIDCIdentity(issuer.server.URL, "grace-1"); !errors.Is(err, database.ErrNotFound) {
+		t.Errorf("lookup of the rejected user = %v, want ErrNotFound", err)
+	}
+
+	// An existing user is neither renamed, promoted nor given the roles of its new groups
+	user, err := issuer.login(t, map[string]interface{}{"sub": "heidi-1", "preferred_username": "heidi"})
+	if err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	claims := map[string]interface{}{"sub": "heidi-1", "preferred_username": "heidi-renamed", "groups": []string{"platform", "developers"}}
+	if _, err := issuer.login(t, claims); !errors.Is(err, ErrProviderMFARequired) {
+		t.Fatalf("err = %v, want ErrProviderMFARequired", err)
+	}
+	stored, err := database.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Username != "heidi" || stored.IsAdmin {
+		t.Errorf("user after the rejected login = %+v, want heidi without admin", stored)
+	}
+	if role, _ := database.GetWorkspaceRole(int(workspaceID), user.ID); role != "" {
+		t.Errorf("role after the rejected login = %q, want none", role)
+	}
+
+	// With the second factor the login goes through
+	claims["amr"] = []string{"mfa"}
+	if user, err = issuer.login(t, claims); err != nil {
+		t.Fatalf("login with mfa: %v", err)
+	}
+	if user.Username != "heidi-renamed" || !user.IsAdmin {
+		t.Errorf("user = %+v, want the admin heidi-renamed", user)
+	}
+}
@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/turplespace/portos/internal/config"
+	"github.com/turplespace/portos/internal/database"
+)
+
+func TestProvisionOIDCUserKeysOnSubject(t *testing.T) {
+	const issuer = "https://idp.example.com"
+	if _, err := database.CreateUser("carol", "hash", false); err != nil {
+		t.Fatal(err)
+	}
+
+	alice, err := provisionOIDCUser(issuer, "subject-alice", "alice", nil)
+	if err != nil || alice.Username != "alice" || alice.AuthSource != "oidc" {
+		t.Fatalf("first login = %+v, %v", alice, err)
+	}
+
+	// Another subject claiming the same username gets its own account
+	mallory, err := provisionOIDCUser(issuer, "subject-mallory", "alice", nil)
+	if err != nil || mallory.ID == alice.ID || mallory.Username != "alice-2" {
+		t.Fatalf("other subject = %+v, %v, want a new account alice-2", mallory, err)
+	}
+	// So does the same subject of another issuer
+	other, err := provisionOIDCUser("https://other.example.com", "subject-alice", "alice", nil)
+	if err != nil || other.ID == alice.ID || other.ID == mallory.ID {
+		t.Fatalf("other issuer = %+v, %v, want a new account", other, err)
+	}
+	// A local account is never taken over
+	carol, err := provisionOIDCUser(issuer, "subject-carol", "carol", nil)
+	if err != nil || carol.AuthSource != "oidc" || carol.Username != "carol-2" {
+		t.Fatalf("local username = %+v, %v, want a new account carol-2", carol, err)
+	}
+
+	// A rename at the provider follows the subject
+	renamed, err := provisionOIDCUser(issuer, "subject-alice", "alice.smith", nil)
+	if err != nil || renamed.ID != alice.ID || renamed.Username != "alice.smith" {
+		t.Fatalf("rename = %+v, %v, want account %d renamed", renamed, err, alice.ID)
+	}
+	// and frees the username for the subject that claims it
+	mallory, err = provisionOIDCUser(issuer, "subject-mallory", "alice", nil)
+	if err != nil || mallory.Username != "alice" {
+		t.Fatalf("freed username = %+v, %v", mallory, err)
+	}
+}
+
+func TestProvisionOIDCUserLinksLegacyAccounts(t *testing.T) {
+	const issuer = "https://idp.example.com"
+	id, err := database.CreateOIDCUser("dave", "", "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dave, err := provisionOIDCUser(issuer, "subject-dave", "dave", nil)
+	if err != nil || dave.ID != int(id) {
+		t.Fatalf("legacy login = %+v, %v, want account %d", dave, err, id)
+	}
+	// Once linked, the account is no longer found by its username
+	other, err := provisionOIDCUser(issuer, "subject-impostor", "dave", nil)
+	if err != nil || other.ID == int(id) {
+		t.Fatalf("impostor = %+v, %v, want a new account", other, err)
+	}
+}
+
+func TestProviderMFA(t *testing.T) {
+	oidc := &config.Get().OIDC
+	methods, contexts := oidc.MFAMethods, oidc.MFAContexts
+	oidc.MFAMethods, oidc.MFAContexts = []string{"mfa", "otp"}, []string{"urn:example:mfa"}
+	t.Cleanup(func() { oidc.MFAMethods, oidc.MFAContexts = methods, contexts })
+
+	for _, test := range []struct {
+		claims map[string]interface{}
+		want   bool
+	}{
+		{map[string]interface{}{}, false},
+		{map[string]interface{}{"amr": []interface{}{"pwd"}}, false},
+		{map[string]interface{}{"amr": []interface{}{"pwd", "otp"}}, true},
+		{map[string]interface{}{"amr": "mfa"}, true},
+		{map[string]interface{}{"acr": "urn:example:mfa"}, true},
+		{map[string]interface{}{"acr": "urn:example:password"}, false},
+	} {
+		if got := providerMFA(test.claims); got != test.want {
+			t.Errorf("providerMFA(%v) = %v, want %v", test.claims, got, test.want)
+		}
+	}
+}
+
+func TestFreeUsernameReportsErrors(t *testing.T) {
+	if _, err := database.CreateUser("ivan", "hash", false); err != nil {
+		t.Fatal(err)
+	}
+	if name, err := freeUsername("ivan", 0); err != nil || name != "ivan-2" {
+		t.Fatalf("freeUsername(ivan) = %q, %v, want ivan-2", name, err)
+	}
+
+	// A failing lookup is not a free username
+	path, err := database.GetPath()
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	if _, err := db.Exec(`ALTER TABLE user RENAME TO user_away`); err != nil {
+		t.Fatal(err)
+	}
+	defer db.Exec(`ALTER TABLE user_away RENAME TO user`)
+	if name, err := freeUsername("ivan", 0); err == nil {
+		t.Errorf("freeUsername(ivan) without the user table = %q, want an error", name)
+	}
+	if user, err := provisionOIDCUser("https://idp.example.com", "subject-ivan", "ivan", nil); err == nil {
+		t.Errorf("provisionOIDCUser without the user table = %+v, want an error", user)
+	}
+}
@@ -0,0 +1,36 @@
+package auth
+
+import (
+	"fmt"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// MinPasswordLength is the minimum number of characters accepted for a password
+const MinPasswordLength = 8
+
+// dummyHash is compared against when a username does not exist, so that a failed
+// login takes the same time whether or not the account exists
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("turplecubes-dummy-password"), bcrypt.DefaultCost)
+
+// HashPassword hashes a plaintext password with bcrypt
+func HashPassword(password string) (string, error) {
+	if len(password) < MinPasswordLength {
+		return "", fmt.Errorf("password must be at least %d characters long", MinPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %v", err)
+	}
+	return string(hash), nil
+}
+
+// CheckPassword reports whether the plaintext password matches the bcrypt hash.
+// An empty hash never matches but still costs a bcrypt comparison.
+func CheckPassword(hash string, password string) bool {
+	if hash == "" {
+		bcrypt.CompareHashAndPassword(dummyHash, []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
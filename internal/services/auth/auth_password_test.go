@@ -0,0 +1,32 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHashPassword(t *testing.T) {
+	if _, err := HashPassword(strings.Repeat("x", MinPasswordLength-1)); err == nil {
+		t.Error("hashed a password shorter than the minimum")
+	}
+
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash == "correct horse" || !strings.HasPrefix(hash, "$2a$") {
+		t.Errorf("hash = %q, want a bcrypt hash", hash)
+	}
+	if again, _ := HashPassword("correct horse"); again == hash {
+		t.Error("two hashes of the same password are equal, want them salted")
+	}
+
+	for password, want := range map[string]bool{"correct horse": true, "correct horse ": false, "Correct horse": false, "": false} {
+		if got := CheckPassword(hash, password); got != want {
+			t.Errorf("CheckPassword(%q) = %v, want %v", password, got, want)
+		}
+	}
+	if CheckPassword("", "") {
+		t.Error("an empty hash matched")
+	}
+}
@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"github.com/turplespace/portos/internal/database"
+)
+
+// Role is the role of a user inside a workspace
+type Role string
+
+const (
+	RoleOwner    Role = "owner"
+	RoleOperator Role = "operator"
+	RoleViewer   Role = "viewer"
+)
+
+// Action is an operation guarded by workspace roles
+type Action string
+
+const (
+	ActionView           Action = "view"            // Read workspace, cube and proxy data
+	ActionLogs           Action = "logs"            // Read the logs of the cubes
+	ActionDeploy         Action = "deploy"          // Deploy, redeploy and stop cubes and proxies
+	ActionExec           Action = "exec"            // Run commands inside cubes
+	ActionCommit         Action = "commit"          // Commit cubes into images
+	ActionCubeWrite      Action = "cube:write"      // Add, edit and delete cubes
+	ActionProxyWrite     Action = "proxy:write"     // Add, edit and delete proxies
+	ActionWorkspaceWrite Action = "workspace:write" // Edit and delete the workspace and manage its members
+)
+
+// roleActions lists the actions granted by each role
+var roleActions = map[Role][]Action{
+	RoleViewer:   {ActionView, ActionLogs},
+	RoleOperator: {ActionView, ActionLogs, ActionDeploy, ActionExec, ActionCommit},
+	RoleOwner:    {ActionView, ActionLogs, ActionDeploy, ActionExec, ActionCommit, ActionCubeWrite, ActionProxyWrite, ActionWorkspaceWrite},
+}
+
+// roleRank orders the roles from the least to the most privileged
+var roleRank = map[Role]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleOwner:    3,
+}
+
+// ValidRole reports whether the role is one of the known workspace roles
+func ValidRole(role string) bool {
+	_, ok := roleActions[Role(role)]
+	return ok
+}
+
+// RoleAllows reports whether the role grants the action
+func RoleAllows(role Role, action Action) bool {
+	for _, allowed := range roleActions[role] {
+		if allowed == action {
+			return true
+		}
+	}
+	return false
+}
+
+// Can reports whether the user may perform the action in the workspace.
+// Admins may do everything, other users need a membership whose role grants the action.
+func Can(user *database.User, workspaceID int, action Action) (bool, error) {
+	if user == nil {
+		return false, nil
+	}
+	if user.IsAdmin {
+		return true, nil
+	}
+
+	role, err := database.GetWorkspaceRole(workspaceID, user.ID)
+	if err != nil {
+		return false, err
+	}
+	return RoleAllows(Role(role), action), nil
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/turplespace/portos/internal/database"
+)
+
+func TestRoleAllows(t *testing.T) {
+	allowed := map[Role][]Action{
+		RoleViewer:   {ActionView, ActionLogs},
+		RoleOperator: {ActionView, ActionLogs, ActionDeploy, ActionExec, ActionCommit},
+		RoleOwner:    {ActionView, ActionLogs, ActionDeploy, ActionExec, ActionCommit, ActionCubeWrite, ActionProxyWrite, ActionWorkspaceWrite},
+	}
+	actions := allowed[RoleOwner]
+	for _, role := range []Role{RoleViewer, RoleOperator, RoleOwner, "admin", ""} {
+		for _, action := range actions {
+			want := false
+			for _, a := range allowed[role] {
+				want = want || a == action
+			}
+			if got := RoleAllows(role, action); got != want {
+				t.Errorf("RoleAllows(%q, %q) = %v, want %v", role, action, got, want)
+			}
+		}
+	}
+
+	for role, want := range map[string]bool{"owner": true, "operator": true, "viewer": true, "admin": false, "Owner": false, "": false} {
+		if got := ValidRole(role); got != want {
+			t.Errorf("ValidRole(%q) = %v, want %v", role, got, want)
+		}
+	}
+}
+
+func TestCan(t *testing.T) {
+	workspaceID, err := database.CreateWorkspace("rbac", "created by "+t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := func(name string, isAdmin bool) *database.User {
+		id, err := database.CreateUser(name, "hash", isAdmin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &database.User{ID: int(id), Username: name, IsAdmin: isAdmin}
+	}
+	admin, operator, stranger := user("rbac-admin", true), user("rbac-operator", false), user("rbac-stranger", false)
+	if err := database.SetWorkspaceMember(int(workspaceID), operator.ID, string(RoleOperator)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		user   *database.User
+		action Action
+		want   bool
+	}{
+		{admin, ActionWorkspaceWrite, true},
+		{operator, ActionDeploy, true},
+		{operator, ActionCubeWrite, false},
+		{stranger, ActionView, false},
+		{nil, ActionView, false},
+	} {
+		name := "nobody"
+		if test.user != nil {
+			name = test.user.Username
+		}
+		if got, err := Can(test.user, int(workspaceID), test.action); err != nil || got != test.want {
+			t.Errorf("Can(%s, %s) = %v, %v, want %v", name, test.action, got, err, test.want)
+		}
+	}
+
+	// A membership only covers its own workspace
+	otherID, err := database.CreateWorkspace("rbac-other", "created by "+t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := Can(operator, int(otherID), ActionView); err != nil || got {
+		t.Errorf("Can(rbac-operator, view) in another workspace = %v, %v, want false", got, err)
+	}
+}
@@ -0,0 +1,89 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/turplespace/portos/internal/config"
+	"github.com/turplespace/portos/internal/database"
+)
+
+// SessionCookieName is the name of the cookie carrying the session token
+const SessionCookieName = "turplecubes_session"
+
+// ErrInvalidCredentials is returned by Login when the username or the password is wrong
+var ErrInvalidCredentials = errors.New("invalid username or password")
+
+/*
+Login checks the credentials, and the TOTP or recovery code when the account has two-factor
+authentication enabled, then opens a new session.
+It returns the user and the plaintext session token to hand to the client.
+*/
+func Login(username string, password string, code string, recoveryCode string) (*database.User, string, time.Time, error) {
+	user, err := database.GetUserByUsername(username)
+	if err != nil {
+		CheckPassword("", password)
+		return nil, "", time.Time{}, ErrInvalidCredentials
+	}
+	if !CheckPassword(user.PasswordHash, password) {
+		return nil, "", time.Time{}, ErrInvalidCredentials
+	}
+	if user.TOTPEnabled {
+		if err := VerifySecondFactor(user, code, recoveryCode); err != nil {
+			return nil, "", time.Time{}, err
+		}
+	}
+
+	token, expiresAt, err := NewSession(user.ID)
+	if err != nil {
+		return nil, "", time.Time{}, err
+	}
+	return user, token, expiresAt, nil
+}
+
+// NewSession creates a session for the user and returns its plaintext token
+func NewSession(userID int) (string, time.Time, error) {
+	token, err := RandomToken(32)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	expiresAt := time.Now().Add(config.Get().SessionTTL)
+	if err := database.CreateSession(userID, HashToken(token), expiresAt); err != nil {
+		return "", time.Time{}, err
+	}
+	return token, expiresAt, nil
+}
+
+// UserFromSession resolves a plaintext session token to its user
+func UserFromSession(token string) (*database.User, error) {
+	if token == "" {
+		return nil, fmt.Errorf("missing session token")
+	}
+	return database.GetSessionUser(HashToken(token))
+}
+
+// Logout deletes the session of the given plaintext token
+func Logout(token string) error {
+	return database.DeleteSession(HashToken(token))
+}
+
+// HashToken returns the hex encoded SHA-256 of a token, which is what gets stored
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// RandomToken returns a URL safe random string built from n random bytes
+func RandomToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate random token: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
@@ -0,0 +1,84 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/turplespace/portos/internal/config"
+	"github.com/turplespace/portos/internal/database"
+)
+
+func TestLogin(t *testing.T) {
+	hash, err := HashPassword("session-password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := database.CreateUser("session-user", hash, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct{ username, password string }{
+		{"session-user", "wrong-password"},
+		{"session-missing", "session-password"},
+	} {
+		if _, _, _, err := Login(test.username, test.password, "", ""); !errors.Is(err, ErrInvalidCredentials) {
+			t.Errorf("login as %s with %s = %v, want ErrInvalidCredentials", test.username, test.password, err)
+		}
+	}
+
+	user, token, expiresAt, err := Login("session-user", "session-password", "", "")
+	if err != nil || user.ID != int(id) {
+		t.Fatalf("login = %+v, %v", user, err)
+	}
+	if ttl := time.Until(expiresAt); ttl <= 0 || ttl > config.Get().SessionTTL {
+		t.Errorf("session expires in %v, want within %v", ttl, config.Get().SessionTTL)
+	}
+
+	// Sessions are stored by the hash of their token
+	if _, err := UserFromSession(HashToken(token)); err == nil {
+		t.Error("the hash of the token opened the session")
+	}
+	if current, err := UserFromSession(token); err != nil || current.ID != int(id) {
+		t.Errorf("session user = %+v, %v", current, err)
+	}
+	if err := Logout(token); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := UserFromSession(token); err == nil {
+		t.Error("the session still opens after a logout")
+	}
+	if _, err := UserFromSession(""); err == nil {
+		t.Error("an empty token opened a session")
+	}
+}
+
+func TestExpiredSession(t *testing.T) {
+	id, err := database.CreateUser("session-expired", "hash", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ttl := config.Get().SessionTTL
+	config.Get().SessionTTL = -time.Minute
+	t.Cleanup(func() { config.Get().SessionTTL = ttl })
+
+	token, _, err := NewSession(int(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := UserFromSession(token); err == nil {
+		t.Error("an expired session opened")
+	}
+}
+
+func TestRandomToken(t *testing.T) {
+	first, err := RandomToken(32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := RandomToken(32)
+	if len(first) != 43 || first == second {
+		t.Errorf("tokens = %q and %q, want two different 43 character tokens", first, second)
+	}
+}
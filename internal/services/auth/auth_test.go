@@ -0,0 +1,23 @@
+package auth
+
+import (
+	"log"
+	"os"
+	"testing"
+
+	"github.com/turplespace/portos/internal/database"
+)
+
+// TestMain runs the tests against a fresh database next to the test binary
+func TestMain(m *testing.M) {
+	path, err := database.GetPath()
+	if err != nil {
+		log.Fatal(err)
+	}
+	os.Remove(path)
+	database.Init()
+
+	code := m.Run()
+	os.Remove(path)
+	os.Exit(code)
+}
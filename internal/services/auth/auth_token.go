@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/turplespace/portos/internal/database"
+)
+
+const (
+	TokenKindPersonal = "personal" // Acts as its owner, narrowed down by its scopes and workspaces
+	TokenKindService  = "service"  // Not bound to a person, only has its scopes on its workspaces
+
+	// ScopeAdmin lets a personal token of an admin use the admin only routes
+	ScopeAdmin = "admin"
+
+	tokenPrefix = "tct_"
+)
+
+// ValidScope reports whether the scope is an action or the admin scope
+func ValidScope(scope string) bool {
+	if scope == ScopeAdmin {
+		return true
+	}
+	for _, actions := range roleActions {
+		for _, action := range actions {
+			if string(action) == scope {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CreateToken generates a new API token and stores its hash. The plaintext token is only returned here.
+func CreateToken(token database.APIToken) (string, int64, error) {
+	if token.Kind != TokenKindPersonal && token.Kind != TokenKindService {
+		return "", 0, fmt.Errorf("invalid token kind %q", token.Kind)
+	}
+	if token.Kind == TokenKindService && len(token.WorkspaceIDs) == 0 {
+		return "", 0, fmt.Errorf("service tokens must be scoped to at least one workspace")
+	}
+	if len(token.Scopes) == 0 {
+		return "", 0, fmt.Errorf("at least one scope is required")
+	}
+	for _, scope := range token.Scopes {
+		if !ValidScope(scope) {
+			return "", 0, fmt.Errorf("invalid scope %q", scope)
+		}
+		if scope == ScopeAdmin && token.Kind == TokenKindService {
+			return "", 0, fmt.Errorf("service tokens cannot have the admin scope")
+		}
+	}
+
+	secret, err := RandomToken(32)
+	if err != nil {
+		return "", 0, err
+	}
+	plaintext := tokenPrefix + secret
+	token.TokenHash = HashToken(plaintext)
+	token.Prefix = plaintext[:len(tokenPrefix)+6]
+
+	id, err := database.CreateAPIToken(token)
+	if err != nil {
+		return "", 0, err
+	}
+	return plaintext, id, nil
+}
+
+/*
+UserFromToken resolves a bearer token. Personal tokens return their owner, service tokens
+return a nil user. Revoked and expired tokens are rejected, the last use is recorded.
+*/
+func UserFromToken(plaintext string) (*database.User, *database.APIToken, error) {
+	if !strings.HasPrefix(plaintext, tokenPrefix) {
+		return nil, nil, fmt.Errorf("malformed api token")
+	}
+
+	token, err := database.GetAPITokenByHash(HashToken(plaintext))
+	if err != nil {
+		return nil, nil, err
+	}
+	if token.RevokedAt != nil {
+		return nil, nil, fmt.Errorf("api token %d is revoked", token.ID)
+	}
+	if token.ExpiresAt != nil && time.Now().After(*token.ExpiresAt) {
+		return nil, nil, fmt.Errorf("api token %d is expired", token.ID)
+	}
+
+	var user *database.User
+	if token.Kind == TokenKindPersonal {
+		user, err = database.GetUserByID(token.UserID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("owner of api token %d: %v", token.ID, err)
+		}
+	}
+
+	if err := database.TouchAPIToken(token.ID); err != nil {
+		log.Printf("[*] Warning: %v", err)
+	}
+	return user, token, nil
+}
+
+// TokenAllows reports whether the scopes and workspaces of a token cover the action in the workspace
+func TokenAllows(token *database.APIToken, workspaceID int, action Action) bool {
+	if !TokenHasScope(token, string(action)) {
+		return false
+	}
+	if len(token.WorkspaceIDs) == 0 {
+		return true
+	}
+	for _, id := range token.WorkspaceIDs {
+		if id == workspaceID {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenHasScope reports whether the token carries the scope
+func TokenHasScope(token *database.APIToken, scope string) bool {
+	for _, s := range token.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
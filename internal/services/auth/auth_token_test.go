@@ -0,0 +1,100 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/turplespace/portos/internal/database"
+)
+
+func TestCreateTokenChecks(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		token database.APIToken
+		want  string
+	}{
+		{"unknown kind", database.APIToken{Kind: "robot", Scopes: []string{"view"}}, "invalid token kind"},
+		{"service token without workspaces", database.APIToken{Kind: TokenKindService, Scopes: []string{"view"}}, "at least one workspace"},
+		{"no scope", database.APIToken{Kind: TokenKindPersonal}, "at least one scope"},
+		{"unknown scope", database.APIToken{Kind: TokenKindPersonal, Scopes: []string{"view", "root"}}, `invalid scope "root"`},
+		{"admin service token", database.APIToken{Kind: TokenKindService, Scopes: []string{ScopeAdmin}, WorkspaceIDs: []int{1}}, "cannot have the admin scope"},
+	} {
+		if _, _, err := CreateToken(test.token); err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: CreateToken = %v, want %q", test.name, err, test.want)
+		}
+	}
+
+	for scope, want := range map[string]bool{"admin": true, "view": true, "cube:write": true, "workspace:write": true, "cube:read": false, "": false} {
+		if got := ValidScope(scope); got != want {
+			t.Errorf("ValidScope(%q) = %v, want %v", scope, got, want)
+		}
+	}
+}
+
+func TestUserFromToken(t *testing.T) {
+	userID, err := database.CreateUser("token-owner", "hash", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	personal, id, err := CreateToken(database.APIToken{UserID: int(userID), Name: "personal", Kind: TokenKindPersonal, Scopes: []string{"view"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(personal, tokenPrefix) {
+		t.Errorf("token = %q, want the %s prefix", personal, tokenPrefix)
+	}
+	user, token, err := UserFromToken(personal)
+	if err != nil || user == nil || user.ID != int(userID) || token.ID != int(id) {
+		t.Fatalf("personal token = %+v, %+v, %v, want its owner", user, token, err)
+	}
+	if stored, err := database.GetAPITokenByID(int(id)); err != nil || stored.LastUsedAt == nil || stored.TokenHash == personal {
+		t.Errorf("stored token = %+v, %v, want its hash and last use", stored, err)
+	}
+
+	service, _, err := CreateToken(database.APIToken{UserID: int(userID), Name: "service", Kind: TokenKindService, Scopes: []string{"deploy"}, WorkspaceIDs: []int{1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user, token, err := UserFromToken(service); err != nil || user != nil || token.Kind != TokenKindService {
+		t.Errorf("service token = %+v, %+v, %v, want no user", user, token, err)
+	}
+
+	expiresAt := time.Now().Add(-time.Minute)
+	expired, _, err := CreateToken(database.APIToken{UserID: int(userID), Name: "expired", Kind: TokenKindPersonal, Scopes: []string{"view"}, ExpiresAt: &expiresAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.RevokeAPIToken(int(id)); err != nil {
+		t.Fatal(err)
+	}
+	for name, plaintext := range map[string]string{"revoked": personal, "expired": expired, "malformed": strings.TrimPrefix(service, tokenPrefix), "unknown": tokenPrefix + "unknown"} {
+		if _, _, err := UserFromToken(plaintext); err == nil {
+			t.Errorf("%s token was accepted", name)
+		}
+	}
+}
+
+func TestTokenAllows(t *testing.T) {
+	everywhere := &database.APIToken{Scopes: []string{"view", "deploy"}}
+	limited := &database.APIToken{Scopes: []string{"view"}, WorkspaceIDs: []int{2, 3}}
+	for _, test := range []struct {
+		token       *database.APIToken
+		workspaceID int
+		action      Action
+		want        bool
+	}{
+		{everywhere, 1, ActionDeploy, true},
+		{everywhere, 1, ActionExec, false},
+		{limited, 3, ActionView, true},
+		{limited, 1, ActionView, false},
+		{limited, 2, ActionDeploy, false},
+	} {
+		if got := TokenAllows(test.token, test.workspaceID, test.action); got != test.want {
+			t.Errorf("TokenAllows(%v in %v, %d, %s) = %v, want %v", test.token.Scopes, test.token.WorkspaceIDs, test.workspaceID, test.action, got, test.want)
+		}
+	}
+	if TokenHasScope(everywhere, ScopeAdmin) {
+		t.Error("a token without the admin scope has it")
+	}
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key of the test vectors of RFC 6238, appendix B
+var rfc6238Secret = totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestValidateTOTPVectors(t *testing.T) {
+	// The last six digits of the eight digit codes of the RFC
+	for unix, code := range map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	} {
+		step, ok := ValidateTOTP(rfc6238Secret, code, time.Unix(unix, 0))
+		if !ok || step != unix/totpPeriod {
+			t.Errorf("ValidateTOTP(%s) at %d = %d, %v, want step %d", code, unix, step, ok, unix/totpPeriod)
+		}
+	}
+}
+
+func TestValidateTOTPWindow(t *testing.T) {
+	key := []byte("12345678901234567890")
+	at := time.Unix(1234567890, 0)
+	current := at.Unix() / totpPeriod
+
+	// One period of clock drift either way is accepted, not two
+	for offset, want := range map[int64]bool{-2: false, -1: true, 0: true, 1: true, 2: false} {
+		step, ok := ValidateTOTP(rfc6238Secret, totpCode(key, current+offset), at)
+		if ok != want || (ok && step != current+offset) {
+			t.Errorf("code of step %+d = %d, %v, want %v", offset, step, ok, want)
+		}
+	}
+
+	for name, test := range map[string]struct{ secret, code string }{
+		"short code":       {rfc6238Secret, "05924"},
+		"long code":        {rfc6238Secret, "0005924"},
+		"wrong code":       {rfc6238Secret, "005925"},
+		"invalid secret":   {"not base32!", "005924"},
+		"different secret": {totpEncoding.EncodeToString([]byte("09876543210987654321")), "005924"},
+	} {
+		if _, ok := ValidateTOTP(test.secret, test.code, at); ok {
+			t.Errorf("%s was accepted", name)
+		}
+	}
+
+	// Secrets are typed by hand from the provisioning page
+	if _, ok := ValidateTOTP(" "+strings.ToLower(rfc6238Secret)+" ", "005924", at); !ok {
+		t.Error("a lower case secret with spaces was rejected")
+	}
+}
+
+func TestTOTPProvisioningURI(t *testing.T) {
+	uri, err := url.Parse(TOTPProvisioningURI("jane doe", rfc6238Secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := uri.Query()
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/"+totpIssuer+":jane doe" ||
+		query.Get("secret") != rfc6238Secret || query.Get("issuer") != totpIssuer || query.Get("digits") != "6" || query.Get("period") != "30" {
+		t.Errorf("provisioning URI = %s", uri)
+	}
+
+	secret, err := NewTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, err := totpEncoding.DecodeString(secret); err != nil || len(key) != 20 {
+		t.Errorf("secret %s decodes to %d bytes, %v, want 20", secret, len(key), err)
+	}
+}
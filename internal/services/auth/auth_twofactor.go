@@ -0,0 +1,154 @@
+package auth
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/turplespace/portos/internal/config"
+	"github.com/turplespace/portos/internal/database"
+)
+
+const (
+	// recoveryCodeCount is the number of one-time recovery codes handed out at enrollment
+	recoveryCodeCount = 10
+	// maxSecondFactorFailures is the number of wrong codes in a row that locks the second factor of a user
+	maxSecondFactorFailures = 5
+	// secondFactorLockout is how long the second factor stays locked, no code is accepted meanwhile
+	secondFactorLockout = 15 * time.Minute
+)
+
+var (
+	// ErrSecondFactorRequired is returned by Login when the account has TOTP enabled and no code was sent
+	ErrSecondFactorRequired = errors.New("two-factor code required")
+	// ErrInvalidSecondFactor is returned when a TOTP or recovery code is wrong or already used
+	ErrInvalidSecondFactor = errors.New("invalid two-factor code")
+	// ErrSecondFactorLocked is returned instead of checking a code after too many wrong ones
+	ErrSecondFactorLocked = errors.New("too many invalid two-factor codes, try again later")
+)
+
+// EnrollmentRequired reports whether the user must enroll TOTP before using the API.
+// Single sign-on accounts are exempt, OIDCCallback makes their provider check the second factor instead.
+func EnrollmentRequired(user *database.User) bool {
+	return config.Get().RequireAdminTOTP && user.IsAdmin && user.AuthSource == "local" && !user.TOTPEnabled
+}
+
+// VerifySecondFactor checks a TOTP code, or a recovery code when no TOTP code is given.
+// Both are single use, and both count towards the lockout of the user.
+func VerifySecondFactor(user *database.User, code string, recoveryCode string) error {
+	code = strings.TrimSpace(code)
+	recoveryCode = normalizeRecoveryCode(recoveryCode)
+	if code == "" && recoveryCode == "" {
+		return ErrSecondFactorRequired
+	}
+
+	return throttleSecondFactor(user.ID, func() (bool, error) {
+		if code != "" {
+			step, ok := ValidateTOTP(user.TOTPSecret, code, time.Now())
+			if !ok {
+				return false, nil
+			}
+			return database.ClaimTOTPStep(user.ID, step)
+		}
+		return database.UseRecoveryCode(user.ID, HashToken(recoveryCode))
+	})
+}
+
+/*
+throttleSecondFactor runs the check of a code of a user unless its second factor is locked. A six
+digit code is otherwise guessed in a few hundred thousand tries, so after maxSecondFactorFailures
+wrong codes in a row no code is checked for secondFactorLockout.
+*/
+func throttleSecondFactor(userID int, check func() (bool, error)) error {
+	allowed, err := database.ClaimSecondFactorAttempt(userID, maxSecondFactorFailures, time.Now())
+	if err != nil {
+		return err
+	}
+	if !allowed {
+		return ErrSecondFactorLocked
+	}
+
+	ok, err := check()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if err := database.LockSecondFactor(userID, maxSecondFactorFailures, time.Now().Add(secondFactorLockout)); err != nil {
+			return err
+		}
+		return ErrInvalidSecondFactor
+	}
+	return database.ResetSecondFactorFailures(userID)
+}
+
+// StartTOTPEnrollment stores a new pending secret for the user and returns it with its provisioning URI
+func StartTOTPEnrollment(user *database.User) (string, string, error) {
+	if user.TOTPEnabled {
+		return "", "", fmt.Errorf("two-factor authentication is already enabled")
+	}
+	secret, err := NewTOTPSecret()
+	if err != nil {
+		return "", "", err
+	}
+	if err := database.SetUserTOTP(user.ID, secret, false); err != nil {
+		return "", "", err
+	}
+	return secret, TOTPProvisioningURI(user.Username, secret), nil
+}
+
+// ConfirmTOTPEnrollment enables TOTP once the user proves the pending secret works, and returns fresh recovery codes
+func ConfirmTOTPEnrollment(user *database.User, code string) ([]string, error) {
+	if user.TOTPEnabled {
+		return nil, fmt.Errorf("two-factor authentication is already enabled")
+	}
+	if user.TOTPSecret == "" {
+		return nil, fmt.Errorf("two-factor enrollment was not started")
+	}
+	err := throttleSecondFactor(user.ID, func() (bool, error) {
+		_, ok := ValidateTOTP(user.TOTPSecret, strings.TrimSpace(code), time.Now())
+		return ok, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := database.SetUserTOTP(user.ID, user.TOTPSecret, true); err != nil {
+		return nil, err
+	}
+	return RegenerateRecoveryCodes(user.ID)
+}
+
+// DisableTOTP turns TOTP off for the user and deletes its recovery codes
+func DisableTOTP(user *database.User) error {
+	if err := database.SetUserTOTP(user.ID, "", false); err != nil {
+		return err
+	}
+	return database.ReplaceRecoveryCodes(user.ID, nil)
+}
+
+// RegenerateRecoveryCodes replaces the recovery codes of a user and returns the plaintext codes
+func RegenerateRecoveryCodes(userID int) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		buf := make([]byte, 10)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, fmt.Errorf("failed to generate recovery code: %v", err)
+		}
+		code := strings.ToLower(totpEncoding.EncodeToString(buf))
+		codes[i] = code[:8] + "-" + code[8:]
+		hashes[i] = HashToken(normalizeRecoveryCode(codes[i]))
+	}
+
+	if err := database.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// normalizeRecoveryCode ignores case, spaces and dashes so codes can be typed loosely
+func normalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
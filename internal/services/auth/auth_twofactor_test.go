@@ -0,0 +1,191 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/turplespace/portos/internal/database"
+)
+
+// newTOTPUser creates a local user with TOTP enabled and returns it with its recovery codes
+func newTOTPUser(t *testing.T, username string) (*database.User, []string) {
+	t.Helper()
+	id, err := database.CreateUser(username, "hash", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret, err := NewTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := database.SetUserTOTP(int(id), secret, true); err != nil {
+		t.Fatal(err)
+	}
+	codes, err := RegenerateRecoveryCodes(int(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	user, err := database.GetUserByID(int(id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user, codes
+}
+
+// currentTOTP returns the code of a secret for the time step at offset from the current one
+func currentTOTP(t *testing.T, secret string, offset int64) string {
+	t.Helper()
+	key, err := totpEncoding.DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return totpCode(key, time.Now().Unix()/totpPeriod+offset)
+}
+
+func TestTOTPStepReuse(t *testing.T) {
+	user, _ := newTOTPUser(t, "step-reuse")
+	if err := VerifySecondFactor(user, "", ""); !errors.Is(err, ErrSecondFactorRequired) {
+		t.Fatalf("no code: err = %v, want ErrSecondFactorRequired", err)
+	}
+
+	code := currentTOTP(t, user.TOTPSecret, 0)
+	if err := VerifySecondFactor(user, " "+code+" ", ""); err != nil {
+		t.Fatalf("valid code: %v", err)
+	}
+	// A code is single use, and so are the codes of the steps before the one used
+	if err := VerifySecondFactor(user, code, ""); !errors.Is(err, ErrInvalidSecondFactor) {
+		t.Errorf("reused code: err = %v, want ErrInvalidSecondFactor", err)
+	}
+	if err := VerifySecondFactor(user, currentTOTP(t, user.TOTPSecret, -1), ""); !errors.Is(err, ErrInvalidSecondFactor) {
+		t.Errorf("code of the previous step: err = %v, want ErrInvalidSecondFactor", err)
+	}
+	if err := VerifySecondFactor(user, currentTOTP(t, user.TOTPSecret, 1), ""); err != nil {
+		t.Errorf("code of the next step: %v", err)
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	user, codes := newTOTPUser(t, "recovery")
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("%d recovery codes, want %d", len(codes), recoveryCodeCount)
+	}
+
+	// Codes are typed loosely, but only once
+	if err := VerifySecondFactor(user, "", strings.ToUpper(strings.ReplaceAll(codes[0], "-", " "))); err != nil {
+		t.Fatalf("recovery code: %v", err)
+	}
+	if err := VerifySecondFactor(user, "", codes[0]); !errors.Is(err, ErrInvalidSecondFactor) {
+		t.Errorf("reused recovery code: err = %v, want ErrInvalidSecondFactor", err)
+	}
+
+	// New codes replace the old ones
+	fresh, err := RegenerateRecoveryCodes(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifySecondFactor(user, "", codes[1]); !errors.Is(err, ErrInvalidSecondFactor) {
+		t.Errorf("replaced recovery code: err = %v, want ErrInvalidSecondFactor", err)
+	}
+	if err := VerifySecondFactor(user, "", fresh[1]); err != nil {
+		t.Errorf("new recovery code: %v", err)
+	}
+}
+
+func TestTOTPEnrollment(t *testing.T) {
+	id, err := database.CreateUser("enrollment", "hash", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &database.User{ID: int(id), Username: "enrollment"}
+
+	secret, uri, err := StartTOTPEnrollment(user)
+	if err != nil || !strings.Contains(uri, "secret="+secret) {
+		t.Fatalf("start = %s, %s, %v", secret, uri, err)
+	}
+	user.TOTPSecret = secret
+	if _, err := ConfirmTOTPEnrollment(user, "000000"); !errors.Is(err, ErrInvalidSecondFactor) {
+		t.Errorf("confirm with a wrong code: err = %v, want ErrInvalidSecondFactor", err)
+	}
+	codes, err := ConfirmTOTPEnrollment(user, currentTOTP(t, secret, 0))
+	if err != nil || len(codes) != recoveryCodeCount {
+		t.Fatalf("confirm = %v, %v", codes, err)
+	}
+	if stored, err := database.GetUserByID(user.ID); err != nil || !stored.TOTPEnabled || stored.TOTPSecret != secret {
+		t.Errorf("user after the enrollment = %+v, %v", stored, err)
+	}
+
+	user.TOTPEnabled = true
+	if _, _, err := StartTOTPEnrollment(user); err == nil {
+		t.Error("started an enrollment with TOTP enabled")
+	}
+	if err := DisableTOTP(user); err != nil {
+		t.Fatal(err)
+	}
+	if stored, err := database.GetUserByID(user.ID); err != nil || stored.TOTPEnabled || stored.TOTPSecret != "" {
+		t.Errorf("user after disabling TOTP = %+v, %v", stored, err)
+	}
+}
+
+func TestSecondFactorLockout(t *testing.T) {
+	user, recoveryCodes := newTOTPUser(t, "lockout")
+	wrong := func() {
+		t.Helper()
+		if err := VerifySecondFactor(user, "000000", ""); !errors.Is(err, ErrInvalidSecondFactor) {
+			t.Fatalf("wrong code: err = %v, want ErrInvalidSecondFactor", err)
+		}
+	}
+
+	// A valid code starts the count again
+	for i := 1; i < maxSecondFactorFailures; i++ {
+		wrong()
+	}
+	if err := VerifySecondFactor(user, currentTOTP(t, user.TOTPSecret, -1), ""); err != nil {
+		t.Fatalf("valid code after %d failures: %v", maxSecondFactorFailures-1, err)
+	}
+
+	for i := 0; i < maxSecondFactorFailures; i++ {
+		wrong()
+	}
+	if err := VerifySecondFactor(user, currentTOTP(t, user.TOTPSecret, 0), ""); !errors.Is(err, ErrSecondFactorLocked) {
+		t.Fatalf("valid code while locked: err = %v, want ErrSecondFactorLocked", err)
+	}
+	if err := VerifySecondFactor(user, "", recoveryCodes[0]); !errors.Is(err, ErrSecondFactorLocked) {
+		t.Fatalf("recovery code while locked: err = %v, want ErrSecondFactorLocked", err)
+	}
+	if _, _, _, err := Login(user.Username, "ignored", "000000", ""); !errors.Is(err, ErrInvalidCredentials) {
+		t.Fatalf("login with a wrong password: err = %v, want ErrInvalidCredentials before the second factor", err)
+	}
+
+	// Once the lock ends codes are checked again, the refused ones were not used up
+	if err := database.LockSecondFactor(user.ID, 0, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifySecondFactor(user, "", recoveryCodes[0]); err != nil {
+		t.Fatalf("recovery code after the lock: %v", err)
+	}
+}
+
+func TestSecondFactorLockoutCountsRecoveryCodes(t *testing.T) {
+	user, recoveryCodes := newTOTPUser(t, "lockout-recovery")
+	for i := 0; i < maxSecondFactorFailures; i++ {
+		if err := VerifySecondFactor(user, "", "aaaaaaaa-aaaaaaaa"); !errors.Is(err, ErrInvalidSecondFactor) {
+			t.Fatalf("wrong recovery code: err = %v, want ErrInvalidSecondFactor", err)
+		}
+	}
+	if err := VerifySecondFactor(user, "", recoveryCodes[0]); !errors.Is(err, ErrSecondFactorLocked) {
+		t.Fatalf("recovery code while locked: err = %v, want ErrSecondFactorLocked", err)
+	}
+
+	// An admin reset lifts the lock
+	if err := DisableTOTP(user); err != nil {
+		t.Fatal(err)
+	}
+	if err := database.SetUserTOTP(user.ID, user.TOTPSecret, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifySecondFactor(user, currentTOTP(t, user.TOTPSecret, 0), ""); err != nil {
+		t.Fatalf("valid code after a reset: %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package deploy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/internal/services/docker"
+	"github.com/turplespace/portos/internal/services/proxy"
+	"github.com/turplespace/portos/internal/services/quota"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+// Deploy strategies of a cube
+const (
+	StrategyRecreate  = "recreate"   // Stop the container, then start the new one
+	StrategyBlueGreen = "blue-green" // Start the new container next to the old one, then switch the proxies
+)
+
+// Timings of blue/green deploys
+var (
+	BlueGreenSettle  = 3 * time.Second // How long a new container without a health check must keep running
+	BlueGreenTimeout = 2 * time.Minute // How long a new container may take to be ready
+	BlueGreenDrain   = 5 * time.Second // How long the old container finishes the requests in flight after the switch
+)
+
+// ErrBlueGreenUnsupported is wrapped by the errors of cubes that cannot run twice side by side
+var ErrBlueGreenUnsupported = errors.New("cube cannot be deployed blue/green")
+
+/*
+DeployBlueGreen replaces the running container of a cube without dropping the traffic of its
+proxies. The new container starts under a temporary name and, once ready, every proxy of the
+cube is pointed at it with a single Nginx reload. After a drain period the old container is
+retired and the new one takes its name. A failure before the old container is retired rolls
+back to it, the new container is removed. A cube without proxies or a running container is
+deployed by recreating it, cubes publishing host ports are rejected as both containers need them,
+and so are cubes with replicas.
+*/
+func DeployBlueGreen(workspaceID int, cube models.Container) error {
+	defer lockCube(cube.ID)()
+	proxies, err := database.GetProxiesByCubeID(cube.ID)
+	if err != nil {
+		return err
+	}
+	if status, err := docker.GetContainerStatus(cube.Name); len(proxies) == 0 || err != nil || status != "running" {
+		return deployReplicas(workspaceID, cube, false)
+	}
+	if cube.ReplicaCount() > 1 {
+		return fmt.Errorf("%w: %s runs replicas", ErrBlueGreenUnsupported, cube.Name)
+	}
+	for _, port := range cube.Ports {
+		if publishesHostPort(port) {
+			return fmt.Errorf("%w: %s publishes the host port of %s", ErrBlueGreenUnsupported, cube.Name, port)
+		}
+	}
+	if err := quota.CheckCube(workspaceID, cube); err != nil {
+		return err
+	}
+
+	oldIP, err := docker.GetContainerIPAddress(cube.Name)
+	if err != nil {
+		return err
+	}
+	domains, err := proxyDomains(proxies)
+	if err != nil {
+		return err
+	}
+
+	next := cube.Name + models.NextSuffix
+	discard := func(cause error) error {
+		if err := docker.RemoveContainer(next); err != nil {
+			log.Printf("[*] Warning: Failed to remove container %s: %v", next, err)
+		}
+		return cause
+	}
+
+	log.Printf("[*] Starting container %s to replace %s", next, cube.Name)
+	if err := deployAs(workspaceID, cube, next, 0); err != nil {
+		return discard(fmt.Errorf("failed to start the new container: %v", err))
+	}
+	ip, err := docker.WaitHealthy(next, BlueGreenSettle, BlueGreenTimeout)
+	if err != nil {
+		return discard(fmt.Errorf("the new container is not ready: %v", err))
+	}
+
+	if err := pointProxies(proxies, domains, []string{ip}, cube.LoadBalancing); err != nil {
+		if err := pointProxies(proxies, domains, []string{oldIP}, cube.LoadBalancing); err != nil {
+			log.Printf("[*] Warning: Failed to point the proxies of %s back to its container: %v", cube.Name, err)
+		}
+		return discard(fmt.Errorf("failed to switch the proxies to the new container: %w", err))
+	}
+
+	time.Sleep(BlueGreenDrain)
+	if err := docker.RemoveContainer(cube.Name); err != nil {
+		if err := pointProxies(proxies, domains, []string{oldIP}, cube.LoadBalancing); err != nil {
+			log.Printf("[*] Warning: Failed to point the proxies of %s back to its container: %v", cube.Name, err)
+		}
+		return discard(fmt.Errorf("failed to retire the old container: %v", err))
+	}
+	// The new container serves the proxies under its temporary name if the rename fails
+	if err := docker.RenameContainer(next, cube.Name); err != nil {
+		return err
+	}
+
+	log.Printf("[*] Container of cube %s replaced, proxies now point to %s", cube.Name, ip)
+	return nil
+}
+
+// pointProxies writes the configuration of every proxy of a cube for the given container IPs, then reloads Nginx once.
+// The previous configurations are kept when Nginx rejects the new ones.
+func pointProxies(proxies []models.Proxy, domains []string, ips []string, balancing string) error {
+	batch, err := proxy.NewBatch()
+	if err != nil {
+		return err
+	}
+	for i, p := range proxies {
+		if err := batch.Write(ips, p.Port, domains[i], balancing); err != nil {
+			batch.Discard()
+			return err
+		}
+	}
+	return batch.Apply()
+}
@@ -0,0 +1,138 @@
+package deploy
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/turplespace/portos/pkg/models"
+)
+
+func TestDeployBlueGreen(t *testing.T) {
+	workspaceID, cube := newCube(t, models.Container{Name: "bluegreen-web", Image: "nginx:1.26"}, "bluegreen.example.com")
+	old := engine.run(cube.Name, cube.Image, cubeLabels(workspaceID, cube.ID))
+	if err := SyncProxies(); err != nil {
+		t.Fatalf("sync before the deploy: %v", err)
+	}
+
+	cube.Image = "nginx:1.27"
+	if err := DeployBlueGreen(workspaceID, cube); err != nil {
+		t.Fatalf("deploy: %v", err)
+	}
+	current, _ := engine.container(cube.Name)
+	if current.ID == old.ID || current.Image != "nginx:1.27" {
+		t.Errorf("container after the deploy = %+v, want a new one of nginx:1.27", current)
+	}
+	if names := engine.names(cube.ID); !slices.Equal(names, []string{cube.Name}) {
+		t.Errorf("containers after the deploy = %v, want only %s", names, cube.Name)
+	}
+	if config := proxyConfig(t, "bluegreen.example.com"); !strings.Contains(config, current.IP+":80") || strings.Contains(config, old.IP+":80") {
+		t.Errorf("configuration after the deploy = %s, want the new container %s only", config, current.IP)
+	}
+}
+
+func TestDeployBlueGreenRollsBack(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		image     string
+		testNginx func() (string, bool)
+		want      string
+	}{
+		{"failed health check", "unhealthy", nil, "the new container is not ready"},
+		{"configuration rejected by nginx", "nginx:1.27", func() (string, bool) { return "nginx: [emerg] invalid", false }, "failed to switch the proxies"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			domain := "rollback-" + strings.ReplaceAll(test.name, " ", "-") + ".example.com"
+			workspaceID, cube := newCube(t, models.Container{Name: "rollback-" + strings.ReplaceAll(test.name, " ", "-"), Image: "nginx:1.26"}, domain)
+			old := engine.run(cube.Name, cube.Image, cubeLabels(workspaceID, cube.ID))
+			if err := SyncProxies(); err != nil {
+				t.Fatalf("sync before the deploy: %v", err)
+			}
+			engine.TestNginx = test.testNginx
+			t.Cleanup(func() { engine.TestNginx = nil })
+
+			cube.Image = test.image
+			if err := DeployBlueGreen(workspaceID, cube); err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("deploy = %v, want %q", err, test.want)
+			}
+
+			// The old container keeps serving the proxies, the new one is gone
+			if current, ok := engine.container(cube.Name); !ok || current.ID != old.ID || current.Status != "running" {
+				t.Errorf("container after the rollback = %+v, want the old one running", current)
+			}
+			if names := engine.names(cube.ID); !slices.Equal(names, []string{cube.Name}) {
+				t.Errorf("containers after the rollback = %v, want only %s", names, cube.Name)
+			}
+			if config := proxyConfig(t, domain); !strings.Contains(config, old.IP+":80") {
+				t.Errorf("configuration after the rollback = %s, want the old container %s", config, old.IP)
+			}
+		})
+	}
+}
+
+func TestDeployBlueGreenRejects(t *testing.T) {
+	for _, cube := range []models.Container{
+		{Name: "bluegreen-published", Image: "nginx", Ports: []string{"8083:80"}},
+		{Name: "bluegreen-replicated", Image: "nginx", Replicas: 2},
+	} {
+		workspaceID, cube := newCube(t, cube, cube.Name+".example.com")
+		engine.run(cube.Name, "nginx", cubeLabels(workspaceID, cube.ID))
+		if err := DeployBlueGreen(workspaceID, cube); !errors.Is(err, ErrBlueGreenUnsupported) {
+			t.Errorf("deploy %s = %v, want ErrBlueGreenUnsupported", cube.Name, err)
+		}
+		if _, ok := engine.container(cube.Name + models.NextSuffix); ok {
+			t.Errorf("deploy %s started a new container", cube.Name)
+		}
+	}
+}
+
+func TestProxySyncDuringBlueGreenSwap(t *testing.T) {
+	workspaceID, cube := newCube(t, models.Container{Name: "swap-web", Image: "nginx"}, "swap.example.com")
+	old := engine.run(cube.Name, "nginx", cubeLabels(workspaceID, cube.ID))
+	if err := SyncProxies(); err != nil {
+		t.Fatalf("sync before the deploy: %v", err)
+	}
+	if config := proxyConfig(t, "swap.example.com"); !strings.Contains(config, old.IP+":80") {
+		t.Fatalf("configuration before the deploy = %s, want the old container %s", config, old.IP)
+	}
+
+	drain := BlueGreenDrain
+	BlueGreenDrain = time.Second
+	t.Cleanup(func() { BlueGreenDrain = drain })
+	done := make(chan error)
+	go func() { done <- DeployBlueGreen(workspaceID, cube) }()
+
+	// Once the proxies point at the new container the old one drains, both run and a sync must
+	// not point the proxies back at the old one
+	var next fakeContainer
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		var ok bool
+		if next, ok = engine.container(cube.Name + models.NextSuffix); ok && strings.Contains(proxyConfig(t, "swap.example.com"), next.IP+":80") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the proxies were not switched to the new container")
+		}
+	}
+	if err := SyncProxies(); err != nil {
+		t.Errorf("sync during the swap: %v", err)
+	}
+	if config := proxyConfig(t, "swap.example.com"); !strings.Contains(config, next.IP+":80") {
+		t.Errorf("configuration after a sync during the swap = %s, want the new container %s", config, next.IP)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatalf("deploy: %v", err)
+	}
+	if renamed, ok := engine.container(cube.Name); !ok || renamed.IP != next.IP {
+		t.Errorf("container %s after the deploy = %+v, want the new container %s", cube.Name, renamed, next.IP)
+	}
+	if err := SyncProxies(); err != nil {
+		t.Errorf("sync after the deploy: %v", err)
+	}
+	if config := proxyConfig(t, "swap.example.com"); !strings.Contains(config, next.IP+":80") {
+		t.Errorf("configuration after the deploy = %s, want the new container %s", config, next.IP)
+	}
+}
@@ -0,0 +1,164 @@
+package deploy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/internal/services/docker"
+	"github.com/turplespace/portos/internal/services/secrets"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+/*
+DeployCube (re)creates the containers of a cube once the workspace quota allows it, one for each
+of its replicas, and removes those of replicas it no longer has. The cube is rendered with the variables of its
+workspace, then the secret references of its environment variables are resolved right before
+the runtime call and the resolved values are redacted from any error returned by the runtime.
+*/
+func DeployCube(workspaceID int, container models.Container) error {
+	defer lockCube(container.ID)()
+	return deployReplicas(workspaceID, container, false)
+}
+
+// deployAs starts a container of a cube under the given name, replica is its number among the
+// replicas of the cube or 0. The cube is still rendered with its own name.
+func deployAs(workspaceID int, container models.Container, name string, replica int) error {
+	container, err := Render(workspaceID, container)
+	if err != nil {
+		return err
+	}
+	container.Name = name
+	container.Labels = docker.ManagedLabels(container.Labels, workspaceID, container.ID, replica)
+	if container.Networks, err = ensureNetworks(workspaceID, container.Networks); err != nil {
+		return err
+	}
+
+	resolved, err := secrets.Resolve(workspaceID, container.EnvironmentVars)
+	if err != nil {
+		return err
+	}
+
+	if err := docker.StartContainer(container, resolved.Env); err != nil {
+		return errors.New(resolved.Redact(err.Error()))
+	}
+	return nil
+}
+
+// ensureNetworks creates the Docker networks joined by a cube and returns their Docker names,
+// networks the workspace does not declare get the default driver
+func ensureNetworks(workspaceID int, names []string) ([]string, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	declared, err := database.ListWorkspaceNetworks(workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	drivers := make(map[string]string, len(declared))
+	for _, network := range declared {
+		drivers[network.Name] = network.Driver
+	}
+
+	dockerNames := make([]string, len(names))
+	for i, name := range names {
+		if err := docker.EnsureNetwork(workspaceID, name, drivers[name]); err != nil {
+			return nil, err
+		}
+		dockerNames[i] = docker.NetworkName(workspaceID, name)
+	}
+	return dockerNames, nil
+}
+
+// DeployWorkspace (re)creates the containers of every cube of a workspace after the cubes they depend on,
+// stopping at the first failure
+func DeployWorkspace(workspaceID int) error {
+	containers, err := database.ListContainersInWorkspace(workspaceID)
+	if err != nil {
+		return fmt.Errorf("failed to list containers: %v", err)
+	}
+
+	for _, container := range Order(containers) {
+		if err := DeployCube(workspaceID, container); err != nil {
+			return fmt.Errorf("failed to deploy container %s: %v", container.Name, err)
+		}
+	}
+	return nil
+}
+
+/*
+Order sorts cubes so that each one comes after the cubes it depends on, keeping the given order
+otherwise. Dependencies on cubes that are not in the list are ignored, and a cycle is broken at
+the dependency leading back to a cube already being ordered.
+*/
+func Order(containers []models.Container) []models.Container {
+	index := make(map[string]int, len(containers))
+	for i, container := range containers {
+		index[container.Name] = i
+	}
+
+	ordered := make([]models.Container, 0, len(containers))
+	visited := make([]bool, len(containers))
+	var visit func(i int)
+	visit = func(i int) {
+		if visited[i] {
+			return
+		}
+		visited[i] = true
+		for _, name := range containers[i].DependsOn {
+			if j, ok := index[name]; ok {
+				visit(j)
+			}
+		}
+		ordered = append(ordered, containers[i])
+	}
+	for i := range containers {
+		visit(i)
+	}
+	return ordered
+}
+
+/*
+RecreateSecretConsumers recreates the running cubes of a workspace that reference a secret, with
+all their replicas, so that a rotated value is picked up. A cube runs when any of its replicas
+does, stopped cubes get the new value on their next deploy. It returns the names of the recreated cubes.
+*/
+func RecreateSecretConsumers(workspaceID int, name string) ([]string, error) {
+	containers, err := database.ListContainersInWorkspace(workspaceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %v", err)
+	}
+
+	states, err := docker.ListManagedContainers(workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	recreated := []string{}
+	for _, container := range containers {
+		rendered, err := Render(workspaceID, container)
+		if err != nil || !references(rendered, name) {
+			continue
+		}
+		if _, ready := ReplicaStatus(states, container); ready == 0 {
+			continue
+		}
+
+		log.Printf("[*] Recreating container %s after rotation of secret %s", container.Name, name)
+		if err := DeployCube(workspaceID, container); err != nil {
+			return recreated, fmt.Errorf("failed to recreate container %s: %v", container.Name, err)
+		}
+		recreated = append(recreated, container.Name)
+	}
+	return recreated, nil
+}
+
+func references(container models.Container, name string) bool {
+	for _, ref := range secrets.References(container.EnvironmentVars) {
+		if ref == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package deploy
+
+import (
+	"encoding/base64"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/turplespace/portos/internal/config"
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/internal/services/secrets"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+func TestRecreateSecretConsumers(t *testing.T) {
+	previous := config.Get().MasterKey
+	config.Get().MasterKey = base64.StdEncoding.EncodeToString([]byte(strings.Repeat("k", 32)))
+	t.Cleanup(func() { config.Get().MasterKey = previous })
+
+	workspaceID, cube := newCube(t, models.Container{Name: "rotate-web", Image: "nginx", Replicas: 2, EnvironmentVars: []string{"API_KEY=${secret:API_KEY}"}})
+	stopped := models.Container{Name: "rotate-stopped", Image: "nginx", EnvironmentVars: []string{"API_KEY=${secret:API_KEY}"}}
+	id, err := database.InsertWorkspaceAndCubes(workspaceID, stopped, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stopped.ID = int(id)
+	if _, err := secrets.Set(workspaceID, "API_KEY", "first"); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeployCube(workspaceID, cube); err != nil {
+		t.Fatalf("deploy: %v", err)
+	}
+	before := map[string]fakeContainer{}
+	for _, name := range engine.names(cube.ID) {
+		before[name], _ = engine.container(name)
+	}
+
+	if _, err := secrets.Set(workspaceID, "API_KEY", "second"); err != nil {
+		t.Fatal(err)
+	}
+	recreated, err := RecreateSecretConsumers(workspaceID, "API_KEY")
+	if err != nil {
+		t.Fatalf("recreate: %v", err)
+	}
+	if !slices.Equal(recreated, []string{cube.Name}) {
+		t.Errorf("recreated = %v, want the running cube %s only", recreated, cube.Name)
+	}
+	names := engine.names(cube.ID)
+	if !slices.Equal(names, []string{"rotate-web-1", "rotate-web-2"}) {
+		t.Fatalf("containers after the rotation = %v, want both replicas", names)
+	}
+	for _, name := range names {
+		c, _ := engine.container(name)
+		if c.ID == before[name].ID || !slices.Contains(c.Env, "API_KEY=second") {
+			t.Errorf("replica %s = %+v, want it recreated with the rotated value", name, c)
+		}
+	}
+	if names := engine.names(stopped.ID); len(names) != 0 {
+		t.Errorf("containers of the stopped cube = %v, want none", names)
+	}
+}
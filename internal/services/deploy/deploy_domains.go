@@ -0,0 +1,177 @@
+package deploy
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/internal/services/proxy"
+	"github.com/turplespace/portos/internal/validation"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+/*
+ProxyDomains holds the domains of every proxy with their variables expanded. A domain only
+becomes a host name once expanded, and two proxies whose domains differ as stored may expand to
+the same one, so the expanded domains are what must be valid and unique before Nginx sees them.
+*/
+type ProxyDomains struct {
+	ids        []int          // Proxy IDs in order of creation
+	domains    map[int]string // Expanded domain by proxy ID
+	workspaces map[int]int    // Workspace ID by proxy ID
+}
+
+/*
+LoadProxyDomains expands the domains of every proxy. The workspaces found in overrides are expanded
+with the given variables instead of their stored ones, to check a change of variables before it is
+stored.
+*/
+func LoadProxyDomains(overrides map[int][]database.WorkspaceVariable) (*ProxyDomains, error) {
+	proxies, err := database.ListProxies()
+	if err != nil {
+		return nil, err
+	}
+
+	d := &ProxyDomains{domains: map[int]string{}, workspaces: map[int]int{}}
+	values := map[int]map[string]string{}
+	for _, p := range proxies {
+		workspaceID, err := database.GetWorkspaceIDByCubeID(p.CubeID)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := values[workspaceID]; !ok {
+			workspace, stored, err := variables(workspaceID)
+			if err != nil {
+				return nil, err
+			}
+			if override, ok := overrides[workspaceID]; ok {
+				stored = override
+			}
+			values[workspaceID] = variableValues(workspace.Name, "", stored)
+		}
+		cube, err := database.GetCubeData(p.CubeID)
+		if err != nil {
+			return nil, err
+		}
+
+		values[workspaceID][VariableCubeName] = cube.Name
+		d.ids = append(d.ids, p.ID)
+		d.domains[p.ID] = expand(p.Domain, values[workspaceID])
+		d.workspaces[p.ID] = workspaceID
+	}
+	return d, nil
+}
+
+/*
+Domain returns the expanded domain of a proxy. It fails with proxy.ErrInvalidConfig when the domain
+is not a valid host name, or when a proxy created earlier has the same domain: that proxy keeps
+serving it and the later one is never configured.
+*/
+func (d *ProxyDomains) Domain(proxyID int) (string, error) {
+	domain, ok := d.domains[proxyID]
+	if !ok {
+		return "", fmt.Errorf("proxy %d not found", proxyID)
+	}
+	if err := checkHostName(domain); err != nil {
+		return "", err
+	}
+	for _, id := range d.ids {
+		if id == proxyID {
+			break
+		}
+		if strings.EqualFold(d.domains[id], domain) {
+			return "", fmt.Errorf("%w: domain %s of proxy %d is already the domain of proxy %d", proxy.ErrInvalidConfig, domain, proxyID, id)
+		}
+	}
+	return domain, nil
+}
+
+/*
+Check fails with proxy.ErrInvalidConfig when an expanded domain is not a valid host name or is the
+domain of a proxy other than proxyID, 0 for a new proxy. Proxies of the workspace skipWorkspace,
+0 for none, are ignored, for a spec that replaces them.
+*/
+func (d *ProxyDomains) Check(domain string, proxyID int, skipWorkspace int) error {
+	if err := checkHostName(domain); err != nil {
+		return err
+	}
+	for _, id := range d.ids {
+		if id == proxyID || (skipWorkspace != 0 && d.workspaces[id] == skipWorkspace) {
+			continue
+		}
+		if strings.EqualFold(d.domains[id], domain) {
+			return fmt.Errorf("%w: domain %s is already the domain of proxy %d", proxy.ErrInvalidConfig, domain, id)
+		}
+	}
+	return nil
+}
+
+/*
+CheckProxyDomain expands the domain of a new or edited proxy of a cube with the stored variables of
+its workspace and checks it, see ProxyDomains.Check. proxyID is 0 for a new proxy.
+*/
+func CheckProxyDomain(workspaceID int, cubeName string, domain string, proxyID int) error {
+	workspace, workspaceVariables, err := variables(workspaceID)
+	if err != nil {
+		return err
+	}
+	d, err := LoadProxyDomains(nil)
+	if err != nil {
+		return err
+	}
+	return d.Check(ExpandProxyDomainWith(workspace.Name, workspaceVariables, cubeName, domain), proxyID, 0)
+}
+
+// CheckVariables checks the domains of the proxies of a workspace that expand differently with new
+// variables, see ProxyDomains.Check
+func CheckVariables(workspaceID int, workspaceVariables []database.WorkspaceVariable) error {
+	before, err := LoadProxyDomains(nil)
+	if err != nil {
+		return err
+	}
+	after, err := LoadProxyDomains(map[int][]database.WorkspaceVariable{workspaceID: workspaceVariables})
+	if err != nil {
+		return err
+	}
+	for _, id := range after.ids {
+		if after.workspaces[id] != workspaceID || after.domains[id] == before.domains[id] {
+			continue
+		}
+		if err := after.Check(after.domains[id], id, 0); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ProxyDomain returns the checked, expanded domain of a proxy, see ProxyDomains.Domain
+func ProxyDomain(proxyID int) (string, error) {
+	d, err := LoadProxyDomains(nil)
+	if err != nil {
+		return "", err
+	}
+	return d.Domain(proxyID)
+}
+
+// proxyDomains returns the checked, expanded domains of proxies, see ProxyDomains.Domain
+func proxyDomains(proxies []models.Proxy) ([]string, error) {
+	d, err := LoadProxyDomains(nil)
+	if err != nil {
+		return nil, err
+	}
+	domains := make([]string, len(proxies))
+	for i, p := range proxies {
+		if domains[i], err = d.Domain(p.ID); err != nil {
+			return nil, err
+		}
+	}
+	return domains, nil
+}
+
+// checkHostName rejects expanded domains that are not host names, unknown ${VAR} references included
+func checkHostName(domain string) error {
+	if !validation.ValidHostName(domain) {
+		return fmt.Errorf("%w: %q is not a valid domain name once its variables are expanded", proxy.ErrInvalidConfig, domain)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package deploy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/internal/services/proxy"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+func TestProxyDomains(t *testing.T) {
+	first := newWorkspace(t, "domains-first")
+	second := newWorkspace(t, "domains-second")
+	if err := database.SetWorkspaceVariable(second, "ZONE", "example.com"); err != nil {
+		t.Fatal(err)
+	}
+	firstCube, err := database.InsertWorkspaceAndCubes(first, models.Container{Name: "domains-first-web", Image: "nginx"}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	secondCube, err := database.InsertWorkspaceAndCubes(second, models.Container{Name: "domains-second-web", Image: "nginx"}, "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The second workspace expands a domain of its own to the domain of the first
+	owner, err := database.AddProxy(int(firstCube), "app.example.com", 80, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	taker, err := database.AddProxy(int(secondCube), "app.${ZONE}", 80, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	named, err := database.AddProxy(int(secondCube), "${CUBE_NAME}.${ZONE}", 80, "", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	domains, err := LoadProxyDomains(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if domain, err := domains.Domain(int(owner)); err != nil || domain != "app.example.com" {
+		t.Errorf("domain of the first proxy = %q, %v, want app.example.com", domain, err)
+	}
+	if _, err := domains.Domain(int(taker)); !errors.Is(err, proxy.ErrInvalidConfig) {
+		t.Errorf("domain of the later proxy = %v, want ErrInvalidConfig", err)
+	}
+	if domain, err := domains.Domain(int(named)); err != nil || domain != "domains-second-web.example.com" {
+		t.Errorf("domain with the cube name = %q, %v, want domains-second-web.example.com", domain, err)
+	}
+
+	for domain, wantErr := range map[string]bool{"new.example.com": false, "APP.example.com": true, "bad domain": true} {
+		if err := domains.Check(domain, 0, 0); (err != nil) != wantErr {
+			t.Errorf("Check(%q) = %v, want error %v", domain, err, wantErr)
+		}
+	}
+	if err := domains.Check("app.example.com", int(owner), 0); err == nil {
+		t.Error("Check of the owner against the later proxy = nil, want an error")
+	}
+	if err := domains.Check("app.example.com", 0, first); err == nil {
+		t.Error("Check skipping the first workspace = nil, want the proxy of the second")
+	}
+
+	// Variables are checked with the values they would get
+	if err := CheckVariables(second, []database.WorkspaceVariable{{Name: "ZONE", Value: "x; }"}}); !errors.Is(err, proxy.ErrInvalidConfig) {
+		t.Errorf("CheckVariables with an invalid value = %v, want ErrInvalidConfig", err)
+	}
+	if err := CheckVariables(second, []database.WorkspaceVariable{{Name: "ZONE", Value: "example.org"}}); err != nil {
+		t.Errorf("CheckVariables with a valid value = %v, want nil", err)
+	}
+}
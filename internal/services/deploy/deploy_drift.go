@@ -0,0 +1,228 @@
+package deploy
+
+import (
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/docker/go-units"
+	"github.com/turplespace/portos/internal/services/docker"
+	"github.com/turplespace/portos/internal/services/secrets"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+/*
+PendingChanges compares a cube, rendered as it would be deployed, with its existing container
+and returns the fields that differ: image, environment, ports, volumes, limits, labels and
+networks. Before is the container and After the cube, environment variables and labels inherited
+from the image are left out of both, and the variables referencing secrets are redacted on both
+sides. A cube with replicas is
+compared with its first replica, and with the number of its containers. deployed is false when the
+cube has no container.
+*/
+func PendingChanges(workspaceID int, cube models.Container) (changes []models.FieldChange, deployed bool, err error) {
+	names := ContainerNames(cube)
+	config, err := docker.InspectConfig(names[0])
+	if err != nil || config == nil {
+		return nil, false, err
+	}
+
+	rendered, err := Render(workspaceID, cube)
+	if err != nil {
+		return nil, true, err
+	}
+	replica := 0
+	if len(names) > 1 {
+		replica = 1
+	}
+	rendered.Labels = docker.ManagedLabels(rendered.Labels, workspaceID, cube.ID, replica)
+	resolved, err := secrets.Resolve(workspaceID, rendered.EnvironmentVars)
+	if err != nil {
+		return nil, true, err
+	}
+
+	changes = []models.FieldChange{}
+	add := func(field string, before interface{}, after interface{}) {
+		changes = append(changes, models.FieldChange{Field: field, Before: before, After: after})
+	}
+
+	if config.Image != rendered.Image {
+		add("image", config.Image, rendered.Image)
+	}
+
+	// Docker runs the container with the variables of the image, overridden by those of the cube
+	env := maps.Clone(config.ImageEnv)
+	for _, variable := range rendered.EnvironmentVars {
+		key, value, _ := strings.Cut(variable, "=")
+		if resolvedValue, ok := resolved.Env[key]; ok {
+			value = resolvedValue
+		}
+		env[key] = value
+	}
+	if !maps.Equal(env, config.Env) {
+		before := []string{}
+		for _, key := range sortedKeys(config.Env) {
+			if value, inherited := config.ImageEnv[key]; !inherited || value != config.Env[key] {
+				before = append(before, resolved.RedactVariable(key, config.Env[key]))
+			}
+		}
+		after := []string{}
+		for _, variable := range sortedCopy(rendered.EnvironmentVars) {
+			key, value, _ := strings.Cut(variable, "=")
+			after = append(after, resolved.RedactVariable(key, value))
+		}
+		add("environment_vars", before, after)
+	}
+
+	ports, err := docker.PortBindings(rendered.Ports)
+	if err != nil {
+		return nil, true, fmt.Errorf("invalid ports of cube %s: %v", cube.Name, err)
+	}
+	if !maps.EqualFunc(ports, config.PortBindings, func(a []string, b []string) bool {
+		return slices.Equal(sortedCopy(a), sortedCopy(b))
+	}) {
+		add("ports", portMappings(config.PortBindings), portMappings(ports))
+	}
+
+	binds := []string{}
+	for hostPath, containerPath := range rendered.Volumes {
+		hostPath, err := docker.VolumePath(hostPath)
+		if err != nil {
+			return nil, true, err
+		}
+		binds = append(binds, hostPath+":"+containerPath)
+	}
+	if !slices.Equal(sortedCopy(binds), sortedCopy(config.Binds)) {
+		add("volumes", sortedCopy(config.Binds), sortedCopy(binds))
+	}
+
+	var nanoCPUs int64
+	if rendered.ResourceLimits.CPUs != "" {
+		cpus, err := strconv.ParseFloat(rendered.ResourceLimits.CPUs, 64)
+		if err != nil {
+			return nil, true, fmt.Errorf("invalid cpus of cube %s: %v", cube.Name, err)
+		}
+		nanoCPUs = int64(math.Round(cpus * 1e9))
+	}
+	if nanoCPUs != config.NanoCPUs {
+		before := ""
+		if config.NanoCPUs != 0 {
+			before = strconv.FormatFloat(float64(config.NanoCPUs)/1e9, 'f', -1, 64)
+		}
+		add("resource_limits.cpus", before, rendered.ResourceLimits.CPUs)
+	}
+	var memory int64
+	if rendered.ResourceLimits.Memory != "" {
+		if memory, err = units.RAMInBytes(rendered.ResourceLimits.Memory); err != nil {
+			return nil, true, fmt.Errorf("invalid memory of cube %s: %v", cube.Name, err)
+		}
+	}
+	if memory != config.Memory {
+		before := ""
+		if config.Memory != 0 {
+			before = units.BytesSize(float64(config.Memory))
+		}
+		add("resource_limits.memory", before, rendered.ResourceLimits.Memory)
+	}
+
+	labels := maps.Clone(config.ImageLabels)
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	for _, label := range rendered.Labels {
+		key, value, _ := strings.Cut(label, "=")
+		labels[key] = value
+	}
+	if !maps.Equal(labels, config.Labels) {
+		before := []string{}
+		for _, key := range sortedKeys(config.Labels) {
+			if value, inherited := config.ImageLabels[key]; !inherited || value != config.Labels[key] {
+				before = append(before, key+"="+config.Labels[key])
+			}
+		}
+		add("labels", before, sortedCopy(rendered.Labels))
+	}
+
+	// Containers without networks are attached to the default bridge
+	networks := []string{"bridge"}
+	if len(rendered.Networks) > 0 {
+		networks = make([]string, len(rendered.Networks))
+		for i, name := range rendered.Networks {
+			networks[i] = docker.NetworkName(workspaceID, name)
+		}
+	}
+	if !slices.Equal(sortedCopy(networks), sortedCopy(config.Networks)) {
+		add("networks", sortedCopy(config.Networks), sortedCopy(networks))
+	}
+
+	if len(names) > 1 {
+		states, err := docker.ListManagedContainers(workspaceID)
+		if err != nil {
+			return nil, true, err
+		}
+		if existing := len(Replicas(states, cube)); existing != len(names) {
+			add("replicas", existing, len(names))
+		}
+	}
+
+	return changes, true, nil
+}
+
+/*
+Redeploy brings the containers of a cube in line with the cube: they are recreated when the cube has
+pending changes or no container yet, and restarted otherwise. It reports whether they were recreated.
+The cube is held from the comparison to the restart or recreation, see lockCube.
+*/
+func Redeploy(workspaceID int, cube models.Container) (bool, error) {
+	defer lockCube(cube.ID)()
+	changes, deployed, err := PendingChanges(workspaceID, cube)
+	if err != nil {
+		return false, err
+	}
+	if deployed && len(changes) == 0 {
+		for _, name := range ContainerNames(cube) {
+			if err := docker.RestartContainer(name); err != nil {
+				return false, err
+			}
+		}
+		return false, nil
+	}
+	return true, deployReplicas(workspaceID, cube, false)
+}
+
+// portMappings formats port bindings as the port mappings of a cube, such as 8080:80/tcp
+func portMappings(bindings map[string][]string) []string {
+	mappings := []string{}
+	for port, hosts := range bindings {
+		for _, host := range hosts {
+			i := strings.LastIndex(host, ":")
+			ip, hostPort := host[:i], host[i+1:]
+			switch {
+			case hostPort == "":
+				mappings = append(mappings, port)
+			case ip == "":
+				mappings = append(mappings, hostPort+":"+port)
+			default:
+				mappings = append(mappings, ip+":"+hostPort+":"+port)
+			}
+		}
+	}
+	slices.Sort(mappings)
+	return mappings
+}
+
+func sortedKeys(values map[string]string) []string {
+	return slices.Sorted(maps.Keys(values))
+}
+
+func sortedCopy(values []string) []string {
+	sorted := slices.Clone(values)
+	if sorted == nil {
+		sorted = []string{}
+	}
+	slices.Sort(sorted)
+	return sorted
+}
@@ -0,0 +1,119 @@
+package deploy
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/turplespace/portos/pkg/models"
+)
+
+// fields lists the fields of changes
+func fields(changes []models.FieldChange) string {
+	var fields []string
+	for _, change := range changes {
+		fields = append(fields, change.Field)
+	}
+	return strings.Join(fields, ",")
+}
+
+func TestPendingChanges(t *testing.T) {
+	workspaceID, cube := newCube(t, models.Container{
+		Name: "drift-web", Image: "nginx:1.27", Ports: []string{"8082:80"}, EnvironmentVars: []string{"MODE=prod"},
+		Labels: []string{"team=web"}, ResourceLimits: models.ResourceLimits{CPUs: "0.5", Memory: "256m"},
+	})
+	if changes, deployed, err := PendingChanges(workspaceID, cube); err != nil || deployed || changes != nil {
+		t.Fatalf("pending changes without a container = %+v, %v, %v, want none", changes, deployed, err)
+	}
+
+	// The variables and labels of the image are not changes
+	if err := DeployCube(workspaceID, cube); err != nil {
+		t.Fatalf("deploy: %v", err)
+	}
+	if changes, deployed, err := PendingChanges(workspaceID, cube); err != nil || !deployed || len(changes) != 0 {
+		t.Fatalf("pending changes after a deploy = %+v, %v, %v, want none", changes, deployed, err)
+	}
+
+	edited := cube
+	edited.Image, edited.Ports, edited.EnvironmentVars = "nginx:1.28", []string{"8083:80"}, []string{"MODE=dev"}
+	edited.ResourceLimits = models.ResourceLimits{CPUs: "0.5"}
+	changes, _, err := PendingChanges(workspaceID, edited)
+	if err != nil {
+		t.Fatalf("pending changes: %v", err)
+	}
+	if got := fields(changes); got != "image,environment_vars,ports,resource_limits.memory" {
+		t.Fatalf("pending changes = %s, want the image, environment, ports and memory", got)
+	}
+	if changes[0].Before != "nginx:1.27" || changes[0].After != "nginx:1.28" {
+		t.Errorf("image change = %+v", changes[0])
+	}
+	if before, _ := changes[1].Before.([]string); !slices.Equal(before, []string{"MODE=prod"}) {
+		t.Errorf("environment before = %v, want the variables of the cube only", changes[1].Before)
+	}
+	if changes[3].Before != "256MiB" || changes[3].After != "" {
+		t.Errorf("memory change = %+v", changes[3])
+	}
+}
+
+func TestRedeploy(t *testing.T) {
+	workspaceID, cube := newCube(t, models.Container{Name: "redeploy-web", Image: "nginx:1.27"})
+	if recreated, err := Redeploy(workspaceID, cube); err != nil || !recreated {
+		t.Fatalf("redeploy without a container = %v, %v, want it created", recreated, err)
+	}
+	first, _ := engine.container(cube.Name)
+
+	// A cube without changes is restarted in place
+	if recreated, err := Redeploy(workspaceID, cube); err != nil || recreated {
+		t.Fatalf("redeploy without changes = %v, %v, want a restart", recreated, err)
+	}
+	if restarted, _ := engine.container(cube.Name); restarted.ID != first.ID {
+		t.Errorf("container after a restart = %s, want %s", restarted.ID, first.ID)
+	}
+
+	cube.EnvironmentVars = []string{"MODE=dev"}
+	if recreated, err := Redeploy(workspaceID, cube); err != nil || !recreated {
+		t.Fatalf("redeploy with changes = %v, %v, want the container recreated", recreated, err)
+	}
+	if recreated, _ := engine.container(cube.Name); recreated.ID == first.ID || !slices.Equal(recreated.Env, []string{"MODE=dev"}) {
+		t.Errorf("container after a change = %+v, want a new one with MODE=dev", recreated)
+	}
+}
+
+func TestRedeployWaitsForDeploy(t *testing.T) {
+	workspaceID, cube := newCube(t, models.Container{Name: "redeploy-locked", Image: "nginx:1.27"})
+	if _, err := Redeploy(workspaceID, cube); err != nil {
+		t.Fatalf("redeploy: %v", err)
+	}
+	first, _ := engine.container(cube.Name)
+
+	// A deploy holds the cube, the restart waits for it
+	unlock := lockCube(cube.ID)
+	done := make(chan error, 1)
+	go func() {
+		_, err := Redeploy(workspaceID, cube)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		unlock()
+		t.Fatalf("redeploy during the deploy returned %v, want it to wait", err)
+	case <-time.After(200 * time.Millisecond):
+	}
+	if current, _ := engine.container(cube.Name); !current.Started.Equal(first.Started) {
+		t.Errorf("container restarted at %s during the deploy", current.Started)
+	}
+
+	unlock()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("redeploy after the deploy: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("redeploy still waiting after the deploy")
+	}
+	if current, _ := engine.container(cube.Name); !current.Started.After(first.Started) {
+		t.Errorf("container started at %s after the redeploy, want a restart after %s", current.Started, first.Started)
+	}
+}
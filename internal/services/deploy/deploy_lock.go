@@ -0,0 +1,41 @@
+package deploy
+
+import "sync"
+
+// cubeLocks holds a mutex for each cube whose containers were changed, see lockCube
+var (
+	cubeLocks   = map[int]*sync.Mutex{}
+	cubeLocksMu sync.Mutex
+)
+
+/*
+lockCube waits until no other deploy changes the containers of a cube, then holds the cube until
+the returned function is called. Deploys, scales and stops of a cube run one at a time, so that
+one of them never removes the -next container of a blue/green deploy in flight, and the proxy sync
+skips the cubes being deployed rather than pointing them back at a container being retired.
+*/
+func lockCube(cubeID int) func() {
+	mu := cubeLock(cubeID)
+	mu.Lock()
+	return mu.Unlock
+}
+
+// tryLockCube holds a cube like lockCube without waiting, ok is false while a deploy holds it
+func tryLockCube(cubeID int) (unlock func(), ok bool) {
+	mu := cubeLock(cubeID)
+	if !mu.TryLock() {
+		return nil, false
+	}
+	return mu.Unlock, true
+}
+
+func cubeLock(cubeID int) *sync.Mutex {
+	cubeLocksMu.Lock()
+	defer cubeLocksMu.Unlock()
+	mu, ok := cubeLocks[cubeID]
+	if !ok {
+		mu = &sync.Mutex{}
+		cubeLocks[cubeID] = mu
+	}
+	return mu
+}
@@ -0,0 +1,225 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/internal/services/docker"
+	"github.com/turplespace/portos/internal/services/proxy"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+// Timings of the proxy sync
+var (
+	ProxySyncDelay = 2 * time.Second  // How long container starts are gathered before a single sync
+	ProxySyncRetry = 10 * time.Second // How long to wait before listening to the Docker events again after an error
+)
+
+/*
+SyncProxies rebuilds the Nginx configuration of every proxy from the database and the IP addresses
+of the running containers of its cube, then reloads Nginx once. The configurations of domains that
+are no longer proxied, or whose cube has no running container, are removed so that Nginx never
+routes to a stale IP. A cube that fails, or whose configuration Nginx rejects, does not keep the
+proxies of the others from being synced. The proxies of a cube being deployed are left as they
+are, the deploy points them at its containers.
+*/
+func SyncProxies() error {
+	proxies, err := database.ListProxies()
+	if err != nil {
+		return err
+	}
+	existing, err := proxy.ListNginxProxyConfigs()
+	if err != nil {
+		return err
+	}
+	domains, err := LoadProxyDomains(nil)
+	if err != nil {
+		return err
+	}
+
+	byCube := map[int][]models.Proxy{}
+	cubeIDs := []int{}
+	for _, p := range proxies {
+		if _, ok := byCube[p.CubeID]; !ok {
+			cubeIDs = append(cubeIDs, p.CubeID)
+		}
+		byCube[p.CubeID] = append(byCube[p.CubeID], p)
+	}
+
+	// The cubes are held until their configurations are applied, the containers are listed once
+	// they are, so that a deploy cannot change them in between
+	var errs []error
+	synced := []string{}
+	held := []int{}
+	for _, cubeID := range cubeIDs {
+		unlock, ok := tryLockCube(cubeID)
+		if !ok {
+			log.Printf("[*] Skipping the proxies of cube %d, it is being deployed", cubeID)
+			for _, p := range byCube[cubeID] {
+				if domain, err := domains.Domain(p.ID); err == nil {
+					synced = append(synced, domain)
+				}
+			}
+			continue
+		}
+		defer unlock()
+		held = append(held, cubeID)
+	}
+	cubeIDs = held
+
+	states, err := docker.ListManagedContainers(0)
+	if err != nil {
+		return err
+	}
+	batch, err := proxy.NewBatch()
+	if err != nil {
+		return err
+	}
+	for _, cubeID := range cubeIDs {
+		staged, err := stageCubeProxies(batch, states, domains, cubeID, byCube[cubeID])
+		if err != nil {
+			log.Printf("[*] Warning: Failed to sync the proxies of cube %d: %v", cubeID, err)
+			errs = append(errs, err)
+		}
+		synced = append(synced, staged...)
+	}
+	stale := []string{}
+	for _, domain := range existing {
+		if !slices.Contains(synced, domain) {
+			log.Printf("[*] Removing proxy configuration of %s, no running cube serves it", domain)
+			stale = append(stale, domain)
+			if err := batch.Remove(domain); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	err = batch.Apply()
+	if errors.Is(err, proxy.ErrInvalidConfig) {
+		// One configuration holds back the whole batch, the cubes are applied one by one instead
+		log.Printf("[*] Warning: Nginx rejected the proxy configurations, syncing cubes one by one: %v", err)
+		return errors.Join(append(errs, syncEachCube(states, domains, cubeIDs, byCube, stale)...)...)
+	}
+	if err != nil {
+		errs = append(errs, err)
+	}
+	log.Printf("[*] Synced %d proxy configurations", len(synced))
+	return errors.Join(errs...)
+}
+
+// syncEachCube applies the removal of the stale domains, then the proxies of each cube, with a batch
+// and an Nginx reload each. The cubes that failed to stage were reported by SyncProxies and are skipped.
+func syncEachCube(states map[string]docker.ContainerState, domains *ProxyDomains, cubeIDs []int, byCube map[int][]models.Proxy, stale []string) []error {
+	var errs []error
+	apply := func(stage func(batch *proxy.Batch) error) {
+		batch, err := proxy.NewBatch()
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		if err := stage(batch); err != nil {
+			batch.Discard()
+			return
+		}
+		if err := batch.Apply(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	apply(func(batch *proxy.Batch) error {
+		for _, domain := range stale {
+			if err := batch.Remove(domain); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	for _, cubeID := range cubeIDs {
+		apply(func(batch *proxy.Batch) error {
+			_, err := stageCubeProxies(batch, states, domains, cubeID, byCube[cubeID])
+			return err
+		})
+	}
+	return errs
+}
+
+// stageCubeProxies stages the configuration of the proxies of a cube for its running containers and
+// returns their domains, none when the cube does not run
+func stageCubeProxies(batch *proxy.Batch, states map[string]docker.ContainerState, domains *ProxyDomains, cubeID int, proxies []models.Proxy) ([]string, error) {
+	cube, err := database.GetCubeData(cubeID)
+	if err != nil {
+		return nil, err
+	}
+	ips := RunningIPs(Replicas(states, *cube))
+	if len(ips) == 0 {
+		return nil, nil
+	}
+
+	staged := []string{}
+	for _, p := range proxies {
+		domain, err := domains.Domain(p.ID)
+		if err != nil {
+			return staged, err
+		}
+		if err := batch.Write(ips, p.Port, domain, cube.LoadBalancing); err != nil {
+			return staged, fmt.Errorf("failed to write proxy configuration of %s: %w", domain, err)
+		}
+		staged = append(staged, domain)
+	}
+	return staged, nil
+}
+
+/*
+WatchProxies keeps the proxy configurations in line with the containers until ctx is done. A start
+or rename of a container of a cube, which may give it a new IP address, schedules SyncProxies, and
+the containers started within ProxySyncDelay are synced together with a single Nginx reload. The
+proxies are synced again after the Docker events are lost, as containers may have started meanwhile.
+*/
+func WatchProxies(ctx context.Context) {
+	for {
+		err := watchProxies(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("[*] Warning: Lost the Docker events of the proxy sync: %v", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(ProxySyncRetry):
+		}
+		if err := SyncProxies(); err != nil {
+			log.Printf("[*] Warning: Failed to sync proxies: %v", err)
+		}
+	}
+}
+
+// watchProxies syncs the proxies after the container events until the events fail or ctx is done
+func watchProxies(ctx context.Context) error {
+	messages, errs := docker.ContainerEvents(ctx, events.ActionStart, events.ActionRename)
+	var pending <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-errs:
+			return err
+		case message := <-messages:
+			log.Printf("[*] Container %s %s, syncing proxies", message.Actor.Attributes["name"], message.Action)
+			if pending == nil {
+				pending = time.After(ProxySyncDelay)
+			}
+		case <-pending:
+			pending = nil
+			if err := SyncProxies(); err != nil {
+				log.Printf("[*] Warning: Failed to sync proxies: %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package deploy
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/turplespace/portos/internal/services/proxy"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+// writeProxyConfig applies a configuration for a domain, as left by an earlier sync
+func writeProxyConfig(t *testing.T, domain string, ip string) {
+	t.Helper()
+	batch, err := proxy.NewBatch()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := batch.Write([]string{ip}, 80, domain, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := batch.Apply(); err != nil {
+		t.Fatalf("apply the configuration of %s: %v", domain, err)
+	}
+}
+
+// waitFor fails the test when condition does not hold within five seconds
+func waitFor(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestSyncProxies(t *testing.T) {
+	workspaceID, running := newCube(t, models.Container{Name: "sync-web", Image: "nginx"}, "sync-web.example.com")
+	web := engine.run(running.Name, "nginx", cubeLabels(workspaceID, running.ID))
+	workspaceID, stopped := newCube(t, models.Container{Name: "sync-stopped", Image: "nginx"}, "sync-stopped.example.com")
+	engine.run(stopped.Name, "nginx", cubeLabels(workspaceID, stopped.ID))
+	engine.cli([]string{"stop", stopped.Name})
+	newCube(t, models.Container{Name: "sync-never", Image: "nginx"}, "sync-never.example.com")
+
+	writeProxyConfig(t, "sync-web.example.com", "10.0.0.1")
+	writeProxyConfig(t, "sync-stopped.example.com", "10.0.0.2")
+	writeProxyConfig(t, "sync-stale.example.com", "10.0.0.3")
+
+	if err := SyncProxies(); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if config := proxyConfig(t, "sync-web.example.com"); !strings.Contains(config, web.IP+":80") || strings.Contains(config, "10.0.0.1") {
+		t.Errorf("configuration of the running cube = %s, want its container %s only", config, web.IP)
+	}
+	for _, domain := range []string{"sync-stopped.example.com", "sync-never.example.com", "sync-stale.example.com"} {
+		if config := proxyConfig(t, domain); config != "" {
+			t.Errorf("configuration of %s = %s, want none", domain, config)
+		}
+	}
+}
+
+func TestSyncProxiesSkipsLockedCubes(t *testing.T) {
+	workspaceID, cube := newCube(t, models.Container{Name: "sync-locked", Image: "nginx"}, "sync-locked.example.com")
+	old := engine.run(cube.Name, "nginx", cubeLabels(workspaceID, cube.ID))
+	if err := SyncProxies(); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+
+	// A deploy replaces the container while it holds the cube
+	unlock := lockCube(cube.ID)
+	engine.cli([]string{"rm", cube.Name})
+	current := engine.run(cube.Name, "nginx", cubeLabels(workspaceID, cube.ID))
+	if err := SyncProxies(); err != nil {
+		unlock()
+		t.Fatalf("sync during the deploy: %v", err)
+	}
+	if config := proxyConfig(t, "sync-locked.example.com"); !strings.Contains(config, old.IP+":80") {
+		t.Errorf("configuration during the deploy = %q, want it kept on %s", config, old.IP)
+	}
+
+	unlock()
+	if err := SyncProxies(); err != nil {
+		t.Fatalf("sync after the deploy: %v", err)
+	}
+	if config := proxyConfig(t, "sync-locked.example.com"); !strings.Contains(config, current.IP+":80") || strings.Contains(config, old.IP+":80") {
+		t.Errorf("configuration after the deploy = %s, want the new container %s only", config, current.IP)
+	}
+}
+
+func TestWatchProxies(t *testing.T) {
+	delay, retry := ProxySyncDelay, ProxySyncRetry
+	ProxySyncDelay, ProxySyncRetry = 300*time.Millisecond, 100*time.Millisecond
+	t.Cleanup(func() { ProxySyncDelay, ProxySyncRetry = delay, retry })
+	var reloads atomic.Int32
+	engine.Reload = func() (string, bool) {
+		reloads.Add(1)
+		return "", true
+	}
+	t.Cleanup(func() { engine.Reload = nil })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		WatchProxies(ctx)
+		close(done)
+	}()
+	defer func() {
+		cancel()
+		<-done
+	}()
+	waitFor(t, "the event stream", func() bool { return engine.subscribers() == 1 })
+
+	// Containers started together are synced with a single reload
+	containers := map[string]*fakeContainer{}
+	for _, name := range []string{"watch-a", "watch-b", "watch-c"} {
+		workspaceID, cube := newCube(t, models.Container{Name: name, Image: "nginx"}, name+".example.com")
+		containers[name] = engine.run(cube.Name, "nginx", cubeLabels(workspaceID, cube.ID))
+	}
+	waitFor(t, "the sync of the started containers", func() bool { return reloads.Load() >= 1 })
+	time.Sleep(2 * ProxySyncDelay)
+	if n := reloads.Load(); n != 1 {
+		t.Errorf("reloads after three starts = %d, want 1", n)
+	}
+	for name, c := range containers {
+		if config := proxyConfig(t, name+".example.com"); !strings.Contains(config, c.IP+":80") {
+			t.Errorf("configuration of %s = %q, want its container %s", name, config, c.IP)
+		}
+	}
+
+	// A rename is synced as well
+	engine.cli([]string{"rename", "watch-a", "watch-a-renamed"})
+	waitFor(t, "the sync of the renamed container", func() bool { return reloads.Load() == 2 })
+
+	// After the events are lost the proxies are synced again and the events followed anew
+	engine.dropEvents()
+	waitFor(t, "the sync after the lost events", func() bool { return reloads.Load() == 3 })
+	waitFor(t, "the new event stream", func() bool { return engine.subscribers() == 1 })
+}
+
+func TestSyncProxiesFallsBackPerCube(t *testing.T) {
+	workspaceID, good := newCube(t, models.Container{Name: "fallback-good", Image: "nginx"}, "fallback-good.example.com")
+	web := engine.run(good.Name, "nginx", cubeLabels(workspaceID, good.ID))
+	workspaceID, bad := newCube(t, models.Container{Name: "fallback-bad", Image: "nginx"}, "fallback-bad.example.com")
+	engine.run(bad.Name, "nginx", cubeLabels(workspaceID, bad.ID))
+	writeProxyConfig(t, "fallback-stale.example.com", "10.0.0.4")
+
+	// Nginx rejects the configuration of the bad cube, whichever batch it is in
+	var reloads atomic.Int32
+	engine.TestNginx = func() (string, bool) {
+		if domains, _ := proxy.ListNginxProxyConfigs(); slices.Contains(domains, "fallback-bad.example.com") {
+			return "nginx: [emerg] host not found in upstream in /etc/nginx/conf.d/fallback-bad.example.com.conf:3\n", false
+		}
+		return "", true
+	}
+	engine.Reload = func() (string, bool) {
+		reloads.Add(1)
+		return "", true
+	}
+	t.Cleanup(func() { engine.TestNginx, engine.Reload = nil, nil })
+
+	err := SyncProxies()
+	if !errors.Is(err, proxy.ErrInvalidConfig) || !strings.Contains(err.Error(), "fallback-bad.example.com.conf") {
+		t.Errorf("sync = %v, want the rejected configuration of the bad cube", err)
+	}
+	if config := proxyConfig(t, "fallback-good.example.com"); !strings.Contains(config, web.IP+":80") {
+		t.Errorf("configuration of the good cube = %q, want its container %s", config, web.IP)
+	}
+	for _, domain := range []string{"fallback-bad.example.com", "fallback-stale.example.com"} {
+		if config := proxyConfig(t, domain); config != "" {
+			t.Errorf("configuration of %s = %s, want none", domain, config)
+		}
+	}
+	// The stale domains and every cube but the bad one are reloaded on their own
+	if n := reloads.Load(); n < 2 {
+		t.Errorf("reloads = %d, want one per applied batch", n)
+	}
+}
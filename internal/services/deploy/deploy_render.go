@@ -0,0 +1,121 @@
+package deploy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+// variablePattern matches ${NAME} references, secret references contain a colon and never match
+var variablePattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+var variableNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Built-in variables, always available and never overridden by workspace variables
+const (
+	VariableWorkspaceName = "WORKSPACE_NAME"
+	VariableCubeName      = "CUBE_NAME"
+)
+
+// ValidVariableName reports whether name can be used as a workspace variable
+func ValidVariableName(name string) bool {
+	return variableNamePattern.MatchString(name) && name != VariableWorkspaceName && name != VariableCubeName
+}
+
+/*
+Render returns the container as it is deployed: the workspace variables are added to its
+environment unless the cube sets the same variable, then ${VAR} references in environment
+values, labels and volume paths are replaced by the built-in variables, the workspace
+variables and the cube's own environment, in increasing priority. Unknown references are kept.
+*/
+func Render(workspaceID int, container models.Container) (models.Container, error) {
+	workspace, workspaceVariables, err := variables(workspaceID)
+	if err != nil {
+		return container, err
+	}
+	return RenderWith(workspace.Name, workspaceVariables, container), nil
+}
+
+// RenderWith renders the container like Render with the given workspace name and variables, such as those of a spec
+func RenderWith(workspaceName string, workspaceVariables []database.WorkspaceVariable, container models.Container) models.Container {
+	values := variableValues(workspaceName, container.Name, workspaceVariables)
+
+	own := make(map[string]bool)
+	for _, env := range container.EnvironmentVars {
+		key, value, _ := strings.Cut(env, "=")
+		own[key] = true
+		values[key] = value
+	}
+
+	var env []string
+	for _, variable := range workspaceVariables {
+		if !own[variable.Name] {
+			env = append(env, fmt.Sprintf("%s=%s", variable.Name, variable.Value))
+		}
+	}
+	env = append(env, container.EnvironmentVars...)
+
+	rendered := container
+	rendered.EnvironmentVars = make([]string, len(env))
+	for i, item := range env {
+		key, value, found := strings.Cut(item, "=")
+		if found {
+			item = key + "=" + expand(value, values)
+		}
+		rendered.EnvironmentVars[i] = item
+	}
+
+	rendered.Labels = make([]string, len(container.Labels))
+	for i, label := range container.Labels {
+		rendered.Labels[i] = expand(label, values)
+	}
+
+	rendered.Volumes = make(map[string]string, len(container.Volumes))
+	for hostPath, containerPath := range container.Volumes {
+		rendered.Volumes[expand(hostPath, values)] = expand(containerPath, values)
+	}
+
+	return rendered
+}
+
+// ExpandProxyDomainWith replaces the built-in and the given workspace variables in the domain of a proxy of a cube.
+// The result is not checked, see ProxyDomains for the domains that are configured.
+func ExpandProxyDomainWith(workspaceName string, workspaceVariables []database.WorkspaceVariable, cubeName string, domain string) string {
+	return expand(domain, variableValues(workspaceName, cubeName, workspaceVariables))
+}
+
+// variables returns a workspace and its variables
+func variables(workspaceID int) (*database.Workspace, []database.WorkspaceVariable, error) {
+	workspace, err := database.GetWorkspaceByID(workspaceID)
+	if err != nil {
+		return nil, nil, err
+	}
+	workspaceVariables, err := database.ListWorkspaceVariables(workspaceID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return workspace, workspaceVariables, nil
+}
+
+// variableValues returns the built-in and workspace variables of a cube by name
+func variableValues(workspaceName string, cubeName string, workspaceVariables []database.WorkspaceVariable) map[string]string {
+	values := make(map[string]string, len(workspaceVariables)+2)
+	for _, variable := range workspaceVariables {
+		values[variable.Name] = variable.Value
+	}
+	values[VariableWorkspaceName] = workspaceName
+	values[VariableCubeName] = cubeName
+	return values
+}
+
+func expand(text string, values map[string]string) string {
+	return variablePattern.ReplaceAllStringFunc(text, func(ref string) string {
+		if value, ok := values[ref[2:len(ref)-1]]; ok {
+			return value
+		}
+		return ref
+	})
+}
@@ -0,0 +1,199 @@
+package deploy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/internal/services/docker"
+	"github.com/turplespace/portos/internal/services/quota"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+// Status of a cube with replicas when only some of them run
+const StatusDegraded = "degraded"
+
+// ErrReplicatedHostPort is wrapped by the errors of cubes with replicas that publish host ports
+var ErrReplicatedHostPort = errors.New("replicas of a cube cannot publish host ports")
+
+// ContainerNames returns the names of the containers of a cube, its own name without replicas
+func ContainerNames(cube models.Container) []string {
+	return cube.ContainerNames()
+}
+
+// CheckReplicas rejects a cube with replicas that publishes host ports, every replica would bind the same port
+func CheckReplicas(cube models.Container) error {
+	if cube.ReplicaCount() == 1 {
+		return nil
+	}
+	for _, port := range cube.Ports {
+		if publishesHostPort(port) {
+			return fmt.Errorf("%w: %s publishes %s", ErrReplicatedHostPort, cube.Name, port)
+		}
+	}
+	return nil
+}
+
+// publishesHostPort tells whether a port mapping binds a port of the host, such as 8080:80
+func publishesHostPort(port string) bool {
+	mapping, _, _ := strings.Cut(port, "/")
+	return strings.Contains(mapping, ":")
+}
+
+/*
+Scale brings the containers of a cube to its number of replicas and points its proxies at them.
+Running replicas are kept, missing ones are started and those beyond the count are removed. Going
+from a single container to replicas, or back, recreates them as their names change.
+*/
+func Scale(workspaceID int, cube models.Container) error {
+	defer lockCube(cube.ID)()
+	if err := deployReplicas(workspaceID, cube, true); err != nil {
+		return err
+	}
+	return RefreshProxies(workspaceID, cube)
+}
+
+// deployReplicas starts the containers of a cube, keepRunning keeps those already running, then
+// removes the containers of the cube that are not among them. The caller holds the cube, see lockCube.
+func deployReplicas(workspaceID int, cube models.Container, keepRunning bool) error {
+	if err := quota.CheckCube(workspaceID, cube); err != nil {
+		return err
+	}
+	if err := CheckReplicas(cube); err != nil {
+		return err
+	}
+	states, err := docker.ListManagedContainers(workspaceID)
+	if err != nil {
+		return err
+	}
+
+	names := ContainerNames(cube)
+	for i, name := range names {
+		if keepRunning && states[name].State == "running" {
+			continue
+		}
+		replica := 0
+		if len(names) > 1 {
+			replica = i + 1
+		}
+		if err := deployAs(workspaceID, cube, name, replica); err != nil {
+			return err
+		}
+	}
+
+	// Containers left by a scale down or a rename of the cube
+	for name, state := range states {
+		if cube.ID == 0 || state.Labels[docker.LabelCubeID] != strconv.Itoa(cube.ID) || slices.Contains(names, name) {
+			continue
+		}
+		log.Printf("[*] Removing container %s, cube %s no longer runs it", name, cube.Name)
+		if err := docker.RemoveContainer(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StopCube stops every container of a cube, a container that fails to stop does not keep the others running
+func StopCube(cube models.Container) error {
+	defer lockCube(cube.ID)()
+	var errs []error
+	for _, name := range ContainerNames(cube) {
+		if err := docker.StopContainer(name); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Replicas returns the existing containers of a cube among states, in the order of ContainerNames
+func Replicas(states map[string]docker.ContainerState, cube models.Container) []docker.ContainerState {
+	replicas := []docker.ContainerState{}
+	for _, name := range ContainerNames(cube) {
+		if state, ok := states[name]; ok {
+			replicas = append(replicas, state)
+		}
+	}
+	return replicas
+}
+
+/*
+ReplicaStatus returns the status of a cube from the state of its containers, and how many of its
+replicas run. It is the state of its container without replicas. With replicas it is running
+when they all run, degraded when some do, and otherwise the state of the first one.
+*/
+func ReplicaStatus(states map[string]docker.ContainerState, cube models.Container) (string, int) {
+	replicas := Replicas(states, cube)
+	ready := 0
+	for _, replica := range replicas {
+		if replica.State == "running" {
+			ready++
+		}
+	}
+
+	switch {
+	case len(replicas) == 0:
+		return "unknown", 0
+	case cube.ReplicaCount() == 1:
+		return replicas[0].State, ready
+	case ready == cube.ReplicaCount():
+		return "running", ready
+	case ready > 0:
+		return StatusDegraded, ready
+	default:
+		return replicas[0].State, ready
+	}
+}
+
+// ReplicaIPs returns the IP addresses of the running containers of a cube
+func ReplicaIPs(workspaceID int, cube models.Container) ([]string, error) {
+	if cube.ReplicaCount() == 1 {
+		ip, err := docker.GetContainerIPAddress(cube.Name)
+		if err != nil {
+			return nil, err
+		}
+		return []string{ip}, nil
+	}
+
+	states, err := docker.ListManagedContainers(workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	ips := RunningIPs(Replicas(states, cube))
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("no replica of cube %s is running", cube.Name)
+	}
+	return ips, nil
+}
+
+// RunningIPs returns the IP addresses of the running containers among replicas
+func RunningIPs(replicas []docker.ContainerState) []string {
+	ips := []string{}
+	for _, replica := range replicas {
+		if replica.State == "running" && replica.IPAddress != "" {
+			ips = append(ips, replica.IPAddress)
+		}
+	}
+	return ips
+}
+
+// RefreshProxies points every proxy of a cube at its running containers, then reloads Nginx once
+func RefreshProxies(workspaceID int, cube models.Container) error {
+	proxies, err := database.GetProxiesByCubeID(cube.ID)
+	if err != nil || len(proxies) == 0 {
+		return err
+	}
+	ips, err := ReplicaIPs(workspaceID, cube)
+	if err != nil {
+		return err
+	}
+	domains, err := proxyDomains(proxies)
+	if err != nil {
+		return err
+	}
+	return pointProxies(proxies, domains, ips, cube.LoadBalancing)
+}
@@ -0,0 +1,142 @@
+package deploy
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/turplespace/portos/internal/services/docker"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+func TestScale(t *testing.T) {
+	workspaceID, cube := newCube(t, models.Container{Name: "scale-web", Image: "nginx", Ports: []string{"80"}, LoadBalancing: models.LoadBalancingLeastConn}, "scale.example.com")
+	upstreams := func() []string {
+		var ips []string
+		for _, name := range engine.names(cube.ID) {
+			c, _ := engine.container(name)
+			ips = append(ips, c.IP)
+		}
+		config := proxyConfig(t, "scale.example.com")
+		for _, ip := range ips {
+			if !strings.Contains(config, "server "+ip+":80") {
+				t.Errorf("configuration = %s, want container %s among its servers", config, ip)
+			}
+		}
+		if got := strings.Count(config, "server 172."); got != len(ips) {
+			t.Errorf("configuration has %d servers, want %d", got, len(ips))
+		}
+		return ips
+	}
+
+	cube.Replicas = 3
+	if err := Scale(workspaceID, cube); err != nil {
+		t.Fatalf("scale up: %v", err)
+	}
+	if names := engine.names(cube.ID); !slices.Equal(names, []string{"scale-web-1", "scale-web-2", "scale-web-3"}) {
+		t.Fatalf("containers after a scale up = %v", names)
+	}
+	if second, _ := engine.container("scale-web-2"); second.Labels["replica"] != "2" {
+		t.Errorf("labels of scale-web-2 = %v, want replica 2", second.Labels)
+	}
+	before := upstreams()
+	if config := proxyConfig(t, "scale.example.com"); !strings.Contains(config, "least_conn;") {
+		t.Errorf("configuration = %s, want least_conn balancing", config)
+	}
+
+	// A scale down keeps the running replicas and removes the others
+	cube.Replicas = 2
+	if err := Scale(workspaceID, cube); err != nil {
+		t.Fatalf("scale down: %v", err)
+	}
+	if names := engine.names(cube.ID); !slices.Equal(names, []string{"scale-web-1", "scale-web-2"}) {
+		t.Fatalf("containers after a scale down = %v", names)
+	}
+	if after := upstreams(); !slices.Equal(after, before[:2]) {
+		t.Errorf("servers after a scale down = %v, want the first two of %v", after, before)
+	}
+
+	// A single container goes by the name of the cube
+	cube.Replicas = 1
+	if err := Scale(workspaceID, cube); err != nil {
+		t.Fatalf("scale to one: %v", err)
+	}
+	if names := engine.names(cube.ID); !slices.Equal(names, []string{"scale-web"}) {
+		t.Fatalf("containers after a scale to one = %v", names)
+	}
+	upstreams()
+}
+
+func TestReplicaStatus(t *testing.T) {
+	workspaceID, cube := newCube(t, models.Container{Name: "status-web", Image: "nginx", Replicas: 2})
+	if err := Scale(workspaceID, cube); err != nil {
+		t.Fatalf("scale: %v", err)
+	}
+	status := func() (string, int) {
+		states, err := docker.ListManagedContainers(workspaceID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return ReplicaStatus(states, cube)
+	}
+	if got, ready := status(); got != "running" || ready != 2 {
+		t.Errorf("status = %s with %d ready, want running with 2", got, ready)
+	}
+	if err := docker.StopContainer("status-web-2"); err != nil {
+		t.Fatal(err)
+	}
+	if got, ready := status(); got != StatusDegraded || ready != 1 {
+		t.Errorf("status with a stopped replica = %s with %d ready, want degraded with 1", got, ready)
+	}
+}
+
+func TestCheckReplicas(t *testing.T) {
+	for _, test := range []struct {
+		cube models.Container
+		ok   bool
+	}{
+		{models.Container{Name: "single", Ports: []string{"8084:80"}}, true},
+		{models.Container{Name: "replicated", Ports: []string{"80", "443/tcp"}, Replicas: 2}, true},
+		{models.Container{Name: "published", Ports: []string{"8084:80"}, Replicas: 2}, false},
+		{models.Container{Name: "published-ip", Ports: []string{"127.0.0.1:8084:80/udp"}, Replicas: 2}, false},
+	} {
+		if err := CheckReplicas(test.cube); (err == nil) != test.ok || (err != nil && !errors.Is(err, ErrReplicatedHostPort)) {
+			t.Errorf("CheckReplicas(%s) = %v, want ok %v", test.cube.Name, err, test.ok)
+		}
+	}
+}
+
+func TestDeployWaitsForBlueGreenSwap(t *testing.T) {
+	workspaceID, cube := newCube(t, models.Container{Name: "serial-web", Image: "nginx"}, "serial.example.com")
+	engine.run(cube.Name, "nginx", cubeLabels(workspaceID, cube.ID))
+
+	drain := BlueGreenDrain
+	BlueGreenDrain = time.Second
+	t.Cleanup(func() { BlueGreenDrain = drain })
+	swapped := make(chan error)
+	go func() { swapped <- DeployBlueGreen(workspaceID, cube) }()
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if next, ok := engine.container(cube.Name + models.NextSuffix); ok && strings.Contains(proxyConfig(t, "serial.example.com"), next.IP+":80") {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("the proxies were not switched to the new container")
+		}
+	}
+
+	// A deploy removes the containers of the cube it does not run, it must not take the -next
+	// container of the swap in flight
+	deployed := make(chan error)
+	go func() { deployed <- DeployCube(workspaceID, cube) }()
+	if err := <-swapped; err != nil {
+		t.Errorf("blue/green deploy: %v", err)
+	}
+	if err := <-deployed; err != nil {
+		t.Errorf("deploy after the swap: %v", err)
+	}
+	if names := engine.names(cube.ID); !slices.Equal(names, []string{cube.Name}) {
+		t.Errorf("containers after both deploys = %v, want only %s", names, cube.Name)
+	}
+}
@@ -0,0 +1,509 @@
+package deploy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/go-connections/nat"
+	"github.com/docker/go-units"
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/internal/services/proxy"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+/*
+TestMain runs the tests against a fresh database and a fake Docker engine. The engine answers the
+Docker API and the docker CLI: the test binary is linked as docker in the PATH, and when run under
+that name it forwards its arguments to the engine and exits with its answer.
+*/
+func TestMain(m *testing.M) {
+	if filepath.Base(os.Args[0]) == "docker" {
+		os.Exit(forwardCLI(os.Args[1:]))
+	}
+
+	server := httptest.NewServer(engine)
+	bin, err := os.MkdirTemp("", "deploy-test-bin")
+	if err != nil {
+		log.Fatal(err)
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.Symlink(executable, filepath.Join(bin, "docker")); err != nil {
+		log.Fatal(err)
+	}
+	os.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+	os.Setenv("DOCKER_HOST", "tcp://"+strings.TrimPrefix(server.URL, "http://"))
+
+	path, err := database.GetPath()
+	if err != nil {
+		log.Fatal(err)
+	}
+	os.Remove(path)
+	database.Init()
+	if err := proxy.CreateFolderIfNotExists(); err != nil {
+		log.Fatal(err)
+	}
+	BlueGreenSettle, BlueGreenTimeout, BlueGreenDrain = 0, 5*time.Second, 0
+
+	code := m.Run()
+	server.Close()
+	os.RemoveAll(bin)
+	os.Remove(path)
+	os.RemoveAll(executable + "_proxy")
+	os.Exit(code)
+}
+
+func newWorkspace(t *testing.T, name string) int {
+	t.Helper()
+	id, err := database.CreateWorkspace(name, "created by "+t.Name())
+	if err != nil {
+		t.Fatalf("create workspace %s: %v", name, err)
+	}
+	return int(id)
+}
+
+// newCube stores a cube in a new workspace, with a proxy for each domain
+func newCube(t *testing.T, cube models.Container, domains ...string) (int, models.Container) {
+	t.Helper()
+	workspaceID := newWorkspace(t, cube.Name)
+	id, err := database.InsertWorkspaceAndCubes(workspaceID, cube, "test")
+	if err != nil {
+		t.Fatalf("insert cube %s: %v", cube.Name, err)
+	}
+	cube.ID = int(id)
+	for _, domain := range domains {
+		if _, err := database.AddProxy(cube.ID, domain, 80, "", false); err != nil {
+			t.Fatalf("add proxy %s: %v", domain, err)
+		}
+	}
+	return workspaceID, cube
+}
+
+// proxyConfig returns the Nginx configuration of a domain, empty when it has none
+func proxyConfig(t *testing.T, domain string) string {
+	t.Helper()
+	executable, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := os.ReadFile(filepath.Join(executable+"_proxy", domain+".conf"))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return string(config)
+}
+
+/*
+forwardCLI sends the arguments of a docker command to the fake engine and prints its output. An
+environment variable given by its name alone takes its value from the environment, as with docker.
+*/
+func forwardCLI(args []string) int {
+	for i := 1; i < len(args); i++ {
+		if value, ok := os.LookupEnv(args[i]); ok && args[i-1] == "-e" && !strings.Contains(args[i], "=") {
+			args[i] += "=" + value
+		}
+	}
+	body, _ := json.Marshal(args)
+	resp, err := http.Post("http://"+strings.TrimPrefix(os.Getenv("DOCKER_HOST"), "tcp://")+"/cli", "application/json", bytes.NewReader(body))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer resp.Body.Close()
+	io.Copy(os.Stdout, resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return 1
+	}
+	return 0
+}
+
+// fakeContainer is a container of the fake engine
+type fakeContainer struct {
+	ID      string
+	Name    string
+	Image   string
+	Status  string // running or exited
+	Health  string // Health check status, empty without a health check
+	IP      string
+	Labels  map[string]string
+	Started time.Time
+
+	// Set by docker run
+	Env      []string
+	Ports    []string
+	Binds    []string
+	Networks []string
+	CPUs     string
+	Memory   string
+}
+
+/*
+fakeEngine keeps the containers of the tests. Containers of the image unhealthy report a failing
+health check, every image sets the variables and labels of imageConfig. Nginx runs in the proxy container: TestNginx and Reload, when set, return the output
+and the success of nginx -t and of the reload. Runs, restarts and renames are streamed as events to the
+subscribers of /events.
+*/
+type fakeEngine struct {
+	mu         sync.Mutex
+	containers map[string]*fakeContainer
+	lastIP     int
+	commands   [][]string
+	TestNginx  func() (string, bool)
+	Reload     func() (string, bool)
+	streams    []chan map[string]interface{}
+}
+
+var engine = &fakeEngine{containers: map[string]*fakeContainer{}}
+
+// imageConfig holds the variables and labels of the images, which containers inherit
+var imageConfig = map[string]interface{}{
+	"Env":    []string{"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin", "IMAGE_VERSION=1"},
+	"Labels": map[string]string{"maintainer": "fake engine"},
+}
+
+// run adds a running container as docker run would, with a new IP address
+func (e *fakeEngine) run(name string, image string, labels map[string]string) *fakeContainer {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.lastIP++
+	c := &fakeContainer{
+		ID:      fmt.Sprintf("%064d", e.lastIP),
+		Name:    name,
+		Image:   image,
+		Status:  "running",
+		IP:      fmt.Sprintf("172.18.0.%d", e.lastIP),
+		Labels:  labels,
+		Started: time.Now(),
+	}
+	if image == "unhealthy" {
+		c.Health = "unhealthy"
+	}
+	e.containers[name] = c
+	e.emit("start", c)
+	return c
+}
+
+// emit sends a container event to the event streams, the caller holds e.mu
+func (e *fakeEngine) emit(action string, c *fakeContainer) {
+	message := map[string]interface{}{
+		"Type":     "container",
+		"Action":   action,
+		"Actor":    map[string]interface{}{"ID": c.ID, "Attributes": map[string]string{"name": c.Name}},
+		"time":     time.Now().Unix(),
+		"timeNano": time.Now().UnixNano(),
+	}
+	for _, stream := range e.streams {
+		select {
+		case stream <- message:
+		default:
+		}
+	}
+}
+
+// subscribers returns the number of open event streams
+func (e *fakeEngine) subscribers() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return len(e.streams)
+}
+
+// dropEvents ends the event streams, as a restart of the engine would
+func (e *fakeEngine) dropEvents() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, stream := range e.streams {
+		close(stream)
+	}
+	e.streams = nil
+}
+
+// events streams the container events until the client leaves or the engine drops the stream
+func (e *fakeEngine) events(w http.ResponseWriter, r *http.Request) {
+	stream := make(chan map[string]interface{}, 64)
+	e.mu.Lock()
+	e.streams = append(e.streams, stream)
+	e.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.(http.Flusher).Flush()
+	encoder := json.NewEncoder(w)
+	for {
+		select {
+		case <-r.Context().Done():
+			e.mu.Lock()
+			e.streams = slices.DeleteFunc(e.streams, func(s chan map[string]interface{}) bool { return s == stream })
+			e.mu.Unlock()
+			return
+		case message, ok := <-stream:
+			if !ok {
+				return
+			}
+			encoder.Encode(message)
+			w.(http.Flusher).Flush()
+		}
+	}
+}
+
+// container returns a copy of a container, ok is false when there is none with that name
+func (e *fakeEngine) container(name string) (fakeContainer, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	c, ok := e.containers[name]
+	if !ok {
+		return fakeContainer{}, false
+	}
+	return *c, true
+}
+
+// names returns the names of the containers of a cube, sorted
+func (e *fakeEngine) names(cubeID int) []string {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	names := []string{}
+	for name, c := range e.containers {
+		if c.Labels["cube_id"] == strconv.Itoa(cubeID) {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// cubeLabels returns the labels docker run gets for a container of a cube
+func cubeLabels(workspaceID int, cubeID int) map[string]string {
+	return map[string]string{"service": "turplespace", "workspace_id": strconv.Itoa(workspaceID), "cube_id": strconv.Itoa(cubeID)}
+}
+
+func (e *fakeEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("API-Version", "1.45")
+	path := r.URL.Path
+	switch {
+	case path == "/cli":
+		var args []string
+		json.NewDecoder(r.Body).Decode(&args)
+		output, ok := e.cli(args)
+		if !ok {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		io.WriteString(w, output)
+	case strings.HasSuffix(path, "/events"):
+		e.events(w, r)
+	case strings.HasSuffix(path, "/_ping"):
+		io.WriteString(w, "OK")
+	case strings.HasSuffix(path, "/containers/json"):
+		e.list(w, r)
+	case strings.HasSuffix(path, "/json") && strings.Contains(path, "/containers/"):
+		name := strings.TrimSuffix(path[strings.LastIndex(path, "/containers/")+len("/containers/"):], "/json")
+		e.inspect(w, name)
+	case strings.HasSuffix(path, "/json") && strings.Contains(path, "/images/"):
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"Id": "sha256:" + strings.Repeat("0", 64), "Config": imageConfig})
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, `{"message":"not supported by the fake engine"}`)
+	}
+}
+
+// list answers the container list, filtered by the label filters
+func (e *fakeEngine) list(w http.ResponseWriter, r *http.Request) {
+	var filters map[string]map[string]bool
+	json.Unmarshal([]byte(r.URL.Query().Get("filters")), &filters)
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	list := []map[string]interface{}{}
+	for _, c := range e.containers {
+		matches := true
+		for label := range filters["label"] {
+			key, value, _ := strings.Cut(label, "=")
+			matches = matches && c.Labels[key] == value
+		}
+		if matches {
+			list = append(list, map[string]interface{}{
+				"Id": c.ID, "Names": []string{"/" + c.Name}, "Image": c.Image, "State": c.Status, "Labels": c.Labels,
+				"NetworkSettings": map[string]interface{}{"Networks": c.networks()},
+			})
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+func (e *fakeEngine) inspect(w http.ResponseWriter, name string) {
+	c, ok := e.container(name)
+	w.Header().Set("Content-Type", "application/json")
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `{"message":"No such container: %s"}`, name)
+		return
+	}
+	state := map[string]interface{}{"Status": c.Status, "Running": c.Status == "running", "StartedAt": c.Started.Format(time.RFC3339Nano)}
+	if c.Health != "" {
+		state["Health"] = map[string]string{"Status": c.Health}
+	}
+
+	// Containers inherit the variables and labels of their image, like with Docker
+	env := append([]string{}, imageConfig["Env"].([]string)...)
+	env = append(env, c.Env...)
+	labels := map[string]string{}
+	for key, value := range imageConfig["Labels"].(map[string]string) {
+		labels[key] = value
+	}
+	for key, value := range c.Labels {
+		labels[key] = value
+	}
+	_, bindings, _ := nat.ParsePortSpecs(c.Ports)
+	hostConfig := map[string]interface{}{"PortBindings": bindings, "Binds": c.Binds}
+	if c.CPUs != "" {
+		cpus, _ := strconv.ParseFloat(c.CPUs, 64)
+		hostConfig["NanoCpus"] = int64(cpus * 1e9)
+	}
+	if c.Memory != "" {
+		hostConfig["Memory"], _ = units.RAMInBytes(c.Memory)
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"Id": c.ID, "Name": "/" + c.Name, "Image": c.Image, "State": state,
+		"Config":          map[string]interface{}{"Image": c.Image, "Labels": labels, "Env": env},
+		"HostConfig":      hostConfig,
+		"NetworkSettings": map[string]interface{}{"Networks": c.networks()},
+	})
+}
+
+// networks returns the networks of a container with its address, the default bridge without any
+func (c *fakeContainer) networks() map[string]interface{} {
+	names := c.Networks
+	if len(names) == 0 {
+		names = []string{"bridge"}
+	}
+	networks := map[string]interface{}{}
+	for _, name := range names {
+		networks[name] = map[string]string{"IPAddress": c.IP}
+	}
+	return networks
+}
+
+// cli runs a docker command against the containers and returns its output and success
+func (e *fakeEngine) cli(args []string) (string, bool) {
+	e.mu.Lock()
+	e.commands = append(e.commands, args)
+	e.mu.Unlock()
+	if len(args) == 0 {
+		return "no command", false
+	}
+
+	switch args[0] {
+	case "ps":
+		for i, arg := range args {
+			if name, ok := strings.CutPrefix(arg, "name="); ok && i > 0 && args[i-1] == "--filter" {
+				if c, ok := e.container(name); ok {
+					return c.ID + "\n", true
+				}
+			}
+		}
+		return "", true
+	case "run":
+		var name, image string
+		labels := map[string]string{}
+		var config fakeContainer
+		for i := 1; i < len(args); i++ {
+			switch args[i] {
+			case "-d":
+			case "--name":
+				i++
+				name = args[i]
+			case "-l":
+				i++
+				key, value, _ := strings.Cut(args[i], "=")
+				labels[key] = value
+			case "-p":
+				i++
+				config.Ports = append(config.Ports, args[i])
+			case "-e":
+				i++
+				config.Env = append(config.Env, args[i])
+			case "-v":
+				i++
+				config.Binds = append(config.Binds, args[i])
+			case "--network":
+				i++
+				config.Networks = append(config.Networks, args[i])
+			case "--cpus":
+				i++
+				config.CPUs = args[i]
+			case "--memory":
+				i++
+				config.Memory = args[i]
+			default:
+				image = args[i]
+			}
+		}
+		if _, ok := e.container(name); ok {
+			return fmt.Sprintf("the container name %q is already in use", name), false
+		}
+		c := e.run(name, image, labels)
+		e.mu.Lock()
+		c.Env, c.Ports, c.Binds, c.Networks, c.CPUs, c.Memory = config.Env, config.Ports, config.Binds, config.Networks, config.CPUs, config.Memory
+		e.mu.Unlock()
+		return c.ID + "\n", true
+	case "exec":
+		if len(args) > 3 && args[1] == "turplecubes-proxy" && args[2] == "nginx" {
+			hook := e.Reload
+			if args[3] == "-t" {
+				hook = e.TestNginx
+			}
+			if hook == nil {
+				return "", true
+			}
+			return hook()
+		}
+		return "exec is not supported by the fake engine", false
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(args) < 2 {
+		return "missing container", false
+	}
+	c, ok := e.containers[args[1]]
+	if !ok {
+		return fmt.Sprintf("No such container: %s", args[1]), false
+	}
+	switch args[0] {
+	case "stop":
+		c.Status = "exited"
+	case "restart":
+		c.Status, c.Started = "running", time.Now()
+		e.emit("start", c)
+	case "rm":
+		delete(e.containers, args[1])
+	case "rename":
+		if _, taken := e.containers[args[2]]; taken {
+			return fmt.Sprintf("the container name %q is already in use", args[2]), false
+		}
+		delete(e.containers, args[1])
+		c.Name = args[2]
+		e.containers[args[2]] = c
+		e.emit("rename", c)
+	default:
+		return fmt.Sprintf("docker %s is not supported by the fake engine", args[0]), false
+	}
+	return args[1] + "\n", true
+}
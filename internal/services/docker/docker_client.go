@@ -0,0 +1,25 @@
+package docker
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/docker/docker/client"
+)
+
+var (
+	sharedClient    *client.Client
+	sharedClientErr error
+	sharedClientSet sync.Once
+)
+
+// Client returns the Docker client shared by the whole process, it is created on first use and never closed
+func Client() (*client.Client, error) {
+	sharedClientSet.Do(func() {
+		sharedClient, sharedClientErr = client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+		if sharedClientErr != nil {
+			sharedClientErr = fmt.Errorf("failed to create Docker client: %v", sharedClientErr)
+		}
+	})
+	return sharedClient, sharedClientErr
+}
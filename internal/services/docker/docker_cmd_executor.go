@@ -7,11 +7,14 @@ import (
 	"os/exec"
 	"strings"
 
-	"github.com/turplespace/portos/internal/models"
+	"github.com/turplespace/portos/internal/validation"
+	"github.com/turplespace/portos/pkg/models"
 )
 
-// StartContainer starts a new container
-func StartContainer(container models.Container) error {
+// StartContainer starts a new container.
+// Variables found in secretEnv are passed by name only, docker reads their value from its own
+// environment so that resolved secrets never appear on the command line.
+func StartContainer(container models.Container, secretEnv map[string]string) error {
 	// Check if the container already exists
 	cmdCheck := exec.Command("docker", "ps", "-a", "--filter", fmt.Sprintf("name=%s", container.Name), "--format", "{{.ID}}")
 	existingContainerID, err := cmdCheck.Output()
@@ -47,20 +50,19 @@ func StartContainer(container models.Container) error {
 
 	// Add environment variables
 	for _, env := range container.EnvironmentVars {
+		key, _, _ := strings.Cut(env, "=")
+		if _, ok := secretEnv[key]; ok {
+			args = append(args, "-e", key)
+			continue
+		}
 		args = append(args, "-e", env)
 	}
 
 	// Add volumes
 	for hostPath, containerPath := range container.Volumes {
-		if strings.Contains(hostPath, "[DEFAULT]") {
-			ex, err := os.Executable()
-			if err != nil {
-				panic(err)
-			}
-			fmt.Println(ex)
-			path := fmt.Sprintf("%s_volumes", ex)
-			fmt.Println(path)
-			hostPath = strings.Replace(hostPath, "[DEFAULT]", path, 1)
+		hostPath, err := VolumePath(hostPath)
+		if err != nil {
+			return err
 		}
 		args = append(args, "-v", fmt.Sprintf("%s:%s", hostPath, containerPath))
 	}
@@ -70,6 +72,11 @@ func StartContainer(container models.Container) error {
 		args = append(args, "-l", label)
 	}
 
+	// Add networks, given by their Docker name
+	for _, network := range container.Networks {
+		args = append(args, "--network", network)
+	}
+
 	// Add resource limits
 	if container.ResourceLimits.CPUs != "" {
 		args = append(args, "--cpus", container.ResourceLimits.CPUs)
@@ -83,6 +90,12 @@ func StartContainer(container models.Container) error {
 
 	// Execute command
 	cmdRun := exec.Command("docker", args...)
+	if len(secretEnv) > 0 {
+		cmdRun.Env = os.Environ()
+		for key, value := range secretEnv {
+			cmdRun.Env = append(cmdRun.Env, fmt.Sprintf("%s=%s", key, value))
+		}
+	}
 	output, err := cmdRun.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("failed to start container: %v\nOutput: %s", err, string(output))
@@ -92,6 +105,28 @@ func StartContainer(container models.Container) error {
 	return nil
 }
 
+// VolumePath returns the host path of a volume with [DEFAULT] replaced by the volume directory next to the executable.
+// Paths that cubes may not bind mount, see validation.HostPathAllowed, are an error.
+func VolumePath(hostPath string) (string, error) {
+	if !validation.HostPathAllowed(hostPath) {
+		return "", fmt.Errorf("host path %s is not allowed, it must be under [DEFAULT] or under a volume root of TURPLECUBES_VOLUME_ROOTS", hostPath)
+	}
+	return ExpandVolumePath(hostPath)
+}
+
+// ExpandVolumePath returns the host path of a volume with [DEFAULT] replaced by the volume directory next to the
+// executable, whether or not cubes may bind mount it. Use VolumePath for the paths that are mounted.
+func ExpandVolumePath(hostPath string) (string, error) {
+	if !strings.HasPrefix(hostPath, "[DEFAULT]") {
+		return hostPath, nil
+	}
+	ex, err := os.Executable()
+	if err != nil {
+		return "", fmt.Errorf("failed to get executable path: %v", err)
+	}
+	return strings.Replace(hostPath, "[DEFAULT]", fmt.Sprintf("%s_volumes", ex), 1), nil
+}
+
 // StopContainer stops a running container
 func StopContainer(containerName string) error {
 	cmd := exec.Command("docker", "stop", containerName)
@@ -104,6 +139,33 @@ func StopContainer(containerName string) error {
 	return nil
 }
 
+// RemoveContainer stops a container and removes it
+func RemoveContainer(containerName string) error {
+	if err := StopContainer(containerName); err != nil {
+		return err
+	}
+	cmd := exec.Command("docker", "rm", containerName)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to remove container: %v\nOutput: %s", err, string(output))
+	}
+
+	log.Printf("Container %s removed successfully", containerName)
+	return nil
+}
+
+// RenameContainer renames a container, its IP address does not change
+func RenameContainer(containerName string, newName string) error {
+	cmd := exec.Command("docker", "rename", containerName, newName)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to rename container: %v\nOutput: %s", err, string(output))
+	}
+
+	log.Printf("Container %s renamed to %s", containerName, newName)
+	return nil
+}
+
 // RestartContainer restarts a container
 func RestartContainer(containerName string) error {
 	cmd := exec.Command("docker", "restart", containerName)
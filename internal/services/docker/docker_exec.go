@@ -0,0 +1,100 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// ExecSession is a command running in a container with its stdin and output attached
+type ExecSession struct {
+	id   string
+	tty  bool
+	conn types.HijackedResponse
+}
+
+// StartExec runs a command in a running container, with a TTY the output is a single raw stream
+func StartExec(ctx context.Context, containerName string, cmd []string, tty bool) (*ExecSession, error) {
+	cli, err := Client()
+	if err != nil {
+		return nil, err
+	}
+
+	created, err := cli.ContainerExecCreate(ctx, containerName, container.ExecOptions{
+		Cmd:          cmd,
+		Tty:          tty,
+		AttachStdin:  true,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create exec in container %s: %v", containerName, err)
+	}
+
+	conn, err := cli.ContainerExecAttach(ctx, created.ID, container.ExecAttachOptions{Tty: tty})
+	if err != nil {
+		return nil, fmt.Errorf("failed to attach to exec in container %s: %v", containerName, err)
+	}
+
+	return &ExecSession{id: created.ID, tty: tty, conn: conn}, nil
+}
+
+// Write sends input to the stdin of the command
+func (s *ExecSession) Write(p []byte) (int, error) {
+	return s.conn.Conn.Write(p)
+}
+
+// CloseStdin closes the stdin of the command, the output can still be read
+func (s *ExecSession) CloseStdin() error {
+	return s.conn.CloseWrite()
+}
+
+// CopyOutput copies the output of the command until it ends, both streams go to stdout with a TTY
+func (s *ExecSession) CopyOutput(stdout io.Writer, stderr io.Writer) error {
+	var err error
+	if s.tty {
+		_, err = io.Copy(stdout, s.conn.Reader)
+	} else {
+		_, err = stdcopy.StdCopy(stdout, stderr, s.conn.Reader)
+	}
+	return err
+}
+
+// Resize changes the size of the TTY of the command
+func (s *ExecSession) Resize(ctx context.Context, cols uint, rows uint) error {
+	cli, err := Client()
+	if err != nil {
+		return err
+	}
+	return cli.ContainerExecResize(ctx, s.id, container.ResizeOptions{Width: cols, Height: rows})
+}
+
+// ExitCode waits briefly for the command to be reported as ended and returns its exit code
+func (s *ExecSession) ExitCode(ctx context.Context) (int, error) {
+	cli, err := Client()
+	if err != nil {
+		return 0, err
+	}
+
+	for i := 0; i < 20; i++ {
+		inspect, err := cli.ContainerExecInspect(ctx, s.id)
+		if err != nil {
+			return 0, fmt.Errorf("failed to inspect exec: %v", err)
+		}
+		if !inspect.Running {
+			return inspect.ExitCode, nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return 0, fmt.Errorf("exec %s is still running", s.id)
+}
+
+// Close detaches from the command, which ends when its stdin closes
+func (s *ExecSession) Close() {
+	s.conn.Close()
+}
@@ -1,20 +1,21 @@
 package docker
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
-	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
 )
 
 // Function to get the status of a Docker container by name
 func GetContainerStatus(containerName string) (string, error) {
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	cli, err := Client()
 	if err != nil {
-		return "", fmt.Errorf("failed to create Docker client: %v", err)
+		return "", err
 	}
 
 	// Inspect the container to get detailed information
@@ -29,11 +30,7 @@ func GetContainerStatus(containerName string) (string, error) {
 
 // GetContainersByLabel retrieves a list of containers with a specific label
 func GetContainersByLabel(labelKey, labelValue string) ([]types.Container, error) {
-	cli, err := client.NewClientWithOpts(
-		client.WithVersion("1.45"), // Set the API version to 1.45
-		client.FromEnv,
-		client.WithAPIVersionNegotiation(),
-	)
+	cli, err := Client()
 	if err != nil {
 		return nil, err
 	}
@@ -56,11 +53,7 @@ func GetContainersByLabel(labelKey, labelValue string) ([]types.Container, error
 
 // CountContainers counts the number of containers with a specific label
 func CountContainersByLabel(labelKey, labelValue string) (int, error) {
-	cli, err := client.NewClientWithOpts(
-		client.WithVersion("1.45"), // Set the API version to 1.45
-		client.FromEnv,
-		client.WithAPIVersionNegotiation(),
-	)
+	cli, err := Client()
 	if err != nil {
 		return 0, err
 	}
@@ -83,9 +76,9 @@ func CountContainersByLabel(labelKey, labelValue string) (int, error) {
 
 // Function to get the IP address of a Docker container by name
 func GetContainerIPAddress(containerName string) (string, error) {
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	cli, err := Client()
 	if err != nil {
-		return "", fmt.Errorf("failed to create Docker client: %v", err)
+		return "", err
 	}
 
 	// Inspect the container to get detailed information
@@ -103,3 +96,30 @@ func GetContainerIPAddress(containerName string) (string, error) {
 
 	return "", fmt.Errorf("no IP address found for container: %s", containerName)
 }
+
+// GetContainerLogs returns the last lines of the stdout and stderr of a container
+func GetContainerLogs(containerName string, tail string) (string, error) {
+	cli, err := Client()
+	if err != nil {
+		return "", err
+	}
+
+	reader, err := cli.ContainerLogs(context.Background(), containerName, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Timestamps: true,
+		Tail:       tail,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to get logs of container %s: %v", containerName, err)
+	}
+	defer reader.Close()
+
+	// Containers without a TTY multiplex stdout and stderr into a single stream
+	var logs bytes.Buffer
+	if _, err := stdcopy.StdCopy(&logs, &logs, reader); err != nil {
+		return "", fmt.Errorf("failed to read logs of container %s: %v", containerName, err)
+	}
+
+	return logs.String(), nil
+}
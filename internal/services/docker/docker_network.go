@@ -0,0 +1,87 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/errdefs"
+)
+
+// NetworkName returns the Docker name of a workspace network, scoped by workspace ID so that
+// workspaces can declare networks with the same name and renaming a workspace keeps them
+func NetworkName(workspaceID int, name string) string {
+	return fmt.Sprintf("%s-%d-%s", ServiceName, workspaceID, name)
+}
+
+// EnsureNetwork creates the Docker network of a workspace network unless it exists, an empty driver is bridge
+func EnsureNetwork(workspaceID int, name string, driver string) error {
+	cli, err := Client()
+	if err != nil {
+		return err
+	}
+
+	dockerName := NetworkName(workspaceID, name)
+	nameFilter := filters.NewArgs(filters.Arg("name", dockerName))
+	existing, err := cli.NetworkList(context.Background(), network.ListOptions{Filters: nameFilter})
+	if err != nil {
+		return fmt.Errorf("failed to list networks: %v", err)
+	}
+	// The name filter matches substrings
+	for _, summary := range existing {
+		if summary.Name == dockerName {
+			return nil
+		}
+	}
+
+	_, err = cli.NetworkCreate(context.Background(), dockerName, network.CreateOptions{
+		Driver: driver,
+		Labels: map[string]string{
+			LabelService:     ServiceName,
+			LabelWorkspaceID: strconv.Itoa(workspaceID),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create network %s: %v", dockerName, err)
+	}
+	return nil
+}
+
+// RemoveNetwork removes the Docker network of a workspace network, a missing network is not an error
+func RemoveNetwork(workspaceID int, name string) error {
+	cli, err := Client()
+	if err != nil {
+		return err
+	}
+
+	dockerName := NetworkName(workspaceID, name)
+	if err := cli.NetworkRemove(context.Background(), dockerName); err != nil && !errdefs.IsNotFound(err) {
+		return fmt.Errorf("failed to remove network %s: %v", dockerName, err)
+	}
+	return nil
+}
+
+// RemoveWorkspaceNetworks removes every Docker network created for a workspace
+func RemoveWorkspaceNetworks(workspaceID int) error {
+	cli, err := Client()
+	if err != nil {
+		return err
+	}
+
+	labelFilter := filters.NewArgs(
+		filters.Arg("label", LabelService+"="+ServiceName),
+		filters.Arg("label", fmt.Sprintf("%s=%d", LabelWorkspaceID, workspaceID)),
+	)
+	networks, err := cli.NetworkList(context.Background(), network.ListOptions{Filters: labelFilter})
+	if err != nil {
+		return fmt.Errorf("failed to list networks: %v", err)
+	}
+	for _, summary := range networks {
+		if err := cli.NetworkRemove(context.Background(), summary.ID); err != nil && !errdefs.IsNotFound(err) {
+			return fmt.Errorf("failed to remove network %s: %v", summary.Name, err)
+		}
+	}
+	return nil
+}
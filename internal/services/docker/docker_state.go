@@ -0,0 +1,274 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/errdefs"
+	"github.com/docker/go-connections/nat"
+)
+
+// Labels set on every container started for a cube, user labels with the same keys are replaced
+const (
+	LabelService     = "service"
+	LabelWorkspaceID = "workspace_id"
+	LabelCubeID      = "cube_id"
+	LabelReplica     = "replica" // Number of the replica, only set on the containers of cubes with replicas
+
+	ServiceName = "turplespace"
+)
+
+// ContainerState is the runtime state of a container started for a cube
+type ContainerState struct {
+	ID        string            `json:"id"`
+	Name      string            `json:"name"`
+	State     string            `json:"state"` // created, running, paused, restarting, removing, exited or dead
+	IPAddress string            `json:"ip_address"`
+	Labels    map[string]string `json:"labels"`
+}
+
+// ManagedLabels returns the labels of a cube with the labels identifying its container appended,
+// replica is the number of the container among the replicas of the cube or 0 without replicas
+func ManagedLabels(labels []string, workspaceID int, cubeID int, replica int) []string {
+	managed := []string{
+		LabelService + "=" + ServiceName,
+		LabelWorkspaceID + "=" + strconv.Itoa(workspaceID),
+	}
+	if cubeID != 0 {
+		managed = append(managed, LabelCubeID+"="+strconv.Itoa(cubeID))
+	}
+	if replica != 0 {
+		managed = append(managed, LabelReplica+"="+strconv.Itoa(replica))
+	}
+
+	result := make([]string, 0, len(labels)+len(managed))
+	for _, label := range labels {
+		key, _, _ := strings.Cut(label, "=")
+		if key != LabelService && key != LabelWorkspaceID && key != LabelCubeID && key != LabelReplica {
+			result = append(result, label)
+		}
+	}
+	return append(result, managed...)
+}
+
+/*
+ListManagedContainers returns the state of the containers started for cubes by container name,
+running or not, with a single call to the daemon. A workspace ID of 0 lists every workspace.
+*/
+func ListManagedContainers(workspaceID int) (map[string]ContainerState, error) {
+	cli, err := Client()
+	if err != nil {
+		return nil, err
+	}
+
+	labelFilter := filters.NewArgs()
+	labelFilter.Add("label", LabelService+"="+ServiceName)
+	if workspaceID != 0 {
+		labelFilter.Add("label", fmt.Sprintf("%s=%d", LabelWorkspaceID, workspaceID))
+	}
+
+	containers, err := cli.ContainerList(context.Background(), container.ListOptions{
+		All:     true,
+		Filters: labelFilter,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %v", err)
+	}
+
+	states := make(map[string]ContainerState, len(containers))
+	for _, c := range containers {
+		state := ContainerState{
+			ID:     c.ID,
+			State:  c.State,
+			Labels: c.Labels,
+		}
+		if c.NetworkSettings != nil {
+			for _, network := range c.NetworkSettings.Networks {
+				if network != nil && network.IPAddress != "" {
+					state.IPAddress = network.IPAddress
+					break
+				}
+			}
+		}
+		for _, name := range c.Names {
+			state.Name = strings.TrimPrefix(name, "/")
+			states[state.Name] = state
+		}
+	}
+	return states, nil
+}
+
+// ContainerEvents streams the given actions, such as start, of the containers started for cubes until ctx is done
+func ContainerEvents(ctx context.Context, actions ...events.Action) (<-chan events.Message, <-chan error) {
+	cli, err := Client()
+	if err != nil {
+		errs := make(chan error, 1)
+		errs <- err
+		return nil, errs
+	}
+
+	eventFilter := filters.NewArgs()
+	eventFilter.Add("type", string(events.ContainerEventType))
+	eventFilter.Add("label", LabelService+"="+ServiceName)
+	for _, action := range actions {
+		eventFilter.Add("event", string(action))
+	}
+	return cli.Events(ctx, events.ListOptions{Filters: eventFilter})
+}
+
+/*
+ContainerConfig is the configuration a container was created with. The environment and labels
+include those of its image, which are given apart so that callers can tell what the container set.
+*/
+type ContainerConfig struct {
+	Image        string              // Reference the container was created from
+	Env          map[string]string   // Every environment variable of the container
+	ImageEnv     map[string]string   // Environment variables of the image
+	Labels       map[string]string   // Every label of the container
+	ImageLabels  map[string]string   // Labels of the image
+	PortBindings map[string][]string // Host bindings as ip:port, by container port/protocol
+	Binds        []string            // Volumes as host_path:container_path
+	NanoCPUs     int64
+	Memory       int64 // Bytes
+	Networks     []string
+}
+
+// InspectConfig returns the configuration of a container, nil when there is no such container
+func InspectConfig(name string) (*ContainerConfig, error) {
+	cli, err := Client()
+	if err != nil {
+		return nil, err
+	}
+
+	inspected, err := cli.ContainerInspect(context.Background(), name)
+	if errdefs.IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to inspect container %s: %v", name, err)
+	}
+
+	config := &ContainerConfig{Env: map[string]string{}, ImageEnv: map[string]string{}, ImageLabels: map[string]string{}, PortBindings: map[string][]string{}}
+	if inspected.Config != nil {
+		config.Image = inspected.Config.Image
+		config.Env = envMap(inspected.Config.Env)
+		config.Labels = inspected.Config.Labels
+	}
+	if inspected.HostConfig != nil {
+		for port, bindings := range inspected.HostConfig.PortBindings {
+			for _, binding := range bindings {
+				config.PortBindings[string(port)] = append(config.PortBindings[string(port)], binding.HostIP+":"+binding.HostPort)
+			}
+		}
+		config.Binds = inspected.HostConfig.Binds
+		config.NanoCPUs = inspected.HostConfig.NanoCPUs
+		config.Memory = inspected.HostConfig.Memory
+	}
+	if inspected.NetworkSettings != nil {
+		for network := range inspected.NetworkSettings.Networks {
+			config.Networks = append(config.Networks, network)
+		}
+	}
+
+	// The image may be gone since the container was created, its defaults are then unknown
+	image, _, err := cli.ImageInspectWithRaw(context.Background(), inspected.Image)
+	if err != nil && !errdefs.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to inspect image of container %s: %v", name, err)
+	}
+	if err == nil && image.Config != nil {
+		config.ImageEnv = envMap(image.Config.Env)
+		config.ImageLabels = image.Config.Labels
+	}
+	return config, nil
+}
+
+// PortBindings returns the host bindings of port mappings like ContainerConfig.PortBindings
+func PortBindings(ports []string) (map[string][]string, error) {
+	_, parsed, err := nat.ParsePortSpecs(ports)
+	if err != nil {
+		return nil, err
+	}
+	bindings := make(map[string][]string, len(parsed))
+	for port, portBindings := range parsed {
+		for _, binding := range portBindings {
+			bindings[string(port)] = append(bindings[string(port)], binding.HostIP+":"+binding.HostPort)
+		}
+	}
+	return bindings, nil
+}
+
+func envMap(env []string) map[string]string {
+	values := make(map[string]string, len(env))
+	for _, variable := range env {
+		key, value, _ := strings.Cut(variable, "=")
+		values[key] = value
+	}
+	return values
+}
+
+/*
+WaitHealthy waits until a container is ready to take traffic and returns its IP address. A
+container with a health check must report healthy, one without must keep running for settle.
+It fails when the container exits, turns unhealthy or is not ready within timeout.
+*/
+func WaitHealthy(name string, settle time.Duration, timeout time.Duration) (string, error) {
+	cli, err := Client()
+	if err != nil {
+		return "", err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		inspected, err := cli.ContainerInspect(context.Background(), name)
+		if err != nil {
+			return "", fmt.Errorf("failed to inspect container %s: %v", name, err)
+		}
+		state := inspected.State
+		if state == nil || !state.Running {
+			status, exitCode := "unknown", 0
+			if state != nil {
+				status, exitCode = state.Status, state.ExitCode
+			}
+			if status != "created" && status != "restarting" {
+				return "", fmt.Errorf("container %s is %s with exit code %d", name, status, exitCode)
+			}
+		} else {
+			ready := false
+			if state.Health != nil {
+				if state.Health.Status == "unhealthy" {
+					return "", fmt.Errorf("container %s is unhealthy", name)
+				}
+				ready = state.Health.Status == "healthy"
+			} else if started, err := time.Parse(time.RFC3339Nano, state.StartedAt); err == nil {
+				ready = time.Since(started) >= settle
+			}
+			if ip := inspectedIPAddress(inspected); ready && ip != "" {
+				return ip, nil
+			}
+		}
+
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("container %s is not ready after %s", name, timeout)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+func inspectedIPAddress(inspected types.ContainerJSON) string {
+	if inspected.NetworkSettings == nil {
+		return ""
+	}
+	for _, network := range inspected.NetworkSettings.Networks {
+		if network != nil && network.IPAddress != "" {
+			return network.IPAddress
+		}
+	}
+	return ""
+}
@@ -0,0 +1,207 @@
+package docker
+
+import (
+	"encoding/json"
+	"log"
+	"maps"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/network"
+)
+
+// TestMain points the shared client at a fake Docker engine
+func TestMain(m *testing.M) {
+	server := httptest.NewUnstartedServer(engine)
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			engine.mu.Lock()
+			engine.connections++
+			engine.mu.Unlock()
+		}
+	}
+	server.Start()
+	if err := os.Setenv("DOCKER_HOST", "tcp://"+strings.TrimPrefix(server.URL, "http://")); err != nil {
+		log.Fatal(err)
+	}
+
+	code := m.Run()
+	server.Close()
+	os.Exit(code)
+}
+
+// fakeEngine answers the container list with containers and records the query of every list
+type fakeEngine struct {
+	mu          sync.Mutex
+	containers  []types.Container
+	fail        bool
+	lists       []url.Values
+	connections int
+}
+
+var engine = &fakeEngine{}
+
+func (e *fakeEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("API-Version", "1.45")
+	w.Header().Set("Content-Type", "application/json")
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/_ping"):
+		w.Write([]byte("OK"))
+	case strings.HasSuffix(r.URL.Path, "/containers/json"):
+		e.lists = append(e.lists, r.URL.Query())
+		if e.fail {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"message":"engine is down"}`))
+			return
+		}
+		json.NewEncoder(w).Encode(e.containers)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message":"not supported by the fake engine"}`))
+	}
+}
+
+// reset gives the engine containers and forgets the recorded lists
+func (e *fakeEngine) reset(t *testing.T, containers ...types.Container) {
+	t.Helper()
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.containers, e.fail, e.lists = containers, false, nil
+}
+
+// listed returns the queries of the container lists since the last reset
+func (e *fakeEngine) listed() []url.Values {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return slices.Clone(e.lists)
+}
+
+// labelFilters returns the label filters of a container list query, sorted
+func labelFilters(t *testing.T, query url.Values) []string {
+	t.Helper()
+	var filters map[string]map[string]bool
+	if err := json.Unmarshal([]byte(query.Get("filters")), &filters); err != nil {
+		t.Fatalf("filters %q: %v", query.Get("filters"), err)
+	}
+	return slices.Sorted(maps.Keys(filters["label"]))
+}
+
+func TestListManagedContainers(t *testing.T) {
+	web := map[string]string{LabelService: ServiceName, LabelWorkspaceID: "1", LabelCubeID: "1"}
+	api1 := map[string]string{LabelService: ServiceName, LabelWorkspaceID: "1", LabelCubeID: "2", LabelReplica: "1"}
+	api2 := map[string]string{LabelService: ServiceName, LabelWorkspaceID: "1", LabelCubeID: "2", LabelReplica: "2"}
+	engine.reset(t,
+		types.Container{ID: "a1", Names: []string{"/web"}, State: "running", Labels: web, NetworkSettings: &types.SummaryNetworkSettings{
+			Networks: map[string]*network.EndpointSettings{"bridge": {IPAddress: "172.17.0.2"}},
+		}},
+		types.Container{ID: "b2", Names: []string{"/api-1"}, State: "exited", Labels: api1},
+		types.Container{ID: "c3", Names: []string{"/api-2"}, State: "running", Labels: api2, NetworkSettings: &types.SummaryNetworkSettings{
+			Networks: map[string]*network.EndpointSettings{"none": {}, "turplespace-1-backend": {IPAddress: "10.0.0.3"}},
+		}},
+	)
+
+	states, err := ListManagedContainers(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]ContainerState{
+		"web":   {ID: "a1", Name: "web", State: "running", IPAddress: "172.17.0.2", Labels: web},
+		"api-1": {ID: "b2", Name: "api-1", State: "exited", Labels: api1},
+		"api-2": {ID: "c3", Name: "api-2", State: "running", IPAddress: "10.0.0.3", Labels: api2},
+	}
+	if !maps.EqualFunc(states, want, func(a, b ContainerState) bool {
+		return a.ID == b.ID && a.Name == b.Name && a.State == b.State && a.IPAddress == b.IPAddress && maps.Equal(a.Labels, b.Labels)
+	}) {
+		t.Errorf("states = %+v, want %+v", states, want)
+	}
+
+	// One list of every container of the workspace, stopped ones included
+	lists := engine.listed()
+	if len(lists) != 1 {
+		t.Fatalf("%d container lists, want 1", len(lists))
+	}
+	if lists[0].Get("all") != "1" {
+		t.Errorf("all = %q, want the stopped containers listed", lists[0].Get("all"))
+	}
+	if labels := labelFilters(t, lists[0]); !slices.Equal(labels, []string{"service=turplespace", "workspace_id=1"}) {
+		t.Errorf("label filters = %v, want the service and the workspace", labels)
+	}
+
+	// Every workspace is listed without a workspace filter
+	engine.reset(t)
+	if states, err := ListManagedContainers(0); err != nil || len(states) != 0 {
+		t.Fatalf("states of every workspace = %v, %v, want none", states, err)
+	}
+	if lists := engine.listed(); len(lists) != 1 || !slices.Equal(labelFilters(t, lists[0]), []string{"service=turplespace"}) {
+		t.Errorf("lists of every workspace = %v, want one filtered on the service only", lists)
+	}
+}
+
+func TestListManagedContainersFails(t *testing.T) {
+	engine.reset(t)
+	engine.mu.Lock()
+	engine.fail = true
+	engine.mu.Unlock()
+	if states, err := ListManagedContainers(1); err == nil || !strings.Contains(err.Error(), "engine is down") {
+		t.Errorf("ListManagedContainers = %v, %v, want the error of the engine", states, err)
+	}
+}
+
+func TestClientIsShared(t *testing.T) {
+	first, err := Client()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second, err := Client(); err != nil || second != first {
+		t.Fatalf("second Client() = %p, %v, want the shared client %p", second, err, first)
+	}
+
+	// The lists reuse the connection of the shared client
+	engine.reset(t)
+	if _, err := ListManagedContainers(1); err != nil {
+		t.Fatal(err)
+	}
+	engine.mu.Lock()
+	connections := engine.connections
+	engine.mu.Unlock()
+	for range 5 {
+		if _, err := ListManagedContainers(1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	engine.mu.Lock()
+	defer engine.mu.Unlock()
+	if engine.connections != connections {
+		t.Errorf("%d new connections for 5 lists, want the connection reused", engine.connections-connections)
+	}
+	if len(engine.lists) != 6 {
+		t.Errorf("%d container lists, want 6", len(engine.lists))
+	}
+}
+
+func TestManagedLabels(t *testing.T) {
+	for _, test := range []struct {
+		labels  []string
+		cube    int
+		replica int
+		want    []string
+	}{
+		{nil, 0, 0, []string{"service=turplespace", "workspace_id=3"}},
+		{[]string{"team=web", "service=mine"}, 7, 0, []string{"team=web", "service=turplespace", "workspace_id=3", "cube_id=7"}},
+		{[]string{"cube_id=1", "replica=9"}, 7, 2, []string{"service=turplespace", "workspace_id=3", "cube_id=7", "replica=2"}},
+	} {
+		if got := ManagedLabels(test.labels, 3, test.cube, test.replica); !slices.Equal(got, test.want) {
+			t.Errorf("ManagedLabels(%v, 3, %d, %d) = %v, want %v", test.labels, test.cube, test.replica, got, test.want)
+		}
+	}
+}
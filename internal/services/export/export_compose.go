@@ -0,0 +1,115 @@
+package export
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/turplespace/portos/internal/services/secrets"
+)
+
+type composeProject struct {
+	Name     string                    `yaml:"name"`
+	Services map[string]composeService `yaml:"services"`
+	Networks map[string]composeNetwork `yaml:"networks,omitempty"`
+}
+
+type composeService struct {
+	Image       string         `yaml:"image"`
+	Ports       []string       `yaml:"ports,omitempty"`
+	Environment []string       `yaml:"environment,omitempty"`
+	Volumes     []string       `yaml:"volumes,omitempty"`
+	Labels      []string       `yaml:"labels,omitempty"`
+	DependsOn   []string       `yaml:"depends_on,omitempty"`
+	Networks    []string       `yaml:"networks,omitempty"`
+	Deploy      *composeDeploy `yaml:"deploy,omitempty"`
+}
+
+type composeDeploy struct {
+	Replicas  int               `yaml:"replicas,omitempty"`
+	Resources *composeResources `yaml:"resources,omitempty"`
+}
+
+type composeResources struct {
+	Limits composeLimits `yaml:"limits"`
+}
+
+type composeLimits struct {
+	CPUs   string `yaml:"cpus,omitempty"`
+	Memory string `yaml:"memory,omitempty"`
+}
+
+type composeNetwork struct {
+	Driver string `yaml:"driver,omitempty"`
+}
+
+/*
+composeFile returns the workspace as a compose project with a service per cube. Compose
+interpolates $ in values, so values are escaped and secret references become ${NAME}
+references to the environment of docker compose.
+*/
+func composeFile(w *workspace) composeProject {
+	project := composeProject{Name: dnsName(w.name), Services: make(map[string]composeService, len(w.cubes))}
+	for _, c := range w.cubes {
+		service := composeService{
+			Image:     escape(c.Image),
+			Ports:     c.Ports,
+			Labels:    escapeAll(c.Labels),
+			DependsOn: c.DependsOn,
+			Networks:  c.Networks,
+		}
+		for _, env := range c.EnvironmentVars {
+			service.Environment = append(service.Environment, secrets.ReplaceReferences(env, escape, func(name string) string {
+				return "${" + name + "}"
+			}))
+		}
+		for _, hostPath := range sortedVolumes(c.Volumes) {
+			service.Volumes = append(service.Volumes, escape(hostPath)+":"+escape(c.Volumes[hostPath]))
+		}
+		if c.ResourceLimits.CPUs != "" || c.ResourceLimits.Memory != "" {
+			service.Deploy = &composeDeploy{Resources: &composeResources{Limits: composeLimits{
+				CPUs:   c.ResourceLimits.CPUs,
+				Memory: c.ResourceLimits.Memory,
+			}}}
+		}
+		if c.Replicas > 1 {
+			if service.Deploy == nil {
+				service.Deploy = &composeDeploy{}
+			}
+			service.Deploy.Replicas = c.Replicas
+		}
+		project.Services[c.Name] = service
+	}
+
+	if len(w.networks) > 0 {
+		project.Networks = make(map[string]composeNetwork, len(w.networks))
+		for _, network := range w.networks {
+			project.Networks[network.Name] = composeNetwork{Driver: network.Driver}
+		}
+	}
+	return project
+}
+
+func composeHeader(w *workspace) []string {
+	header := []string{fmt.Sprintf("Workspace %s exported by TurpleCubes as a docker-compose file", w.name)}
+	if len(w.secrets) > 0 {
+		header = append(header, fmt.Sprintf("Secrets are not exported, set %s in the environment of docker compose", strings.Join(w.secrets, ", ")))
+	}
+	for _, c := range w.cubes {
+		for _, proxy := range c.proxies {
+			header = append(header, fmt.Sprintf("Proxy %s forwards to %s:%d", proxy.Domain, c.Name, proxy.Port))
+		}
+	}
+	return header
+}
+
+func escape(value string) string {
+	return strings.ReplaceAll(value, "$", "$$")
+}
+
+func escapeAll(values []string) []string {
+	escaped := make([]string, len(values))
+	for i, value := range values {
+		escaped[i] = escape(value)
+	}
+	return escaped
+}
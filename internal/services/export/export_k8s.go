@@ -0,0 +1,334 @@
+package export
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/docker/go-units"
+	"github.com/turplespace/portos/internal/services/secrets"
+)
+
+// Kubernetes objects, with only the fields the export sets
+
+type k8sMeta struct {
+	Name        string            `yaml:"name"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+type k8sObject struct {
+	APIVersion string      `yaml:"apiVersion"`
+	Kind       string      `yaml:"kind"`
+	Metadata   k8sMeta     `yaml:"metadata"`
+	Spec       interface{} `yaml:"spec"`
+}
+
+type k8sDeploymentSpec struct {
+	Replicas int                `yaml:"replicas"`
+	Selector k8sSelector        `yaml:"selector"`
+	Template k8sPodTemplateSpec `yaml:"template"`
+}
+
+type k8sSelector struct {
+	MatchLabels map[string]string `yaml:"matchLabels"`
+}
+
+type k8sPodTemplateSpec struct {
+	Metadata k8sPodMeta `yaml:"metadata"`
+	Spec     k8sPodSpec `yaml:"spec"`
+}
+
+type k8sPodMeta struct {
+	Labels map[string]string `yaml:"labels"`
+}
+
+type k8sPodSpec struct {
+	Containers []k8sContainer `yaml:"containers"`
+	Volumes    []k8sVolume    `yaml:"volumes,omitempty"`
+}
+
+type k8sContainer struct {
+	Name         string           `yaml:"name"`
+	Image        string           `yaml:"image"`
+	Ports        []k8sPort        `yaml:"ports,omitempty"`
+	Env          []k8sEnv         `yaml:"env,omitempty"`
+	Resources    *k8sResources    `yaml:"resources,omitempty"`
+	VolumeMounts []k8sVolumeMount `yaml:"volumeMounts,omitempty"`
+}
+
+type k8sPort struct {
+	ContainerPort int    `yaml:"containerPort"`
+	Protocol      string `yaml:"protocol"`
+}
+
+type k8sEnv struct {
+	Name      string        `yaml:"name"`
+	Value     string        `yaml:"value,omitempty"`
+	ValueFrom *k8sEnvSource `yaml:"valueFrom,omitempty"`
+}
+
+type k8sEnvSource struct {
+	SecretKeyRef k8sSecretKeyRef `yaml:"secretKeyRef"`
+}
+
+type k8sSecretKeyRef struct {
+	Name string `yaml:"name"`
+	Key  string `yaml:"key"`
+}
+
+type k8sResources struct {
+	Limits map[string]string `yaml:"limits"`
+}
+
+type k8sVolumeMount struct {
+	Name      string `yaml:"name"`
+	MountPath string `yaml:"mountPath"`
+}
+
+type k8sVolume struct {
+	Name     string      `yaml:"name"`
+	HostPath k8sHostPath `yaml:"hostPath"`
+}
+
+type k8sHostPath struct {
+	Path string `yaml:"path"`
+}
+
+type k8sServiceSpec struct {
+	Selector map[string]string `yaml:"selector"`
+	Ports    []k8sServicePort  `yaml:"ports"`
+}
+
+type k8sServicePort struct {
+	Name       string `yaml:"name"`
+	Port       int    `yaml:"port"`
+	TargetPort int    `yaml:"targetPort"`
+	Protocol   string `yaml:"protocol"`
+}
+
+type k8sIngressSpec struct {
+	Rules []k8sIngressRule `yaml:"rules"`
+}
+
+type k8sIngressRule struct {
+	Host string         `yaml:"host"`
+	HTTP k8sIngressHTTP `yaml:"http"`
+}
+
+type k8sIngressHTTP struct {
+	Paths []k8sIngressPath `yaml:"paths"`
+}
+
+type k8sIngressPath struct {
+	Path     string            `yaml:"path"`
+	PathType string            `yaml:"pathType"`
+	Backend  k8sIngressBackend `yaml:"backend"`
+}
+
+type k8sIngressBackend struct {
+	Service k8sIngressService `yaml:"service"`
+}
+
+type k8sIngressService struct {
+	Name string         `yaml:"name"`
+	Port k8sIngressPort `yaml:"port"`
+}
+
+type k8sIngressPort struct {
+	Number int `yaml:"number"`
+}
+
+/*
+kubernetesManifests returns a Deployment per cube, a Service for the ports it publishes or
+proxies, and an Ingress for its proxies. Volumes are host paths of the server, networks and
+dependencies have no equivalent since every pod can reach every Service.
+*/
+func kubernetesManifests(w *workspace) []interface{} {
+	partOf := dnsName(w.name)
+	var manifests []interface{}
+	for _, c := range w.cubes {
+		name := dnsName(c.Name)
+		selector := map[string]string{"app.kubernetes.io/name": name}
+		labels := map[string]string{"app.kubernetes.io/name": name, "app.kubernetes.io/part-of": partOf}
+		ports := containerPorts(c)
+
+		container := k8sContainer{Name: name, Image: c.Image, Env: kubernetesEnv(c.EnvironmentVars, secretName(w))}
+		for _, port := range ports {
+			container.Ports = append(container.Ports, k8sPort{ContainerPort: port.Port, Protocol: port.Protocol})
+		}
+		if c.ResourceLimits.CPUs != "" || c.ResourceLimits.Memory != "" {
+			container.Resources = &k8sResources{Limits: map[string]string{}}
+			if c.ResourceLimits.CPUs != "" {
+				container.Resources.Limits["cpu"] = c.ResourceLimits.CPUs
+			}
+			if c.ResourceLimits.Memory != "" {
+				container.Resources.Limits["memory"] = quantity(c.ResourceLimits.Memory)
+			}
+		}
+		pod := k8sPodSpec{}
+		for i, hostPath := range sortedVolumes(c.Volumes) {
+			volume := fmt.Sprintf("volume-%d", i)
+			container.VolumeMounts = append(container.VolumeMounts, k8sVolumeMount{Name: volume, MountPath: c.Volumes[hostPath]})
+			pod.Volumes = append(pod.Volumes, k8sVolume{Name: volume, HostPath: k8sHostPath{Path: hostPath}})
+		}
+		pod.Containers = []k8sContainer{container}
+
+		meta := k8sMeta{Name: name, Labels: labels}
+		if len(c.Labels) > 0 {
+			// Docker labels rarely make valid Kubernetes labels, annotations take any value
+			meta.Annotations = make(map[string]string, len(c.Labels))
+			for _, label := range c.Labels {
+				key, value, _ := strings.Cut(label, "=")
+				meta.Annotations[key] = value
+			}
+		}
+		manifests = append(manifests, k8sObject{
+			APIVersion: "apps/v1",
+			Kind:       "Deployment",
+			Metadata:   meta,
+			Spec: k8sDeploymentSpec{
+				Replicas: c.ReplicaCount(),
+				Selector: k8sSelector{MatchLabels: selector},
+				Template: k8sPodTemplateSpec{Metadata: k8sPodMeta{Labels: labels}, Spec: pod},
+			},
+		})
+
+		if len(ports) == 0 {
+			continue
+		}
+		service := k8sServiceSpec{Selector: selector}
+		for _, port := range ports {
+			service.Ports = append(service.Ports, k8sServicePort{
+				Name:       fmt.Sprintf("%s-%d", strings.ToLower(port.Protocol), port.Port),
+				Port:       port.Port,
+				TargetPort: port.Port,
+				Protocol:   port.Protocol,
+			})
+		}
+		manifests = append(manifests, k8sObject{APIVersion: "v1", Kind: "Service", Metadata: k8sMeta{Name: name, Labels: labels}, Spec: service})
+
+		if len(c.proxies) == 0 {
+			continue
+		}
+		ingress := k8sIngressSpec{}
+		for _, proxy := range c.proxies {
+			ingress.Rules = append(ingress.Rules, k8sIngressRule{
+				Host: proxy.Domain,
+				HTTP: k8sIngressHTTP{Paths: []k8sIngressPath{{
+					Path:     "/",
+					PathType: "Prefix",
+					Backend:  k8sIngressBackend{Service: k8sIngressService{Name: name, Port: k8sIngressPort{Number: proxy.Port}}},
+				}}},
+			})
+		}
+		manifests = append(manifests, k8sObject{APIVersion: "networking.k8s.io/v1", Kind: "Ingress", Metadata: k8sMeta{Name: name, Labels: labels}, Spec: ingress})
+	}
+	return manifests
+}
+
+func kubernetesHeader(w *workspace) []string {
+	header := []string{fmt.Sprintf("Workspace %s exported by TurpleCubes as Kubernetes manifests", w.name)}
+	if len(w.secrets) > 0 {
+		header = append(header, fmt.Sprintf("Secrets are not exported, create the Secret %s with the keys %s", secretName(w), strings.Join(w.secrets, ", ")))
+	}
+	for _, c := range w.cubes {
+		if len(c.Volumes) > 0 {
+			header = append(header, "Volumes are host paths of the TurpleCubes server, replace them with persistent volume claims")
+			break
+		}
+	}
+	return header
+}
+
+// secretName is the name of the Kubernetes Secret holding the secrets of the workspace
+func secretName(w *workspace) string {
+	return dnsName(w.name) + "-secrets"
+}
+
+type k8sContainerPort struct {
+	Port     int
+	Protocol string
+}
+
+// containerPorts returns the container ports of the port mappings of a cube and of its proxies, without duplicates
+func containerPorts(c cube) []k8sContainerPort {
+	var ports []k8sContainerPort
+	seen := make(map[k8sContainerPort]bool)
+	add := func(port k8sContainerPort) {
+		if !seen[port] {
+			seen[port] = true
+			ports = append(ports, port)
+		}
+	}
+
+	for _, mapping := range c.Ports {
+		mapping, protocol, _ := strings.Cut(mapping, "/")
+		if protocol == "" {
+			protocol = "tcp"
+		}
+		target := mapping[strings.LastIndex(mapping, ":")+1:]
+		first, last, isRange := strings.Cut(target, "-")
+		if !isRange {
+			last = first
+		}
+		start, err := strconv.Atoi(first)
+		if err != nil {
+			continue
+		}
+		end, err := strconv.Atoi(last)
+		if err != nil {
+			continue
+		}
+		for port := start; port <= end; port++ {
+			add(k8sContainerPort{Port: port, Protocol: strings.ToUpper(protocol)})
+		}
+	}
+	for _, proxy := range c.proxies {
+		add(k8sContainerPort{Port: proxy.Port, Protocol: "TCP"})
+	}
+	return ports
+}
+
+/*
+kubernetesEnv converts environment variables, a variable that is a secret reference reads the key
+of the workspace Secret. References inside a longer value become $(NAME) references to a variable
+read from the Secret first, which Kubernetes expands.
+*/
+func kubernetesEnv(envVars []string, secret string) []k8sEnv {
+	var env, fromSecrets []k8sEnv
+	added := make(map[string]bool)
+	for _, variable := range envVars {
+		key, value, _ := strings.Cut(variable, "=")
+		if refs := secrets.References([]string{value}); len(refs) == 1 && value == "${secret:"+refs[0]+"}" {
+			env = append(env, k8sEnv{Name: key, ValueFrom: &k8sEnvSource{SecretKeyRef: k8sSecretKeyRef{Name: secret, Key: refs[0]}}})
+			continue
+		}
+		value = secrets.ReplaceReferences(value, func(text string) string { return text }, func(name string) string {
+			if !added[name] {
+				added[name] = true
+				fromSecrets = append(fromSecrets, k8sEnv{Name: name, ValueFrom: &k8sEnvSource{SecretKeyRef: k8sSecretKeyRef{Name: secret, Key: name}}})
+			}
+			return "$(" + name + ")"
+		})
+		env = append(env, k8sEnv{Name: key, Value: value})
+	}
+	return append(fromSecrets, env...)
+}
+
+// quantity converts a Docker memory size such as 512m into a Kubernetes quantity such as 512Mi
+func quantity(memory string) string {
+	size, err := units.RAMInBytes(memory)
+	if err != nil {
+		return memory
+	}
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"Gi", units.GiB}, {"Mi", units.MiB}, {"Ki", units.KiB}} {
+		if size%unit.size == 0 {
+			return fmt.Sprintf("%d%s", size/unit.size, unit.suffix)
+		}
+	}
+	return strconv.FormatInt(size, 10)
+}
@@ -0,0 +1,140 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/internal/services/deploy"
+	"github.com/turplespace/portos/internal/services/docker"
+	"github.com/turplespace/portos/internal/services/secrets"
+	"github.com/turplespace/portos/pkg/models"
+	"gopkg.in/yaml.v3"
+)
+
+// Export formats
+const (
+	FormatCompose    = "compose"
+	FormatKubernetes = "k8s"
+)
+
+var invalidNameChars = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// workspace is a workspace spec rendered as its cubes are deployed
+type workspace struct {
+	name     string
+	networks []models.NetworkSpec
+	cubes    []cube
+	secrets  []string // Secrets referenced by the cubes, their values are never exported
+}
+
+// cube is a cube rendered with the variables of its workspace, its volume paths resolved
+type cube struct {
+	models.Container
+	proxies []models.ProxySpec // With expanded domains
+}
+
+// Render returns the workspace in the given format, as YAML documents
+func Render(spec *models.WorkspaceSpec, format string) ([]byte, error) {
+	rendered, err := render(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case FormatCompose:
+		return encode(composeHeader(rendered), composeFile(rendered))
+	case FormatKubernetes:
+		return encode(kubernetesHeader(rendered), kubernetesManifests(rendered)...)
+	}
+	return nil, fmt.Errorf("unknown export format %q, expected %s or %s", format, FormatCompose, FormatKubernetes)
+}
+
+func render(spec *models.WorkspaceSpec) (*workspace, error) {
+	variables := make([]database.WorkspaceVariable, 0, len(spec.Variables))
+	for name, value := range spec.Variables {
+		variables = append(variables, database.WorkspaceVariable{Name: name, Value: value})
+	}
+	sort.Slice(variables, func(i, j int) bool { return variables[i].Name < variables[j].Name })
+
+	rendered := &workspace{name: spec.Name, networks: spec.Networks}
+	seen := make(map[string]bool)
+	for _, cubeSpec := range spec.Cubes {
+		container := deploy.RenderWith(spec.Name, variables, cubeSpec.Container())
+		volumes := make(map[string]string, len(container.Volumes))
+		for hostPath, containerPath := range container.Volumes {
+			// Exports describe the volumes as stored, cubes from before the volume roots may use other paths
+			hostPath, err := docker.ExpandVolumePath(hostPath)
+			if err != nil {
+				return nil, err
+			}
+			volumes[hostPath] = containerPath
+		}
+		container.Volumes = volumes
+
+		c := cube{Container: container}
+		for _, proxy := range cubeSpec.Proxies {
+			proxy.Domain = deploy.ExpandProxyDomainWith(spec.Name, variables, cubeSpec.Name, proxy.Domain)
+			c.proxies = append(c.proxies, proxy)
+		}
+		rendered.cubes = append(rendered.cubes, c)
+
+		for _, name := range secrets.References(container.EnvironmentVars) {
+			if !seen[name] {
+				seen[name] = true
+				rendered.secrets = append(rendered.secrets, name)
+			}
+		}
+	}
+	sort.Strings(rendered.secrets)
+	return rendered, nil
+}
+
+// encode writes documents as a YAML stream after a comment header
+func encode(header []string, documents ...interface{}) ([]byte, error) {
+	var data bytes.Buffer
+	for _, line := range header {
+		fmt.Fprintf(&data, "# %s\n", line)
+	}
+	encoder := yaml.NewEncoder(&data)
+	encoder.SetIndent(2)
+	for _, document := range documents {
+		if err := encoder.Encode(document); err != nil {
+			return nil, fmt.Errorf("failed to encode export: %v", err)
+		}
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("failed to encode export: %v", err)
+	}
+	return data.Bytes(), nil
+}
+
+// dnsName turns a name into a lowercase DNS label, as compose projects and Kubernetes objects need
+func dnsName(name string) string {
+	label := strings.Trim(invalidNameChars.ReplaceAllString(strings.ToLower(name), "-"), "-")
+	if len(label) > 63 {
+		label = strings.TrimRight(label[:63], "-")
+	}
+	if label == "" {
+		return "workspace"
+	}
+	return label
+}
+
+// FileName returns the base name of the exported files of a workspace
+func FileName(workspaceName string) string {
+	return dnsName(workspaceName)
+}
+
+// sortedVolumes returns the host paths of the volumes of a cube in a stable order
+func sortedVolumes(volumes map[string]string) []string {
+	hostPaths := make([]string, 0, len(volumes))
+	for hostPath := range volumes {
+		hostPaths = append(hostPaths, hostPath)
+	}
+	sort.Strings(hostPaths)
+	return hostPaths
+}
@@ -0,0 +1,70 @@
+package export
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/turplespace/portos/pkg/models"
+)
+
+func exportedSpec() *models.WorkspaceSpec {
+	return &models.WorkspaceSpec{
+		Name:      "exported",
+		Variables: map[string]string{"DOMAIN": "example.com"},
+		Cubes: []models.CubeSpec{{
+			Name:            "exported-web",
+			Image:           "nginx:1.27",
+			Ports:           []string{"8082:80"},
+			EnvironmentVars: []string{"PASSWORD=${secret:PASSWORD}"},
+			ResourceLimits:  models.ResourceLimits{Memory: "256m"},
+			Volumes:         map[string]string{"[DEFAULT]/${WORKSPACE_NAME}/html": "/usr/share/nginx/html"},
+			Proxies:         []models.ProxySpec{{Domain: "www.${DOMAIN}", Port: 80}},
+		}},
+	}
+}
+
+func TestRenderCompose(t *testing.T) {
+	compose, err := Render(exportedSpec(), FormatCompose)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"exported-web:", "- 8082:80", "- DOMAIN=example.com", "- PASSWORD=${PASSWORD}", "_volumes/exported/html:/usr/share/nginx/html", "memory: 256m"} {
+		if !strings.Contains(string(compose), want) {
+			t.Errorf("compose export lacks %q:\n%s", want, compose)
+		}
+	}
+	if strings.Contains(string(compose), "[DEFAULT]") {
+		t.Errorf("compose export has an unresolved volume path:\n%s", compose)
+	}
+}
+
+func TestRenderKubernetes(t *testing.T) {
+	manifests, err := Render(exportedSpec(), FormatKubernetes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"kind: Deployment", "kind: Service", "kind: Ingress", "host: www.example.com", "name: exported-secrets", "memory: 256Mi"} {
+		if !strings.Contains(string(manifests), want) {
+			t.Errorf("k8s export lacks %q:\n%s", want, manifests)
+		}
+	}
+}
+
+func TestRenderRejects(t *testing.T) {
+	if _, err := Render(exportedSpec(), "helm"); err == nil {
+		t.Error("rendered an unknown format")
+	}
+}
+
+func TestRenderLegacyHostPath(t *testing.T) {
+	// Cubes stored before the volume roots may mount other host paths, their export describes them as they are
+	spec := exportedSpec()
+	spec.Cubes[0].Volumes = map[string]string{"/srv/legacy/html": "/usr/share/nginx/html"}
+	compose, err := Render(spec, FormatCompose)
+	if err != nil {
+		t.Fatalf("render with a legacy host path: %v", err)
+	}
+	if !strings.Contains(string(compose), "- /srv/legacy/html:/usr/share/nginx/html") {
+		t.Errorf("compose export lacks the legacy volume:\n%s", compose)
+	}
+}
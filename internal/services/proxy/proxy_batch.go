@@ -0,0 +1,201 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/turplespace/portos/internal/validation"
+)
+
+// ErrInvalidConfig is wrapped by the errors of proxy configurations that Nginx rejects
+var ErrInvalidConfig = errors.New("invalid Nginx configuration")
+
+// applyMu keeps batches from testing and reloading each other's configurations
+var applyMu sync.Mutex
+
+/*
+Batch gathers changes of proxy configurations to apply them together. Configurations are written
+to staging files that Nginx does not load, then Apply swaps them into the proxy folder, tests the
+configuration with nginx -t and reloads Nginx once. When the test or the reload fails, the previous
+configurations are restored, so that one bad domain does not take down the routing of the others.
+*/
+type Batch struct {
+	folder  string
+	changes []change
+}
+
+// change replaces the configuration of a domain with a staging file, or removes it without one
+type change struct {
+	domain   string
+	staging  string
+	previous []byte // Configuration replaced by Apply, nil when the domain had none
+}
+
+// NewBatch starts an empty batch of changes to the proxy folder
+func NewBatch() (*Batch, error) {
+	ex, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	return &Batch{folder: fmt.Sprintf("%s_proxy", ex)}, nil
+}
+
+// Write stages the configuration proxying a domain to the given IP addresses, see NginxProxyConfig.
+// Domains that are not host names are rejected, as they would end up in the configuration.
+func (b *Batch) Write(ips []string, port int, subdomain string, balancing string) error {
+	if !validation.ValidHostName(subdomain) {
+		return fmt.Errorf("%w: %q is not a valid domain name", ErrInvalidConfig, subdomain)
+	}
+	config, err := NginxProxyConfig(ips, port, subdomain, balancing)
+	if err != nil {
+		return err
+	}
+
+	staging, err := writeStaging(b.folder, subdomain, []byte(config))
+	if err != nil {
+		return err
+	}
+	b.changes = append(b.changes, change{domain: subdomain, staging: staging})
+	return nil
+}
+
+// Remove stages the removal of the configuration of a domain, a missing configuration is not an error
+func (b *Batch) Remove(subdomain string) error {
+	if err := checkDomain(subdomain); err != nil {
+		return err
+	}
+	b.changes = append(b.changes, change{domain: subdomain})
+	return nil
+}
+
+// Len returns the number of staged changes
+func (b *Batch) Len() int {
+	return len(b.changes)
+}
+
+/*
+Apply swaps the staged configurations into the proxy folder, each with an atomic rename, tests the
+whole configuration with nginx -t and reloads Nginx. When any step fails the previous
+configurations are restored and the error is returned, with the text of Nginx for an invalid
+configuration. The batch is discarded in every case, it is applied once.
+*/
+func (b *Batch) Apply() error {
+	defer b.Discard()
+	if len(b.changes) == 0 {
+		return nil
+	}
+	applyMu.Lock()
+	defer applyMu.Unlock()
+
+	for i := range b.changes {
+		if err := b.swap(&b.changes[i]); err != nil {
+			b.restore(i)
+			return err
+		}
+	}
+	if err := TestNginxConfig(); err != nil {
+		b.restore(len(b.changes))
+		return err
+	}
+	if err := RestartNginxService(); err != nil {
+		b.restore(len(b.changes))
+		return err
+	}
+	return nil
+}
+
+// swap puts the staging file of a change in place of the configuration of its domain, keeping the previous one
+func (b *Batch) swap(c *change) error {
+	path := b.path(c.domain)
+	previous, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	c.previous = previous
+
+	if c.staging == "" {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	return os.Rename(c.staging, path)
+}
+
+// restore puts back the configurations replaced by the first n changes, latest first so that a
+// domain changed twice gets its original configuration
+func (b *Batch) restore(n int) {
+	for i := n - 1; i >= 0; i-- {
+		c := b.changes[i]
+		path := b.path(c.domain)
+		var err error
+		if c.previous == nil {
+			err = os.Remove(path)
+			if os.IsNotExist(err) {
+				err = nil
+			}
+		} else {
+			var staging string
+			if staging, err = writeStaging(b.folder, c.domain, c.previous); err == nil {
+				err = os.Rename(staging, path)
+			}
+		}
+		if err != nil {
+			log.Printf("[*] Warning: Failed to restore proxy configuration of %s: %v", c.domain, err)
+		}
+	}
+}
+
+// Discard drops the staged changes and removes the staging files that were not swapped into place
+func (b *Batch) Discard() {
+	for _, c := range b.changes {
+		if c.staging != "" {
+			if err := os.Remove(c.staging); err != nil && !os.IsNotExist(err) {
+				log.Printf("[*] Warning: Failed to remove staging file %s: %v", c.staging, err)
+			}
+		}
+	}
+	b.changes = nil
+}
+
+func (b *Batch) path(domain string) string {
+	return filepath.Join(b.folder, fmt.Sprintf("%s.conf", domain))
+}
+
+// writeStaging writes a configuration to a new staging file of the folder, which Nginx does not load
+// as it does not end with .conf, and returns its path
+func writeStaging(folder string, domain string, config []byte) (string, error) {
+	file, err := os.CreateTemp(folder, "."+domain+".*.staging")
+	if err != nil {
+		return "", err
+	}
+	// Nginx may run its workers as another user
+	if err := file.Chmod(0644); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return "", err
+	}
+	if _, err := file.Write(config); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return "", err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// checkDomain rejects domains that cannot name a configuration file of the proxy folder
+func checkDomain(domain string) error {
+	if domain == "" || strings.HasPrefix(domain, ".") || strings.ContainsAny(domain, `/\`) {
+		return fmt.Errorf("%w: %q cannot be proxied", ErrInvalidConfig, domain)
+	}
+	return nil
+}
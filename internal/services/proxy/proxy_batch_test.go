@@ -0,0 +1,168 @@
+package proxy
+
+import (
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWriteRejectsInvalidDomains(t *testing.T) {
+	batch := &Batch{folder: t.TempDir()}
+	for _, domain := range []string{"", ".hidden", "../escape", "a b.example.com", "app.example.com;", "x; }\nserver { listen 80", "web.${UNKNOWN}"} {
+		if err := batch.Write([]string{"172.17.0.2"}, 80, domain, ""); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("Write(%q) = %v, want ErrInvalidConfig", domain, err)
+		}
+	}
+	if entries, _ := os.ReadDir(batch.folder); len(entries) != 0 || batch.Len() != 0 {
+		t.Errorf("%d files and %d changes staged for invalid domains, want none", len(entries), batch.Len())
+	}
+}
+
+// proxyFolder returns a proxy folder holding the given configurations
+func proxyFolder(t *testing.T, configs map[string]string) string {
+	t.Helper()
+	folder := t.TempDir()
+	for domain, config := range configs {
+		if err := os.WriteFile(filepath.Join(folder, domain+".conf"), []byte(config), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return folder
+}
+
+// folderFiles returns the files of a folder by name with their content
+func folderFiles(t *testing.T, folder string) map[string]string {
+	t.Helper()
+	entries, err := os.ReadDir(folder)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, entry := range entries {
+		content, err := os.ReadFile(filepath.Join(folder, entry.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[entry.Name()] = string(content)
+	}
+	return files
+}
+
+func TestApply(t *testing.T) {
+	commands := dockerCommands(t)
+	folder := proxyFolder(t, map[string]string{"a.example.com": "old a", "c.example.com": "old c", "d.example.com": "old d"})
+	batch := &Batch{folder: folder}
+	for _, domain := range []string{"a.example.com", "b.example.com"} {
+		if err := batch.Write([]string{"172.18.0.2", "172.18.0.3"}, 8080, domain, "least_conn"); err != nil {
+			t.Fatalf("Write(%s) = %v", domain, err)
+		}
+	}
+	if err := batch.Remove("c.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if err := batch.Remove("missing.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if got := commands(); len(got) != 0 {
+		t.Errorf("commands before Apply = %v, want none", got)
+	}
+	if files := folderFiles(t, folder); len(files) != 5 {
+		t.Errorf("files before Apply = %v, want the configurations and two staging files", files)
+	}
+
+	if err := batch.Apply(); err != nil {
+		t.Fatalf("Apply() = %v", err)
+	}
+	files := folderFiles(t, folder)
+	if len(files) != 3 || files["d.example.com.conf"] != "old d" {
+		t.Errorf("files after Apply = %v, want a, b and the untouched d", files)
+	}
+	for _, domain := range []string{"a.example.com", "b.example.com"} {
+		config := files[domain+".conf"]
+		if !strings.Contains(config, "server_name "+domain) || !strings.Contains(config, "172.18.0.2:8080") || !strings.Contains(config, "172.18.0.3:8080") || !strings.Contains(config, "least_conn") {
+			t.Errorf("configuration of %s = %s, want both servers with least_conn", domain, config)
+		}
+	}
+	want := []string{"exec turplecubes-proxy nginx -t", "exec turplecubes-proxy nginx -s reload"}
+	if got := commands(); !slices.Equal(got, want) {
+		t.Errorf("commands = %v, want %v", got, want)
+	}
+	if batch.Len() != 0 {
+		t.Errorf("Len() after Apply = %d, want 0", batch.Len())
+	}
+}
+
+func TestApplyEmpty(t *testing.T) {
+	commands := dockerCommands(t)
+	if err := (&Batch{folder: t.TempDir()}).Apply(); err != nil {
+		t.Fatalf("Apply() = %v", err)
+	}
+	if got := commands(); len(got) != 0 {
+		t.Errorf("commands = %v, want none for an empty batch", got)
+	}
+}
+
+func TestApplyRestores(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		test    string
+		reload  string
+		invalid bool
+	}{
+		{name: "configuration rejected", test: "nginx: [emerg] host not found in upstream in /etc/nginx/conf.d/b.example.com.conf:3\n", invalid: true},
+		{name: "failed test", test: "Error response from daemon: container turplecubes-proxy is not running"},
+		{name: "failed reload", reload: "nginx: [alert] kill(1, 1) failed (3: No such process)"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			commands := dockerCommands(t)
+			t.Setenv("FAKE_NGINX_TEST", test.test)
+			t.Setenv("FAKE_NGINX_RELOAD", test.reload)
+			original := map[string]string{"a.example.com": "old a", "c.example.com": "old c"}
+			folder := proxyFolder(t, original)
+			batch := &Batch{folder: folder}
+			// a is changed twice, it gets its original configuration back
+			for _, domain := range []string{"a.example.com", "b.example.com", "a.example.com"} {
+				if err := batch.Write([]string{"172.18.0.2"}, 80, domain, ""); err != nil {
+					t.Fatalf("Write(%s) = %v", domain, err)
+				}
+			}
+			if err := batch.Remove("c.example.com"); err != nil {
+				t.Fatal(err)
+			}
+
+			err := batch.Apply()
+			if err == nil || errors.Is(err, ErrInvalidConfig) != test.invalid {
+				t.Fatalf("Apply() = %v, want an error, invalid configuration %v", err, test.invalid)
+			}
+			if test.invalid && !strings.Contains(err.Error(), "host not found in upstream") {
+				t.Errorf("Apply() = %v, want the message of Nginx", err)
+			}
+			if files := folderFiles(t, folder); !maps.Equal(files, map[string]string{"a.example.com.conf": "old a", "c.example.com.conf": "old c"}) {
+				t.Errorf("files after the failed Apply = %v, want the original configurations only", files)
+			}
+			if got := commands(); slices.Contains(got, "exec turplecubes-proxy nginx -s reload") != (test.reload != "") {
+				t.Errorf("commands = %v, want a reload only after a successful test", got)
+			}
+		})
+	}
+}
+
+func TestDiscard(t *testing.T) {
+	commands := dockerCommands(t)
+	folder := proxyFolder(t, map[string]string{"a.example.com": "old a"})
+	batch := &Batch{folder: folder}
+	if err := batch.Write([]string{"172.18.0.2"}, 80, "a.example.com", ""); err != nil {
+		t.Fatal(err)
+	}
+	batch.Discard()
+	if files := folderFiles(t, folder); !maps.Equal(files, map[string]string{"a.example.com.conf": "old a"}) {
+		t.Errorf("files after Discard = %v, want the configuration untouched", files)
+	}
+	if got := commands(); batch.Len() != 0 || len(got) != 0 {
+		t.Errorf("%d changes and commands %v after Discard, want none", batch.Len(), got)
+	}
+}
@@ -4,63 +4,62 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
-	"path/filepath"
+	"strings"
 )
 
-// RestartNginxService restarts the Nginx service inside the Docker container.
-func RestartNginxService() error {
-	containerName := "turplecubes-proxy"
+// Name of the container running Nginx, the proxy folder is its conf.d
+const containerName = "turplecubes-proxy"
 
-	// Restart the Nginx service inside the container
-	cmd := exec.Command("docker", "exec", containerName, "nginx", "-s", "reload")
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		fmt.Println("Error: ", err)
-		return fmt.Errorf("failed to restart Nginx service inside container %s: %v", containerName, err)
+// RestartNginxService reloads the configuration of the Nginx service inside the Docker container.
+func RestartNginxService() error {
+	output, err := exec.Command("docker", "exec", containerName, "nginx", "-s", "reload").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to restart Nginx service inside container %s: %v: %s", containerName, err, strings.TrimSpace(string(output)))
 	}
-
 	return nil
 }
 
-/*
-RemoveDataInFolder removes all data in the specified folder.
-the proxy data will be deleted while restarting the turplecubes
-to avoid domain not found error in ngxin
-*/
-func RemoveDataInFolder() error {
-	ex, err := os.Executable()
-	if err != nil {
-		return err
+// TestNginxConfig runs nginx -t inside the Docker container. A configuration that Nginx rejects
+// wraps ErrInvalidConfig with the errors Nginx reported.
+func TestNginxConfig() error {
+	output, err := exec.Command("docker", "exec", containerName, "nginx", "-t").CombinedOutput()
+	if err == nil {
+		return nil
 	}
-	folder := fmt.Sprintf("%s_proxy", ex)
 
-	// Ensure the folder exists
-	if _, err := os.Stat(folder); os.IsNotExist(err) {
-		return fmt.Errorf("configuration folder does not exist: %s", folder)
+	// Nginx reports the errors of the configuration as emergencies, such as
+	// nginx: [emerg] invalid number of arguments in "server_name" directive in /etc/nginx/conf.d/a.conf:9
+	var emergencies []string
+	for _, line := range strings.Split(string(output), "\n") {
+		if _, message, ok := strings.Cut(line, "[emerg] "); ok {
+			emergencies = append(emergencies, strings.TrimSpace(message))
+		}
+	}
+	if len(emergencies) > 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidConfig, strings.Join(emergencies, "; "))
 	}
+	return fmt.Errorf("failed to test Nginx configuration inside container %s: %v: %s", containerName, err, strings.TrimSpace(string(output)))
+}
 
-	// Open the folder
-	dir, err := os.Open(folder)
+// ListNginxProxyConfigs returns the domains that have an Nginx proxy configuration in the proxy folder
+func ListNginxProxyConfigs() ([]string, error) {
+	ex, err := os.Executable()
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer dir.Close()
+	folder := fmt.Sprintf("%s_proxy", ex)
 
-	// Read all files in the folder
-	names, err := dir.Readdirnames(-1)
+	entries, err := os.ReadDir(folder)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	// Remove all files in the folder
-	for _, name := range names {
-		err = os.RemoveAll(filepath.Join(folder, name))
-		if err != nil {
-			return err
+	domains := []string{}
+	for _, entry := range entries {
+		if domain, ok := strings.CutSuffix(entry.Name(), ".conf"); ok && !entry.IsDir() {
+			domains = append(domains, domain)
 		}
 	}
-
-	return nil
+	return domains, nil
 }
 
 // CreateFolderIfNotExists creates the folder if it doesn't exist.
@@ -0,0 +1,54 @@
+package proxy
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTestNginxConfig(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		output  string
+		invalid bool
+		want    string
+	}{
+		{name: "valid"},
+		{
+			name:    "emergencies",
+			output:  "nginx: [emerg] host not found in upstream \"web\" in /etc/nginx/conf.d/a.conf:3\nnginx: [emerg] unknown directive \"prox\" in /etc/nginx/conf.d/b.conf:9\nnginx: configuration file /etc/nginx/nginx.conf test failed\n",
+			invalid: true,
+			want:    `host not found in upstream "web" in /etc/nginx/conf.d/a.conf:3; unknown directive "prox" in /etc/nginx/conf.d/b.conf:9`,
+		},
+		{name: "other failure", output: "Error response from daemon: container turplecubes-proxy is not running", want: "is not running"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			t.Setenv("FAKE_NGINX_TEST", test.output)
+			err := TestNginxConfig()
+			if test.output == "" {
+				if err != nil {
+					t.Errorf("TestNginxConfig() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || errors.Is(err, ErrInvalidConfig) != test.invalid || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("TestNginxConfig() = %v, want an error with %q, invalid configuration %v", err, test.want, test.invalid)
+			}
+		})
+	}
+}
+
+func TestRestartNginxService(t *testing.T) {
+	commands := dockerCommands(t)
+	if err := RestartNginxService(); err != nil {
+		t.Fatalf("RestartNginxService() = %v", err)
+	}
+	if got := commands(); len(got) != 1 || got[0] != "exec turplecubes-proxy nginx -s reload" {
+		t.Errorf("commands = %v, want the reload of the proxy container", got)
+	}
+
+	t.Setenv("FAKE_NGINX_RELOAD", "nginx: [alert] kill(1, 1) failed (3: No such process)")
+	if err := RestartNginxService(); err == nil || !strings.Contains(err.Error(), "No such process") {
+		t.Errorf("RestartNginxService() = %v, want the output of the failed reload", err)
+	}
+}
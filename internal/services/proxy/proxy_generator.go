@@ -2,20 +2,45 @@ package proxy
 
 import (
 	"fmt"
-	"os"
-	"path/filepath"
+	"strings"
+
+	"github.com/turplespace/portos/pkg/models"
 )
 
-// GenerateNginxProxyConfig generates an Nginx proxy configuration for the given IP address, port, and subdomain,
-// and writes it to the specified folder.
-func GenerateNginxProxyConfig(ip string, port int, subdomain string) error {
+// balancingDirectives are the upstream directives of the load balancing methods, round robin is the Nginx default
+var balancingDirectives = map[string]string{
+	models.LoadBalancingLeastConn: "least_conn;",
+	models.LoadBalancingIPHash:    "ip_hash;",
+	models.LoadBalancingRandom:    "random;",
+}
+
+// NginxProxyConfig generates an Nginx proxy configuration for the given IP addresses, port, and subdomain.
+// Requests are spread over the IP addresses with the balancing method.
+func NginxProxyConfig(ips []string, port int, subdomain string, balancing string) (string, error) {
+	if len(ips) == 0 {
+		return "", fmt.Errorf("no IP address to proxy %s to", subdomain)
+	}
+
+	// The upstream is named after the domain, a wildcard is not valid in its name
+	upstream := "upstream_" + strings.ReplaceAll(subdomain, "*", "_")
+	servers := ""
+	if directive, ok := balancingDirectives[balancing]; ok {
+		servers += fmt.Sprintf("\n\t\t\t%s", directive)
+	}
+	for _, ip := range ips {
+		servers += fmt.Sprintf("\n\t\t\tserver %s:%d;", ip, port)
+	}
+
 	config := fmt.Sprintf(`
+		upstream %s {%s
+		}
+
 		server {
 			listen 80;
 			server_name %s;
 
 			location / {
-				proxy_pass http://%s:%d;
+				proxy_pass http://%s;
 				proxy_set_header Host $http_host;
 				proxy_set_header Upgrade $http_upgrade;
 				proxy_set_header Connection upgrade;
@@ -23,28 +48,7 @@ func GenerateNginxProxyConfig(ip string, port int, subdomain string) error {
 			}
 		
 		}
-`, subdomain, ip, port)
-
-	// Get the path of the executable
-	ex, err := os.Executable()
-	if err != nil {
-		panic(err)
-	}
-	// Create a folder with the name of the executable + "_proxy"
-	folder := fmt.Sprintf("%s_proxy", ex)
-	file_name := fmt.Sprintf("%s.conf", subdomain)
-	filePath := filepath.Join(folder, file_name)
-	file, err := os.Create(filePath)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	// Write the configuration to the file
-	_, err = file.WriteString(config)
-	if err != nil {
-		return err
-	}
+`, upstream, servers, subdomain, upstream)
 
-	return nil
+	return config, nil
 }
@@ -0,0 +1,81 @@
+package proxy
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+/*
+TestMain runs the tests with a fake docker command: the test binary is linked as docker in the
+PATH, and when run under that name it plays Nginx in the proxy container. nginx -t and the reload
+succeed, unless FAKE_NGINX_TEST or FAKE_NGINX_RELOAD is set, then the command prints its value and
+fails. Every command is appended to the file FAKE_DOCKER_LOG when it is set.
+*/
+func TestMain(m *testing.M) {
+	if filepath.Base(os.Args[0]) == "docker" {
+		os.Exit(fakeDocker(os.Args[1:]))
+	}
+
+	bin, err := os.MkdirTemp("", "proxy-test-bin")
+	if err != nil {
+		log.Fatal(err)
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.Symlink(executable, filepath.Join(bin, "docker")); err != nil {
+		log.Fatal(err)
+	}
+	os.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	code := m.Run()
+	os.RemoveAll(bin)
+	os.Exit(code)
+}
+
+// fakeDocker answers the commands run in the proxy container and returns the exit code
+func fakeDocker(args []string) int {
+	if path := os.Getenv("FAKE_DOCKER_LOG"); path != "" {
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err == nil {
+			fmt.Fprintln(file, strings.Join(args, " "))
+			file.Close()
+		}
+	}
+	if len(args) < 4 || args[0] != "exec" || args[1] != containerName || args[2] != "nginx" {
+		fmt.Println("not supported by the fake docker")
+		return 1
+	}
+
+	failure := os.Getenv("FAKE_NGINX_RELOAD")
+	if args[3] == "-t" {
+		failure = os.Getenv("FAKE_NGINX_TEST")
+	}
+	if failure != "" {
+		fmt.Print(failure)
+		return 1
+	}
+	return 0
+}
+
+// dockerCommands records the docker commands of the test and returns a function listing them
+func dockerCommands(t *testing.T) func() []string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "docker.log")
+	t.Setenv("FAKE_DOCKER_LOG", path)
+	return func() []string {
+		output, err := os.ReadFile(path)
+		if err != nil && !os.IsNotExist(err) {
+			t.Fatal(err)
+		}
+		if len(output) == 0 {
+			return nil
+		}
+		return strings.Split(strings.TrimSuffix(string(output), "\n"), "\n")
+	}
+}
@@ -0,0 +1,189 @@
+package quota
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/docker/go-units"
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+// ExceededError is returned when a change would take a workspace over its quota
+type ExceededError struct {
+	Message string
+}
+
+func (e *ExceededError) Error() string {
+	return "quota exceeded: " + e.Message
+}
+
+func exceeded(format string, args ...interface{}) error {
+	return &ExceededError{Message: fmt.Sprintf(format, args...)}
+}
+
+// ParseCPUs parses a docker --cpus value, an empty value is 0
+func ParseCPUs(value string) (float64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	cpus, err := strconv.ParseFloat(value, 64)
+	if err != nil || cpus < 0 {
+		return 0, fmt.Errorf("invalid CPU value %q", value)
+	}
+	return cpus, nil
+}
+
+// ParseMemory parses a docker --memory value such as 512m or 2g into bytes, an empty value is 0
+func ParseMemory(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	memory, err := units.RAMInBytes(value)
+	if err != nil || memory < 0 {
+		return 0, fmt.Errorf("invalid memory value %q", value)
+	}
+	return memory, nil
+}
+
+// Validate checks that the limits of a quota can be parsed
+func Validate(quota models.WorkspaceQuota) error {
+	if quota.MaxCubes < 0 || quota.MaxPorts < 0 || quota.MaxProxies < 0 {
+		return fmt.Errorf("quota limits cannot be negative")
+	}
+	if _, err := ParseCPUs(quota.CPUs); err != nil {
+		return err
+	}
+	_, err := ParseMemory(quota.Memory)
+	return err
+}
+
+// Usage sums what the cubes and proxies of a workspace use of its quota
+func Usage(workspaceID int) (*models.QuotaUsage, error) {
+	cubes, err := database.ListContainersInWorkspace(workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	proxies, err := database.CountProxiesByWorkspaceID(workspaceID)
+	if err != nil {
+		return nil, err
+	}
+	return usage(cubes, proxies)
+}
+
+func usage(cubes []models.Container, proxies int) (*models.QuotaUsage, error) {
+	result := &models.QuotaUsage{Cubes: len(cubes), Proxies: proxies}
+	for _, cube := range cubes {
+		cpus, err := ParseCPUs(cube.ResourceLimits.CPUs)
+		if err != nil {
+			return nil, fmt.Errorf("cube %s: %v", cube.Name, err)
+		}
+		memory, err := ParseMemory(cube.ResourceLimits.Memory)
+		if err != nil {
+			return nil, fmt.Errorf("cube %s: %v", cube.Name, err)
+		}
+		// Every replica of a cube gets its limits and publishes its ports
+		replicas := cube.ReplicaCount()
+		result.CPUs += cpus * float64(replicas)
+		result.Memory += memory * int64(replicas)
+		result.Ports += len(cube.Ports) * replicas
+	}
+	return result, nil
+}
+
+// CheckCube checks the quota of a workspace with a cube added, or replaced when its ID is set
+func CheckCube(workspaceID int, cube models.Container) error {
+	return check(workspaceID, &cube, 0, false)
+}
+
+// CheckProxy checks the quota of a workspace with one more proxy
+func CheckProxy(workspaceID int) error {
+	return check(workspaceID, nil, 1, false)
+}
+
+// CheckWorkspace checks that a workspace is within its quota and that none of its cubes is unlimited
+func CheckWorkspace(workspaceID int) error {
+	return check(workspaceID, nil, 0, true)
+}
+
+// CheckSpec checks the quota of a workspace with its cubes and proxies replaced by those of a spec
+func CheckSpec(workspaceID int, cubes []models.Container, proxies int) error {
+	quota, err := database.GetWorkspaceQuota(workspaceID)
+	if err != nil || quota == nil {
+		return err
+	}
+	return compare(quota, cubes, proxies, cubes)
+}
+
+/*
+check compares the usage of a workspace after the change with its quota. When a quota limits
+CPUs or memory, cubes without the matching limit are rejected as they could use the whole host.
+Only the changed cube is checked for limits, or every cube when allCubes is set.
+*/
+func check(workspaceID int, changed *models.Container, newProxies int, allCubes bool) error {
+	quota, err := database.GetWorkspaceQuota(workspaceID)
+	if err != nil || quota == nil {
+		return err
+	}
+
+	cubes, err := database.ListContainersInWorkspace(workspaceID)
+	if err != nil {
+		return err
+	}
+	proxies, err := database.CountProxiesByWorkspaceID(workspaceID)
+	if err != nil {
+		return err
+	}
+
+	var checked []models.Container
+	if allCubes {
+		checked = cubes
+	}
+	if changed != nil {
+		replaced := false
+		for i := range cubes {
+			if changed.ID != 0 && cubes[i].ID == changed.ID {
+				cubes[i] = *changed
+				replaced = true
+			}
+		}
+		if !replaced {
+			cubes = append(cubes, *changed)
+		}
+		checked = []models.Container{*changed}
+	}
+	return compare(quota, cubes, proxies+newProxies, checked)
+}
+
+// compare checks the usage of the cubes and proxies against a quota, and that the checked cubes have the limits it needs
+func compare(quota *models.WorkspaceQuota, cubes []models.Container, proxies int, checked []models.Container) error {
+	for _, cube := range checked {
+		if quota.CPUs != "" && cube.ResourceLimits.CPUs == "" {
+			return exceeded("cube %s needs a CPU limit, the workspace has a CPU quota", cube.Name)
+		}
+		if quota.Memory != "" && cube.ResourceLimits.Memory == "" {
+			return exceeded("cube %s needs a memory limit, the workspace has a memory quota", cube.Name)
+		}
+	}
+
+	used, err := usage(cubes, proxies)
+	if err != nil {
+		return err
+	}
+	maxCPUs, _ := ParseCPUs(quota.CPUs)
+	maxMemory, _ := ParseMemory(quota.Memory)
+
+	switch {
+	case quota.MaxCubes > 0 && used.Cubes > quota.MaxCubes:
+		return exceeded("%d cubes, the workspace allows %d", used.Cubes, quota.MaxCubes)
+	case maxCPUs > 0 && used.CPUs > maxCPUs:
+		return exceeded("%g CPUs, the workspace allows %s", used.CPUs, quota.CPUs)
+	case maxMemory > 0 && used.Memory > maxMemory:
+		return exceeded("%s of memory, the workspace allows %s", units.BytesSize(float64(used.Memory)), quota.Memory)
+	case quota.MaxPorts > 0 && used.Ports > quota.MaxPorts:
+		return exceeded("%d published ports, the workspace allows %d", used.Ports, quota.MaxPorts)
+	case quota.MaxProxies > 0 && used.Proxies > quota.MaxProxies:
+		return exceeded("%d proxies, the workspace allows %d", used.Proxies, quota.MaxProxies)
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package quota
+
+import (
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+// TestMain runs the tests against a fresh database next to the test binary
+func TestMain(m *testing.M) {
+	path, err := database.GetPath()
+	if err != nil {
+		log.Fatal(err)
+	}
+	os.Remove(path)
+	database.Init()
+
+	code := m.Run()
+	os.Remove(path)
+	os.Exit(code)
+}
+
+// newWorkspace creates a workspace with the quota and cubes, nil for no quota, and returns its ID and the cube IDs
+func newWorkspace(t *testing.T, name string, quota *models.WorkspaceQuota, cubes ...models.Container) (int, []int) {
+	t.Helper()
+	id, err := database.CreateWorkspace(name, "created by "+t.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if quota != nil {
+		if err := database.SetWorkspaceQuota(int(id), *quota); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var cubeIDs []int
+	for _, cube := range cubes {
+		cubeID, err := database.InsertWorkspaceAndCubes(int(id), cube, "test")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cubeIDs = append(cubeIDs, int(cubeID))
+	}
+	return int(id), cubeIDs
+}
+
+// checkExceeded fails the test unless err is an ExceededError mentioning want, or nil for an empty want
+func checkExceeded(t *testing.T, name string, err error, want string) {
+	t.Helper()
+	var exceeded *ExceededError
+	switch {
+	case want == "" && err != nil:
+		t.Errorf("%s = %v, want nil", name, err)
+	case want != "" && (!errors.As(err, &exceeded) || !strings.Contains(err.Error(), want)):
+		t.Errorf("%s = %v, want a quota error: %s", name, err, want)
+	}
+}
+
+func TestParseLimits(t *testing.T) {
+	for value, want := range map[string]float64{"": 0, "0.5": 0.5, "4": 4} {
+		if got, err := ParseCPUs(value); err != nil || got != want {
+			t.Errorf("ParseCPUs(%q) = %v, %v, want %v", value, got, err, want)
+		}
+	}
+	for value, want := range map[string]int64{"": 0, "512m": 512 << 20, "2g": 2 << 30, "1024": 1024} {
+		if got, err := ParseMemory(value); err != nil || got != want {
+			t.Errorf("ParseMemory(%q) = %v, %v, want %v", value, got, err, want)
+		}
+	}
+
+	for _, quota := range []models.WorkspaceQuota{{CPUs: "-1"}, {CPUs: "two"}, {Memory: "lots"}, {MaxCubes: -1}, {MaxProxies: -2}} {
+		if err := Validate(quota); err == nil {
+			t.Errorf("Validate(%+v) = nil, want an error", quota)
+		}
+	}
+	if err := Validate(models.WorkspaceQuota{MaxCubes: 3, CPUs: "2.5", Memory: "1g", MaxPorts: 2}); err != nil {
+		t.Errorf("Validate of a valid quota = %v", err)
+	}
+}
+
+func TestCheckCube(t *testing.T) {
+	limited := models.ResourceLimits{CPUs: "0.5", Memory: "256m"}
+	workspaceID, cubeIDs := newWorkspace(t, "quota-cubes",
+		&models.WorkspaceQuota{MaxCubes: 3, CPUs: "1.5", Memory: "1g", MaxPorts: 2},
+		models.Container{Name: "quota-web", Image: "nginx", Ports: []string{"8080:80"}, ResourceLimits: limited},
+	)
+
+	for _, test := range []struct {
+		name string
+		cube models.Container
+		want string
+	}{
+		{"cube within the quota", models.Container{Name: "quota-api", ResourceLimits: limited}, ""},
+		{"cube without a CPU limit", models.Container{Name: "quota-api", ResourceLimits: models.ResourceLimits{Memory: "256m"}}, "needs a CPU limit"},
+		{"cube without a memory limit", models.Container{Name: "quota-api", ResourceLimits: models.ResourceLimits{CPUs: "0.5"}}, "needs a memory limit"},
+		{"cube over the CPUs", models.Container{Name: "quota-api", ResourceLimits: models.ResourceLimits{CPUs: "1.1", Memory: "256m"}}, "1.6 CPUs"},
+		{"cube over the memory", models.Container{Name: "quota-api", ResourceLimits: models.ResourceLimits{CPUs: "0.5", Memory: "800m"}}, "of memory"},
+		{"replicas over the CPUs", models.Container{Name: "quota-api", Replicas: 3, ResourceLimits: limited}, "2 CPUs"},
+		{"cube over the ports", models.Container{Name: "quota-api", Ports: []string{"8081:80", "8443:443"}, ResourceLimits: limited}, "3 published ports"},
+		{"replaced cube", models.Container{ID: cubeIDs[0], Name: "quota-web", ResourceLimits: models.ResourceLimits{CPUs: "1.5", Memory: "1g"}}, ""},
+		{"replaced cube over the CPUs", models.Container{ID: cubeIDs[0], Name: "quota-web", ResourceLimits: models.ResourceLimits{CPUs: "2", Memory: "256m"}}, "2 CPUs"},
+	} {
+		checkExceeded(t, test.name, CheckCube(workspaceID, test.cube), test.want)
+	}
+
+	for _, name := range []string{"quota-api", "quota-db"} {
+		if _, err := database.InsertWorkspaceAndCubes(workspaceID, models.Container{Name: name, Image: "nginx", ResourceLimits: models.ResourceLimits{CPUs: "0.25", Memory: "128m"}}, "test"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkExceeded(t, "fourth cube", CheckCube(workspaceID, models.Container{Name: "quota-cache", ResourceLimits: models.ResourceLimits{CPUs: "0.1", Memory: "64m"}}), "4 cubes")
+
+	usage, err := Usage(workspaceID)
+	if err != nil || usage.Cubes != 3 || usage.CPUs != 1 || usage.Memory != 512<<20 || usage.Ports != 1 {
+		t.Errorf("usage = %+v, %v", usage, err)
+	}
+}
+
+func TestCheckProxyAndWorkspace(t *testing.T) {
+	workspaceID, cubeIDs := newWorkspace(t, "quota-proxies", &models.WorkspaceQuota{MaxProxies: 1},
+		models.Container{Name: "quota-proxied", Image: "nginx"},
+	)
+	checkExceeded(t, "first proxy", CheckProxy(workspaceID), "")
+	if _, err := database.AddProxy(cubeIDs[0], "quota.example.com", 80, "", false); err != nil {
+		t.Fatal(err)
+	}
+	checkExceeded(t, "second proxy", CheckProxy(workspaceID), "2 proxies")
+
+	// A quota set on a workspace whose cubes have no limits is reported for every cube
+	checkExceeded(t, "workspace without a memory quota", CheckWorkspace(workspaceID), "")
+	if err := database.SetWorkspaceQuota(workspaceID, models.WorkspaceQuota{Memory: "1g"}); err != nil {
+		t.Fatal(err)
+	}
+	checkExceeded(t, "workspace with a memory quota", CheckWorkspace(workspaceID), "quota-proxied needs a memory limit")
+
+	// A spec replaces every cube, and each needs the limits
+	spec := []models.Container{{Name: "quota-proxied", ResourceLimits: models.ResourceLimits{Memory: "512m"}}, {Name: "quota-other", ResourceLimits: models.ResourceLimits{Memory: "512m"}}}
+	checkExceeded(t, "spec within the quota", CheckSpec(workspaceID, spec, 1), "")
+	spec[1].ResourceLimits.Memory = ""
+	checkExceeded(t, "spec with an unlimited cube", CheckSpec(workspaceID, spec, 1), "quota-other needs a memory limit")
+}
+
+func TestNoQuota(t *testing.T) {
+	workspaceID, _ := newWorkspace(t, "quota-none", nil, models.Container{Name: "quota-free", Image: "nginx", Replicas: 10, Ports: []string{"80"}})
+	huge := models.Container{Name: "quota-huge", ResourceLimits: models.ResourceLimits{CPUs: "64", Memory: "256g"}}
+	checkExceeded(t, "cube", CheckCube(workspaceID, huge), "")
+	checkExceeded(t, "proxy", CheckProxy(workspaceID), "")
+	checkExceeded(t, "workspace", CheckWorkspace(workspaceID), "")
+	checkExceeded(t, "spec", CheckSpec(workspaceID, []models.Container{huge}, 100), "")
+}
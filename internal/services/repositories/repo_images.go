@@ -6,7 +6,7 @@ import (
 	"io/ioutil"
 	"os"
 
-	"github.com/turplespace/portos/internal/models"
+	"github.com/turplespace/portos/pkg/models"
 )
 
 // ReadImages reads the images from the JSON file
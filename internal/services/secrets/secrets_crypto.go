@@ -0,0 +1,70 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/turplespace/portos/internal/config"
+)
+
+// ErrNoMasterKey is returned by every operation of the store when no master key is configured
+var ErrNoMasterKey = errors.New("secrets store is disabled, TURPLECUBES_MASTER_KEY is not set")
+
+// newCipher builds the AES-256-GCM cipher from the configured master key
+func newCipher() (cipher.AEAD, error) {
+	encoded := config.Get().MasterKey
+	if encoded == "" {
+		return nil, ErrNoMasterKey
+	}
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != 32 {
+		return nil, fmt.Errorf("master key must be 32 bytes encoded as base64")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encrypt seals the plaintext with a random nonce, the nonce is stored in front of the ciphertext.
+// The name of the secret is bound as additional data so values cannot be swapped between rows.
+func encrypt(workspaceID int, name string, plaintext string) ([]byte, error) {
+	gcm, err := newCipher()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, []byte(plaintext), additionalData(workspaceID, name)), nil
+}
+
+// decrypt opens a value sealed by encrypt
+func decrypt(workspaceID int, name string, ciphertext []byte) (string, error) {
+	gcm, err := newCipher()
+	if err != nil {
+		return "", err
+	}
+	if len(ciphertext) < gcm.NonceSize() {
+		return "", fmt.Errorf("secret %s is corrupted", name)
+	}
+
+	nonce, sealed := ciphertext[:gcm.NonceSize()], ciphertext[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, sealed, additionalData(workspaceID, name))
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt secret %s, was the master key changed?", name)
+	}
+	return string(plaintext), nil
+}
+
+func additionalData(workspaceID int, name string) []byte {
+	return []byte(fmt.Sprintf("%d/%s", workspaceID, name))
+}
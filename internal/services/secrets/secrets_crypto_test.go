@@ -0,0 +1,99 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/turplespace/portos/internal/config"
+)
+
+// withMasterKey configures the master key for the duration of the test
+func withMasterKey(t *testing.T, key string) {
+	t.Helper()
+	previous := config.Get().MasterKey
+	config.Get().MasterKey = key
+	t.Cleanup(func() { config.Get().MasterKey = previous })
+}
+
+func key(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	withMasterKey(t, key(1))
+	for _, plaintext := range []string{"", "s3cret", strings.Repeat("long value ", 1000)} {
+		sealed, err := encrypt(1, "DB_PASSWORD", plaintext)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if plaintext != "" && bytes.Contains(sealed, []byte(plaintext)) {
+			t.Errorf("ciphertext of %q contains the plaintext", plaintext)
+		}
+		if opened, err := decrypt(1, "DB_PASSWORD", sealed); err != nil || opened != plaintext {
+			t.Errorf("decrypt = %q, %v, want %q", opened, err, plaintext)
+		}
+	}
+
+	// Each value gets its own nonce
+	first, _ := encrypt(1, "DB_PASSWORD", "s3cret")
+	second, _ := encrypt(1, "DB_PASSWORD", "s3cret")
+	if bytes.Equal(first, second) {
+		t.Error("two encryptions of the same value are equal")
+	}
+}
+
+func TestDecryptRejects(t *testing.T) {
+	withMasterKey(t, key(1))
+	sealed, err := encrypt(1, "DB_PASSWORD", "s3cret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := bytes.Clone(sealed)
+	tampered[len(tampered)-1] ^= 1
+
+	for _, test := range []struct {
+		name        string
+		workspaceID int
+		secret      string
+		ciphertext  []byte
+	}{
+		{"value of another secret", 1, "API_KEY", sealed},
+		{"value of another workspace", 2, "DB_PASSWORD", sealed},
+		{"tampered value", 1, "DB_PASSWORD", tampered},
+		{"truncated value", 1, "DB_PASSWORD", sealed[:8]},
+	} {
+		if _, err := decrypt(test.workspaceID, test.secret, test.ciphertext); err == nil {
+			t.Errorf("%s was decrypted", test.name)
+		}
+	}
+
+	// A changed master key cannot open the values sealed by the previous one
+	config.Get().MasterKey = key(2)
+	if _, err := decrypt(1, "DB_PASSWORD", sealed); err == nil || !strings.Contains(err.Error(), "master key") {
+		t.Errorf("decrypt with another key = %v, want a master key error", err)
+	}
+}
+
+func TestMasterKeyErrors(t *testing.T) {
+	for _, test := range []struct {
+		name, key string
+		noKey     bool
+	}{
+		{"no key", "", true},
+		{"not base64", "not a key!", false},
+		{"short key", base64.StdEncoding.EncodeToString(make([]byte, 16)), false},
+		{"long key", base64.StdEncoding.EncodeToString(make([]byte, 64)), false},
+	} {
+		withMasterKey(t, test.key)
+		_, err := encrypt(1, "DB_PASSWORD", "s3cret")
+		if err == nil || errors.Is(err, ErrNoMasterKey) != test.noKey {
+			t.Errorf("%s: encrypt = %v", test.name, err)
+		}
+		if _, err := decrypt(1, "DB_PASSWORD", make([]byte, 64)); err == nil || errors.Is(err, ErrNoMasterKey) != test.noKey {
+			t.Errorf("%s: decrypt = %v", test.name, err)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package secrets
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/turplespace/portos/internal/database"
+)
+
+// referencePattern matches ${secret:NAME} references in the environment variables of a cube
+var referencePattern = regexp.MustCompile(`\$\{secret:([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+var namePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// redacted replaces secret values in logs and error messages
+const redacted = "[REDACTED]"
+
+// ValidName reports whether name can be used as a secret name and referenced from a cube
+func ValidName(name string) bool {
+	return namePattern.MatchString(name)
+}
+
+// Set encrypts and stores a secret of a workspace, returning its new version
+func Set(workspaceID int, name string, value string) (int, error) {
+	if !ValidName(name) {
+		return 0, fmt.Errorf("invalid secret name %q, use letters, digits and underscores", name)
+	}
+	ciphertext, err := encrypt(workspaceID, name, value)
+	if err != nil {
+		return 0, err
+	}
+	return database.SetSecret(workspaceID, name, ciphertext)
+}
+
+// References returns the names of the secrets referenced by environment variables
+func References(envVars []string) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, env := range envVars {
+		for _, match := range referencePattern.FindAllStringSubmatch(env, -1) {
+			if !seen[match[1]] {
+				seen[match[1]] = true
+				names = append(names, match[1])
+			}
+		}
+	}
+	return names
+}
+
+// ReplaceReferences returns value with its secret references replaced by reference(name) and the text around them by text(text)
+func ReplaceReferences(value string, text func(string) string, reference func(name string) string) string {
+	var replaced strings.Builder
+	last := 0
+	for _, match := range referencePattern.FindAllStringSubmatchIndex(value, -1) {
+		replaced.WriteString(text(value[last:match[0]]))
+		replaced.WriteString(reference(value[match[2]:match[3]]))
+		last = match[1]
+	}
+	replaced.WriteString(text(value[last:]))
+	return replaced.String()
+}
+
+// Resolved holds the environment variables of a cube whose secret references were replaced
+type Resolved struct {
+	Env    map[string]string // Resolved values by variable name, only for variables with references
+	values []string
+}
+
+/*
+Resolve replaces the ${secret:NAME} references in the environment variables of a cube with
+the decrypted values of the secrets of its workspace. Variables without references are left out,
+callers pass the resolved ones to the runtime without writing them in any command line or log.
+*/
+func Resolve(workspaceID int, envVars []string) (*Resolved, error) {
+	resolved := &Resolved{Env: make(map[string]string)}
+	cache := make(map[string]string)
+
+	for _, env := range envVars {
+		if !referencePattern.MatchString(env) {
+			continue
+		}
+		key, value, _ := strings.Cut(env, "=")
+
+		var resolveErr error
+		value = referencePattern.ReplaceAllStringFunc(value, func(ref string) string {
+			name := referencePattern.FindStringSubmatch(ref)[1]
+			if plaintext, ok := cache[name]; ok {
+				return plaintext
+			}
+			secret, err := database.GetSecret(workspaceID, name)
+			if err != nil {
+				resolveErr = fmt.Errorf("variable %s references unknown secret %s", key, name)
+				return ""
+			}
+			plaintext, err := decrypt(workspaceID, name, secret.Ciphertext)
+			if err != nil {
+				resolveErr = err
+				return ""
+			}
+			cache[name] = plaintext
+			if plaintext != "" {
+				resolved.values = append(resolved.values, plaintext)
+			}
+			return plaintext
+		})
+		if resolveErr != nil {
+			return nil, resolveErr
+		}
+		resolved.Env[key] = value
+	}
+
+	return resolved, nil
+}
+
+// Redact replaces every resolved secret value in text, for messages coming back from the runtime
+func (r *Resolved) Redact(text string) string {
+	for _, value := range r.values {
+		text = strings.ReplaceAll(text, value, redacted)
+	}
+	return text
+}
+
+// RedactVariable returns KEY=value with the whole value redacted when the variable references a
+// secret, whatever its value. Values read back from a container may hold a secret that has since
+// been rotated, which Redact no longer knows.
+func (r *Resolved) RedactVariable(key string, value string) string {
+	if _, ok := r.Env[key]; ok {
+		return key + "=" + redacted
+	}
+	return r.Redact(key + "=" + value)
+}
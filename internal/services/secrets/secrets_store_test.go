@@ -0,0 +1,19 @@
+package secrets
+
+import "testing"
+
+func TestRedactVariable(t *testing.T) {
+	// DB_PASSWORD references a secret that was rotated since the container was started
+	resolved := &Resolved{Env: map[string]string{"DB_PASSWORD": "new-password"}, values: []string{"new-password"}}
+
+	for _, test := range []struct{ key, value, want string }{
+		{"DB_PASSWORD", "old-password", "DB_PASSWORD=[REDACTED]"},
+		{"DB_PASSWORD", "${secret:db}", "DB_PASSWORD=[REDACTED]"},
+		{"DB_URL", "postgres://app:new-password@db", "DB_URL=postgres://app:[REDACTED]@db"},
+		{"MODE", "prod", "MODE=prod"},
+	} {
+		if got := resolved.RedactVariable(test.key, test.value); got != test.want {
+			t.Errorf("RedactVariable(%s, %s) = %s, want %s", test.key, test.value, got, test.want)
+		}
+	}
+}
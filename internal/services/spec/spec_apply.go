@@ -0,0 +1,188 @@
+package spec
+
+import (
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/internal/services/deploy"
+	"github.com/turplespace/portos/internal/services/docker"
+	"github.com/turplespace/portos/internal/services/proxy"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+// Response returns the plan as the response of a dry run, or of an apply before its runtime steps
+func (p *Plan) Response(dryRun bool) models.ApplyResponse {
+	changes := p.Changes
+	if changes == nil {
+		changes = []models.PlanChange{}
+	}
+	return models.ApplyResponse{WorkspaceID: p.WorkspaceID, DryRun: dryRun, Changes: changes}
+}
+
+/*
+Apply stores the changes of the plan in a single transaction, with a revision by author for each
+created or updated cube, then brings the runtime in line: containers of deleted cubes are stopped,
+running cubes are recreated, deleted networks are removed and the proxy configurations of running
+cubes are regenerated with a single Nginx reload. The changes stay stored when a runtime step
+fails, the failure is returned as a warning.
+*/
+func (p *Plan) Apply(author string) (models.ApplyResponse, error) {
+	p.stored.Author = author
+	workspaceID, err := database.ApplySpecChanges(p.stored)
+	if err != nil {
+		return models.ApplyResponse{}, err
+	}
+	p.WorkspaceID = workspaceID
+	result := p.Response(false)
+	warn := func(format string, args ...interface{}) {
+		message := fmt.Sprintf(format, args...)
+		log.Printf("[*] Warning: %s", message)
+		result.Warnings = append(result.Warnings, message)
+	}
+
+	for _, name := range append(p.stop, p.stopForNetwork...) {
+		if err := docker.StopContainer(name); err != nil {
+			warn("failed to stop container %s: %v", name, err)
+		}
+	}
+	for _, name := range p.recreatedNetworks {
+		if err := docker.RemoveNetwork(workspaceID, name); err != nil {
+			warn("failed to remove network %s: %v", name, err)
+		}
+	}
+
+	if len(p.recreate) > 0 {
+		cubes, err := database.ListContainersInWorkspace(workspaceID)
+		if err != nil {
+			warn("failed to list cubes: %v", err)
+		}
+		// Cubes are recreated after the cubes they depend on
+		for _, cube := range deploy.Order(cubes) {
+			if !slices.Contains(p.recreate, cube.Name) {
+				continue
+			}
+			log.Printf("[*] Recreating container %s of workspace %d", cube.Name, workspaceID)
+			if err := deploy.DeployCube(workspaceID, cube); err != nil {
+				warn("failed to recreate container %s: %v", cube.Name, err)
+			}
+		}
+	}
+
+	for _, name := range p.stored.DeleteNetworks {
+		if err := docker.RemoveNetwork(workspaceID, name); err != nil {
+			warn("failed to remove network %s: %v", name, err)
+		}
+	}
+
+	p.reloadProxies(workspaceID, warn)
+	return result, nil
+}
+
+// reloadProxies removes the stale proxy configurations and regenerates those of the running cubes that changed,
+// Nginx keeps the previous configurations when it rejects the new ones
+func (p *Plan) reloadProxies(workspaceID int, warn func(format string, args ...interface{})) {
+	if len(p.staleDomains) == 0 && len(p.proxied) == 0 {
+		return
+	}
+
+	batch, err := proxy.NewBatch()
+	if err != nil {
+		warn("failed to reload proxies: %v", err)
+		return
+	}
+	for _, domain := range p.staleDomains {
+		if err := batch.Remove(domain); err != nil {
+			warn("failed to remove proxy configuration of %s: %v", domain, err)
+		}
+	}
+
+	states, err := docker.ListManagedContainers(workspaceID)
+	if err != nil {
+		warn("failed to list containers: %v", err)
+	}
+	cubes, err := database.ListContainersInWorkspace(workspaceID)
+	if err != nil {
+		warn("failed to list cubes: %v", err)
+	}
+	byName := make(map[string]models.Container, len(cubes))
+	for _, cube := range cubes {
+		byName[cube.Name] = cube
+	}
+	for _, name := range sortedKeys(p.proxied) {
+		// Stopped cubes get their proxies configured when they are deployed
+		cube, ok := byName[name]
+		ips := deploy.RunningIPs(deploy.Replicas(states, cube))
+		if !ok || len(ips) == 0 {
+			continue
+		}
+		for _, proxySpec := range p.proxies[name] {
+			domain := deploy.ExpandProxyDomainWith(p.workspaceName, p.variables, name, proxySpec.Domain)
+			if err := batch.Write(ips, proxySpec.Port, domain, cube.LoadBalancing); err != nil {
+				warn("failed to generate proxy configuration of %s: %v", domain, err)
+			}
+		}
+	}
+
+	if err := batch.Apply(); err != nil {
+		warn("failed to reload Nginx: %v", err)
+	}
+}
+
+// SpecOf returns the spec of a stored cube with its proxies
+func SpecOf(cube models.Container, proxies []models.Proxy) models.CubeSpec {
+	spec := models.CubeSpec{
+		Name:            cube.Name,
+		Image:           cube.Image,
+		Ports:           cube.Ports,
+		EnvironmentVars: cube.EnvironmentVars,
+		ResourceLimits:  cube.ResourceLimits,
+		Volumes:         cube.Volumes,
+		Labels:          cube.Labels,
+		Networks:        cube.Networks,
+		DependsOn:       cube.DependsOn,
+		Replicas:        cube.Replicas,
+		LoadBalancing:   cube.LoadBalancing,
+	}
+	for _, p := range proxies {
+		spec.Proxies = append(spec.Proxies, models.ProxySpec{Domain: p.Domain, Port: p.Port, Type: p.Type, Default: p.Default})
+	}
+	return spec
+}
+
+// Export returns the spec of a stored workspace, applying it leaves the workspace unchanged
+func Export(workspaceID int) (*models.WorkspaceSpec, error) {
+	current, err := loadByID(workspaceID)
+	if err != nil {
+		return nil, err
+	}
+
+	spec := &models.WorkspaceSpec{
+		Name:  current.workspace.Name,
+		Desc:  current.workspace.Desc,
+		Cubes: []models.CubeSpec{},
+	}
+	if len(current.variables) > 0 {
+		spec.Variables = make(map[string]string, len(current.variables))
+		for _, variable := range current.variables {
+			spec.Variables[variable.Name] = variable.Value
+		}
+	}
+	declared := make(map[string]bool)
+	for _, network := range current.networks {
+		spec.Networks = append(spec.Networks, models.NetworkSpec{Name: network.Name, Driver: network.Driver})
+		declared[network.Name] = true
+	}
+	for _, cube := range current.cubes {
+		spec.Cubes = append(spec.Cubes, SpecOf(cube, current.proxies[cube.Name]))
+		// Cubes added through the API can join networks the workspace does not declare
+		for _, network := range cube.Networks {
+			if !declared[network] {
+				spec.Networks = append(spec.Networks, models.NetworkSpec{Name: network})
+				declared[network] = true
+			}
+		}
+	}
+	return spec, nil
+}
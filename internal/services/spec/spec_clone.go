@@ -0,0 +1,251 @@
+package spec
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/internal/services/secrets"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+/*
+Derive returns the spec of a workspace copied as the workspace of the request. Cubes are
+renamed since container names are unique on the host: by the cube name rules, or by replacing
+the suffix named after the source workspace with one named after the copy. Proxy domains are
+rewritten by the domain rules, then the overrides are applied. The warnings list what the copy
+does not bring along, such as secrets, and what clashes with the source, such as host ports.
+*/
+func Derive(sourceID int, request models.CloneWorkspaceRequest) (*models.WorkspaceSpec, []string, error) {
+	source, err := Export(sourceID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if source.Name == request.Name {
+		return nil, nil, invalid("workspace %s cannot be copied onto itself", source.Name)
+	}
+
+	target, err := existing(request.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	derived := &models.WorkspaceSpec{
+		Name:      request.Name,
+		Desc:      request.Desc,
+		Variables: source.Variables,
+		Networks:  source.Networks,
+		Cubes:     make([]models.CubeSpec, 0, len(source.Cubes)),
+	}
+	// A promotion keeps the description of its target unless the request sets one
+	if derived.Desc == "" && target != nil {
+		derived.Desc = target.Desc
+	}
+	if derived.Desc == "" {
+		derived.Desc = source.Desc
+	}
+	if len(request.Overrides.Variables) > 0 {
+		derived.Variables = make(map[string]string, len(source.Variables)+len(request.Overrides.Variables))
+		for name, value := range source.Variables {
+			derived.Variables[name] = value
+		}
+		for name, value := range request.Overrides.Variables {
+			derived.Variables[name] = value
+		}
+	}
+
+	names := make(map[string]string, len(source.Cubes))
+	for _, cube := range source.Cubes {
+		name := renameCube(cube.Name, source.Name, request)
+		if name == cube.Name {
+			return nil, nil, invalid("cube %s keeps its name in the copy, container names must be unique", cube.Name)
+		}
+		names[cube.Name] = name
+	}
+	if err := checkRenamedCubes(source.Cubes, names, target); err != nil {
+		return nil, nil, err
+	}
+	for name := range request.Overrides.Cubes {
+		if _, ok := names[name]; !ok {
+			return nil, nil, invalid("override of cube %s, which workspace %s does not have", name, source.Name)
+		}
+	}
+
+	var warnings []string
+	for _, cube := range source.Cubes {
+		copied := cube
+		copied.Name = names[cube.Name]
+		copied.DependsOn = nil
+		for _, dependency := range cube.DependsOn {
+			copied.DependsOn = append(copied.DependsOn, names[dependency])
+		}
+		copied.Proxies = nil
+		for _, proxy := range cube.Proxies {
+			proxy.Domain = rewrite(proxy.Domain, request.Domains)
+			copied.Proxies = append(copied.Proxies, proxy)
+		}
+		if override, ok := request.Overrides.Cubes[cube.Name]; ok {
+			copied = overrideCube(copied, override)
+		}
+
+		// Promotions onto an existing workspace only warn once, when it is created
+		for _, port := range copied.Ports {
+			if mapping, _, _ := strings.Cut(port, "/"); target == nil && strings.Contains(mapping, ":") {
+				warnings = append(warnings, fmt.Sprintf("cube %s publishes the host port of %s %s, change it before deploying both", copied.Name, cube.Name, port))
+			}
+		}
+		derived.Cubes = append(derived.Cubes, copied)
+	}
+
+	missing, err := missingSecrets(derived, target)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, name := range missing {
+		warnings = append(warnings, fmt.Sprintf("secret %s is not copied, set it in workspace %s before deploying", name, derived.Name))
+	}
+	return derived, warnings, nil
+}
+
+// renameCube returns the name of a cube in a copy of its workspace
+func renameCube(name string, sourceName string, request models.CloneWorkspaceRequest) string {
+	if len(request.CubeNames) > 0 {
+		return rewrite(name, request.CubeNames)
+	}
+	return strings.TrimSuffix(name, "-"+nameSuffix(sourceName)) + "-" + nameSuffix(request.Name)
+}
+
+/*
+checkRenamedCubes fails a copy whose renamed cubes could take the container names of each other, or
+of a cube of another workspace, the source included. The cubes of the target of a promotion are
+replaced by the copy, their names are free.
+*/
+func checkRenamedCubes(cubes []models.CubeSpec, names map[string]string, target *database.Workspace) error {
+	targetID := 0
+	if target != nil {
+		targetID = target.ID
+	}
+
+	claimedBy := make(map[string]string)
+	for _, cube := range cubes {
+		renamed := cube.Container()
+		renamed.Name = names[cube.Name]
+		for _, name := range renamed.ClaimedNames() {
+			if other, ok := claimedBy[name]; ok {
+				return invalid("cubes %s and %s both get the container name %s in the copy", other, cube.Name, name)
+			}
+			claimedBy[name] = cube.Name
+		}
+
+		err := database.CheckContainerNames(renamed, targetID)
+		if errors.Is(err, database.ErrNameTaken) {
+			return invalid("cube %s is renamed %s in the copy: %v", cube.Name, renamed.Name, err)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nameSuffix turns a workspace name into a suffix valid in container names
+func nameSuffix(workspaceName string) string {
+	return strings.ToLower(strings.ReplaceAll(workspaceName, " ", "-"))
+}
+
+func rewrite(value string, rules []models.RewriteRule) string {
+	for _, rule := range rules {
+		value = strings.ReplaceAll(value, rule.From, rule.To)
+	}
+	return value
+}
+
+func overrideCube(cube models.CubeSpec, override models.CubeOverride) models.CubeSpec {
+	if override.Image != "" {
+		cube.Image = override.Image
+	}
+	if override.Tag != "" {
+		cube.Image = withTag(cube.Image, override.Tag)
+	}
+	if override.ResourceLimits != nil {
+		if override.ResourceLimits.CPUs != "" {
+			cube.ResourceLimits.CPUs = override.ResourceLimits.CPUs
+		}
+		if override.ResourceLimits.Memory != "" {
+			cube.ResourceLimits.Memory = override.ResourceLimits.Memory
+		}
+	}
+	if len(override.EnvironmentVars) > 0 {
+		env := append([]string{}, cube.EnvironmentVars...)
+		for _, variable := range override.EnvironmentVars {
+			key, _, _ := strings.Cut(variable, "=")
+			replaced := false
+			for i, current := range env {
+				if currentKey, _, _ := strings.Cut(current, "="); currentKey == key {
+					env[i] = variable
+					replaced = true
+				}
+			}
+			if !replaced {
+				env = append(env, variable)
+			}
+		}
+		cube.EnvironmentVars = env
+	}
+	return cube
+}
+
+// withTag replaces the tag or digest of an image reference
+func withTag(image string, tag string) string {
+	if i := strings.Index(image, "@"); i >= 0 {
+		image = image[:i]
+	}
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		image = image[:i]
+	}
+	return image + ":" + tag
+}
+
+// existing returns the workspace of the given name, nil when there is none
+func existing(name string) (*database.Workspace, error) {
+	workspaceID, err := database.GetWorkspaceIDByName(name)
+	if errors.Is(err, database.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return database.GetWorkspaceByID(workspaceID)
+}
+
+// missingSecrets returns the secrets referenced by the cubes of a spec that its workspace, nil when it is created, does not have
+func missingSecrets(spec *models.WorkspaceSpec, workspace *database.Workspace) ([]string, error) {
+	var envVars []string
+	for _, cube := range spec.Cubes {
+		envVars = append(envVars, cube.EnvironmentVars...)
+	}
+	referenced := secrets.References(envVars)
+	if len(referenced) == 0 {
+		return nil, nil
+	}
+
+	stored := make(map[string]bool)
+	if workspace != nil {
+		current, err := database.ListSecrets(workspace.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, secret := range current {
+			stored[secret.Name] = true
+		}
+	}
+
+	var missing []string
+	for _, name := range referenced {
+		if !stored[name] {
+			missing = append(missing, name)
+		}
+	}
+	return missing, nil
+}
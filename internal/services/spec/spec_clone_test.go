@@ -0,0 +1,97 @@
+package spec
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/turplespace/portos/pkg/models"
+)
+
+func TestDeriveAndPromote(t *testing.T) {
+	source := apply(t, models.WorkspaceSpec{
+		Name:      "dev",
+		Variables: map[string]string{"DOMAIN": "example.com"},
+		Cubes: []models.CubeSpec{
+			{Name: "shop-db-dev", Image: "postgres:16"},
+			{Name: "shop-web-dev", Image: "nginx:1.26", EnvironmentVars: []string{"MODE=dev"}, DependsOn: []string{"shop-db-dev"}, Proxies: []models.ProxySpec{{Domain: "dev.${DOMAIN}", Port: 80}}},
+		},
+	})
+
+	request := models.CloneWorkspaceRequest{Name: "staging", Domains: []models.RewriteRule{{From: "dev.", To: "staging."}}}
+	derived, _, err := Derive(source.WorkspaceID, request)
+	if err != nil {
+		t.Fatalf("derive: %v", err)
+	}
+	cloned := apply(t, *derived)
+	spec, err := Export(cloned.WorkspaceID)
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if len(spec.Cubes) != 2 || spec.Cubes[1].Name != "shop-web-staging" || spec.Cubes[1].DependsOn[0] != "shop-db-staging" ||
+		spec.Cubes[1].Proxies[0].Domain != "staging.${DOMAIN}" || spec.Variables["DOMAIN"] != "example.com" {
+		t.Fatalf("cloned spec = %+v", spec)
+	}
+
+	// Promoting onto the copy only changes what the overrides change
+	request.Overrides = models.WorkspaceOverrides{Cubes: map[string]models.CubeOverride{
+		"shop-web-dev": {Tag: "1.27", EnvironmentVars: []string{"MODE=staging"}},
+	}}
+	derived, _, err = Derive(source.WorkspaceID, request)
+	if err != nil {
+		t.Fatalf("derive promotion: %v", err)
+	}
+	plan, err := NewPlan(*derived)
+	if err != nil {
+		t.Fatalf("plan promotion: %v", err)
+	}
+	if len(plan.Changes) != 1 || plan.Changes[0].Name != "shop-web-staging" || len(plan.Changes[0].Fields) != 2 {
+		t.Fatalf("promotion changes = %+v, want the image and environment of shop-web-staging", plan.Changes)
+	}
+	if _, err := plan.Apply("test"); err != nil {
+		t.Fatalf("apply promotion: %v", err)
+	}
+	if spec, err := Export(cloned.WorkspaceID); err != nil || spec.Cubes[1].Image != "nginx:1.27" || spec.Cubes[1].EnvironmentVars[0] != "MODE=staging" {
+		t.Errorf("promoted spec = %+v, %v", spec, err)
+	}
+}
+
+func TestDeriveChecksRenamedCubes(t *testing.T) {
+	sourceID := newWorkspace(t, "clash-dev",
+		models.Container{Name: "api-clash-dev", Image: "api:1"},
+		models.Container{Name: "web-clash-dev", Image: "nginx:1.26", Replicas: 2},
+	)
+	newWorkspace(t, "clash-other", models.Container{Name: "api-clash-prod", Image: "api:1"})
+	newWorkspace(t, "clash-stage", models.Container{Name: "api-clash-stage", Image: "api:1"})
+
+	for _, test := range []struct {
+		name    string
+		request models.CloneWorkspaceRequest
+		want    string
+	}{
+		{"cube of another workspace", models.CloneWorkspaceRequest{Name: "clash-prod"}, "api-clash-prod is used by another cube"},
+		{"replica of another renamed cube", models.CloneWorkspaceRequest{Name: "clash-copy", CubeNames: []models.RewriteRule{
+			{From: "-clash-dev", To: ""}, {From: "api", To: "web-1"},
+		}}, "cubes api-clash-dev and web-clash-dev both get the container name web-1"},
+		{"reserved container", models.CloneWorkspaceRequest{Name: "clash-copy", CubeNames: []models.RewriteRule{
+			{From: "api-clash-dev", To: "turplecubes-proxy"}, {From: "clash-dev", To: "clash-copy"},
+		}}, "turplecubes-proxy is reserved"},
+		{"cube of the source", models.CloneWorkspaceRequest{Name: "clash-copy", CubeNames: []models.RewriteRule{
+			{From: "-clash-dev", To: "-clash-copy"}, {From: "api-clash-copy", To: "web-clash-dev-2"},
+		}}, "web-clash-dev-2 is used by another cube"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, _, err := Derive(sourceID, test.request)
+			var invalid *InvalidError
+			if !errors.As(err, &invalid) || !strings.Contains(err.Error(), test.want) {
+				t.Fatalf("err = %v, want an invalid copy: %s", err, test.want)
+			}
+		})
+	}
+
+	// A promotion replaces the cubes of its target, their names are not taken
+	derived, _, err := Derive(sourceID, models.CloneWorkspaceRequest{Name: "clash-stage"})
+	if err != nil || derived.Cubes[0].Name != "api-clash-stage" {
+		t.Fatalf("promotion = %+v, %v", derived, err)
+	}
+}
@@ -0,0 +1,406 @@
+package spec
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/turplespace/portos/pkg/models"
+	"gopkg.in/yaml.v3"
+)
+
+// composeDefaultNetwork is the network compose connects services to when they do not list any
+const composeDefaultNetwork = "default"
+
+// composeVolumeRoot is the host directory of named volumes and relative bind mounts of an imported workspace
+const composeVolumeRoot = "[DEFAULT]/${WORKSPACE_NAME}"
+
+// composeDrivers are the network drivers a workspace network accepts
+var composeDrivers = map[string]bool{"bridge": true, "overlay": true, "macvlan": true, "ipvlan": true}
+
+/*
+ParseCompose converts a docker-compose file (version 3) into a workspace spec named after its
+top-level name. Services become cubes named after their container_name, or their service name.
+Keys with no equivalent on a cube are ignored and reported in the returned warnings, as are the
+options of the supported keys that are dropped on the way.
+*/
+func ParseCompose(data []byte) (*models.WorkspaceSpec, []string, error) {
+	var file map[string]interface{}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, nil, invalid("invalid compose file: %v", err)
+	}
+	services, ok := file["services"].(map[string]interface{})
+	if !ok || len(services) == 0 {
+		return nil, nil, invalid("compose file has no services")
+	}
+
+	c := &composeParser{}
+	spec := &models.WorkspaceSpec{Cubes: []models.CubeSpec{}}
+	for _, key := range sortedKeys(file) {
+		switch {
+		case key == "name":
+			spec.Name = scalar(file[key])
+		case key == "version" || key == "services" || key == "networks" || key == "volumes" || strings.HasPrefix(key, "x-"):
+		default:
+			c.warn("%s is not supported and was ignored", key)
+		}
+	}
+	c.parseVolumes(file["volumes"])
+
+	// Services are referenced by service name, cubes by container name
+	names := make(map[string]string, len(services))
+	for _, service := range sortedKeys(services) {
+		names[service] = service
+		if definition, ok := services[service].(map[string]interface{}); ok {
+			if name := scalar(definition["container_name"]); name != "" {
+				names[service] = name
+			}
+		}
+	}
+
+	joined := make(map[string]bool)
+	for _, service := range sortedKeys(services) {
+		definition, ok := services[service].(map[string]interface{})
+		if !ok {
+			return nil, nil, invalid("service %s must be a mapping", service)
+		}
+		cube, err := c.parseService(service, names, definition)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, network := range cube.Networks {
+			joined[network] = true
+		}
+		spec.Cubes = append(spec.Cubes, cube)
+	}
+	spec.Networks = c.parseNetworks(file["networks"], joined)
+	return spec, c.warnings, nil
+}
+
+type composeParser struct {
+	warnings []string
+}
+
+func (c *composeParser) warn(format string, args ...interface{}) {
+	c.warnings = append(c.warnings, fmt.Sprintf(format, args...))
+}
+
+// parseVolumes reports the top-level volumes that need more than a directory of the server
+func (c *composeParser) parseVolumes(value interface{}) {
+	volumes, _ := value.(map[string]interface{})
+	for _, name := range sortedKeys(volumes) {
+		options, _ := volumes[name].(map[string]interface{})
+		for _, key := range sortedKeys(options) {
+			c.warn("volumes.%s.%s is not supported, the volume is a directory of the server", name, key)
+		}
+	}
+}
+
+// parseNetworks declares the networks joined by the cubes, with the driver of their top-level definition
+func (c *composeParser) parseNetworks(value interface{}, joined map[string]bool) []models.NetworkSpec {
+	definitions, _ := value.(map[string]interface{})
+	var networks []models.NetworkSpec
+	for _, name := range sortedKeys(joined) {
+		network := models.NetworkSpec{Name: name}
+		options, _ := definitions[name].(map[string]interface{})
+		for _, key := range sortedKeys(options) {
+			switch key {
+			case "driver":
+				driver := scalar(options[key])
+				if composeDrivers[driver] {
+					network.Driver = driver
+				} else {
+					c.warn("networks.%s.driver %s is not supported, the network uses bridge", name, driver)
+				}
+			case "external":
+				c.warn("networks.%s.external is not supported, the network is created for the workspace", name)
+			default:
+				c.warn("networks.%s.%s is not supported and was ignored", name, key)
+			}
+		}
+		networks = append(networks, network)
+	}
+	for _, name := range sortedKeys(definitions) {
+		if !joined[name] {
+			c.warn("network %s is not used by any service and was ignored", name)
+		}
+	}
+	return networks
+}
+
+func (c *composeParser) parseService(service string, names map[string]string, definition map[string]interface{}) (models.CubeSpec, error) {
+	cube := models.CubeSpec{Name: names[service], Image: scalar(definition["image"])}
+	if cube.Image == "" {
+		return cube, invalid("service %s has no image, building images is not supported", service)
+	}
+
+	for _, key := range sortedKeys(definition) {
+		value := definition[key]
+		field := fmt.Sprintf("services.%s.%s", service, key)
+		switch key {
+		case "image", "container_name":
+		case "build":
+			c.warn("%s is not supported, the image %s is used", field, cube.Image)
+		case "ports":
+			cube.Ports = c.parsePorts(field, value)
+		case "environment":
+			cube.EnvironmentVars = c.parseEnvironment(field, value)
+		case "volumes":
+			cube.Volumes = c.parseServiceVolumes(service, field, value)
+		case "labels":
+			cube.Labels = keyValues(value)
+		case "depends_on":
+			cube.DependsOn = c.parseDependsOn(field, value, names)
+		case "networks":
+			cube.Networks = c.parseServiceNetworks(field, value)
+		case "cpus":
+			cube.ResourceLimits.CPUs = scalar(value)
+		case "mem_limit":
+			cube.ResourceLimits.Memory = scalar(value)
+		case "deploy":
+			c.parseDeploy(field, value, &cube)
+		default:
+			c.warn("%s is not supported and was ignored", field)
+		}
+	}
+	if _, ok := definition["networks"]; !ok {
+		if _, ok := definition["network_mode"]; !ok {
+			cube.Networks = []string{composeDefaultNetwork}
+		}
+	}
+	return cube, nil
+}
+
+// parsePorts converts the short and long port syntaxes into docker -p mappings
+func (c *composeParser) parsePorts(field string, value interface{}) []string {
+	items, _ := value.([]interface{})
+	var ports []string
+	for _, item := range items {
+		port, ok := item.(map[string]interface{})
+		if !ok {
+			ports = append(ports, scalar(item))
+			continue
+		}
+
+		mapping := scalar(port["target"])
+		if published := scalar(port["published"]); published != "" {
+			mapping = published + ":" + mapping
+		}
+		if hostIP := scalar(port["host_ip"]); hostIP != "" {
+			mapping = hostIP + ":" + mapping
+		}
+		if protocol := scalar(port["protocol"]); protocol != "" {
+			mapping += "/" + protocol
+		}
+		if mode := scalar(port["mode"]); mode != "" && mode != "host" {
+			c.warn("%s mode %s is not supported, port %s is published on the host", field, mode, mapping)
+		}
+		ports = append(ports, mapping)
+	}
+	return ports
+}
+
+// parseEnvironment converts the list and mapping syntaxes into KEY=value, variables without a value are skipped
+func (c *composeParser) parseEnvironment(field string, value interface{}) []string {
+	var env []string
+	add := func(key string, value string, set bool) {
+		if !set {
+			c.warn("%s.%s has no value and was ignored", field, key)
+			return
+		}
+		env = append(env, key+"="+value)
+	}
+	switch items := value.(type) {
+	case []interface{}:
+		for _, item := range items {
+			key, value, set := strings.Cut(scalar(item), "=")
+			add(key, value, set)
+		}
+	case map[string]interface{}:
+		for _, key := range sortedKeys(items) {
+			add(key, scalar(items[key]), items[key] != nil)
+		}
+	}
+	return env
+}
+
+/*
+parseServiceVolumes converts the short and long volume syntaxes into host path mappings. Absolute
+bind mounts are kept, named volumes and relative bind mounts become directories of the workspace
+under the default volume directory. Access modes are dropped.
+*/
+func (c *composeParser) parseServiceVolumes(service string, field string, value interface{}) map[string]string {
+	items, _ := value.([]interface{})
+	volumes := make(map[string]string, len(items))
+	for _, item := range items {
+		var source, target, mode string
+		if volume, ok := item.(map[string]interface{}); ok {
+			if volumeType := scalar(volume["type"]); volumeType != "" && volumeType != "volume" && volumeType != "bind" {
+				c.warn("%s of type %s is not supported and was ignored", field, volumeType)
+				continue
+			}
+			source, target = scalar(volume["source"]), scalar(volume["target"])
+			if readOnly, _ := volume["read_only"].(bool); readOnly {
+				mode = "ro"
+			}
+		} else {
+			parts := strings.Split(scalar(item), ":")
+			switch len(parts) {
+			case 1:
+				target = parts[0]
+			case 2:
+				source, target = parts[0], parts[1]
+			default:
+				source, target, mode = parts[0], parts[1], strings.Join(parts[2:], ":")
+			}
+		}
+
+		switch {
+		case target == "":
+			c.warn("%s has a volume without target and was ignored", field)
+			continue
+		case source == "":
+			c.warn("%s anonymous volume %s is not supported and was ignored", field, target)
+			continue
+		case strings.HasPrefix(source, "/"):
+		case strings.HasPrefix(source, ".") || strings.HasPrefix(source, "~"):
+			relative := strings.TrimLeft(path.Clean(strings.TrimPrefix(source, "~")), "./")
+			if relative == "" {
+				relative = service
+			}
+			mapped := composeVolumeRoot + "/" + relative
+			c.warn("%s bind mount %s is relative to the compose file, it was mapped to %s", field, source, mapped)
+			source = mapped
+		default:
+			source = composeVolumeRoot + "/" + source
+		}
+		if mode != "" && mode != "rw" {
+			c.warn("%s mode %s of %s is not supported, the volume is mounted read-write", field, mode, target)
+		}
+		volumes[source] = target
+	}
+	return volumes
+}
+
+// parseDependsOn converts the list and mapping syntaxes into cube names, start conditions are not awaited
+func (c *composeParser) parseDependsOn(field string, value interface{}, names map[string]string) []string {
+	var services []string
+	switch items := value.(type) {
+	case []interface{}:
+		for _, item := range items {
+			services = append(services, scalar(item))
+		}
+	case map[string]interface{}:
+		for _, service := range sortedKeys(items) {
+			services = append(services, service)
+			options, _ := items[service].(map[string]interface{})
+			if condition := scalar(options["condition"]); condition != "" && condition != "service_started" {
+				c.warn("%s.%s.condition %s is not supported, the cube is only deployed first", field, service, condition)
+			}
+		}
+	}
+
+	dependsOn := make([]string, 0, len(services))
+	for _, service := range services {
+		name, ok := names[service]
+		if !ok {
+			// Unknown services are kept so that the spec check reports them
+			name = service
+		}
+		dependsOn = append(dependsOn, name)
+	}
+	return dependsOn
+}
+
+// parseServiceNetworks converts the list and mapping syntaxes into network names, per network options are dropped
+func (c *composeParser) parseServiceNetworks(field string, value interface{}) []string {
+	var networks []string
+	switch items := value.(type) {
+	case []interface{}:
+		for _, item := range items {
+			networks = append(networks, scalar(item))
+		}
+	case map[string]interface{}:
+		for _, network := range sortedKeys(items) {
+			networks = append(networks, network)
+			options, _ := items[network].(map[string]interface{})
+			for _, key := range sortedKeys(options) {
+				c.warn("%s.%s.%s is not supported and was ignored", field, network, key)
+			}
+		}
+	}
+	return networks
+}
+
+// parseDeploy reads the replicas and resource limits of the deploy section, the rest of it has no equivalent on a cube
+func (c *composeParser) parseDeploy(field string, value interface{}, cube *models.CubeSpec) {
+	deploy, _ := value.(map[string]interface{})
+	limits := &cube.ResourceLimits
+	for _, key := range sortedKeys(deploy) {
+		if key == "replicas" {
+			replicas, err := strconv.Atoi(scalar(deploy[key]))
+			if err != nil || replicas < 1 {
+				c.warn("%s.replicas %v is not a number of replicas and was ignored", field, deploy[key])
+				continue
+			}
+			cube.Replicas = replicas
+			continue
+		}
+		if key != "resources" {
+			c.warn("%s.%s is not supported and was ignored", field, key)
+			continue
+		}
+		resources, _ := deploy[key].(map[string]interface{})
+		for _, kind := range sortedKeys(resources) {
+			if kind != "limits" {
+				c.warn("%s.resources.%s is not supported and was ignored", field, kind)
+				continue
+			}
+			values, _ := resources[kind].(map[string]interface{})
+			for _, name := range sortedKeys(values) {
+				switch name {
+				case "cpus":
+					limits.CPUs = scalar(values[name])
+				case "memory":
+					limits.Memory = scalar(values[name])
+				default:
+					c.warn("%s.resources.limits.%s is not supported and was ignored", field, name)
+				}
+			}
+		}
+	}
+}
+
+// keyValues converts the list and mapping syntaxes of labels into key=value
+func keyValues(value interface{}) []string {
+	var pairs []string
+	switch items := value.(type) {
+	case []interface{}:
+		for _, item := range items {
+			pairs = append(pairs, scalar(item))
+		}
+	case map[string]interface{}:
+		for _, key := range sortedKeys(items) {
+			pairs = append(pairs, key+"="+scalar(items[key]))
+		}
+	}
+	return pairs
+}
+
+// scalar returns a YAML scalar as written, compose allows numbers and booleans where strings are expected
+func scalar(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,71 @@
+package spec
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseCompose(t *testing.T) {
+	spec, warnings, err := ParseCompose([]byte(`
+name: shop
+services:
+  shop-db:
+    image: postgres:16
+    environment:
+      POSTGRES_PASSWORD: secret
+    volumes:
+      - data:/var/lib/postgresql/data
+    restart: always
+  web:
+    image: nginx:1.27
+    container_name: shop-web
+    ports:
+      - "8080:80"
+    depends_on:
+      shop-db:
+        condition: service_healthy
+    deploy:
+      resources:
+        limits:
+          cpus: "0.5"
+          memory: 256M
+volumes:
+  data:
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	for _, want := range []string{"services.shop-db.restart is not supported", "condition service_healthy is not supported"} {
+		if !strings.Contains(strings.Join(warnings, "\n"), want) {
+			t.Errorf("warnings = %q, want %q", warnings, want)
+		}
+	}
+
+	if spec.Name != "shop" || len(spec.Cubes) != 2 || len(spec.Networks) != 1 || spec.Networks[0].Name != "default" {
+		t.Fatalf("spec = %+v", spec)
+	}
+	db, web := spec.Cubes[0], spec.Cubes[1]
+	if db.Volumes["[DEFAULT]/${WORKSPACE_NAME}/data"] != "/var/lib/postgresql/data" || len(db.EnvironmentVars) != 1 {
+		t.Errorf("db = %+v", db)
+	}
+	// Cubes are named after their container name, and so are their dependencies
+	if web.Name != "shop-web" || len(web.DependsOn) != 1 || web.DependsOn[0] != "shop-db" || web.ResourceLimits.CPUs != "0.5" || web.ResourceLimits.Memory != "256M" {
+		t.Errorf("web = %+v", web)
+	}
+	if plan, err := NewPlan(*spec); err != nil || len(plan.Changes) != 4 {
+		t.Errorf("plan of the imported spec = %+v, %v, want the workspace, its network and two cubes", plan, err)
+	}
+}
+
+func TestParseComposeRejectsInvalidFiles(t *testing.T) {
+	for name, data := range map[string]string{
+		"not YAML":    "services: [",
+		"no services": "name: empty\n",
+	} {
+		var invalid *InvalidError
+		if _, _, err := ParseCompose([]byte(data)); !errors.As(err, &invalid) {
+			t.Errorf("%s: err = %v, want an invalid compose file", name, err)
+		}
+	}
+}
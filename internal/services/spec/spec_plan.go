@@ -0,0 +1,538 @@
+package spec
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/internal/services/audit"
+	"github.com/turplespace/portos/internal/services/deploy"
+	"github.com/turplespace/portos/internal/services/docker"
+	"github.com/turplespace/portos/internal/services/proxy"
+	"github.com/turplespace/portos/internal/services/quota"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+// InvalidError is returned when a spec contradicts itself or claims what another workspace owns
+type InvalidError struct {
+	Message string
+}
+
+func (e *InvalidError) Error() string {
+	return e.Message
+}
+
+func invalid(format string, args ...interface{}) error {
+	return &InvalidError{Message: fmt.Sprintf(format, args...)}
+}
+
+/*
+Plan is a workspace spec compared with the stored workspace and its containers. The changes
+are stored by Apply in a single transaction, the runtime steps run after they are stored.
+*/
+type Plan struct {
+	WorkspaceID int // 0 when the workspace is created
+	Changes     []models.PlanChange
+
+	stored            database.SpecChanges
+	recreate          []string        // Running cubes recreated with their new spec
+	stop              []string        // Running containers of deleted cubes
+	recreatedNetworks []string        // Networks removed before their cubes are recreated, to change their driver
+	stopForNetwork    []string        // Running cubes stopped so that their network can be removed
+	staleDomains      []string        // Expanded domains whose proxy configuration is removed
+	proxied           map[string]bool // Cubes whose proxy configurations are regenerated when running
+	proxies           map[string][]models.ProxySpec
+	workspaceName     string
+	variables         []database.WorkspaceVariable
+}
+
+// state is a workspace as stored, with the state of its containers
+type state struct {
+	workspace *database.Workspace // nil when the workspace does not exist
+	cubes     []models.Container
+	proxies   map[string][]models.Proxy // By cube name
+	variables []database.WorkspaceVariable
+	networks  []database.WorkspaceNetwork
+	running   map[string]docker.ContainerState
+}
+
+// load reads a workspace by name with the state of its containers, a missing workspace gives an empty state
+func load(name string) (*state, error) {
+	current := &state{proxies: map[string][]models.Proxy{}, running: map[string]docker.ContainerState{}}
+	workspaceID, err := database.GetWorkspaceIDByName(name)
+	if errors.Is(err, database.ErrNotFound) {
+		return current, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if current, err = loadByID(workspaceID); err != nil {
+		return nil, err
+	}
+	if current.running, err = docker.ListManagedContainers(workspaceID); err != nil {
+		return nil, err
+	}
+	return current, nil
+}
+
+// loadByID reads a workspace without the state of its containers
+func loadByID(workspaceID int) (*state, error) {
+	current := &state{proxies: map[string][]models.Proxy{}}
+	var err error
+	if current.workspace, err = database.GetWorkspaceByID(workspaceID); err != nil {
+		return nil, err
+	}
+	if current.cubes, err = database.ListContainersInWorkspace(workspaceID); err != nil {
+		return nil, err
+	}
+	for _, cube := range current.cubes {
+		if current.proxies[cube.Name], err = database.GetProxiesByCubeID(cube.ID); err != nil {
+			return nil, err
+		}
+	}
+	if current.variables, err = database.ListWorkspaceVariables(workspaceID); err != nil {
+		return nil, err
+	}
+	if current.networks, err = database.ListWorkspaceNetworks(workspaceID); err != nil {
+		return nil, err
+	}
+	return current, nil
+}
+
+// runningContainers returns the names of the running containers of a stored cube
+func (s *state) runningContainers(cube models.Container) []string {
+	names := []string{}
+	for _, replica := range deploy.Replicas(s.running, cube) {
+		if replica.State == "running" {
+			names = append(names, replica.Name)
+		}
+	}
+	return names
+}
+
+func (s *state) isRunning(cube models.Container) bool {
+	return len(s.runningContainers(cube)) > 0
+}
+
+/*
+NewPlan compares a spec with the workspace of the same name. Objects are matched by name, proxies
+by domain. A running cube is recreated when its spec changes, or when its rendered environment,
+labels or volumes change with the workspace variables, or when a network it joins changes driver.
+*/
+func NewPlan(spec models.WorkspaceSpec) (*Plan, error) {
+	if err := check(spec); err != nil {
+		return nil, err
+	}
+	current, err := load(spec.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{
+		proxied:       map[string]bool{},
+		proxies:       map[string][]models.ProxySpec{},
+		workspaceName: spec.Name,
+	}
+	plan.stored.Name, plan.stored.Desc = spec.Name, spec.Desc
+	if current.workspace == nil {
+		plan.add(models.PlanCreate, "workspace", spec.Name, nil)
+	} else {
+		plan.WorkspaceID = current.workspace.ID
+		plan.stored.WorkspaceID = current.workspace.ID
+		if current.workspace.Desc != spec.Desc {
+			plan.add(models.PlanUpdate, "workspace", spec.Name, []models.FieldChange{{Field: "desc", Before: current.workspace.Desc, After: spec.Desc}})
+		}
+	}
+
+	plan.diffVariables(spec, current)
+	changedNetworks := plan.diffNetworks(spec, current)
+	plan.diffCubes(spec, current, changedNetworks)
+	if err := plan.checkContainerNames(); err != nil {
+		return nil, err
+	}
+	if err := plan.diffProxies(spec, current); err != nil {
+		return nil, err
+	}
+	if err := plan.checkProxyDomains(spec); err != nil {
+		return nil, err
+	}
+
+	if plan.WorkspaceID != 0 {
+		cubes := append(append([]models.Container{}, plan.stored.UpdateCubes...), plan.stored.CreateCubes...)
+		for _, cube := range current.cubes {
+			if !contains(plan.stored.DeleteCubes, cube.ID) && !containsCube(cubes, cube.Name) {
+				cubes = append(cubes, cube)
+			}
+		}
+		proxies := 0
+		for _, cube := range spec.Cubes {
+			proxies += len(cube.Proxies)
+		}
+		if err := quota.CheckSpec(plan.WorkspaceID, cubes, proxies); err != nil {
+			return nil, err
+		}
+	}
+	return plan, nil
+}
+
+// check validates what the validate tags of a spec cannot
+func check(spec models.WorkspaceSpec) error {
+	for name := range spec.Variables {
+		if !deploy.ValidVariableName(name) {
+			return invalid("invalid variable name %q, use letters, digits and underscores other than the built-in %s and %s", name, deploy.VariableWorkspaceName, deploy.VariableCubeName)
+		}
+	}
+
+	networks := make(map[string]bool)
+	for _, network := range spec.Networks {
+		if networks[network.Name] {
+			return invalid("network %s is declared twice", network.Name)
+		}
+		networks[network.Name] = true
+	}
+
+	cubes := make(map[string]bool)
+	domains := make(map[string]bool)
+	for _, cube := range spec.Cubes {
+		if cubes[cube.Name] {
+			return invalid("cube %s is declared twice", cube.Name)
+		}
+		cubes[cube.Name] = true
+		for _, network := range cube.Networks {
+			if !networks[network] {
+				return invalid("cube %s joins network %s, which the spec does not declare", cube.Name, network)
+			}
+		}
+		for _, proxy := range cube.Proxies {
+			if domains[proxy.Domain] {
+				return invalid("domain %s is declared twice", proxy.Domain)
+			}
+			domains[proxy.Domain] = true
+		}
+	}
+	return checkDependencies(spec.Cubes, cubes)
+}
+
+// checkDependencies rejects dependencies on cubes the spec does not declare and dependency cycles
+func checkDependencies(specs []models.CubeSpec, cubes map[string]bool) error {
+	dependsOn := make(map[string][]string, len(specs))
+	for _, cube := range specs {
+		for _, name := range cube.DependsOn {
+			if !cubes[name] {
+				return invalid("cube %s depends on cube %s, which the spec does not declare", cube.Name, name)
+			}
+		}
+		dependsOn[cube.Name] = cube.DependsOn
+	}
+
+	// Cubes are marked while their dependencies are visited, reaching a marked cube again is a cycle
+	visiting := make(map[string]bool)
+	done := make(map[string]bool)
+	var visit func(name string) error
+	visit = func(name string) error {
+		if done[name] {
+			return nil
+		}
+		if visiting[name] {
+			return invalid("cube %s depends on itself through depends_on", name)
+		}
+		visiting[name] = true
+		for _, dependency := range dependsOn[name] {
+			if err := visit(dependency); err != nil {
+				return err
+			}
+		}
+		visiting[name] = false
+		done[name] = true
+		return nil
+	}
+	for _, cube := range specs {
+		if err := visit(cube.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (p *Plan) add(action string, kind string, name string, fields []models.FieldChange) {
+	p.Changes = append(p.Changes, models.PlanChange{Action: action, Kind: kind, Name: name, Fields: fields})
+}
+
+func (p *Plan) diffVariables(spec models.WorkspaceSpec, current *state) {
+	before := make(map[string]string, len(current.variables))
+	for _, variable := range current.variables {
+		before[variable.Name] = variable.Value
+	}
+
+	p.stored.SetVariables = map[string]string{}
+	for _, name := range sortedKeys(spec.Variables) {
+		value := spec.Variables[name]
+		p.variables = append(p.variables, database.WorkspaceVariable{Name: name, Value: value})
+		old, ok := before[name]
+		switch {
+		case !ok:
+			p.add(models.PlanCreate, "variable", name, nil)
+		case old != value:
+			p.add(models.PlanUpdate, "variable", name, []models.FieldChange{{Field: "value", Before: old, After: value}})
+		default:
+			continue
+		}
+		p.stored.SetVariables[name] = value
+	}
+	for _, variable := range current.variables {
+		if _, ok := spec.Variables[variable.Name]; !ok {
+			p.add(models.PlanDelete, "variable", variable.Name, nil)
+			p.stored.DeleteVariables = append(p.stored.DeleteVariables, variable.Name)
+		}
+	}
+}
+
+// diffNetworks returns the networks recreated with another driver
+func (p *Plan) diffNetworks(spec models.WorkspaceSpec, current *state) map[string]bool {
+	before := make(map[string]string, len(current.networks))
+	for _, network := range current.networks {
+		before[network.Name] = network.Driver
+	}
+
+	changed := make(map[string]bool)
+	desired := make(map[string]bool, len(spec.Networks))
+	for _, network := range spec.Networks {
+		desired[network.Name] = true
+		old, ok := before[network.Name]
+		switch {
+		case !ok:
+			p.add(models.PlanCreate, "network", network.Name, nil)
+		case driver(old) != driver(network.Driver):
+			// Docker cannot change the driver of a network, it is removed and created again
+			p.add(models.PlanRecreate, "network", network.Name, []models.FieldChange{{Field: "driver", Before: driver(old), After: driver(network.Driver)}})
+			p.recreatedNetworks = append(p.recreatedNetworks, network.Name)
+			changed[network.Name] = true
+		default:
+			continue
+		}
+		p.stored.SetNetworks = append(p.stored.SetNetworks, database.WorkspaceNetwork{Name: network.Name, Driver: network.Driver})
+	}
+	for _, network := range current.networks {
+		if !desired[network.Name] {
+			p.add(models.PlanDelete, "network", network.Name, nil)
+			p.stored.DeleteNetworks = append(p.stored.DeleteNetworks, network.Name)
+		}
+	}
+	return changed
+}
+
+func driver(name string) string {
+	if name == "" {
+		return "bridge"
+	}
+	return name
+}
+
+func (p *Plan) diffCubes(spec models.WorkspaceSpec, current *state, changedNetworks map[string]bool) {
+	before := make(map[string]models.Container, len(current.cubes))
+	for _, cube := range current.cubes {
+		before[cube.Name] = cube
+	}
+	workspaceName := spec.Name
+	oldVariables := current.variables
+
+	desired := make(map[string]bool, len(spec.Cubes))
+	for _, cubeSpec := range spec.Cubes {
+		desired[cubeSpec.Name] = true
+		cube := cubeSpec.Container()
+		old, ok := before[cube.Name]
+		if !ok {
+			p.add(models.PlanCreate, "cube", cube.Name, nil)
+			p.stored.CreateCubes = append(p.stored.CreateCubes, cube)
+			continue
+		}
+		cube.ID = old.ID
+
+		compared := cubeSpec
+		compared.Proxies = nil
+		fields := fieldChanges(audit.Diff(audit.Snapshot(SpecOf(old, nil)), audit.Snapshot(compared)))
+		rendered := audit.Diff(
+			audit.Snapshot(deploy.RenderWith(workspaceName, oldVariables, old)),
+			audit.Snapshot(deploy.RenderWith(workspaceName, p.variables, cube)),
+		)
+		leavesNetwork := false
+		for _, network := range old.Networks {
+			leavesNetwork = leavesNetwork || changedNetworks[network]
+		}
+		if len(fields) > 0 {
+			p.stored.UpdateCubes = append(p.stored.UpdateCubes, cube)
+		}
+
+		switch {
+		case current.isRunning(old) && (len(rendered) > 0 || leavesNetwork):
+			p.add(models.PlanRecreate, "cube", cube.Name, fields)
+			p.recreate = append(p.recreate, cube.Name)
+			p.proxied[cube.Name] = true
+			if leavesNetwork {
+				p.stopForNetwork = append(p.stopForNetwork, current.runningContainers(old)...)
+			}
+		case len(fields) > 0:
+			p.add(models.PlanUpdate, "cube", cube.Name, fields)
+		}
+	}
+
+	for _, cube := range current.cubes {
+		if desired[cube.Name] {
+			continue
+		}
+		p.add(models.PlanDelete, "cube", cube.Name, nil)
+		p.stored.DeleteCubes = append(p.stored.DeleteCubes, cube.ID)
+		p.stop = append(p.stop, current.runningContainers(cube)...)
+	}
+}
+
+// checkContainerNames rejects the created and updated cubes whose containers could take the name of a container of another workspace
+func (p *Plan) checkContainerNames() error {
+	for _, cube := range append(append([]models.Container{}, p.stored.CreateCubes...), p.stored.UpdateCubes...) {
+		err := database.CheckContainerNames(cube, p.WorkspaceID)
+		if errors.Is(err, database.ErrNameTaken) {
+			return invalid("%v", err)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkProxyDomains checks the domains of the proxies of the spec once expanded with its variables,
+// they must be host names and not serve the domain of a proxy of another workspace or of the spec
+func (p *Plan) checkProxyDomains(spec models.WorkspaceSpec) error {
+	domains, err := deploy.LoadProxyDomains(nil)
+	if err != nil {
+		return err
+	}
+	seen := map[string]string{}
+	for _, cube := range spec.Cubes {
+		for _, proxySpec := range cube.Proxies {
+			domain := deploy.ExpandProxyDomainWith(spec.Name, p.variables, cube.Name, proxySpec.Domain)
+			err := domains.Check(domain, 0, p.WorkspaceID)
+			if errors.Is(err, proxy.ErrInvalidConfig) {
+				return invalid("proxy %s of cube %s: %v", proxySpec.Domain, cube.Name, err)
+			}
+			if err != nil {
+				return err
+			}
+			if other, ok := seen[strings.ToLower(domain)]; ok {
+				return invalid("proxies %s and %s both expand to the domain %s", other, proxySpec.Domain, domain)
+			}
+			seen[strings.ToLower(domain)] = proxySpec.Domain
+		}
+	}
+	return nil
+}
+
+// proxyFields are the compared fields of a proxy
+type proxyFields struct {
+	Cube    string `json:"cube"`
+	Port    int    `json:"port"`
+	Type    string `json:"type"`
+	Default bool   `json:"default"`
+}
+
+func (p *Plan) diffProxies(spec models.WorkspaceSpec, current *state) error {
+	type storedProxy struct {
+		proxy    models.Proxy
+		cubeName string
+	}
+	before := make(map[string]storedProxy)
+	for cubeName, proxies := range current.proxies {
+		for _, proxy := range proxies {
+			before[proxy.Domain] = storedProxy{proxy: proxy, cubeName: cubeName}
+		}
+	}
+
+	desired := make(map[string]bool)
+	for _, cube := range spec.Cubes {
+		p.proxies[cube.Name] = cube.Proxies
+		for _, proxy := range cube.Proxies {
+			desired[proxy.Domain] = true
+			stored := database.SpecProxy{CubeName: cube.Name, Domain: proxy.Domain, Port: proxy.Port, Type: proxy.Type, Default: proxy.Default}
+			old, ok := before[proxy.Domain]
+			if !ok {
+				if id, err := database.GetProxyIDByDomain(proxy.Domain); err == nil {
+					workspaceID, err := database.GetWorkspaceIDByProxyID(id)
+					if err != nil || workspaceID != p.WorkspaceID {
+						return invalid("domain %s is used by a proxy of another workspace", proxy.Domain)
+					}
+				}
+				p.add(models.PlanCreate, "proxy", proxy.Domain, nil)
+				p.stored.CreateProxies = append(p.stored.CreateProxies, stored)
+				p.proxied[cube.Name] = true
+				continue
+			}
+
+			// A domain expanding differently with the new variables leaves a stale configuration behind
+			oldDomain := deploy.ExpandProxyDomainWith(spec.Name, current.variables, old.cubeName, proxy.Domain)
+			if oldDomain != deploy.ExpandProxyDomainWith(spec.Name, p.variables, cube.Name, proxy.Domain) {
+				p.staleDomains = append(p.staleDomains, oldDomain)
+				p.proxied[cube.Name] = true
+			}
+
+			fields := fieldChanges(audit.Diff(
+				audit.Snapshot(proxyFields{Cube: old.cubeName, Port: old.proxy.Port, Type: old.proxy.Type, Default: old.proxy.Default}),
+				audit.Snapshot(proxyFields{Cube: cube.Name, Port: proxy.Port, Type: proxy.Type, Default: proxy.Default}),
+			))
+			if len(fields) > 0 {
+				stored.ID = old.proxy.ID
+				p.add(models.PlanUpdate, "proxy", proxy.Domain, fields)
+				p.stored.UpdateProxies = append(p.stored.UpdateProxies, stored)
+				p.proxied[cube.Name] = true
+			}
+		}
+	}
+
+	for _, domain := range sortedKeys(before) {
+		if desired[domain] {
+			continue
+		}
+		old := before[domain]
+		p.add(models.PlanDelete, "proxy", domain, nil)
+		p.stored.DeleteProxies = append(p.stored.DeleteProxies, old.proxy.ID)
+		p.staleDomains = append(p.staleDomains, deploy.ExpandProxyDomainWith(spec.Name, current.variables, old.cubeName, domain))
+	}
+	return nil
+}
+
+// fieldChanges converts the changes of audit.Diff to those of a plan
+func fieldChanges(changes []database.FieldChange) []models.FieldChange {
+	var fields []models.FieldChange
+	for _, change := range changes {
+		fields = append(fields, models.FieldChange{Field: change.Field, Before: change.Before, After: change.After})
+	}
+	return fields
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func contains(ids []int, id int) bool {
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
+
+func containsCube(cubes []models.Container, name string) bool {
+	for _, cube := range cubes {
+		if cube.Name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+package spec
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+// actions lists the changes of a plan as "action kind name"
+func actions(changes []models.PlanChange) string {
+	var actions []string
+	for _, change := range changes {
+		actions = append(actions, change.Action+" "+change.Kind+" "+change.Name)
+	}
+	return strings.Join(actions, ",")
+}
+
+// apply plans a spec and applies it, failing the test on an error
+func apply(t *testing.T, spec models.WorkspaceSpec) models.ApplyResponse {
+	t.Helper()
+	plan, err := NewPlan(spec)
+	if err != nil {
+		t.Fatalf("plan %s: %v", spec.Name, err)
+	}
+	result, err := plan.Apply("test")
+	if err != nil {
+		t.Fatalf("apply %s: %v", spec.Name, err)
+	}
+	return result
+}
+
+func TestPlanAndApply(t *testing.T) {
+	spec := models.WorkspaceSpec{
+		Name:      "applied",
+		Variables: map[string]string{"DOMAIN": "example.com"},
+		Networks:  []models.NetworkSpec{{Name: "backend"}},
+		Cubes: []models.CubeSpec{
+			{Name: "applied-web", Image: "nginx:latest", Networks: []string{"backend"}, Proxies: []models.ProxySpec{{Domain: "web.${DOMAIN}", Port: 80}}},
+			{Name: "applied-api", Image: "node:20"},
+		},
+	}
+
+	plan, err := NewPlan(spec)
+	if err != nil {
+		t.Fatalf("plan: %v", err)
+	}
+	want := "create workspace applied,create variable DOMAIN,create network backend,create cube applied-web,create cube applied-api,create proxy web.${DOMAIN}"
+	if got := actions(plan.Changes); got != want || plan.WorkspaceID != 0 {
+		t.Fatalf("plan = %s in workspace %d, want %s in no workspace", got, plan.WorkspaceID, want)
+	}
+
+	result := apply(t, spec)
+	if result.WorkspaceID == 0 || actions(result.Changes) != want {
+		t.Fatalf("apply = %+v", result)
+	}
+	if again, err := NewPlan(spec); err != nil || len(again.Changes) != 0 {
+		t.Fatalf("plan after apply = %+v, %v, want no changes", again, err)
+	}
+	exported, err := Export(result.WorkspaceID)
+	if err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if again, err := NewPlan(*exported); err != nil || len(again.Changes) != 0 {
+		t.Fatalf("plan of the exported spec = %+v, %v, want no changes", again, err)
+	}
+
+	spec.Cubes = spec.Cubes[:1]
+	spec.Cubes[0].Image = "nginx:1.27"
+	spec.Cubes[0].Proxies[0].Port = 8080
+	spec.Variables = nil
+	var invalid *InvalidError
+	if _, err := NewPlan(spec); !errors.As(err, &invalid) {
+		t.Errorf("proxy domain referencing a deleted variable = %v, want an invalid spec", err)
+	}
+	spec.Variables = map[string]string{"DOMAIN": "example.org"}
+	result = apply(t, spec)
+	want = "update variable DOMAIN,update cube applied-web,delete cube applied-api,update proxy web.${DOMAIN}"
+	if got := actions(result.Changes); got != want {
+		t.Errorf("apply changes = %s, want %s", got, want)
+	}
+	cubes, err := database.ListContainersInWorkspace(result.WorkspaceID)
+	if err != nil || len(cubes) != 1 || cubes[0].Image != "nginx:1.27" {
+		t.Errorf("cubes after apply = %+v, %v", cubes, err)
+	}
+
+	spec.Cubes[0].Networks = []string{"frontend"}
+	if _, err := NewPlan(spec); !errors.As(err, &invalid) || !strings.Contains(err.Error(), "network frontend") {
+		t.Errorf("undeclared network = %v, want an invalid spec", err)
+	}
+}
@@ -0,0 +1,65 @@
+package spec
+
+import (
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/internal/services/proxy"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+// TestMain runs the tests against a fresh database and a Docker daemon without containers
+func TestMain(m *testing.M) {
+	docker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("API-Version", "1.45")
+		w.Header().Set("Content-Type", "application/json")
+		switch {
+		case strings.HasSuffix(r.URL.Path, "/_ping"):
+			w.Write([]byte("OK"))
+		case strings.HasSuffix(r.URL.Path, "/containers/json"):
+			w.Write([]byte("[]"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"message":"No such container"}`))
+		}
+	}))
+	os.Setenv("DOCKER_HOST", "tcp://"+strings.TrimPrefix(docker.URL, "http://"))
+
+	path, err := database.GetPath()
+	if err != nil {
+		log.Fatal(err)
+	}
+	os.Remove(path)
+	database.Init()
+	if err := proxy.CreateFolderIfNotExists(); err != nil {
+		log.Fatal(err)
+	}
+
+	code := m.Run()
+	docker.Close()
+	os.Remove(path)
+	if executable, err := os.Executable(); err == nil {
+		os.RemoveAll(executable + "_proxy")
+	}
+	os.Exit(code)
+}
+
+// newWorkspace stores a workspace with cubes and returns its ID
+func newWorkspace(t *testing.T, name string, cubes ...models.Container) int {
+	t.Helper()
+	id, err := database.CreateWorkspace(name, "created by "+t.Name())
+	if err != nil {
+		t.Fatalf("create workspace %s: %v", name, err)
+	}
+	for _, cube := range cubes {
+		if _, err := database.InsertWorkspaceAndCubes(int(id), cube, "test"); err != nil {
+			t.Fatalf("insert cube %s: %v", cube.Name, err)
+		}
+	}
+	return int(id)
+}
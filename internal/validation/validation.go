@@ -0,0 +1,98 @@
+package validation
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+var (
+	validate     *validator.Validate
+	validateOnce sync.Once
+)
+
+// get returns the validator with the JSON field names and the custom rules registered
+func get() *validator.Validate {
+	validateOnce.Do(func() {
+		validate = validator.New(validator.WithRequiredStructEnabled())
+		validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				return ""
+			}
+			return name
+		})
+		for tag, rule := range rules {
+			validate.RegisterValidation(tag, rule)
+		}
+	})
+	return validate
+}
+
+// Struct validates a request model against its validate tags
+func Struct(v interface{}) error {
+	return get().Struct(v)
+}
+
+// Bind binds the request body and validates it
+func Bind(c echo.Context, v interface{}) error {
+	if err := c.Bind(v); err != nil {
+		return err
+	}
+	return Struct(v)
+}
+
+// Fields converts validation errors to field errors, other errors give nil
+func Fields(err error) []models.FieldError {
+	errs, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return nil
+	}
+
+	fields := make([]models.FieldError, 0, len(errs))
+	for _, fieldErr := range errs {
+		// The namespace starts with the name of the request struct
+		_, path, _ := strings.Cut(fieldErr.Namespace(), ".")
+		fields = append(fields, models.FieldError{
+			Field:   path,
+			Code:    fieldErr.Tag(),
+			Message: message(fieldErr),
+		})
+	}
+	return fields
+}
+
+// message describes a failed rule for humans
+func message(fieldErr validator.FieldError) string {
+	if text, ok := messages[fieldErr.Tag()]; ok {
+		return text
+	}
+	switch fieldErr.Tag() {
+	case "required", "required_with", "required_without":
+		return "is required"
+	case "min", "gte":
+		if fieldErr.Kind() == reflect.String {
+			return fmt.Sprintf("must be at least %s characters", fieldErr.Param())
+		}
+		return fmt.Sprintf("must be at least %s", fieldErr.Param())
+	case "max", "lte":
+		if fieldErr.Kind() == reflect.String {
+			return fmt.Sprintf("must be at most %s characters", fieldErr.Param())
+		}
+		return fmt.Sprintf("must be at most %s", fieldErr.Param())
+	case "gt":
+		return fmt.Sprintf("must be greater than %s", fieldErr.Param())
+	case "oneof":
+		return fmt.Sprintf("must be one of: %s", strings.ReplaceAll(fieldErr.Param(), " ", ", "))
+	case "len":
+		return fmt.Sprintf("must be %s characters long", fieldErr.Param())
+	case "numeric":
+		return "must only contain digits"
+	}
+	return fmt.Sprintf("failed the %s rule", fieldErr.Tag())
+}
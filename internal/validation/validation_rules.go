@@ -0,0 +1,206 @@
+package validation
+
+import (
+	"net"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/distribution/reference"
+	"github.com/docker/go-units"
+	"github.com/go-playground/validator/v10"
+	"github.com/turplespace/portos/internal/config"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+var (
+	containerNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+	workspaceNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9 _.-]*$`)
+	usernamePattern      = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.@-]*$`)
+	imageTagPattern      = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_.-]{0,127}$`)
+	envKeyPattern        = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_.-]*$`)
+	domainLabelPattern   = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+	variablePattern      = regexp.MustCompile(`\$\{[A-Za-z_][A-Za-z0-9_]*\}`)
+	networkNamePattern   = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,63}$`)
+)
+
+// rules are the custom validate tags, registered on first use
+var rules = map[string]validator.Func{
+	"container_name": func(fl validator.FieldLevel) bool { return containerNamePattern.MatchString(fl.Field().String()) },
+	"workspace_name": func(fl validator.FieldLevel) bool { return workspaceNamePattern.MatchString(fl.Field().String()) },
+	"username":       func(fl validator.FieldLevel) bool { return usernamePattern.MatchString(fl.Field().String()) },
+	"image_ref":      func(fl validator.FieldLevel) bool { return validImageReference(fl.Field().String()) },
+	"image_name":     func(fl validator.FieldLevel) bool { return validImageName(fl.Field().String()) },
+	"image_tag":      func(fl validator.FieldLevel) bool { return imageTagPattern.MatchString(fl.Field().String()) },
+	"cpus":           func(fl validator.FieldLevel) bool { return validCPUs(fl.Field().String()) },
+	"memory":         func(fl validator.FieldLevel) bool { return validMemory(fl.Field().String()) },
+	"port_mapping":   func(fl validator.FieldLevel) bool { return validPortMapping(fl.Field().String()) },
+	"env_var":        func(fl validator.FieldLevel) bool { return validEnvVar(fl.Field().String()) },
+	"label":          func(fl validator.FieldLevel) bool { return validLabel(fl.Field().String()) },
+	"volume_path":    func(fl validator.FieldLevel) bool { return validVolumePath(fl.Field().String()) },
+	"host_path":      func(fl validator.FieldLevel) bool { return validHostPath(fl.Field().String()) },
+	"proxy_domain":   func(fl validator.FieldLevel) bool { return validDomain(fl.Field().String()) },
+	"network_name":   func(fl validator.FieldLevel) bool { return networkNamePattern.MatchString(fl.Field().String()) },
+	"balancing":      func(fl validator.FieldLevel) bool { return slices.Contains(loadBalancingMethods, fl.Field().String()) },
+}
+
+var loadBalancingMethods = []string{models.LoadBalancingRoundRobin, models.LoadBalancingLeastConn, models.LoadBalancingIPHash, models.LoadBalancingRandom}
+
+// messages describe the custom rules, and the built-in rules that need more than the defaults
+var messages = map[string]string{
+	"container_name": "must start with a letter or digit and only contain letters, digits, _, . and -",
+	"workspace_name": "must start with a letter or digit and only contain letters, digits, spaces, _, . and -",
+	"username":       "must start with a letter or digit and only contain letters, digits, _, ., @ and -",
+	"image_ref":      "must be an image reference such as nginx, nginx:1.27 or registry.example.com/team/app:v2",
+	"image_name":     "must be a lowercase image name without tag, such as team/app",
+	"image_tag":      "must be a tag of up to 128 letters, digits, _, . and -",
+	"cpus":           "must be a positive number of CPU cores such as 0.5 or 2",
+	"memory":         "must be a memory size such as 512m or 2g",
+	"port_mapping":   "must be a port mapping such as 8080:80, 127.0.0.1:8080:80 or 53:53/udp with ports between 1 and 65535",
+	"env_var":        "must be KEY=value with a key of letters, digits and _, and no commas",
+	"label":          "must be key=value or key, without commas",
+	"volume_path":    "must be a path without commas or colons",
+	"host_path":      "must be a path under [DEFAULT] or under a volume root allowed by the admin, without commas or colons",
+	"proxy_domain":   "must be a domain name such as app.example.com, ${VAR} references are allowed",
+	"network_name":   "must be up to 64 letters, digits, _, . and -, starting with a letter or digit",
+	"balancing":      "must be round_robin, least_conn, ip_hash or random",
+}
+
+func validImageReference(value string) bool {
+	_, err := reference.ParseNormalizedNamed(value)
+	return err == nil
+}
+
+func validImageName(value string) bool {
+	named, err := reference.ParseNormalizedNamed(value)
+	return err == nil && reference.IsNameOnly(named)
+}
+
+func validCPUs(value string) bool {
+	cpus, err := strconv.ParseFloat(value, 64)
+	return err == nil && cpus > 0
+}
+
+func validMemory(value string) bool {
+	memory, err := units.RAMInBytes(value)
+	return err == nil && memory > 0
+}
+
+// validPortMapping accepts the docker -p syntax, [[ip:]hostPort:]containerPort[/protocol], with port ranges
+func validPortMapping(value string) bool {
+	if strings.Contains(value, ",") {
+		return false
+	}
+	mapping, protocol, found := strings.Cut(value, "/")
+	if found && protocol != "tcp" && protocol != "udp" && protocol != "sctp" {
+		return false
+	}
+
+	// An IPv6 host address is written in brackets
+	if strings.HasPrefix(mapping, "[") {
+		end := strings.Index(mapping, "]:")
+		if end < 0 || net.ParseIP(mapping[1:end]) == nil {
+			return false
+		}
+		mapping = mapping[end+2:]
+	} else if parts := strings.Split(mapping, ":"); len(parts) == 3 {
+		if net.ParseIP(parts[0]) == nil {
+			return false
+		}
+		mapping = parts[1] + ":" + parts[2]
+	}
+
+	parts := strings.Split(mapping, ":")
+	switch len(parts) {
+	case 1:
+		return validPortRange(parts[0])
+	case 2:
+		return (parts[0] == "" || validPortRange(parts[0])) && validPortRange(parts[1])
+	}
+	return false
+}
+
+func validPortRange(value string) bool {
+	start, end, isRange := strings.Cut(value, "-")
+	if !validPort(start) {
+		return false
+	}
+	if !isRange {
+		return true
+	}
+	first, _ := strconv.Atoi(start)
+	last, err := strconv.Atoi(end)
+	return err == nil && validPort(end) && last >= first
+}
+
+func validPort(value string) bool {
+	port, err := strconv.Atoi(value)
+	return err == nil && port >= 1 && port <= 65535
+}
+
+// validEnvVar requires KEY=value, a bare KEY would make docker copy the variable from the server environment
+func validEnvVar(value string) bool {
+	key, _, found := strings.Cut(value, "=")
+	return found && envKeyPattern.MatchString(key) && !strings.Contains(value, ",")
+}
+
+func validLabel(value string) bool {
+	key, _, _ := strings.Cut(value, "=")
+	return strings.TrimSpace(key) != "" && !strings.Contains(value, ",")
+}
+
+// validVolumePath rejects the separators of the stored volume list
+func validVolumePath(value string) bool {
+	return value != "" && !strings.ContainsAny(value, ",:")
+}
+
+// validHostPath checks the host path of a volume, paths with ${VAR} references are checked once rendered on deploy
+func validHostPath(value string) bool {
+	return validVolumePath(value) && (variablePattern.MatchString(value) || HostPathAllowed(value))
+}
+
+/*
+HostPathAllowed reports whether a host path may be bind mounted into a cube. Paths under [DEFAULT],
+the volume directory of the server, are always allowed, other paths must be under one of the volume
+roots configured by the admin. Paths that climb out of their root with .. are never allowed.
+*/
+func HostPathAllowed(hostPath string) bool {
+	if slices.Contains(strings.Split(hostPath, "/"), "..") {
+		return false
+	}
+	if hostPath == "[DEFAULT]" || strings.HasPrefix(hostPath, "[DEFAULT]/") {
+		return true
+	}
+	if !path.IsAbs(hostPath) {
+		return false
+	}
+	hostPath = path.Clean(hostPath)
+	for _, root := range config.Get().VolumeRoots {
+		if root = path.Clean(root); path.IsAbs(root) && (hostPath == root || strings.HasPrefix(hostPath, strings.TrimSuffix(root, "/")+"/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// validDomain accepts host names with an optional leading wildcard label, ${VAR} references count as a label
+func validDomain(value string) bool {
+	return ValidHostName(variablePattern.ReplaceAllString(value, "x"))
+}
+
+// ValidHostName accepts the domains of proxies once their variables are expanded: host names with an
+// optional leading wildcard label
+func ValidHostName(value string) bool {
+	value = strings.TrimPrefix(value, "*.")
+	if value == "" || len(value) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(strings.ToLower(value), ".") {
+		if !domainLabelPattern.MatchString(label) {
+			return false
+		}
+	}
+	return true
+}
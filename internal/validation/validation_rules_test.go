@@ -0,0 +1,46 @@
+package validation
+
+import (
+	"testing"
+
+	"github.com/turplespace/portos/internal/config"
+)
+
+func TestHostPathAllowed(t *testing.T) {
+	roots := config.Get().VolumeRoots
+	config.Get().VolumeRoots = []string{"/srv/cubes", "/data/"}
+	t.Cleanup(func() { config.Get().VolumeRoots = roots })
+
+	for hostPath, want := range map[string]bool{
+		"[DEFAULT]":                      true,
+		"[DEFAULT]/web/html":             true,
+		"[DEFAULT]/../../etc":            false,
+		"[DEFAULT]x/web":                 false,
+		"/srv/cubes":                     true,
+		"/srv/cubes/web":                 true,
+		"/srv/cubes/../../etc":           false,
+		"/srv/cubes-other":               false,
+		"/data/db":                       true,
+		"/var/run/docker.sock":           false,
+		"/":                              false,
+		"relative/path":                  false,
+		"${WORKSPACE_NAME}":              false,
+		"[DEFAULT]/${WORKSPACE_NAME}/db": true,
+	} {
+		if got := HostPathAllowed(hostPath); got != want {
+			t.Errorf("HostPathAllowed(%q) = %v, want %v", hostPath, got, want)
+		}
+	}
+}
+
+func TestValidHostPathDefersVariables(t *testing.T) {
+	for hostPath, want := range map[string]bool{
+		"${DATA_DIR}/db":       true,
+		"/var/run/docker.sock": false,
+		"[DEFAULT]/a:b":        false,
+	} {
+		if got := validHostPath(hostPath); got != want {
+			t.Errorf("validHostPath(%q) = %v, want %v", hostPath, got, want)
+		}
+	}
+}
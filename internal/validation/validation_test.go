@@ -0,0 +1,88 @@
+package validation
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+func TestFields(t *testing.T) {
+	err := Struct(models.WorkspaceSpec{
+		Name: "bad/name",
+		Cubes: []models.CubeSpec{
+			{Name: "web", Image: "nginx", Ports: []string{"80", "99999:80"}},
+			{Image: "nginx"},
+		},
+	})
+	want := map[string]models.FieldError{
+		"name":              {Field: "name", Code: "workspace_name", Message: messages["workspace_name"]},
+		"cubes[0].ports[1]": {Field: "cubes[0].ports[1]", Code: "port_mapping", Message: messages["port_mapping"]},
+		"cubes[1].name":     {Field: "cubes[1].name", Code: "required", Message: "is required"},
+	}
+	fields := Fields(err)
+	if len(fields) != len(want) {
+		t.Fatalf("fields = %+v, want %d", fields, len(want))
+	}
+	for _, field := range fields {
+		if field != want[field.Field] {
+			t.Errorf("field %s = %+v, want %+v", field.Field, field, want[field.Field])
+		}
+	}
+
+	if fields := Fields(errors.New("not a validation error")); fields != nil {
+		t.Errorf("fields of another error = %+v, want nil", fields)
+	}
+	if err := Struct(models.ScaleCubeRequest{Replicas: 2}); err != nil {
+		t.Errorf("valid request = %v", err)
+	}
+}
+
+func TestMessages(t *testing.T) {
+	type request struct {
+		Name     string `json:"name" validate:"min=3"`
+		Count    int    `json:"count" validate:"max=5"`
+		Strategy string `json:"strategy" validate:"oneof=recreate blue-green"`
+		Code     string `json:"code" validate:"len=6,numeric"`
+	}
+	fields := Fields(Struct(request{Name: "ab", Count: 6, Strategy: "canary", Code: "12345"}))
+	messages := map[string]string{}
+	for _, field := range fields {
+		messages[field.Field] = field.Message
+	}
+	for field, want := range map[string]string{
+		"name":     "must be at least 3 characters",
+		"count":    "must be at most 5",
+		"strategy": "must be one of: recreate, blue-green",
+		"code":     "must be 6 characters long",
+	} {
+		if messages[field] != want {
+			t.Errorf("message of %q = %q, want %q", field, messages[field], want)
+		}
+	}
+}
+
+func TestBind(t *testing.T) {
+	bind := func(body string) error {
+		request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		request.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		c := echo.New().NewContext(request, httptest.NewRecorder())
+		var scale models.ScaleCubeRequest
+		return Bind(c, &scale)
+	}
+
+	if err := bind(`{"replicas": 2}`); err != nil {
+		t.Errorf("valid body = %v", err)
+	}
+	if err := bind(`{"replicas": 0}`); Fields(err) == nil {
+		t.Errorf("invalid body = %v, want validation errors", err)
+	}
+	var he *echo.HTTPError
+	if err := bind(`{"replicas": "two"}`); !errors.As(err, &he) || Fields(err) != nil {
+		t.Errorf("malformed body = %v, want a bind error", err)
+	}
+}
@@ -0,0 +1,186 @@
+/*
+Package client is a typed Go client for the Turple Cubes API.
+
+A client authenticates either with an API token, see WithToken, or with a login session kept
+in its cookie jar, see Client.Login. Errors returned by the API are *Error values.
+
+	c, err := client.New("http://localhost:8080", client.WithToken(os.Getenv("TURPLECUBES_TOKEN")))
+	if err != nil {
+		return err
+	}
+	workspaces, err := c.ListWorkspaces(ctx, nil)
+*/
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// Client calls the Turple Cubes API, it is safe for concurrent use
+type Client struct {
+	baseURL    *url.URL
+	httpClient *http.Client
+	token      string
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithToken authenticates every request with an API token instead of a login session
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithHTTPClient replaces the HTTP client, it needs a cookie jar for Login to work
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// New returns a client for the server at baseURL, such as http://localhost:8080
+func New(baseURL string, options ...Option) (*Client, error) {
+	parsed, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base URL: %v", err)
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return nil, fmt.Errorf("invalid base URL %q: the scheme must be http or https", baseURL)
+	}
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{
+		baseURL:    parsed,
+		httpClient: &http.Client{Jar: jar},
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c, nil
+}
+
+// newRequest builds a request to an API path, body is encoded as JSON when it is not nil
+func (c *Client) newRequest(ctx context.Context, method string, path string, query url.Values, body interface{}) (*http.Request, error) {
+	target := *c.baseURL
+	target.Path += path
+	target.RawQuery = query.Encode()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode request: %v", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target.String(), reader)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	return req, nil
+}
+
+// send sends a request and returns the response, or an *Error when the status is not 2xx
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		return nil, decodeError(resp)
+	}
+	return resp, nil
+}
+
+// do sends a JSON request and decodes the JSON response into out when it is not nil
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, body interface{}, out interface{}) (http.Header, error) {
+	req, err := c.newRequest(ctx, method, path, query, body)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.send(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return nil, fmt.Errorf("failed to decode response of %s %s: %v", method, path, err)
+		}
+	}
+	return resp.Header, nil
+}
+
+// dialWebSocket opens a WebSocket to an API path with the credentials of the client
+func (c *Client) dialWebSocket(ctx context.Context, path string, query url.Values) (*websocket.Conn, error) {
+	target := *c.baseURL
+	target.Path += path
+	target.RawQuery = query.Encode()
+	target.Scheme = strings.Replace(target.Scheme, "http", "ws", 1)
+
+	header := http.Header{}
+	if c.token != "" {
+		header.Set("Authorization", "Bearer "+c.token)
+	}
+	dialer := websocket.Dialer{Jar: c.httpClient.Jar, Proxy: http.ProxyFromEnvironment}
+	conn, resp, err := dialer.DialContext(ctx, target.String(), header)
+	if err != nil {
+		if resp != nil && resp.StatusCode >= http.StatusBadRequest {
+			defer resp.Body.Close()
+			return nil, decodeError(resp)
+		}
+		return nil, fmt.Errorf("failed to open WebSocket %s: %v", path, err)
+	}
+	return conn, nil
+}
+
+// created is the body of the responses to create requests
+type created struct {
+	ID int `json:"id"`
+}
+
+// pageQuery adds the paging params shared by the list methods
+func pageQuery(query url.Values, sort string, limit int, cursor string) {
+	if sort != "" {
+		query.Set("sort", sort)
+	}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	if cursor != "" {
+		query.Set("cursor", cursor)
+	}
+}
+
+func idPath(format string, ids ...int) string {
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	return fmt.Sprintf(format, args...)
+}
@@ -0,0 +1,20 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/turplespace/portos/pkg/models"
+)
+
+// Login starts a session kept in the cookie jar of the client, Code or RecoveryCode are needed with TOTP
+func (c *Client) Login(ctx context.Context, req models.LoginRequest) error {
+	_, err := c.do(ctx, http.MethodPost, "/api/auth/login", nil, req, nil)
+	return err
+}
+
+// Logout ends the session of the client
+func (c *Client) Logout(ctx context.Context) error {
+	_, err := c.do(ctx, http.MethodPost, "/api/auth/logout", nil, nil, nil)
+	return err
+}
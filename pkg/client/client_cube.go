@@ -0,0 +1,151 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/turplespace/portos/pkg/models"
+)
+
+// ListCubesOptions filters and pages ListCubes, zero values do not filter
+type ListCubesOptions struct {
+	Search string // Substring of the name or image
+	Image  string // Image, without a tag it matches every tag
+	Label  string // key=value, or a key matching any value
+	Status string // Container state such as running or exited
+	Sort   string // name, created_at, -name or -created_at
+	Limit  int
+	Cursor string // NextCursor of the previous page
+}
+
+// CubePage is a page of the cubes of a workspace
+type CubePage struct {
+	Cubes      []models.GetCubesResponse
+	NextCursor string // Empty on the last page
+}
+
+// ListCubes returns the cubes of a workspace with the state of their containers
+func (c *Client) ListCubes(ctx context.Context, workspaceID int, options *ListCubesOptions) (*CubePage, error) {
+	query := url.Values{}
+	if options != nil {
+		for name, value := range map[string]string{"q": options.Search, "image": options.Image, "label": options.Label, "status": options.Status} {
+			if value != "" {
+				query.Set(name, value)
+			}
+		}
+		pageQuery(query, options.Sort, options.Limit, options.Cursor)
+	}
+
+	page := &CubePage{}
+	header, err := c.do(ctx, http.MethodGet, idPath("/api/workspace/%d", workspaceID), query, nil, &page.Cubes)
+	if err != nil {
+		return nil, err
+	}
+	page.NextCursor = header.Get("X-Next-Cursor")
+	return page, nil
+}
+
+// GetCube returns a cube with the state of its container
+func (c *Client) GetCube(ctx context.Context, cubeID int) (*models.GetCubesByIdResponse, error) {
+	var result models.GetCubesByIdResponse
+	if _, err := c.do(ctx, http.MethodGet, idPath("/api/cube/%d", cubeID), nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// AddCube adds a cube to a workspace and returns its ID, the cube is not deployed
+func (c *Client) AddCube(ctx context.Context, workspaceID int, cube models.Container) (int, error) {
+	var result created
+	req := models.AddCubesRequest{WorkspaceID: workspaceID, Cube: cube}
+	if _, err := c.do(ctx, http.MethodPost, "/api/cube", nil, req, &result); err != nil {
+		return 0, err
+	}
+	return result.ID, nil
+}
+
+// EditCube replaces the configuration of a cube, it applies on the next deploy
+func (c *Client) EditCube(ctx context.Context, cubeID int, cube models.Container) error {
+	_, err := c.do(ctx, http.MethodPut, idPath("/api/cube/%d", cubeID), nil, models.EditCubeRequest{UpdatedCube: cube}, nil)
+	return err
+}
+
+// DeleteCube stops and deletes a cube
+func (c *Client) DeleteCube(ctx context.Context, cubeID int) error {
+	_, err := c.do(ctx, http.MethodDelete, idPath("/api/cube/%d", cubeID), nil, nil, nil)
+	return err
+}
+
+// DeployCube creates the container of a cube
+func (c *Client) DeployCube(ctx context.Context, cubeID int) error {
+	_, err := c.do(ctx, http.MethodPost, idPath("/api/cube/%d/deploy", cubeID), nil, nil, nil)
+	return err
+}
+
+// RedeployCube recreates the container of a cube
+func (c *Client) RedeployCube(ctx context.Context, cubeID int) error {
+	_, err := c.do(ctx, http.MethodPost, idPath("/api/cube/%d/redeploy", cubeID), nil, nil, nil)
+	return err
+}
+
+// RedeployCubeBlueGreen replaces the container of a cube without dropping the traffic of its proxies
+func (c *Client) RedeployCubeBlueGreen(ctx context.Context, cubeID int) error {
+	query := url.Values{"strategy": {"blue-green"}}
+	_, err := c.do(ctx, http.MethodPost, idPath("/api/cube/%d/redeploy", cubeID), query, nil, nil)
+	return err
+}
+
+// ScaleCube sets the number of replicas of a cube and starts or removes containers to match
+func (c *Client) ScaleCube(ctx context.Context, cubeID int, req models.ScaleCubeRequest) (*models.ScaleCubeResponse, error) {
+	var result models.ScaleCubeResponse
+	if _, err := c.do(ctx, http.MethodPost, idPath("/api/cube/%d/scale", cubeID), nil, req, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// StopCube stops the container of a cube
+func (c *Client) StopCube(ctx context.Context, cubeID int) error {
+	_, err := c.do(ctx, http.MethodPost, idPath("/api/cube/%d/stop", cubeID), nil, nil, nil)
+	return err
+}
+
+// CommitCube commits the container of a cube to an image
+func (c *Client) CommitCube(ctx context.Context, cubeID int, req models.CommitCubeRequest) error {
+	_, err := c.do(ctx, http.MethodPost, idPath("/api/cube/%d/commit", cubeID), nil, req, nil)
+	return err
+}
+
+// ListCubeRevisions returns the revisions of the spec of a cube, newest first
+func (c *Client) ListCubeRevisions(ctx context.Context, cubeID int) ([]models.CubeRevision, error) {
+	var revisions []models.CubeRevision
+	if _, err := c.do(ctx, http.MethodGet, idPath("/api/cube/%d/revisions", cubeID), nil, nil, &revisions); err != nil {
+		return nil, err
+	}
+	return revisions, nil
+}
+
+// DiffCubeRevisions returns the fields of a cube changed from one revision to another
+func (c *Client) DiffCubeRevisions(ctx context.Context, cubeID int, from int, to int) (*models.CubeRevisionDiff, error) {
+	query := url.Values{"from": {strconv.Itoa(from)}, "to": {strconv.Itoa(to)}}
+	var diff models.CubeRevisionDiff
+	if _, err := c.do(ctx, http.MethodGet, idPath("/api/cube/%d/revisions/diff", cubeID), query, nil, &diff); err != nil {
+		return nil, err
+	}
+	return &diff, nil
+}
+
+// RollbackCube restores the spec of a cube from a revision, redeploy recreates its container
+func (c *Client) RollbackCube(ctx context.Context, cubeID int, revision int, redeploy bool) (*models.RollbackCubeResponse, error) {
+	query := url.Values{}
+	if redeploy {
+		query.Set("redeploy", "true")
+	}
+	var result models.RollbackCubeResponse
+	if _, err := c.do(ctx, http.MethodPost, idPath("/api/cube/%d/rollback/%d", cubeID, revision), query, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
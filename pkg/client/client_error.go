@@ -0,0 +1,54 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/turplespace/portos/pkg/models"
+)
+
+// Error is an error response of the API
+type Error struct {
+	StatusCode int
+	Code       string // Stable code such as not_found or validation_failed
+	Message    string
+	Fields     []models.FieldError // Failed validation rules of the request body
+}
+
+func (e *Error) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// ErrorCode returns the code of an API error, or an empty string when err is not one
+func ErrorCode(err error) string {
+	var apiErr *Error
+	if errors.As(err, &apiErr) {
+		return apiErr.Code
+	}
+	return ""
+}
+
+// decodeError reads the error envelope of a response, a body that is not one is kept as the message
+func decodeError(resp *http.Response) error {
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("failed to read error response: %v", err)
+	}
+
+	apiErr := &Error{StatusCode: resp.StatusCode}
+	var body models.ErrorResponse
+	if json.Unmarshal(data, &body) == nil && body.Error != "" {
+		apiErr.Code = body.Code
+		apiErr.Message = body.Error
+		apiErr.Fields = body.Fields
+	} else {
+		apiErr.Message = string(data)
+	}
+	return apiErr
+}
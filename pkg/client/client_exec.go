@@ -0,0 +1,138 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+// ExecOptions configures a command run in a cube by Exec
+type ExecOptions struct {
+	Command []string  // Command and arguments, sh when empty
+	TTY     bool      // Allocate a terminal, its output is all written to Stdout
+	Stdin   io.Reader // Input of the command, its stdin is closed when it ends. Nil sends no input
+	Stdout  io.Writer // Discarded when nil
+	Stderr  io.Writer // Stdout is used when nil
+	Resize  <-chan TerminalSize
+}
+
+// TerminalSize is the size of the terminal of a command run with a TTY
+type TerminalSize struct {
+	Cols uint
+	Rows uint
+}
+
+// Exec runs a command in the running container of a cube and returns its exit code once it ends
+func (c *Client) Exec(ctx context.Context, cubeID int, options ExecOptions) (int, error) {
+	query := url.Values{"cmd": options.Command}
+	if options.TTY {
+		query.Set("tty", strconv.FormatBool(true))
+	}
+	stdout, stderr := options.Stdout, options.Stderr
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	if stderr == nil {
+		stderr = stdout
+	}
+
+	conn, err := c.dialWebSocket(ctx, idPath("/api/cube/%d/exec", cubeID), query)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	// Gorilla connections support a single concurrent writer
+	var mu sync.Mutex
+	send := func(kind int, data []byte) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return conn.WriteMessage(kind, data)
+	}
+	control := func(message models.ExecMessage) error {
+		data, err := json.Marshal(message)
+		if err != nil {
+			return err
+		}
+		return send(websocket.TextMessage, data)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	if options.Stdin != nil {
+		go func() {
+			buf := make([]byte, 32*1024)
+			for {
+				n, err := options.Stdin.Read(buf)
+				if n > 0 {
+					if send(websocket.BinaryMessage, buf[:n]) != nil {
+						return
+					}
+				}
+				if err != nil {
+					control(models.ExecMessage{Type: models.ExecEOF})
+					return
+				}
+			}
+		}()
+	} else {
+		control(models.ExecMessage{Type: models.ExecEOF})
+	}
+	if options.Resize != nil {
+		go func() {
+			for {
+				select {
+				case size := <-options.Resize:
+					control(models.ExecMessage{Type: models.ExecResize, Cols: size.Cols, Rows: size.Rows})
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	for {
+		kind, data, err := conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				return 0, ctx.Err()
+			}
+			return 0, fmt.Errorf("exec ended without an exit code: %v", err)
+		}
+
+		if kind == websocket.BinaryMessage {
+			if len(data) == 0 {
+				continue
+			}
+			out := stdout
+			if data[0] == models.ExecStderr {
+				out = stderr
+			}
+			if _, err := out.Write(data[1:]); err != nil {
+				return 0, fmt.Errorf("failed to write exec output: %v", err)
+			}
+			continue
+		}
+
+		var message models.ExecMessage
+		if err := json.Unmarshal(data, &message); err != nil {
+			return 0, fmt.Errorf("invalid exec message: %v", err)
+		}
+		if message.Type == models.ExecExit {
+			if message.Error != "" {
+				return 0, errors.New(message.Error)
+			}
+			return message.ExitCode, nil
+		}
+	}
+}
@@ -0,0 +1,17 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/turplespace/portos/pkg/models"
+)
+
+// ListImages returns the custom images of the server
+func (c *Client) ListImages(ctx context.Context) (*models.ImagesResponse, error) {
+	var result models.ImagesResponse
+	if _, err := c.do(ctx, http.MethodGet, "/api/repo/local", nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
@@ -0,0 +1,115 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+
+	"github.com/gorilla/websocket"
+)
+
+// CubeLogs returns the last lines of the container logs of a cube, tail is a number of lines or
+// all and defaults to 200 when empty
+func (c *Client) CubeLogs(ctx context.Context, cubeID int, tail string) (string, error) {
+	query := url.Values{}
+	if tail != "" {
+		query.Set("tail", tail)
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet, idPath("/api/cube/%d/logs", cubeID), query, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := c.send(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	logs, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read logs: %v", err)
+	}
+	return string(logs), nil
+}
+
+/*
+LogStream iterates over the lines of the server log as they are written, admins only.
+It is used like a bufio.Scanner:
+
+	stream, err := c.StreamLogs(ctx)
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+	for stream.Next() {
+		fmt.Println(stream.Line())
+	}
+	return stream.Err()
+*/
+type LogStream struct {
+	ctx    context.Context
+	conn   *websocket.Conn
+	stop   func() bool
+	closed atomic.Bool
+	line   string
+	err    error
+}
+
+// StreamLogs opens a stream of the server log, it ends when ctx is done or Close is called
+func (c *Client) StreamLogs(ctx context.Context) (*LogStream, error) {
+	conn, err := c.dialWebSocket(ctx, "/api/logs/stream", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	stream := &LogStream{ctx: ctx, conn: conn}
+	stream.stop = context.AfterFunc(ctx, func() { conn.Close() })
+	return stream, nil
+}
+
+// Next waits for the next line and reports whether there is one
+func (s *LogStream) Next() bool {
+	if s.err != nil || s.closed.Load() {
+		return false
+	}
+
+	_, data, err := s.conn.ReadMessage()
+	if err != nil {
+		switch {
+		case s.closed.Load():
+		case s.ctx.Err() != nil:
+			s.err = s.ctx.Err()
+		case websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway):
+		default:
+			s.err = err
+		}
+		return false
+	}
+
+	s.line = strings.TrimSuffix(string(data), "\n")
+	return true
+}
+
+// Line returns the line read by the last call to Next
+func (s *LogStream) Line() string {
+	return s.line
+}
+
+// Err returns the error that ended the stream, nil when it was closed or ended normally
+func (s *LogStream) Err() error {
+	return s.err
+}
+
+// Close ends the stream
+func (s *LogStream) Close() error {
+	if s.closed.Swap(true) {
+		return nil
+	}
+	s.stop()
+	return s.conn.Close()
+}
@@ -0,0 +1,59 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/turplespace/portos/pkg/models"
+)
+
+// AddProxy adds a proxy to a cube and returns its ID, the ID of the existing proxy when the domain is taken
+func (c *Client) AddProxy(ctx context.Context, req models.AddProxyRequest) (int, error) {
+	var result created
+	if _, err := c.do(ctx, http.MethodPost, "/api/proxy", nil, req, &result); err != nil {
+		return 0, err
+	}
+	return result.ID, nil
+}
+
+// GetProxy returns a proxy
+func (c *Client) GetProxy(ctx context.Context, proxyID int) (*models.Proxy, error) {
+	var result models.Proxy
+	if _, err := c.do(ctx, http.MethodGet, idPath("/api/proxy/%d", proxyID), nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ListCubeProxies returns the proxies of a cube
+func (c *Client) ListCubeProxies(ctx context.Context, cubeID int) ([]models.Proxy, error) {
+	var result []models.Proxy
+	if _, err := c.do(ctx, http.MethodGet, idPath("/api/proxy/by-cube/%d", cubeID), nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// EditProxy changes the domain, port and type of a proxy
+func (c *Client) EditProxy(ctx context.Context, proxyID int, req models.EditProxyByIDRequest) error {
+	_, err := c.do(ctx, http.MethodPut, idPath("/api/proxy/%d", proxyID), nil, req, nil)
+	return err
+}
+
+// DeleteProxy deletes a proxy
+func (c *Client) DeleteProxy(ctx context.Context, proxyID int) error {
+	_, err := c.do(ctx, http.MethodDelete, idPath("/api/proxy/%d", proxyID), nil, nil, nil)
+	return err
+}
+
+// DeleteCubeProxies deletes every proxy of a cube
+func (c *Client) DeleteCubeProxies(ctx context.Context, cubeID int) error {
+	_, err := c.do(ctx, http.MethodDelete, idPath("/api/proxy/by-cube/%d", cubeID), nil, nil, nil)
+	return err
+}
+
+// DeployProxy writes the nginx configuration of a proxy
+func (c *Client) DeployProxy(ctx context.Context, proxyID int) error {
+	_, err := c.do(ctx, http.MethodPost, idPath("/api/proxy/%d/deploy", proxyID), nil, nil, nil)
+	return err
+}
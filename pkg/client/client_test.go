@@ -0,0 +1,355 @@
+package client_test
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/turplespace/portos/internal/database"
+	"github.com/turplespace/portos/internal/routes"
+	"github.com/turplespace/portos/internal/services"
+	"github.com/turplespace/portos/internal/services/auth"
+	"github.com/turplespace/portos/pkg/client"
+	"github.com/turplespace/portos/pkg/models"
+)
+
+const adminPassword = "client-test-password"
+
+var serverURL string
+
+// TestMain runs the real router against a fresh database and a fake Docker daemon
+func TestMain(m *testing.M) {
+	docker := httptest.NewServer(http.HandlerFunc(fakeDocker))
+	defer docker.Close()
+
+	os.Setenv("DOCKER_HOST", "tcp://"+strings.TrimPrefix(docker.URL, "http://"))
+	os.Setenv("TURPLECUBES_ADMIN_USERNAME", "admin")
+	os.Setenv("TURPLECUBES_ADMIN_PASSWORD", adminPassword)
+
+	path, err := database.GetPath()
+	if err != nil {
+		log.Fatal(err)
+	}
+	os.Remove(path)
+	database.Init()
+	if err := auth.EnsureAdmin(); err != nil {
+		log.Fatal(err)
+	}
+	if err := writeImages(); err != nil {
+		log.Fatal(err)
+	}
+
+	services.GetLogService()
+	e := echo.New()
+	routes.SetupRoutes(e)
+	server := httptest.NewServer(e)
+	serverURL = server.URL
+
+	code := m.Run()
+	server.Close()
+	os.Remove(path)
+	os.Exit(code)
+}
+
+// fakeDocker answers the Docker API calls of the server: no containers and fixed logs
+func fakeDocker(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("API-Version", "1.45")
+	switch {
+	case strings.HasSuffix(r.URL.Path, "/_ping"):
+		w.Write([]byte("OK"))
+	case strings.HasSuffix(r.URL.Path, "/containers/json"):
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte("[]"))
+	case strings.HasSuffix(r.URL.Path, "/logs"):
+		// Logs of containers without a TTY are multiplexed in frames with an 8 byte header
+		line := []byte("2026-01-01T00:00:00Z hello from the cube\n")
+		header := make([]byte, 8)
+		header[0] = 1
+		binary.BigEndian.PutUint32(header[4:], uint32(len(line)))
+		w.Write(append(header, line...))
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`{"message":"No such container"}`))
+	}
+}
+
+func writeImages() error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(executable+"_conf", 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(executable+"_conf/images.json", []byte(`{"custom_images":[{"image":"nginx","tag":"latest"}]}`), 0644)
+}
+
+func newAdmin(t *testing.T) *client.Client {
+	t.Helper()
+	c, err := client.New(serverURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Login(context.Background(), models.LoginRequest{Username: "admin", Password: adminPassword}); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	return c
+}
+
+func newWorkspace(t *testing.T, c *client.Client, name string) int {
+	t.Helper()
+	id, err := c.CreateWorkspace(context.Background(), models.CreateWorkspaceRequest{Name: name, Desc: "created by " + t.Name()})
+	if err != nil {
+		t.Fatalf("create workspace %s: %v", name, err)
+	}
+	return id
+}
+
+func TestWorkspaces(t *testing.T) {
+	ctx := context.Background()
+	c := newAdmin(t)
+
+	for _, name := range []string{"paging-a", "paging-b", "paging-c"} {
+		newWorkspace(t, c, name)
+	}
+
+	var names []string
+	options := &client.ListWorkspacesOptions{Search: "paging-", Sort: "-name", Limit: 2}
+	for {
+		page, err := c.ListWorkspaces(ctx, options)
+		if err != nil {
+			t.Fatalf("list workspaces: %v", err)
+		}
+		for _, workspace := range page.Workspaces {
+			names = append(names, workspace.Name)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		options.Cursor = page.NextCursor
+	}
+	if got := strings.Join(names, ","); got != "paging-c,paging-b,paging-a" {
+		t.Errorf("paged workspaces = %s, want paging-c,paging-b,paging-a", got)
+	}
+
+	id := newWorkspace(t, c, "renamed-before")
+	if err := c.EditWorkspace(ctx, id, models.EditWorkspaceRequest{Name: "renamed-after"}); err != nil {
+		t.Fatalf("edit workspace: %v", err)
+	}
+	page, err := c.ListWorkspaces(ctx, &client.ListWorkspacesOptions{Search: "renamed-"})
+	if err != nil || len(page.Workspaces) != 1 || page.Workspaces[0].Name != "renamed-after" {
+		t.Fatalf("list renamed workspace = %+v, %v", page, err)
+	}
+	if err := c.DeleteWorkspace(ctx, id); err != nil {
+		t.Fatalf("delete workspace: %v", err)
+	}
+}
+
+func TestCubes(t *testing.T) {
+	ctx := context.Background()
+	c := newAdmin(t)
+	workspaceID := newWorkspace(t, c, "cubes")
+
+	webID, err := c.AddCube(ctx, workspaceID, models.Container{Name: "client-web", Image: "nginx:1.27", Ports: []string{"8080:80"}, Labels: []string{"tier=web"}})
+	if err != nil {
+		t.Fatalf("add cube: %v", err)
+	}
+	if _, err := c.AddCube(ctx, workspaceID, models.Container{Name: "client-db", Image: "postgres:16", Labels: []string{"tier=db"}}); err != nil {
+		t.Fatalf("add cube: %v", err)
+	}
+
+	cube, err := c.GetCube(ctx, webID)
+	if err != nil {
+		t.Fatalf("get cube: %v", err)
+	}
+	if cube.ContainerData.Name != "client-web" || cube.Status != "unknown" {
+		t.Errorf("get cube = %+v, want client-web with an unknown status", cube)
+	}
+
+	edited := *cube.ContainerData
+	edited.Image = "nginx:1.28"
+	if err := c.EditCube(ctx, webID, edited); err != nil {
+		t.Fatalf("edit cube: %v", err)
+	}
+
+	page, err := c.ListCubes(ctx, workspaceID, &client.ListCubesOptions{Image: "nginx"})
+	if err != nil {
+		t.Fatalf("list cubes: %v", err)
+	}
+	if len(page.Cubes) != 1 || page.Cubes[0].Image != "nginx:1.28" {
+		t.Errorf("cubes with image nginx = %+v, want the edited client-web", page.Cubes)
+	}
+
+	page, err = c.ListCubes(ctx, workspaceID, &client.ListCubesOptions{Sort: "name", Limit: 1})
+	if err != nil {
+		t.Fatalf("list cubes: %v", err)
+	}
+	if len(page.Cubes) != 1 || page.Cubes[0].ContainerName != "client-db" || page.NextCursor == "" {
+		t.Errorf("first page = %+v, want client-db and a next cursor", page)
+	}
+
+	logs, err := c.CubeLogs(ctx, webID, "10")
+	if err != nil {
+		t.Fatalf("cube logs: %v", err)
+	}
+	if !strings.Contains(logs, "hello from the cube") {
+		t.Errorf("cube logs = %q", logs)
+	}
+
+	if err := c.DeleteCube(ctx, webID); err != nil {
+		t.Fatalf("delete cube: %v", err)
+	}
+	if _, err := c.GetCube(ctx, webID); err == nil {
+		t.Error("get deleted cube succeeded")
+	}
+}
+
+func TestProxies(t *testing.T) {
+	ctx := context.Background()
+	c := newAdmin(t)
+	workspaceID := newWorkspace(t, c, "proxies")
+	cubeID, err := c.AddCube(ctx, workspaceID, models.Container{Name: "client-proxied", Image: "nginx"})
+	if err != nil {
+		t.Fatalf("add cube: %v", err)
+	}
+
+	proxyID, err := c.AddProxy(ctx, models.AddProxyRequest{CubeID: cubeID, Domain: "app.example.com", Port: 80})
+	if err != nil {
+		t.Fatalf("add proxy: %v", err)
+	}
+	if err := c.EditProxy(ctx, proxyID, models.EditProxyByIDRequest{Domain: "www.example.com", Port: 8080}); err != nil {
+		t.Fatalf("edit proxy: %v", err)
+	}
+
+	proxy, err := c.GetProxy(ctx, proxyID)
+	if err != nil {
+		t.Fatalf("get proxy: %v", err)
+	}
+	if proxy.Domain != "www.example.com" || proxy.Port != 8080 || proxy.CubeID != cubeID {
+		t.Errorf("get proxy = %+v", proxy)
+	}
+
+	proxies, err := c.ListCubeProxies(ctx, cubeID)
+	if err != nil || len(proxies) != 1 {
+		t.Fatalf("list cube proxies = %+v, %v", proxies, err)
+	}
+
+	if err := c.DeleteProxy(ctx, proxyID); err != nil {
+		t.Fatalf("delete proxy: %v", err)
+	}
+	if proxies, err := c.ListCubeProxies(ctx, cubeID); err != nil || len(proxies) != 0 {
+		t.Errorf("proxies after delete = %+v, %v", proxies, err)
+	}
+}
+
+func TestImages(t *testing.T) {
+	images, err := newAdmin(t).ListImages(context.Background())
+	if err != nil {
+		t.Fatalf("list images: %v", err)
+	}
+	if images.TotalCustomImages != 1 || images.CustomImages[0].Image != "nginx" {
+		t.Errorf("images = %+v", images)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	ctx := context.Background()
+
+	anonymous, err := client.New(serverURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = anonymous.ListWorkspaces(ctx, nil)
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized || apiErr.Code != "unauthorized" {
+		t.Errorf("anonymous list error = %v, want an unauthorized *client.Error", err)
+	}
+
+	c := newAdmin(t)
+	workspaceID := newWorkspace(t, c, "errors")
+	_, err = c.AddCube(ctx, workspaceID, models.Container{Name: "bad ports", Image: "nginx", Ports: []string{"99999:80"}})
+	if !errors.As(err, &apiErr) || apiErr.Code != "validation_failed" {
+		t.Fatalf("invalid cube error = %v, want validation_failed", err)
+	}
+	fields := map[string]bool{}
+	for _, field := range apiErr.Fields {
+		fields[field.Field] = true
+	}
+	if !fields["cube_data.name"] || !fields["cube_data.ports[0]"] {
+		t.Errorf("invalid cube fields = %+v, want cube_data.name and cube_data.ports[0]", apiErr.Fields)
+	}
+
+	if _, err := c.GetProxy(ctx, 999999); client.ErrorCode(err) == "" {
+		t.Errorf("unknown proxy error = %v, want an API error", err)
+	}
+}
+
+func TestToken(t *testing.T) {
+	ctx := context.Background()
+	workspaceID := newWorkspace(t, newAdmin(t), "token")
+
+	token, _, err := auth.CreateToken(database.APIToken{
+		UserID:       1,
+		Name:         "client-test",
+		Kind:         auth.TokenKindService,
+		Scopes:       []string{"view"},
+		WorkspaceIDs: []int{workspaceID},
+	})
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+
+	c, err := client.New(serverURL, client.WithToken(token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := c.ListWorkspaces(ctx, nil)
+	if err != nil {
+		t.Fatalf("list workspaces with token: %v", err)
+	}
+	if len(page.Workspaces) != 1 || page.Workspaces[0].ID != workspaceID {
+		t.Errorf("workspaces of the token = %+v, want only workspace %d", page.Workspaces, workspaceID)
+	}
+
+	_, err = c.AddCube(ctx, workspaceID, models.Container{Name: "not-allowed", Image: "nginx"})
+	if client.ErrorCode(err) != "forbidden" {
+		t.Errorf("add cube with a view token = %v, want forbidden", err)
+	}
+}
+
+func TestStreamLogs(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	stream, err := newAdmin(t).StreamLogs(ctx)
+	if err != nil {
+		t.Fatalf("stream logs: %v", err)
+	}
+	defer stream.Close()
+
+	marker := fmt.Sprintf("client stream marker %d", time.Now().UnixNano())
+	go func() {
+		// Give the server time to subscribe the stream before logging
+		time.Sleep(200 * time.Millisecond)
+		log.Print(marker)
+	}()
+
+	for stream.Next() {
+		if strings.Contains(stream.Line(), marker) {
+			cancel()
+		}
+	}
+	if !errors.Is(stream.Err(), context.Canceled) {
+		t.Errorf("stream error = %v, want context.Canceled once the marker was read", stream.Err())
+	}
+}
@@ -0,0 +1,189 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/turplespace/portos/pkg/models"
+)
+
+// ListWorkspacesOptions filters and pages ListWorkspaces, zero values do not filter
+type ListWorkspacesOptions struct {
+	Search string // Substring of the name or description
+	Sort   string // name, created_at, -name or -created_at
+	Limit  int
+	Cursor string // NextCursor of the previous page
+}
+
+// WorkspacePage is a page of the workspaces visible to the caller, with the totals of every workspace
+type WorkspacePage struct {
+	models.WorkspaceResponse
+	NextCursor string `json:"next_cursor,omitempty"` // Empty on the last page
+}
+
+// ListWorkspaces returns the workspaces visible to the caller
+func (c *Client) ListWorkspaces(ctx context.Context, options *ListWorkspacesOptions) (*WorkspacePage, error) {
+	query := url.Values{}
+	if options != nil {
+		if options.Search != "" {
+			query.Set("q", options.Search)
+		}
+		pageQuery(query, options.Sort, options.Limit, options.Cursor)
+	}
+
+	page := &WorkspacePage{}
+	header, err := c.do(ctx, http.MethodGet, "/api/workspace", query, nil, &page.WorkspaceResponse)
+	if err != nil {
+		return nil, err
+	}
+	page.NextCursor = header.Get("X-Next-Cursor")
+	return page, nil
+}
+
+// CreateWorkspace creates a workspace and returns its ID
+func (c *Client) CreateWorkspace(ctx context.Context, req models.CreateWorkspaceRequest) (int, error) {
+	var result created
+	if _, err := c.do(ctx, http.MethodPost, "/api/workspace", nil, req, &result); err != nil {
+		return 0, err
+	}
+	return result.ID, nil
+}
+
+// EditWorkspace changes the name and description of a workspace
+func (c *Client) EditWorkspace(ctx context.Context, workspaceID int, req models.EditWorkspaceRequest) error {
+	_, err := c.do(ctx, http.MethodPut, idPath("/api/workspace/%d", workspaceID), nil, req, nil)
+	return err
+}
+
+// DeleteWorkspace stops and deletes the cubes of a workspace, then the workspace
+func (c *Client) DeleteWorkspace(ctx context.Context, workspaceID int) error {
+	_, err := c.do(ctx, http.MethodDelete, idPath("/api/workspace/%d", workspaceID), nil, nil, nil)
+	return err
+}
+
+// DeployWorkspace deploys every cube of a workspace
+func (c *Client) DeployWorkspace(ctx context.Context, workspaceID int) error {
+	_, err := c.do(ctx, http.MethodPost, idPath("/api/workspace/%d/deploy", workspaceID), nil, nil, nil)
+	return err
+}
+
+// RedeployWorkspace redeploys every cube of a workspace
+func (c *Client) RedeployWorkspace(ctx context.Context, workspaceID int) error {
+	_, err := c.do(ctx, http.MethodPost, idPath("/api/workspace/%d/redeploy", workspaceID), nil, nil, nil)
+	return err
+}
+
+// StopWorkspace stops every cube of a workspace
+func (c *Client) StopWorkspace(ctx context.Context, workspaceID int) error {
+	_, err := c.do(ctx, http.MethodPost, idPath("/api/workspace/%d/stop", workspaceID), nil, nil, nil)
+	return err
+}
+
+// ApplyWorkspace creates or updates the workspace named by a spec, a dry run only returns the plan
+func (c *Client) ApplyWorkspace(ctx context.Context, spec models.WorkspaceSpec, dryRun bool) (*models.ApplyResponse, error) {
+	query := url.Values{}
+	if dryRun {
+		query.Set("dry_run", "true")
+	}
+
+	var result models.ApplyResponse
+	if _, err := c.do(ctx, http.MethodPost, "/api/workspace/apply", query, spec, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+/*
+ImportCompose creates a workspace from a docker-compose file. The workspace is named after name,
+or the name of the compose file when name is empty. A dry run only returns the plan. The compose
+keys that were ignored are returned in the warnings.
+*/
+func (c *Client) ImportCompose(ctx context.Context, compose []byte, name string, dryRun bool) (*models.ApplyResponse, error) {
+	query := url.Values{}
+	if name != "" {
+		query.Set("name", name)
+	}
+	if dryRun {
+		query.Set("dry_run", "true")
+	}
+
+	req, err := c.newRequest(ctx, http.MethodPost, "/api/workspace/import/compose", query, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Body = io.NopCloser(bytes.NewReader(compose))
+	req.ContentLength = int64(len(compose))
+	req.Header.Set("Content-Type", "application/yaml")
+	resp, err := c.send(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var result models.ApplyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode response of compose import: %v", err)
+	}
+	return &result, nil
+}
+
+// GetWorkspaceSpec returns the spec of a workspace
+func (c *Client) GetWorkspaceSpec(ctx context.Context, workspaceID int) (*models.WorkspaceSpec, error) {
+	var result models.WorkspaceSpec
+	if _, err := c.do(ctx, http.MethodGet, idPath("/api/workspace/%d/spec", workspaceID), nil, nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ExportWorkspace returns a workspace as a docker-compose file with the compose format, or as Kubernetes manifests with k8s
+func (c *Client) ExportWorkspace(ctx context.Context, workspaceID int, format string) ([]byte, error) {
+	query := url.Values{}
+	if format != "" {
+		query.Set("format", format)
+	}
+
+	req, err := c.newRequest(ctx, http.MethodGet, idPath("/api/workspace/%d/export", workspaceID), query, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.send(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read export: %v", err)
+	}
+	return data, nil
+}
+
+// CloneWorkspace copies a workspace into the new workspace named by the request, a dry run only returns the plan
+func (c *Client) CloneWorkspace(ctx context.Context, workspaceID int, request models.CloneWorkspaceRequest, dryRun bool) (*models.ApplyResponse, error) {
+	return c.copyWorkspace(ctx, idPath("/api/workspace/%d/clone", workspaceID), request, dryRun)
+}
+
+// PromoteWorkspace copies a workspace with overrides into the workspace named by the request, a dry run only returns the diff
+func (c *Client) PromoteWorkspace(ctx context.Context, workspaceID int, request models.CloneWorkspaceRequest, dryRun bool) (*models.ApplyResponse, error) {
+	return c.copyWorkspace(ctx, idPath("/api/workspace/%d/promote", workspaceID), request, dryRun)
+}
+
+func (c *Client) copyWorkspace(ctx context.Context, path string, request models.CloneWorkspaceRequest, dryRun bool) (*models.ApplyResponse, error) {
+	query := url.Values{}
+	if dryRun {
+		query.Set("dry_run", "true")
+	}
+
+	var result models.ApplyResponse
+	if _, err := c.do(ctx, http.MethodPost, path, query, request, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
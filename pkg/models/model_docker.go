@@ -0,0 +1,70 @@
+package models
+
+import "fmt"
+
+// Container represents the configuration for a single container in the workspace
+// It includes all necessary settings like resource limits, environment variables,
+// port mappings, and volume configurations.
+type Container struct {
+	ID              int               `json:"id"`                                                         // Container ID
+	Name            string            `json:"name" validate:"required,max=128,container_name"`            // Container name
+	Image           string            `json:"image" validate:"required,image_ref"`                        // Docker image to use
+	Ports           []string          `json:"ports" validate:"dive,port_mapping"`                         // Port mappings (host:container)
+	EnvironmentVars []string          `json:"environment_vars" validate:"dive,env_var"`                   // Environment variables
+	ResourceLimits  ResourceLimits    `json:"resource_limits"`                                            // CPU, memory, and swap limits
+	Volumes         map[string]string `json:"volumes" validate:"dive,keys,host_path,endkeys,volume_path"` // Volume mappings (source:target)
+	Labels          []string          `json:"labels" validate:"dive,label"`                               // Container labels
+	Networks        []string          `json:"networks,omitempty" validate:"dive,network_name"`            // Workspace networks joined by the container
+	DependsOn       []string          `json:"depends_on,omitempty" validate:"dive,container_name"`        // Cubes of the workspace deployed before this one
+	Replicas        int               `json:"replicas,omitempty" validate:"min=0,max=32"`                 // Containers running the cube, named <name>-<i> when more than 1
+	LoadBalancing   string            `json:"load_balancing,omitempty" validate:"omitempty,balancing"`    // How the proxies spread requests over the replicas, round_robin by default
+}
+
+// Load balancing methods of the proxies of a cube with replicas
+const (
+	LoadBalancingRoundRobin = "round_robin"
+	LoadBalancingLeastConn  = "least_conn"
+	LoadBalancingIPHash     = "ip_hash"
+	LoadBalancingRandom     = "random"
+)
+
+// NextSuffix names the container a blue/green deploy starts next to the running one, <name>-next
+const NextSuffix = "-next"
+
+// ReplicaCount returns the number of containers of the cube, 1 when Replicas is not set
+func (c Container) ReplicaCount() int {
+	if c.Replicas < 1 {
+		return 1
+	}
+	return c.Replicas
+}
+
+// ContainerNames returns the names of the containers of the cube, its own name without replicas
+// and <name>-1 to <name>-N with replicas
+func (c Container) ContainerNames() []string {
+	if c.ReplicaCount() == 1 {
+		return []string{c.Name}
+	}
+	names := make([]string, c.Replicas)
+	for i := range names {
+		names[i] = fmt.Sprintf("%s-%d", c.Name, i+1)
+	}
+	return names
+}
+
+// ClaimedNames returns every container name the cube may use: those of its containers, its own name
+// that it takes back when scaled to a single container, and that of a blue/green deploy
+func (c Container) ClaimedNames() []string {
+	names := c.ContainerNames()
+	if c.ReplicaCount() > 1 {
+		names = append(names, c.Name)
+	}
+	return append(names, c.Name+NextSuffix)
+}
+
+// ResourceLimits defines the computational resources allocated to a container
+// This includes CPU cores, memory allocation, and swap space.
+type ResourceLimits struct {
+	CPUs   string `json:"cpus,omitempty" validate:"omitempty,cpus"`     // CPU cores allocation (e.g., "1.0")
+	Memory string `json:"memory,omitempty" validate:"omitempty,memory"` // Memory limit (e.g., "1G")
+}
@@ -0,0 +1,34 @@
+package models
+
+/*
+ExecMessage is a control message of the exec WebSocket of a cube, sent as a text message.
+The client sends resize and eof messages, the server sends a single exit message before it
+closes the connection. Input and output are binary messages: the client sends stdin as is,
+the server prefixes each output chunk with ExecStdout or ExecStderr.
+*/
+type ExecMessage struct {
+	Type     string `json:"type"`            // resize, eof or exit
+	Cols     uint   `json:"cols,omitempty"`  // Terminal width of a resize
+	Rows     uint   `json:"rows,omitempty"`  // Terminal height of a resize
+	ExitCode int    `json:"exit_code"`       // Exit code of the command
+	Error    string `json:"error,omitempty"` // Why the exit code is unknown
+}
+
+// Exec message types
+const (
+	ExecResize = "resize"
+	ExecEOF    = "eof"
+	ExecExit   = "exit"
+)
+
+// First byte of the binary output messages of an exec, with a TTY all output is stdout
+const (
+	ExecStdout byte = 1
+	ExecStderr byte = 2
+)
+
+// ExecRequest is the command run by an exec, recorded in the audit log
+type ExecRequest struct {
+	Command []string `json:"command"`
+	TTY     bool     `json:"tty"`
+}
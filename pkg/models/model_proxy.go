@@ -0,0 +1,12 @@
+package models
+
+// Proxy routes a domain to a port of a cube through nginx
+type Proxy struct {
+	ID        int    `json:"id"`
+	CubeID    int    `json:"cube_id"`
+	Domain    string `json:"domain"`
+	Port      int    `json:"port"`
+	Type      string `json:"type"`
+	Default   bool   `json:"default"`
+	CreatedAt string `json:"created_at"`
+}
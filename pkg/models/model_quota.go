@@ -0,0 +1,19 @@
+package models
+
+// WorkspaceQuota limits the resources of a workspace, zero or empty values are unlimited
+type WorkspaceQuota struct {
+	MaxCubes   int    `json:"max_cubes" validate:"min=0"`         // Number of cubes
+	CPUs       string `json:"cpus" validate:"omitempty,cpus"`     // Total CPU cores of all cubes (e.g., "4" or "2.5")
+	Memory     string `json:"memory" validate:"omitempty,memory"` // Total memory of all cubes (e.g., "8g")
+	MaxPorts   int    `json:"max_ports" validate:"min=0"`         // Number of published ports of all cubes
+	MaxProxies int    `json:"max_proxies" validate:"min=0"`       // Number of proxies pointing to the cubes
+}
+
+// QuotaUsage is what the cubes of a workspace currently use of its quota
+type QuotaUsage struct {
+	Cubes   int     `json:"cubes"`
+	CPUs    float64 `json:"cpus"`
+	Memory  int64   `json:"memory"` // Bytes
+	Ports   int     `json:"ports"`
+	Proxies int     `json:"proxies"`
+}
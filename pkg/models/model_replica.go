@@ -0,0 +1,15 @@
+package models
+
+// ScaleCubeRequest sets the number of replicas of a cube, and optionally how its proxies balance requests over them
+type ScaleCubeRequest struct {
+	Replicas      int    `json:"replicas" validate:"min=1,max=32"`
+	LoadBalancing string `json:"load_balancing,omitempty" validate:"omitempty,balancing"` // Kept when empty
+}
+
+// ScaleCubeResponse is the revision stored by a scale and the replicas running after it
+type ScaleCubeResponse struct {
+	Revision      int    `json:"revision"`
+	Status        string `json:"status"`
+	ReadyReplicas int    `json:"ready_replicas"`
+	Replicas      int    `json:"replicas"`
+}
@@ -0,0 +1,87 @@
+package models
+
+import "time"
+
+// ProxyRequest is the request body for the proxy service
+
+type EditCubeRequest struct {
+	UpdatedCube Container `json:"updated_cube" validate:"required"`
+}
+
+type AddCubesRequest struct {
+	WorkspaceID int       `json:"workspace_id" validate:"required,gt=0"`
+	Cube        Container `json:"cube_data" validate:"required"`
+}
+
+type EditWorkspaceRequest struct {
+	Name string `json:"name" validate:"required,max=64,workspace_name"`
+	Desc string `json:"desc" validate:"max=1024"`
+}
+
+type CreateWorkspaceRequest struct {
+	Name string `json:"name" validate:"required,max=64,workspace_name"`
+	Desc string `json:"desc" validate:"max=1024"`
+}
+
+type AddProxyRequest struct {
+	CubeID  int    `json:"cube_id" validate:"required,gt=0"`
+	Domain  string `json:"domain" validate:"required,proxy_domain"`
+	Port    int    `json:"port" validate:"required,min=1,max=65535"`
+	Type    string `json:"type" validate:"max=32"`
+	Default bool   `json:"default"`
+}
+
+type EditProxyByIDRequest struct {
+	Domain  string `json:"domain" validate:"required,proxy_domain"`
+	Port    int    `json:"port" validate:"required,min=1,max=65535"`
+	Type    string `json:"type" validate:"max=32"`
+	Default bool   `json:"default"`
+}
+
+type CommitCubeRequest struct {
+	Image string `json:"image" validate:"required,image_name"`
+	Tag   string `json:"tag" validate:"required,image_tag"`
+}
+
+type LoginRequest struct {
+	Username     string `json:"username" validate:"required"`
+	Password     string `json:"password" validate:"required"`
+	Code         string `json:"code"`          // TOTP code, required when two-factor authentication is enabled
+	RecoveryCode string `json:"recovery_code"` // One-time recovery code, used instead of a TOTP code
+}
+
+type TwoFactorCodeRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type CreateUserRequest struct {
+	Username string `json:"username" validate:"required,max=64,username"`
+	Password string `json:"password" validate:"required,min=8,max=72"`
+	IsAdmin  bool   `json:"is_admin"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password" validate:"required,min=8,max=72"`
+}
+
+type SetWorkspaceMemberRequest struct {
+	Role string `json:"role" validate:"required,oneof=owner operator viewer"`
+}
+
+type CreateAPITokenRequest struct {
+	Name         string     `json:"name" validate:"required,max=100"`
+	Kind         string     `json:"kind" validate:"omitempty,oneof=personal service"` // personal or service
+	Scopes       []string   `json:"scopes" validate:"required,min=1,dive,required"`   // Actions such as deploy, commit or proxy:write
+	WorkspaceIDs []int      `json:"workspace_ids" validate:"dive,gt=0"`               // Empty means every workspace of the owner, required for service tokens
+	ExpiresAt    *time.Time `json:"expires_at"`                                       // Optional expiry
+}
+
+type SetSecretRequest struct {
+	Value string `json:"value" validate:"required,max=65536"`
+}
+
+type SetWorkspaceVariableRequest struct {
+	Value string `json:"value" validate:"max=4096"`
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"time"
+)
+
+type GetCubesResponse struct {
+	ContainerID   int    `json:"container_id"`
+	Image         string `json:"image"`
+	ContainerName string `json:"container_name"`
+	IPAddress     string `json:"ip_address,omitempty"`
+	Status        string `json:"status"`         // State of the container, or running or degraded for a cube with replicas
+	ReadyReplicas int    `json:"ready_replicas"` // Running containers of the cube
+	Replicas      int    `json:"replicas"`       // Containers the cube should run
+}
+
+type GetCubesByIdResponse struct {
+	IPAddress      string        `json:"ip_address"`
+	Status         string        `json:"status"`
+	ReadyReplicas  int           `json:"ready_replicas"`
+	Replicas       int           `json:"replicas"`
+	ContainerData  *Container    `json:"container_data"`
+	PendingChanges []FieldChange `json:"pending_changes"` // Fields of the cube its container does not have yet, null without a container
+}
+
+// WorkspaceWithContainerCounts includes workspace details and container counts
+type WorkspaceWithContainerCounts struct {
+	ID                int        `json:"id"`
+	Name              string     `json:"name"`
+	Desc              string     `json:"desc"`
+	TotalContainers   int        `json:"total_containers"`
+	RunningContainers int             `json:"running_containers"`
+	CreatedAt         *time.Time      `json:"created_at"`
+	Quota             *WorkspaceQuota `json:"quota,omitempty"` // Only set when the workspace has a quota
+	Usage             *QuotaUsage     `json:"usage,omitempty"`
+}
+
+// WorkspaceResponse holds the total counts and the list of workspaces with container counts
+type WorkspaceResponse struct {
+	TotalWorkspaces   int                            `json:"total_workspaces"`
+	TotalCubes        int                            `json:"total_cubes"`
+	TotalRunningCubes int                            `json:"total_running_cubes"`
+	Workspaces        []WorkspaceWithContainerCounts `json:"workspaces"`
+}
+
+// WorkspaceQuotaResponse holds the quota of a workspace, nil when unlimited, and its current usage
+type WorkspaceQuotaResponse struct {
+	Quota *WorkspaceQuota `json:"quota"`
+	Usage *QuotaUsage     `json:"usage"`
+}
+
+type ImagesResponse struct {
+	CustomImages      []Image `json:"custom_images"`
+	TotalCustomImages int     `json:"total_custom_images"`
+}
+
+// CreateAPITokenResponse holds the plaintext token, which is only ever returned once
+type CreateAPITokenResponse struct {
+	ID    int    `json:"id"`
+	Token string `json:"token"`
+}
+
+// TOTPEnrollmentResponse holds the pending TOTP secret and the otpauth URI to render as a QR code
+type TOTPEnrollmentResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// RecoveryCodesResponse holds one-time recovery codes, they are only ever returned once
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// SetSecretResponse holds the version of the stored secret and the containers recreated to pick it up
+type SetSecretResponse struct {
+	Name      string   `json:"name"`
+	Version   int      `json:"version"`
+	Recreated []string `json:"recreated"`
+}
+
+// ErrorResponse is the body of every error response, Code is stable for clients to switch on
+type ErrorResponse struct {
+	Error  string       `json:"error"`
+	Code   string       `json:"code"`
+	Fields []FieldError `json:"fields,omitempty"` // Only set for validation errors
+}
+
+// FieldError is a failed validation rule of a request field, Field is a JSON path such as cube_data.ports[0]
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// CubeRevision is a version of the spec of a cube, every change of the cube stores a new revision
+type CubeRevision struct {
+	CubeID    int        `json:"cube_id"`
+	Revision  int        `json:"revision"` // Numbered from 1 for each cube
+	Spec      Container  `json:"spec"`
+	Author    string     `json:"author"`
+	Note      string     `json:"note"` // What stored it: create, edit, apply, initial or rollback to N
+	CreatedAt *time.Time `json:"created_at"`
+}
+
+// CubeRevisionDiff is the fields of a cube changed from one revision to another
+type CubeRevisionDiff struct {
+	CubeID  int           `json:"cube_id"`
+	From    int           `json:"from"`
+	To      int           `json:"to"`
+	Changes []FieldChange `json:"changes"`
+}
+
+// RollbackCubeResponse is the revision stored by restoring an older one
+type RollbackCubeResponse struct {
+	Revision   int      `json:"revision"`
+	RestoredTo int      `json:"restored_to"` // The revision whose spec was restored
+	Redeployed bool     `json:"redeployed"`
+	Warnings   []string `json:"warnings,omitempty"` // A redeploy that failed after the spec was restored
+}
@@ -0,0 +1,125 @@
+package models
+
+/*
+WorkspaceSpec declares a workspace with its cubes, their proxies, its variables and its networks,
+in JSON or YAML. Applying it makes the workspace match the document: objects are matched by
+name, or by domain for proxies, and objects missing from the document are deleted.
+*/
+type WorkspaceSpec struct {
+	Name      string            `json:"name" yaml:"name" validate:"required,max=64,workspace_name"`
+	Desc      string            `json:"desc,omitempty" yaml:"desc,omitempty" validate:"max=1024"`
+	Variables map[string]string `json:"variables,omitempty" yaml:"variables,omitempty"`
+	Networks  []NetworkSpec     `json:"networks,omitempty" yaml:"networks,omitempty" validate:"dive"`
+	Cubes     []CubeSpec        `json:"cubes" yaml:"cubes" validate:"dive"`
+}
+
+// NetworkSpec declares a network that cubes of the workspace can join
+type NetworkSpec struct {
+	Name   string `json:"name" yaml:"name" validate:"required,network_name"`
+	Driver string `json:"driver,omitempty" yaml:"driver,omitempty" validate:"omitempty,oneof=bridge overlay macvlan ipvlan"` // bridge when empty
+}
+
+// CubeSpec declares a cube, its fields are those of Container
+type CubeSpec struct {
+	Name            string            `json:"name" yaml:"name" validate:"required,max=128,container_name"`
+	Image           string            `json:"image" yaml:"image" validate:"required,image_ref"`
+	Ports           []string          `json:"ports,omitempty" yaml:"ports,omitempty" validate:"dive,port_mapping"`
+	EnvironmentVars []string          `json:"environment_vars,omitempty" yaml:"environment_vars,omitempty" validate:"dive,env_var"`
+	ResourceLimits  ResourceLimits    `json:"resource_limits,omitempty" yaml:"resource_limits,omitempty"`
+	Volumes         map[string]string `json:"volumes,omitempty" yaml:"volumes,omitempty" validate:"dive,keys,host_path,endkeys,volume_path"`
+	Labels          []string          `json:"labels,omitempty" yaml:"labels,omitempty" validate:"dive,label"`
+	Networks        []string          `json:"networks,omitempty" yaml:"networks,omitempty" validate:"dive,network_name"`
+	DependsOn       []string          `json:"depends_on,omitempty" yaml:"depends_on,omitempty" validate:"dive,container_name"`
+	Replicas        int               `json:"replicas,omitempty" yaml:"replicas,omitempty" validate:"min=0,max=32"`
+	LoadBalancing   string            `json:"load_balancing,omitempty" yaml:"load_balancing,omitempty" validate:"omitempty,balancing"`
+	Proxies         []ProxySpec       `json:"proxies,omitempty" yaml:"proxies,omitempty" validate:"dive"`
+}
+
+// ProxySpec declares a proxy of a cube
+type ProxySpec struct {
+	Domain  string `json:"domain" yaml:"domain" validate:"required,proxy_domain"`
+	Port    int    `json:"port" yaml:"port" validate:"required,min=1,max=65535"`
+	Type    string `json:"type,omitempty" yaml:"type,omitempty" validate:"max=32"`
+	Default bool   `json:"default,omitempty" yaml:"default,omitempty"`
+}
+
+// Container returns the cube as a container of the workspace, without an ID
+func (s CubeSpec) Container() Container {
+	return Container{
+		Name:            s.Name,
+		Image:           s.Image,
+		Ports:           s.Ports,
+		EnvironmentVars: s.EnvironmentVars,
+		ResourceLimits:  s.ResourceLimits,
+		Volumes:         s.Volumes,
+		Labels:          s.Labels,
+		Networks:        s.Networks,
+		DependsOn:       s.DependsOn,
+		Replicas:        s.Replicas,
+		LoadBalancing:   s.LoadBalancing,
+	}
+}
+
+// Plan actions
+const (
+	PlanCreate   = "create"
+	PlanUpdate   = "update"   // Stored only, or applied in place such as a proxy config
+	PlanRecreate = "recreate" // The running container is recreated to pick up the change
+	PlanDelete   = "delete"
+)
+
+// PlanChange is a change made by applying a workspace spec
+type PlanChange struct {
+	Action string        `json:"action"` // create, update, recreate or delete
+	Kind   string        `json:"kind"`   // workspace, cube, proxy, variable or network
+	Name   string        `json:"name"`   // Name of the object, the domain of a proxy
+	Fields []FieldChange `json:"fields,omitempty"`
+}
+
+// FieldChange is a field changed by an update
+type FieldChange struct {
+	Field  string      `json:"field"`
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+// ApplyResponse is the plan of a workspace spec, and what applying it did unless it was a dry run
+type ApplyResponse struct {
+	WorkspaceID int          `json:"workspace_id,omitempty"` // Not set for a dry run creating the workspace
+	DryRun      bool         `json:"dry_run"`
+	Changes     []PlanChange `json:"changes"`
+	Warnings    []string     `json:"warnings,omitempty"` // Runtime steps that failed after the changes were stored, or ignored compose keys
+}
+
+/*
+CloneWorkspaceRequest copies a workspace into the workspace named Name, which a clone creates
+and a promotion creates or updates. Cube names and proxy domains are rewritten by the rules,
+then the overrides are applied.
+*/
+type CloneWorkspaceRequest struct {
+	Name      string             `json:"name" yaml:"name" validate:"required,max=64,workspace_name"`
+	Desc      string             `json:"desc,omitempty" yaml:"desc,omitempty" validate:"max=1024"`         // The description of the source when empty
+	CubeNames []RewriteRule      `json:"cube_names,omitempty" yaml:"cube_names,omitempty" validate:"dive"` // A suffix named after the workspace when empty
+	Domains   []RewriteRule      `json:"domains,omitempty" yaml:"domains,omitempty" validate:"dive"`
+	Overrides WorkspaceOverrides `json:"overrides,omitempty" yaml:"overrides,omitempty"`
+}
+
+// RewriteRule replaces every occurrence of From by To
+type RewriteRule struct {
+	From string `json:"from" yaml:"from" validate:"required"`
+	To   string `json:"to" yaml:"to"`
+}
+
+// WorkspaceOverrides changes a copied workspace, cubes are given by their name in the source workspace
+type WorkspaceOverrides struct {
+	Variables map[string]string       `json:"variables,omitempty" yaml:"variables,omitempty"` // Set, other variables are kept
+	Cubes     map[string]CubeOverride `json:"cubes,omitempty" yaml:"cubes,omitempty" validate:"dive"`
+}
+
+// CubeOverride changes a copied cube, empty fields are kept
+type CubeOverride struct {
+	Image           string          `json:"image,omitempty" yaml:"image,omitempty" validate:"omitempty,image_ref"`
+	Tag             string          `json:"tag,omitempty" yaml:"tag,omitempty" validate:"omitempty,image_tag"`                    // Replaces the tag of the image
+	EnvironmentVars []string        `json:"environment_vars,omitempty" yaml:"environment_vars,omitempty" validate:"dive,env_var"` // Set by key, other variables are kept
+	ResourceLimits  *ResourceLimits `json:"resource_limits,omitempty" yaml:"resource_limits,omitempty"`
+}